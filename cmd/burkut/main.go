@@ -3,31 +3,45 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/kilimcininkoroglu/burkut/internal/cache"
 	"github.com/kilimcininkoroglu/burkut/internal/config"
 	"github.com/kilimcininkoroglu/burkut/internal/crawler"
 	"github.com/kilimcininkoroglu/burkut/internal/download"
 	"github.com/kilimcininkoroglu/burkut/internal/engine"
+	"github.com/kilimcininkoroglu/burkut/internal/extract"
 	"github.com/kilimcininkoroglu/burkut/internal/hooks"
+	"github.com/kilimcininkoroglu/burkut/internal/manifest"
 	"github.com/kilimcininkoroglu/burkut/internal/metalink"
 	"github.com/kilimcininkoroglu/burkut/internal/metrics"
 	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+	"github.com/kilimcininkoroglu/burkut/internal/signature"
+	"github.com/kilimcininkoroglu/burkut/internal/storage"
 	btorrent "github.com/kilimcininkoroglu/burkut/internal/torrent"
 	"github.com/kilimcininkoroglu/burkut/internal/tui"
 	"github.com/kilimcininkoroglu/burkut/internal/ui"
 	"github.com/kilimcininkoroglu/burkut/internal/version"
+	"github.com/kilimcininkoroglu/burkut/internal/zsync"
 )
 
 // Exit codes
@@ -41,8 +55,13 @@ const (
 	ExitChecksumError  = 6
 	ExitTimeoutError   = 7
 	ExitInterrupted    = 8
+	ExitPipeError      = 9
+	ExitSignatureError = 10
 )
 
+// appMetrics collects download metrics when --metrics is enabled
+var appMetrics *metrics.Metrics
+
 // headerList is a custom flag type for multiple headers
 type headerList []string
 
@@ -55,6 +74,78 @@ func (h *headerList) Set(value string) error {
 	return nil
 }
 
+// stringList is a custom flag type for repeatable string options
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList splits a comma-separated option value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// http3Flag is a custom flag type for --http3[=on|auto|off]
+type http3Flag string
+
+func (f *http3Flag) String() string {
+	return string(*f)
+}
+
+func (f *http3Flag) Set(value string) error {
+	mode, err := protocol.ParseHTTP3Mode(value)
+	if err != nil {
+		return err
+	}
+	*f = http3Flag(mode)
+	return nil
+}
+
+// IsBoolFlag lets --http3 be given without a value, meaning "on"
+func (f *http3Flag) IsBoolFlag() bool {
+	return true
+}
+
+// extractFlag is a custom flag type for --extract[=DIR]
+type extractFlag struct {
+	Enabled bool
+	Dir     string // Empty extracts next to the archive
+}
+
+func (f *extractFlag) String() string {
+	return f.Dir
+}
+
+// Set receives "true" when --extract is given without a directory
+func (f *extractFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.Enabled, f.Dir = true, ""
+	case "false":
+		f.Enabled, f.Dir = false, ""
+	default:
+		f.Enabled, f.Dir = true, value
+	}
+	return nil
+}
+
+// IsBoolFlag lets --extract be given without a directory
+func (f *extractFlag) IsBoolFlag() bool {
+	return true
+}
+
 // CLIConfig holds CLI configuration
 type CLIConfig struct {
 	Output      string
@@ -71,7 +162,7 @@ type CLIConfig struct {
 	// Phase 2 features
 	LimitRate    string // e.g., "10M", "500K"
 	Checksum     string // e.g., "sha256:abc123..."
-	AutoVerify   bool   // Auto-detect and verify checksum from .sha256 files
+	AutoVerify   bool   // Find the checksum published for the file and verify it
 	ConfigFile   string // custom config file path
 	Profile      string // named profile to use
 	InitConfig   bool   // generate default config
@@ -83,11 +174,55 @@ type CLIConfig struct {
 	OnError       string // Command to run on error
 	WebhookURL    string // Webhook URL for notifications
 	MirrorURLs    string // Comma-separated mirror URLs
-	UseHTTP3      bool   // Use HTTP/3 (QUIC) protocol
+	HTTP3         http3Flag // HTTP/3 mode: on, auto, off
 	ForceHTTP1    bool   // Force HTTP/1.1 (disable HTTP/2)
 	ForceHTTP2    bool   // Force HTTP/2 (fail if not supported)
+	// Network endpoints
+	Resolve   stringList // Static host:port:addr mappings
+	ConnectTo stringList // host1:port1:host2:port2 rewrites
+	IPv4Only  bool       // Only use IPv4 addresses
+	IPv6Only  bool       // Only use IPv6 addresses
+	Interface string     // Source interface name or IP address
 	// Conditional download
 	Timestamping bool // Only download if remote is newer
+	// Existing files
+	NoClobber  bool   // Never overwrite existing files
+	OnConflict string // Collision policy: overwrite, rename, skip, skip-same-size
+	PartSuffix string // Suffix of the file written until a download is complete
+	// Disk space
+	FileAllocation string // Allocation mode: none, sparse, falloc, trunc
+	// Archives
+	Extract         extractFlag // Extract downloaded archives
+	StripComponents int         // Leading path components dropped when extracting
+	RemoveArchive   bool        // Delete the archive after extracting it
+	// Local cache
+	CacheDir     string // Content-addressable download cache (empty = disabled)
+	CacheMaxSize string // Size cap of the cache, e.g. "20G" (empty = unlimited)
+	// Delta downloads
+	SeedFiles stringList // Older local copies whose blocks zsync downloads reuse
+	// Output command
+	PipeTo string // Shell command receiving the download on its standard input
+	// Signatures
+	Signature     string     // Detached signature: URL, local file or "auto"
+	SignatureData string     // Signature given by a metalink file
+	PubKeys       stringList // minisign or OpenPGP public key files
+	Keyrings      stringList // OpenPGP keyring files
+	// Metalink
+	MetalinkLocations   string               // Preferred mirror countries, comma-separated
+	MetalinkSelect      string               // Glob patterns of the files to download, comma-separated
+	MetalinkJobs        int                  // Files of a metalink downloaded at once
+	MetalinkPeerTimeout time.Duration        // How long a metalink torrent waits for peers, 0 for mirrors only
+	Pieces              engine.PieceVerifier // Piece hashes given by a metalink file
+	PieceMirrors        []string             // Metalink sources failing pieces are fetched from again
+	ExpectedSize        int64                // Size given by a metalink file
+	// Torrent
+	SelectFiles    string        // Torrent files to download: indexes, ranges or patterns
+	FilePriorities stringList    // SPEC=LEVEL priorities of torrent files
+	ShowFiles      bool          // List the files of a torrent instead of downloading
+	Seed           bool          // Keep seeding a torrent once downloaded
+	SeedRatio      float64       // Stop seeding at this upload ratio (0 = unlimited)
+	SeedTime       time.Duration // Stop seeding after this long (0 = unlimited)
+	UploadLimit    string        // Torrent upload speed limit, e.g. "1M"
 	// Security
 	PinnedPubKey string // SHA256 public key pin for certificate pinning
 	// Authentication
@@ -133,8 +268,8 @@ func main() {
 
 	// Start metrics server if requested
 	if cliConfig.MetricsAddr != "" {
-		m := metrics.New()
-		metricsServer := metrics.NewServer(cliConfig.MetricsAddr, m)
+		appMetrics = metrics.New()
+		metricsServer := metrics.NewServer(cliConfig.MetricsAddr, appMetrics)
 		if err := metricsServer.Start(); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: Failed to start metrics server: %v\n", err)
 		} else {
@@ -149,6 +284,28 @@ func main() {
 		os.Exit(exitCode)
 	}
 
+	// Cache maintenance: burkut cache ls|prune|verify
+	if flag.Arg(0) == "cache" {
+		exitCode := runCacheCommand(cliConfig, flag.Args()[1:])
+		os.Exit(exitCode)
+	}
+
+	// Checksum manifests: burkut verify [-c SHA256SUMS] [DIR], burkut checksum
+	// Metalink repair: burkut repair file.meta4, burkut metalink create FILE...
+	// Delta downloads: burkut zsync make FILE
+	switch flag.Arg(0) {
+	case "verify":
+		os.Exit(runVerifyCommand(cliConfig, flag.Args()[1:]))
+	case "checksum":
+		os.Exit(runChecksumCommand(cliConfig, flag.Args()[1:]))
+	case "repair":
+		os.Exit(runRepairCommand(cliConfig, flag.Args()[1:]))
+	case "metalink":
+		os.Exit(runMetalinkCommand(cliConfig, flag.Args()[1:]))
+	case "zsync":
+		os.Exit(runZsyncCommand(cliConfig, flag.Args()[1:]))
+	}
+
 	// Check for batch download mode first
 	if cliConfig.InputFile != "" {
 		exitCode := runBatchDownload(cliConfig)
@@ -171,6 +328,20 @@ func main() {
 		os.Exit(ExitParseError)
 	}
 
+	// Piping needs a single file arriving in order
+	if cliConfig.PipeTo != "" && (btorrent.IsTorrentFile(urlArg) || btorrent.IsMagnetURI(urlArg) ||
+		metalink.IsMetalink(urlArg) || cliConfig.Recursive || cliConfig.MirrorMode || cliConfig.SpiderMode) {
+		fmt.Fprintln(os.Stderr, "Error: --pipe-to cannot be used with torrent, metalink or recursive downloads")
+		os.Exit(ExitParseError)
+	}
+
+	// Signatures are checked before a single file is moved into place
+	if cliConfig.Signature != "" && (btorrent.IsTorrentFile(urlArg) || btorrent.IsMagnetURI(urlArg) ||
+		isFTPURL(urlArg) || cliConfig.Recursive || cliConfig.MirrorMode || cliConfig.SpiderMode) {
+		fmt.Fprintln(os.Stderr, "Error: --signature cannot be used with torrent, FTP or recursive downloads")
+		os.Exit(ExitParseError)
+	}
+
 	// Check if argument is a torrent file or magnet link
 	if btorrent.IsTorrentFile(urlArg) || btorrent.IsMagnetURI(urlArg) {
 		exitCode := runTorrentDownload(cliConfig, urlArg)
@@ -183,6 +354,13 @@ func main() {
 		os.Exit(exitCode)
 	}
 
+	// Check if argument is a zsync control file, or a download that should
+	// reuse blocks of older local copies
+	if zsync.IsZsync(urlArg) || len(cliConfig.SeedFiles) > 0 && !isFTPURL(urlArg) {
+		exitCode := runZsyncDownload(cliConfig, urlArg)
+		os.Exit(exitCode)
+	}
+
 	// Handle mirror mode shortcuts
 	if cliConfig.MirrorMode {
 		cliConfig.Recursive = true
@@ -235,7 +413,7 @@ func parseFlags() CLIConfig {
 	// Phase 2 options
 	flag.StringVar(&cfg.LimitRate, "limit-rate", "", "Limit download speed (e.g., 10M, 500K)")
 	flag.StringVar(&cfg.Checksum, "checksum", "", "Verify checksum (e.g., sha256:abc123...)")
-	flag.BoolVar(&cfg.AutoVerify, "verify", false, "Auto-detect and verify checksum (.sha256, .md5, etc.)")
+	flag.BoolVar(&cfg.AutoVerify, "verify", false, "Find and verify the published checksum (.sha256 files, SHA256SUMS, digest headers, metalinks)")
 	flag.StringVar(&cfg.ConfigFile, "config", "", "Use custom config file")
 	flag.StringVar(&cfg.Profile, "profile", "", "Use named profile from config")
 	flag.BoolVar(&cfg.InitConfig, "init-config", false, "Generate default config file")
@@ -249,7 +427,18 @@ func parseFlags() CLIConfig {
 	flag.StringVar(&cfg.OnError, "on-error", "", "Command to run after failed download")
 	flag.StringVar(&cfg.WebhookURL, "webhook", "", "Webhook URL for download notifications")
 	flag.StringVar(&cfg.MirrorURLs, "mirrors", "", "Comma-separated mirror URLs for fallback")
-	flag.BoolVar(&cfg.UseHTTP3, "http3", false, "Use HTTP/3 (QUIC) protocol (experimental)")
+	flag.StringVar(&cfg.MetalinkLocations, "metalink-location", "", "Prefer metalink mirrors in these countries (comma-separated, e.g. de,tr)")
+	flag.StringVar(&cfg.MetalinkSelect, "metalink-select", "", "Only download metalink files matching these patterns (comma-separated)")
+	flag.IntVar(&cfg.MetalinkJobs, "metalink-jobs", 4, "Files of a metalink downloaded at once")
+	flag.StringVar(&cfg.SelectFiles, "select-file", "", "Only download these torrent files: indexes, ranges or patterns (e.g. 1,3-5 or '*.csv')")
+	flag.Var(&cfg.FilePriorities, "file-priority", "Priority of torrent files, SPEC=normal|high (repeatable, e.g. '*.csv=high')")
+	flag.BoolVar(&cfg.ShowFiles, "show-files", false, "List the files of a torrent and exit")
+	flag.BoolVar(&cfg.Seed, "seed", false, "Keep seeding a torrent after downloading it, until interrupted")
+	flag.Float64Var(&cfg.SeedRatio, "seed-ratio", 0, "Seed a torrent until it has uploaded this many times its size (e.g. 1.5)")
+	flag.DurationVar(&cfg.SeedTime, "seed-time", 0, "Seed a torrent for this long after downloading it (e.g. 30m)")
+	flag.StringVar(&cfg.UploadLimit, "upload-limit", "", "Limit torrent upload speed (e.g., 1M, 500K)")
+	flag.DurationVar(&cfg.MetalinkPeerTimeout, "metalink-peer-timeout", 30*time.Second, "How long a metalink torrent waits for peers before the mirrors are used alone (0: never use torrents)")
+	flag.Var(&cfg.HTTP3, "http3", "HTTP/3 (QUIC) mode: on, auto (upgrade via Alt-Svc), off")
 	flag.BoolVar(&cfg.ForceHTTP1, "http1", false, "Force HTTP/1.1 (disable HTTP/2)")
 	flag.BoolVar(&cfg.ForceHTTP2, "http2", false, "Force HTTP/2 (fail if server doesn't support)")
 
@@ -257,6 +446,42 @@ func parseFlags() CLIConfig {
 	flag.BoolVar(&cfg.Timestamping, "N", false, "Only download if remote file is newer than local")
 	flag.BoolVar(&cfg.Timestamping, "timestamping", false, "Only download if remote file is newer than local")
 
+	// Existing file options
+	flag.BoolVar(&cfg.NoClobber, "nc", false, "Skip downloads that would overwrite existing files")
+	flag.BoolVar(&cfg.NoClobber, "no-clobber", false, "Skip downloads that would overwrite existing files")
+	flag.StringVar(&cfg.OnConflict, "on-conflict", "overwrite", "Existing file policy: overwrite, rename, skip, skip-same-size")
+	flag.StringVar(&cfg.PartSuffix, "part-suffix", storage.DefaultPartSuffix, "Suffix of the file written until a download is complete (empty writes in place)")
+	flag.StringVar(&cfg.FileAllocation, "file-allocation", string(storage.DefaultAllocationMode), "Disk space allocation: none, sparse, falloc, trunc")
+
+	// Archive options
+	flag.Var(&cfg.Extract, "extract", "Extract tar, tar.gz, tar.zst, tar.xz and zip archives (into DIR with --extract=DIR)")
+	flag.IntVar(&cfg.StripComponents, "strip-components", 0, "Strip N leading path components when extracting")
+	flag.BoolVar(&cfg.RemoveArchive, "remove-archive", false, "Delete the archive after extracting it")
+
+	// Cache options
+	flag.StringVar(&cfg.CacheDir, "cache-dir", "", "Reuse downloads from a local cache in DIR")
+	flag.StringVar(&cfg.CacheMaxSize, "cache-max-size", "", "Evict least recently used cache files above SIZE (e.g., 20G)")
+
+	// Delta download options
+	flag.Var(&cfg.SeedFiles, "seed-file", "Reuse blocks of an older local copy FILE for zsync downloads (repeatable)")
+
+	// Output command options
+	flag.StringVar(&cfg.PipeTo, "pipe-to", "", "Stream the download in order into the standard input of CMD")
+
+	// Signature options
+	flag.StringVar(&cfg.Signature, "signature", "", "Verify a detached signature from URL or FILE (auto: .minisig, .sig, .asc next to the file)")
+	flag.Var(&cfg.PubKeys, "pubkey", "minisign or OpenPGP public key FILE for --signature (repeatable)")
+	flag.Var(&cfg.Keyrings, "keyring", "OpenPGP keyring FILE for --signature (repeatable)")
+
+	// Network endpoint options
+	flag.Var(&cfg.Resolve, "resolve", "Use ADDR for HOST:PORT (HOST:PORT:ADDR[,ADDR], repeatable)")
+	flag.Var(&cfg.ConnectTo, "connect-to", "Connect to HOST2:PORT2 instead of HOST1:PORT1 (repeatable)")
+	flag.BoolVar(&cfg.IPv4Only, "4", false, "Use IPv4 addresses only")
+	flag.BoolVar(&cfg.IPv4Only, "ipv4", false, "Use IPv4 addresses only")
+	flag.BoolVar(&cfg.IPv6Only, "6", false, "Use IPv6 addresses only")
+	flag.BoolVar(&cfg.IPv6Only, "ipv6", false, "Use IPv6 addresses only")
+	flag.StringVar(&cfg.Interface, "interface", "", "Bind to network interface or source IP address")
+
 	// Security options
 	flag.StringVar(&cfg.PinnedPubKey, "pinnedpubkey", "", "SHA256 public key pin (sha256//base64hash)")
 
@@ -361,41 +586,45 @@ func runDownload(cliCfg CLIConfig, url string) int {
 			fmt.Fprintf(os.Stderr, "Expected checksum: %s\n", expectedChecksum.String())
 		}
 	} else if cliCfg.AutoVerify {
-		// Auto-verify will be handled after download
+		// Checksum files are looked up before the download starts
 		if cliCfg.Verbose {
 			fmt.Fprintf(os.Stderr, "Auto-verify enabled\n")
 		}
 	}
 
-
-	// Build HTTP client options
-	httpOpts := []protocol.HTTPClientOption{
-		protocol.WithTimeout(cliCfg.Timeout),
-		protocol.WithUserAgent(fmt.Sprintf("Burkut/%s", version.Version)),
+	signatureKeys, err := loadSignatureKeys(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
 
-	// Add proxy if specified (CLI takes precedence over config)
-	proxyURL := cliCfg.Proxy
-	if proxyURL == "" && cfg.Proxy.HTTP != "" {
-		proxyURL = cfg.Proxy.HTTP
+	allocation, err := storage.ParseAllocationMode(cliCfg.FileAllocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
-	if proxyURL != "" {
-		if strings.HasPrefix(proxyURL, "socks5://") {
-			httpOpts = append(httpOpts, protocol.WithSOCKS5Proxy(proxyURL, nil))
-		} else {
-			httpOpts = append(httpOpts, protocol.WithProxy(proxyURL))
+	if cliCfg.StripComponents < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --strip-components cannot be negative\n")
+		return ExitParseError
+	}
+
+
+	// Build HTTP client options (timeout, proxy, TLS and HTTP/3)
+	httpOpts := buildHTTPOptions(cliCfg, cfg)
+	if cliCfg.Verbose {
+		proxyURL := cliCfg.Proxy
+		if proxyURL == "" {
+			proxyURL = cfg.Proxy.HTTP
 		}
-		if cliCfg.Verbose {
+		if proxyURL != "" {
 			fmt.Fprintf(os.Stderr, "Using proxy: %s\n", proxyURL)
 		}
-	}
-
-	// Skip certificate verification if requested
-	if cliCfg.NoCheckCert || !cfg.TLS.Verify {
-		httpOpts = append(httpOpts, protocol.WithInsecureSkipVerify(true))
-		if cliCfg.Verbose {
+		if cliCfg.NoCheckCert || !cfg.TLS.Verify {
 			fmt.Fprintf(os.Stderr, "Warning: TLS certificate verification disabled\n")
 		}
+		if mode := protocol.HTTP3Mode(cliCfg.HTTP3); mode != "" && mode != protocol.HTTP3Off {
+			fmt.Fprintf(os.Stderr, "HTTP/3 (QUIC) mode: %s\n", mode)
+		}
 	}
 
 	// HTTP version control
@@ -469,41 +698,81 @@ func runDownload(cliCfg CLIConfig, url string) int {
 		}
 	}
 
+	// Network endpoints
+	dialer, err := buildDialer(cliCfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if dialer != nil {
+		httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+	}
+
 	// Create HTTP client
 	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
 
-	// HTTP/3 client (optional)
-	var http3Client *protocol.HTTP3Client
-	if cliCfg.UseHTTP3 {
-		if cliCfg.Verbose {
-			fmt.Fprintf(os.Stderr, "Using HTTP/3 (QUIC) protocol\n")
-		}
-		http3Client = protocol.NewHTTP3Client(
-			protocol.WithHTTP3Timeout(cliCfg.Timeout),
-			protocol.WithHTTP3UserAgent(fmt.Sprintf("Burkut/%s", version.Version)),
-		)
-		defer http3Client.Close()
+	// The signature is fetched up front so a missing one fails before the download
+	verifier, err := fetchSignature(ctx, cliCfg, httpClient, url, signatureKeys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitSignatureError
 	}
 
-	// Get file info first
-	if cliCfg.Verbose {
-		fmt.Fprintf(os.Stderr, "Fetching metadata from %s\n", url)
+	fileCache, err := openCache(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
 
+	// A cached copy is used without any request when its checksum is
+	// expected, or once a conditional request shows the URL still serves it
 	var meta *protocol.Metadata
-	if http3Client != nil {
-		meta, err = http3Client.Head(ctx, url)
-	} else {
-		meta, err = httpClient.Head(ctx, url)
+	if fileCache != nil {
+		hit, cacheMeta, findErr := fileCache.Find(ctx, httpClient, url, expectedChecksum)
+		if findErr != nil && cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Cache revalidation failed: %v\n", findErr)
+		}
+		if hit != nil {
+			return runCacheHit(ctx, cliCfg, fileCache, url, hit, verifier)
+		}
+		meta = cacheMeta
 	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to get file info: %v\n", err)
-		return ExitNetworkError
+
+	// Get file info first; the downloader reuses it instead of asking again
+	var probeBody io.ReadCloser
+	if meta == nil {
+		if cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Fetching metadata from %s\n", url)
+		}
+
+		meta, probeBody, err = httpClient.Probe(ctx, url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to get file info: %v\n", err)
+			return ExitNetworkError
+		}
+		if probeBody != nil {
+			defer probeBody.Close()
+		}
 	}
 
 	// Determine output path
 	outputPath := determineOutputPath(cliCfg, meta.Filename)
 
+	// Apply existing file policy
+	collision, err := resolveOutputCollision(cliCfg, outputPath, meta.ContentLength)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if collision.Skip {
+		if !cliCfg.Quiet {
+			fmt.Printf("File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
+		}
+		return ExitSuccess
+	}
+	outputPath = collision.Path
+
 	if cliCfg.Verbose {
 		fmt.Fprintf(os.Stderr, "Filename: %s\n", meta.Filename)
 		fmt.Fprintf(os.Stderr, "Size: %s\n", ui.FormatBytes(meta.ContentLength))
@@ -538,14 +807,37 @@ func runDownload(cliCfg CLIConfig, url string) int {
 		}
 	}
 
+	// Auto-verify: look for a published checksum if none was given
+	if expectedChecksum == nil && cliCfg.AutoVerify {
+		var source string
+		expectedChecksum, source = discoverChecksum(ctx, cliCfg, httpClient, url, meta)
+		if expectedChecksum != nil {
+			if !cliCfg.Quiet {
+				fmt.Fprintf(os.Stderr, "Checksum from %s: %s\n", source, expectedChecksum)
+			}
+		} else if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Warning: No checksum found for auto-verify\n")
+		}
+	}
+
 	// Create downloader
 	downloaderConfig := engine.DefaultConfig()
 	downloaderConfig.Connections = cliCfg.Connections
 	if rateLimiter != nil {
 		downloaderConfig.RateLimiter = rateLimiter
 	}
+	downloaderConfig.PartSuffix = cliCfg.PartSuffix
+	downloaderConfig.Checksum = expectedChecksum // Verified before the file is moved into place
+	downloaderConfig.Allocation = allocation
+	if verifier != nil {
+		downloaderConfig.Signature = verifier
+	}
+	downloaderConfig.Pieces = cliCfg.Pieces
+	downloaderConfig.RepairURLs = cliCfg.PieceMirrors
+	downloaderConfig.ExpectedSize = cliCfg.ExpectedSize
 
 	downloader := engine.NewDownloader(downloaderConfig, httpClient)
+	downloader.SetMetadata(url, meta, probeBody)
 
 	// Setup progress display
 	var progressBar *ui.ProgressBar
@@ -567,6 +859,22 @@ func runDownload(cliCfg CLIConfig, url string) int {
 		})
 	}
 
+	// Notices such as a fallback to a single stream (the bar shows them itself)
+	if cliCfg.Verbose || (!cliCfg.Quiet && cliCfg.Progress != "bar") {
+		downloader.SetNoticeCallback(func(msg string) {
+			fmt.Fprintf(os.Stderr, "\nWarning: %s\n", msg)
+		})
+	}
+
+	// Tar archives are extracted while they download if the download runs as
+	// a single stream; otherwise, like zip archives, once it is verified
+	var extractStream *extract.Stream
+	archive := archiveFormat(cliCfg, outputPath, meta.Filename)
+	if archive.Streamable() {
+		extractStream = extract.NewStream(archive, extractionDir(cliCfg, outputPath), extractOptions(cliCfg))
+		downloader.SetStreamCallback(extractStream.Write)
+	}
+
 	// Print header
 	if !cliCfg.Quiet && cliCfg.Progress == "bar" {
 		fmt.Printf("Burkut %s - Downloading\n\n", version.Version)
@@ -576,14 +884,19 @@ func runDownload(cliCfg CLIConfig, url string) int {
 	startTime := time.Now()
 
 	// Parse mirror URLs if provided
-	var mirrors []string
-	if cliCfg.MirrorURLs != "" {
-		for _, m := range strings.Split(cliCfg.MirrorURLs, ",") {
-			m = strings.TrimSpace(m)
-			if m != "" {
-				mirrors = append(mirrors, m)
-			}
+	mirrors := splitList(cliCfg.MirrorURLs)
+
+	// The command receives the file in order while it downloads
+	var pipe *hooks.Pipe
+	var piped *pipeWriter
+	if cliCfg.PipeTo != "" {
+		pipe, err = startPipe(ctx, cliCfg, url, meta.Filename, outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitPipeError
 		}
+		piped = &pipeWriter{w: pipe}
+		downloader.SetOrderedWriter(piped)
 	}
 
 	// Try main URL first, then mirrors
@@ -605,20 +918,54 @@ func runDownload(cliCfg CLIConfig, url string) int {
 			break
 		}
 
+		// A mirror would send the command the start of the file again
+		if piped != nil && piped.Started() {
+			break
+		}
+
 		if cliCfg.Verbose && i < len(allURLs)-1 {
 			fmt.Fprintf(os.Stderr, "Failed: %v, trying next mirror...\n", err)
 		}
 	}
 
+	// The command gets no end of input for an incomplete download. If it
+	// failed on its own, that is why the download stopped.
+	if pipe != nil {
+		if err != nil {
+			pipe.Kill()
+		}
+		var pipeErr *hooks.PipeError
+		if errors.As(pipe.Close(), &pipeErr) && (err == nil || pipeErr.ExitCode > 0) {
+			err = pipeErr
+		}
+	}
+
+	// Files extracted from an incomplete or unverified archive are removed
+	if err != nil && extractStream != nil {
+		extractStream.Abort()
+	}
+
 	// Setup hooks
 	hookManager := setupHooks(cliCfg)
 	elapsed := time.Since(startTime)
+	recordDownloadMetrics(downloader.GetProgress(), elapsed, err)
+
+	if allocTime := downloader.AllocationTime(); cliCfg.Verbose && allocTime > 0 {
+		fmt.Fprintf(os.Stderr, "\nFile allocation (%s): %s\n", allocation, allocTime.Round(time.Millisecond))
+	}
 
 	// Handle result
 	if err != nil {
+		var sigErr *signature.Error
+		isSignatureError := errors.As(err, &sigErr)
+
 		// Execute error hooks
 		if hookManager.Count() > 0 {
-			payload := hooks.CreatePayload(hooks.EventError, url, meta.Filename, outputPath).
+			event := hooks.EventError
+			if isSignatureError {
+				event = hooks.EventSignatureFailed
+			}
+			payload := hooks.CreatePayload(event, url, meta.Filename, outputPath).
 				WithError(err).
 				WithDuration(elapsed)
 			hookManager.ExecuteAsync(ctx, payload)
@@ -631,106 +978,88 @@ func runDownload(cliCfg CLIConfig, url string) int {
 			return ExitInterrupted
 		}
 
-		if progressBar != nil {
-			progressBar.RenderError(os.Stdout, meta.Filename, err)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		}
-		return ExitNetworkError
-	}
-
-	// Auto-verify: try to fetch checksum file if enabled
-	if expectedChecksum == nil && cliCfg.AutoVerify {
-		// Try common checksum file extensions
-		checksumExts := []struct {
-			ext string
-			alg engine.ChecksumAlgorithm
-		}{
-			{".sha256", engine.AlgorithmSHA256},
-			{".sha256sum", engine.AlgorithmSHA256},
-			{".sha512", engine.AlgorithmSHA512},
-			{".md5", engine.AlgorithmMD5},
-			{".md5sum", engine.AlgorithmMD5},
-		}
-
-		for _, cs := range checksumExts {
-			checksumURL := url + cs.ext
-			if cliCfg.Verbose {
-				fmt.Fprintf(os.Stderr, "Trying checksum URL: %s\n", checksumURL)
-			}
-
-			// Try to fetch the checksum file
-			checksumValue, alg, fetchErr := engine.FetchAndParseChecksumURL(checksumURL, filepath.Base(outputPath), func(fetchURL string) ([]byte, error) {
-				resp, _, fetchErr := httpClient.Get(ctx, fetchURL)
-				if fetchErr != nil {
-					return nil, fetchErr
-				}
-				defer resp.Close()
-				return io.ReadAll(resp)
-			})
-
-			if fetchErr == nil && checksumValue != "" {
-				expectedChecksum = &engine.Checksum{
-					Algorithm: alg,
-					Value:     strings.ToLower(checksumValue),
-				}
-				if !cliCfg.Quiet {
-					fmt.Fprintf(os.Stderr, "Found checksum file: %s\n", checksumURL)
-				}
-				break
-			}
+		var noSpace *storage.InsufficientSpaceError
+		if errors.As(err, &noSpace) {
+			fmt.Fprintf(os.Stderr, "Error: Not enough disk space for %s: %s needed, %s available\n",
+				noSpace.Path, ui.FormatBytes(noSpace.Needed), ui.FormatBytes(noSpace.Available))
+			return ExitGeneralError
 		}
 
-		if expectedChecksum == nil && !cliCfg.Quiet {
-			fmt.Fprintf(os.Stderr, "Warning: No checksum file found for auto-verify\n")
+		if isPipeError(err) {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			return ExitPipeError
 		}
-	}
 
-	// Verify checksum if provided
-	if expectedChecksum != nil {
-		if cliCfg.Verbose || cliCfg.Progress != "none" {
-			fmt.Fprintf(os.Stderr, "Verifying checksum (%s)...\n", expectedChecksum.Algorithm)
+		if isSignatureError {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			return ExitSignatureError
 		}
 
-		valid, err := engine.VerifyChecksum(outputPath, expectedChecksum)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to verify checksum: %v\n", err)
-			return ExitGeneralError
+		var mismatch *engine.ChecksumMismatchError
+		if errors.As(err, &mismatch) {
+			fmt.Fprintf(os.Stderr, "\nError: Checksum mismatch!\n")
+			fmt.Fprintf(os.Stderr, "  Expected: %s\n", mismatch.Expected.Value)
+			fmt.Fprintf(os.Stderr, "  Actual:   %s\n", mismatch.Actual.Value)
+			return ExitChecksumError
 		}
 
-		if !valid {
-			actual, _ := engine.CalculateChecksum(outputPath, expectedChecksum.Algorithm)
-			fmt.Fprintf(os.Stderr, "Error: Checksum mismatch!\n")
-			fmt.Fprintf(os.Stderr, "  Expected: %s\n", expectedChecksum.Value)
-			if actual != nil {
-				fmt.Fprintf(os.Stderr, "  Actual:   %s\n", actual.Value)
-			}
+		var pieceErr *engine.PieceError
+		if errors.As(err, &pieceErr) {
+			fmt.Fprintf(os.Stderr, "\nError: %v on every mirror\n", err)
 			return ExitChecksumError
 		}
 
-		if cliCfg.Verbose {
-			fmt.Fprintf(os.Stderr, "Checksum verified successfully!\n")
+		if progressBar != nil {
+			progressBar.RenderError(os.Stdout, meta.Filename, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
+		return ExitNetworkError
 	}
 
-	// Set file modification time to match server (for timestamping)
-	if !meta.LastModified.IsZero() {
-		if err := engine.SetFileModTime(outputPath, meta.LastModified); err != nil {
-			if cliCfg.Verbose {
-				fmt.Fprintf(os.Stderr, "Warning: Could not set file modification time: %v\n", err)
-			}
-		}
+	if expectedChecksum != nil && cliCfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Checksum verified successfully!\n")
 	}
+	if verifier != nil && !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "\nSignature verified: %s\n", verifier.Signer())
+	}
+
 
 	// Success
 	finalProgress := downloader.GetProgress()
 	finalProgress.ElapsedTime = time.Since(startTime)
 
+	// Keep a copy for the next download of the same file
+	if fileCache != nil {
+		if err := cacheDownload(fileCache, url, outputPath, meta, expectedChecksum); err != nil && !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Warning: Could not add %s to the cache: %v\n", filepath.Base(outputPath), err)
+		}
+	}
+
+	// Extract the archive now that it is complete and verified
+	var extracted *extract.Result
+	if archive != extract.FormatNone {
+		extracted, err = extractDownload(cliCfg, outputPath, archive, extractStream, finalProgress.TotalSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+			if hookManager.Count() > 0 {
+				payload := hooks.CreatePayload(hooks.EventError, url, meta.Filename, outputPath).
+					WithError(err).
+					WithDuration(finalProgress.ElapsedTime)
+				hookManager.ExecuteAsync(ctx, payload)
+			}
+			return ExitGeneralError
+		}
+	}
+
 	// Execute completion hooks
 	if hookManager.Count() > 0 {
 		payload := hooks.CreatePayload(hooks.EventComplete, url, meta.Filename, outputPath).
 			WithProgress(finalProgress.Downloaded, finalProgress.TotalSize, finalProgress.Speed, finalProgress.Percent).
 			WithDuration(finalProgress.ElapsedTime)
+		if extracted != nil {
+			payload.WithExtractDir(extracted.Dir)
+		}
 		hookManager.ExecuteAsync(ctx, payload)
 	}
 
@@ -739,6 +1068,9 @@ func runDownload(cliCfg CLIConfig, url string) int {
 	} else if !cliCfg.Quiet {
 		fmt.Printf("\nDownload complete: %s (%s)\n", outputPath, ui.FormatBytes(meta.ContentLength))
 	}
+	if extracted != nil && !cliCfg.Quiet {
+		fmt.Printf("Extracted %d files (%s) to %s\n", extracted.Files, ui.FormatBytes(extracted.Bytes), extracted.Dir)
+	}
 
 	return ExitSuccess
 }
@@ -812,63 +1144,544 @@ func determineOutputPath(cfg CLIConfig, filename string) string {
 	return filepath.Join(cfg.OutputDir, filename)
 }
 
-func printUsage() {
-	fmt.Printf(`%s
+// archiveFormat returns the format of the archive to extract with --extract,
+// judged by the first of names that is a supported archive. Without --extract,
+// or for other files, it returns extract.FormatNone.
+func archiveFormat(cfg CLIConfig, names ...string) extract.Format {
+	if !cfg.Extract.Enabled {
+		return extract.FormatNone
+	}
+	for _, name := range names {
+		if format := extract.DetectFormat(name); format != extract.FormatNone {
+			return format
+		}
+	}
+	if !cfg.Quiet {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not a supported archive, it will not be extracted\n", filepath.Base(names[0]))
+	}
+	return extract.FormatNone
+}
 
-Usage:
-  burkut [OPTIONS] URL
+// extractionDir returns the directory --extract unpacks outputPath into
+func extractionDir(cfg CLIConfig, outputPath string) string {
+	if cfg.Extract.Dir != "" {
+		return cfg.Extract.Dir
+	}
+	return filepath.Dir(outputPath)
+}
 
-A modern download manager combining the best of wget and curl
-with HTTP/2 support, parallel downloads, and smart resume.
+// extractOptions returns the extraction options selected on the command line
+func extractOptions(cfg CLIConfig) extract.Options {
+	return extract.Options{StripComponents: cfg.StripComponents}
+}
 
-Options:
-  -o, --output FILE      Write output to FILE
-  -P, --output-dir DIR   Save files to DIR (default: current directory)
-  -c, --continue         Resume partially downloaded file
-  -n, --connections N    Number of parallel connections (default: 4)
-  -T, --timeout DUR      Connection timeout (default: 30s)
-  -q, --quiet            Quiet mode (no progress output)
-  -v, --verbose          Verbose output (show headers and chunk info)
-      --progress TYPE    Progress display: bar, minimal, json, none (default: bar)
-      --no-color         Disable colored output
-  -h, --help             Show this help message
-  -V, --version          Show version information
+// extractDownload extracts the finished download at outputPath. If stream
+// extracted it during the download, the stream is finished instead; a stream
+// that missed part of the file is redone from disk.
+func extractDownload(cfg CLIConfig, outputPath string, format extract.Format, stream *extract.Stream, size int64) (*extract.Result, error) {
+	var result *extract.Result
+	err := extract.ErrNotStreamed
+	if stream != nil {
+		result, err = stream.Close(size)
+	}
+	if errors.Is(err, extract.ErrNotStreamed) {
+		result, err = extract.File(outputPath, format, extractionDir(cfg, outputPath), extractOptions(cfg))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extracting %s: %w", filepath.Base(outputPath), err)
+	}
 
-Advanced Options:
-      --limit-rate RATE  Limit download speed (e.g., 10M, 500K)
-      --checksum SUM     Verify file checksum (e.g., sha256:abc123, blake3:def456)
-      --verify           Auto-detect and verify checksum (.sha256, .md5 files)
-      --proxy URL        Use proxy (http://host:port or socks5://host:port)
-      --no-check-certificate  Skip TLS certificate verification
-      --config FILE      Use custom config file
-      --profile NAME     Use named profile from config
-      --init-config      Generate default config file
+	if cfg.RemoveArchive {
+		if err := os.Remove(outputPath); err != nil {
+			return nil, fmt.Errorf("removing archive: %w", err)
+		}
+	}
+	return result, nil
+}
 
-Authentication Options:
-  -u, --user USER:PASS   Basic authentication credentials
-      --netrc            Use ~/.netrc for authentication
-  -H, --header HEADER    Add custom header (can be repeated)
+// collisionPolicy returns the existing file policy selected on the command line
+func collisionPolicy(cfg CLIConfig) (storage.CollisionPolicy, error) {
+	if cfg.NoClobber {
+		return storage.CollisionSkip, nil
+	}
+	return storage.ParseCollisionPolicy(cfg.OnConflict)
+}
 
-Protocol Options:
-      --http1            Force HTTP/1.1 (disable HTTP/2)
-      --http2            Force HTTP/2 (fail if server doesn't support)
-      --http3            Use HTTP/3 (QUIC) protocol (experimental)
+// hasPartialDownload reports whether an unfinished download to outputPath can be resumed
+func hasPartialDownload(cfg CLIConfig, outputPath string) bool {
+	return download.StateExists(storage.PartPath(outputPath, cfg.PartSuffix)) || download.StateExists(outputPath)
+}
 
-Conditional Download:
-  -N, --timestamping     Only download if remote file is newer than local
+// resolveOutputCollision applies the existing file policy to outputPath.
+// Resumed downloads and timestamping manage existing files themselves and keep the path.
+func resolveOutputCollision(cfg CLIConfig, outputPath string, remoteSize int64) (storage.CollisionResult, error) {
+	policy, err := collisionPolicy(cfg)
+	if err != nil {
+		return storage.CollisionResult{}, err
+	}
 
-Security Options:
-      --pinnedpubkey PIN SHA256 public key pin (sha256//base64hash)
+	if cfg.Continue || cfg.Timestamping || hasPartialDownload(cfg, outputPath) {
+		return storage.CollisionResult{Path: outputPath}, nil
+	}
 
-Batch & Automation:
-  -i, --input-file FILE  Read URLs from file (batch download)
-      --on-complete CMD  Run command after successful download
-      --on-error CMD     Run command after failed download
-      --webhook URL      Send webhook notification on complete/error
-      --mirrors URLs     Comma-separated mirror URLs for fallback
+	return storage.ResolveCollision(outputPath, policy, remoteSize)
+}
 
-Interface:
-      --tui              Use interactive TUI mode (fullscreen)
+// openCache opens the download cache selected with --cache-dir, or returns
+// nil when caching is off
+func openCache(cfg CLIConfig) (*cache.Cache, error) {
+	if cfg.CacheDir == "" {
+		return nil, nil
+	}
+	maxSize, err := config.ParseBandwidth(cfg.CacheMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --cache-max-size: %w", err)
+	}
+	return cache.Open(cfg.CacheDir, maxSize)
+}
+
+// cacheDownload adds the finished download at path to the cache, together
+// with the validators url was served with
+func cacheDownload(c *cache.Cache, url, path string, meta *protocol.Metadata, checksum *engine.Checksum) error {
+	var algorithms []engine.ChecksumAlgorithm
+	if checksum != nil {
+		algorithms = append(algorithms, checksum.Algorithm)
+	}
+	obj, err := c.Put(path, algorithms...)
+	if err != nil {
+		return err
+	}
+
+	rec := cache.URLRecord{URL: url, Filename: filepath.Base(path), Size: obj.Size, SHA256: obj.SHA256}
+	if meta != nil {
+		rec.Filename = meta.Filename
+		rec.ETag = meta.ETag
+		rec.LastModified = meta.LastModified
+	}
+	return c.PutURL(rec)
+}
+
+// pipeWriter passes a download to the --pipe-to command and records whether
+// any of it was sent
+type pipeWriter struct {
+	w       io.Writer
+	started atomic.Bool
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	p.started.Store(true)
+	return p.w.Write(b)
+}
+
+// Started reports whether the command was sent any data
+func (p *pipeWriter) Started() bool {
+	return p.started.Load()
+}
+
+// startPipe starts the --pipe-to command for the download of url to outputPath
+func startPipe(ctx context.Context, cfg CLIConfig, url, filename, outputPath string) (*hooks.Pipe, error) {
+	payload := hooks.CreatePayload(hooks.EventStart, url, filename, outputPath)
+	return hooks.NewCommandHook(cfg.PipeTo).StartPipe(ctx, payload, os.Stdout, os.Stderr)
+}
+
+// pipeFile passes a file that is already complete to the --pipe-to command,
+// if there is one
+func pipeFile(ctx context.Context, cfg CLIConfig, path, url, filename string) error {
+	if cfg.PipeTo == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	pipe, err := startPipe(ctx, cfg, url, filename, path)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(pipe, f)
+	if err := pipe.Close(); err != nil {
+		return err
+	}
+	if copyErr != nil {
+		return &engine.OrderedWriterError{Err: copyErr}
+	}
+	return nil
+}
+
+// isPipeError reports whether err comes from the --pipe-to command or from
+// passing data to it
+func isPipeError(err error) bool {
+	var pipeErr *hooks.PipeError
+	var writeErr *engine.OrderedWriterError
+	return errors.As(err, &pipeErr) || errors.As(err, &writeErr)
+}
+
+// maxSignatureSize caps the size of a fetched signature file
+const maxSignatureSize = 1 << 20
+
+// loadSignatureKeys reads the keys of --pubkey and --keyring. It returns nil
+// if no signature is to be verified.
+func loadSignatureKeys(cfg CLIConfig) (*signature.Keyring, error) {
+	if len(cfg.PubKeys) == 0 && len(cfg.Keyrings) == 0 {
+		if cfg.Signature != "" {
+			return nil, errors.New("--signature needs --pubkey or --keyring")
+		}
+		return nil, nil // A metalink signature is only checked against given keys
+	}
+	if cfg.Signature == "" && cfg.SignatureData == "" {
+		return nil, nil
+	}
+	return signature.LoadKeys(cfg.PubKeys, cfg.Keyrings)
+}
+
+// fetchSignature returns the verifier of the detached signature of url: the
+// one given by --signature or a metalink file, or with --signature auto the
+// first signature file found next to url. It returns nil if keys is nil.
+func fetchSignature(ctx context.Context, cfg CLIConfig, client *protocol.HTTPClient, url string, keys *signature.Keyring) (*signature.Verifier, error) {
+	if keys == nil {
+		return nil, nil
+	}
+
+	switch {
+	case cfg.SignatureData != "" && (cfg.Signature == "" || cfg.Signature == "auto"):
+		return signature.New([]byte(cfg.SignatureData), "metalink", keys)
+
+	case cfg.Signature == "auto":
+		for _, ext := range signature.Extensions {
+			data, err := fetchSmallFile(ctx, client, url+ext)
+			if err != nil {
+				continue
+			}
+			if v, err := signature.New(data, url+ext, keys); err == nil {
+				return v, nil
+			}
+		}
+		return nil, &signature.Error{Source: url, Err: fmt.Errorf("no signature found (%s)", strings.Join(signature.Extensions, ", "))}
+
+	case strings.HasPrefix(cfg.Signature, "http://") || strings.HasPrefix(cfg.Signature, "https://"):
+		data, err := fetchSmallFile(ctx, client, cfg.Signature)
+		if err != nil {
+			return nil, &signature.Error{Source: cfg.Signature, Err: err}
+		}
+		return signature.New(data, cfg.Signature, keys)
+
+	default:
+		data, err := os.ReadFile(cfg.Signature)
+		if err != nil {
+			return nil, &signature.Error{Source: cfg.Signature, Err: err}
+		}
+		return signature.New(data, cfg.Signature, keys)
+	}
+}
+
+// checksumSidecars are the extensions of checksum files looked for next to a
+// download by --verify
+var checksumSidecars = []string{".sha256", ".sha256sum", ".sha512", ".sha512sum", ".md5", ".md5sum"}
+
+// checksumManifests are the manifests looked for in the directory of a
+// download by --verify
+var checksumManifests = []string{"SHA256SUMS", "CHECKSUMS"}
+
+// discoverChecksum finds the expected checksum of the file at rawURL for
+// --verify, trying in order: checksum files next to it, SHA256SUMS and
+// CHECKSUMS in its directory, the digest headers of meta (Repr-Digest,
+// Content-Digest, Digest, Content-MD5) and the metalinks they link to. It
+// returns the checksum and a description of where it came from, or nil.
+func discoverChecksum(ctx context.Context, cliCfg CLIConfig, client *protocol.HTTPClient, rawURL string, meta *protocol.Metadata) (*engine.Checksum, string) {
+	names := remoteFilenames(rawURL, meta.Filename)
+	if len(names) == 0 {
+		return nil, ""
+	}
+
+	for _, ext := range checksumSidecars {
+		checksumURL := rawURL + ext
+		if cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Trying checksum URL: %s\n", checksumURL)
+		}
+		value, alg, err := engine.FetchAndParseChecksumURL(checksumURL, names[0], func(fetchURL string) ([]byte, error) {
+			return fetchSmallFile(ctx, client, fetchURL)
+		})
+		if err == nil && validChecksum(alg, value) {
+			return &engine.Checksum{Algorithm: alg, Value: strings.ToLower(value)}, checksumURL
+		}
+	}
+
+	if dirURL, err := url.Parse(rawURL); err == nil {
+		dirURL.RawQuery, dirURL.Fragment = "", ""
+		for _, name := range checksumManifests {
+			manifestURL := dirURL.ResolveReference(&url.URL{Path: name}).String()
+			if cliCfg.Verbose {
+				fmt.Fprintf(os.Stderr, "Trying checksum manifest: %s\n", manifestURL)
+			}
+			data, err := fetchSmallFile(ctx, client, manifestURL)
+			if err != nil {
+				continue
+			}
+			entries, err := manifest.Parse(bytes.NewReader(data), manifest.AlgorithmFromName(name))
+			if err != nil {
+				if cliCfg.Verbose {
+					fmt.Fprintf(os.Stderr, "Ignoring %s: %v\n", manifestURL, err)
+				}
+				continue
+			}
+			if entry := findManifestEntry(entries, names); entry != nil {
+				sum := entry.Checksum
+				return &sum, manifestURL
+			}
+		}
+	}
+
+	for _, digest := range meta.Digests {
+		if sum := engine.ChecksumFromDigest(digest); sum != nil {
+			return sum, digest.Header + " header"
+		}
+	}
+
+	for _, metalinkURL := range meta.MetalinkURLs {
+		if cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Trying metalink: %s\n", metalinkURL)
+		}
+		data, err := fetchSmallFile(ctx, client, metalinkURL)
+		if err != nil {
+			continue
+		}
+		ml, err := metalink.Parse(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		file := findMetalinkFile(ml, names)
+		if file == nil {
+			continue
+		}
+		for _, hashType := range []string{"sha-512", "sha-256", "sha-1", "md5"} {
+			alg := engine.AlgorithmFromIANA(hashType)
+			if value := file.GetChecksum(hashType); validChecksum(alg, value) {
+				return &engine.Checksum{Algorithm: alg, Value: strings.ToLower(value)}, metalinkURL
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// remoteFilenames returns the names a download may be listed under in a
+// checksum file: the last segment of its URL path and the server's name
+func remoteFilenames(rawURL, filename string) []string {
+	var names []string
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "/" && base != "." {
+			names = append(names, base)
+		}
+	}
+	if filename != "" && (len(names) == 0 || names[0] != filename) {
+		names = append(names, filename)
+	}
+	return names
+}
+
+// findManifestEntry returns the entry listing one of names, by its base name
+func findManifestEntry(entries []manifest.Entry, names []string) *manifest.Entry {
+	for _, name := range names {
+		for i := range entries {
+			if path.Base(entries[i].Path) == name {
+				return &entries[i]
+			}
+		}
+	}
+	return nil
+}
+
+// findMetalinkFile returns the file of a metalink listed under one of names,
+// whatever its directory. A metalink of a single file describes the download
+// whatever it is called; one of several files naming none of them, nothing.
+func findMetalinkFile(ml *metalink.Metalink, names []string) *metalink.File {
+	for _, name := range names {
+		for i := range ml.Files {
+			if path.Base(ml.Files[i].Name) == name {
+				return &ml.Files[i]
+			}
+		}
+	}
+	if len(ml.Files) == 1 {
+		return &ml.Files[0]
+	}
+	return nil
+}
+
+// validChecksum reports whether value is a hex digest of the right length
+// for alg, so an error page is never taken for a checksum file
+func validChecksum(alg engine.ChecksumAlgorithm, value string) bool {
+	hasher, err := engine.NewHasher(alg)
+	if err != nil || len(value) != hasher.Size()*2 {
+		return false
+	}
+	_, err = hex.DecodeString(value)
+	return err == nil
+}
+
+// fetchSmallFile downloads a file of at most maxSignatureSize bytes
+func fetchSmallFile(ctx context.Context, client *protocol.HTTPClient, url string) ([]byte, error) {
+	body, _, err := client.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, maxSignatureSize))
+}
+
+func printUsage() {
+	fmt.Printf(`%s
+
+Usage:
+  burkut [OPTIONS] URL
+
+A modern download manager combining the best of wget and curl
+with HTTP/2 support, parallel downloads, and smart resume.
+
+Options:
+  -o, --output FILE      Write output to FILE
+  -P, --output-dir DIR   Save files to DIR (default: current directory)
+  -c, --continue         Resume partially downloaded file
+  -n, --connections N    Number of parallel connections (default: 4)
+  -T, --timeout DUR      Connection timeout (default: 30s)
+  -q, --quiet            Quiet mode (no progress output)
+  -v, --verbose          Verbose output (show headers and chunk info)
+      --progress TYPE    Progress display: bar, minimal, json, none (default: bar)
+      --no-color         Disable colored output
+  -h, --help             Show this help message
+  -V, --version          Show version information
+
+Advanced Options:
+      --limit-rate RATE  Limit download speed (e.g., 10M, 500K)
+      --checksum SUM     Verify file checksum (e.g., sha256:abc123, blake3:def456)
+      --verify           Find and verify the published checksum, trying in order
+                         URL.sha256/.sha512/.md5, SHA256SUMS and CHECKSUMS in
+                         the same directory, Repr-Digest/Content-Digest, Digest
+                         and Content-MD5 headers, then Link rel=describedby
+                         metalinks; the source used is printed
+      --proxy URL        Use proxy (http://host:port or socks5://host:port)
+      --no-check-certificate  Skip TLS certificate verification
+      --config FILE      Use custom config file
+      --profile NAME     Use named profile from config
+      --init-config      Generate default config file
+
+Authentication Options:
+  -u, --user USER:PASS   Basic authentication credentials
+      --netrc            Use ~/.netrc for authentication
+  -H, --header HEADER    Add custom header (can be repeated)
+
+Protocol Options:
+      --http1            Force HTTP/1.1 (disable HTTP/2)
+      --http2            Force HTTP/2 (fail if server doesn't support)
+      --http3[=MODE]     HTTP/3 (QUIC): on (default), auto (Alt-Svc upgrade
+                         with TCP fallback), off
+
+Network Options:
+      --resolve HOST:PORT:ADDR   Use ADDR for HOST:PORT (ADDR may be a
+                                 comma-separated list; repeatable)
+      --connect-to H1:P1:H2:P2   Connect to H2:P2 instead of H1:P1; empty
+                                 fields match any host/port (repeatable)
+  -4, --ipv4                     Use IPv4 addresses only
+  -6, --ipv6                     Use IPv6 addresses only
+      --interface IF|ADDR        Bind to network interface or source address
+
+Conditional Download:
+  -N, --timestamping     Only download if remote file is newer than local
+  -nc, --no-clobber      Skip downloads that would overwrite existing files
+      --on-conflict MODE Existing file policy: overwrite, rename (file.1),
+                         skip, skip-same-size (default: overwrite)
+      --part-suffix SFX  Download to FILE+SFX and rename when complete and
+                         verified (default: .part, empty writes in place)
+      --file-allocation MODE
+                         Reserve disk space: none, sparse, falloc (Linux,
+                         real blocks), trunc (default: sparse)
+
+Archive Options:
+      --extract[=DIR]    Extract tar, tar.gz, tar.zst, tar.xz and zip
+                         archives into DIR (default: next to the archive);
+                         single-stream tar downloads extract as they arrive
+      --strip-components N
+                         Drop N leading path components when extracting
+      --remove-archive   Delete the archive after extracting it
+
+Cache Options:
+      --cache-dir DIR    Reuse downloads from a content-addressable cache;
+                         files are found by --checksum without a request,
+                         or by URL once the server confirms ETag/Last-Modified
+      --cache-max-size SIZE
+                         Evict least recently used files above SIZE (e.g., 20G)
+
+Delta Downloads (zsync):
+      --seed-file FILE   Reuse matching blocks of an older local copy and
+                         fetch only the missing ranges (repeatable). Works
+                         with FILE.zsync control files, or URL.zsync next
+                         to a plain URL; the result is checked with the
+                         control file's SHA-1
+
+Output Command:
+      --pipe-to CMD      Stream the download in byte order into the standard
+                         input of shell command CMD while it is saved; data
+                         from parallel connections that arrives early waits
+                         in a 32MB buffer. A failing CMD fails the download
+                         (exit code 9). CMD gets the hook environment variables
+
+Signature Verification:
+      --signature URL|FILE|auto
+                         Verify a detached minisign or OpenPGP signature
+                         before the file is moved into place; auto looks for
+                         .minisig, .sig and .asc next to the file. A metalink
+                         <signature> is used when keys are given. Failures
+                         exit with code 10 and run --on-error/--webhook with
+                         the signature_failed event
+      --pubkey FILE      minisign or armored OpenPGP public key (repeatable)
+      --keyring FILE     OpenPGP keyring, armored or binary (repeatable)
+
+Security Options:
+      --pinnedpubkey PIN SHA256 public key pin (sha256//base64hash)
+
+Batch & Automation:
+  -i, --input-file FILE  Read URLs from file (batch download)
+      --on-complete CMD  Run command after successful download
+      --on-error CMD     Run command after failed download
+      --webhook URL      Send webhook notification on complete/error
+      --mirrors URLs     Comma-separated mirror URLs for fallback
+
+Metalink Options:
+      --metalink-location CC,...
+                         Prefer mirrors in these countries (e.g., de,tr),
+                         then follow the metalink's priorities
+      --metalink-select PATTERNS
+                         Only download files whose path or name matches a
+                         pattern (comma-separated, e.g., '*.iso,docs/*')
+      --metalink-jobs N  Files of a multi-file metalink downloaded at once
+                         (default: 4); each goes to its path under -P
+      --metalink-peer-timeout DURATION
+                         Wait this long for peers of a torrent listed by a
+                         single-file metalink, which then downloads from them
+                         and the mirrors (default: 30s, 0 = mirrors only)
+
+BitTorrent Options:
+      --select-file SPEC Only download these files: indexes and ranges
+                         from 1 or patterns (e.g., 1,3-5 or '*.csv')
+      --file-priority SPEC=LEVEL
+                         Fetch matching files at normal or high priority
+                         (repeatable, e.g., '*.csv=high')
+      --show-files       List the files of the torrent (# for --select-file)
+                         and exit
+      --seed             Keep seeding once downloaded, until interrupted
+      --seed-ratio N     Seed until N times the size is uploaded (e.g., 1.5)
+      --seed-time DURATION
+                         Seed for this long once downloaded (e.g., 30m);
+                         with --seed-ratio, whichever comes first
+      --upload-limit RATE
+                         Limit upload speed (e.g., 1M); --limit-rate limits
+                         downloads from peers too
+
+Interface:
+      --tui              Use interactive TUI mode (fullscreen)
 
 Recursive Download (Spider Mode):
   -r, --recursive        Enable recursive download
@@ -899,11 +1712,14 @@ Exit Codes:
   6  Checksum mismatch
   7  Timeout
   8  Interrupted (Ctrl+C)
+  9  --pipe-to command failed
+  10 Signature verification failed
 
 Examples:
   burkut https://example.com/file.zip
   burkut -o myfile.zip https://example.com/file.zip
   burkut -c https://example.com/large-file.iso
+  burkut --on-conflict rename https://example.com/file.zip
   burkut -n 8 https://example.com/large-file.iso
   burkut --limit-rate 1M https://example.com/large.iso
   burkut --checksum sha256:abc123... https://example.com/file.zip
@@ -916,11 +1732,48 @@ Examples:
   burkut --netrc https://example.com/file.zip
   burkut -H "X-API-Key: abc123" https://api.example.com/download
   burkut --tui https://example.com/large-file.iso
+  burkut --resolve example.com:443:203.0.113.7 https://example.com/file.zip
+  burkut --seed-file old.iso https://example.com/new.iso.zsync
+  burkut --pipe-to "psql mydb" https://example.com/dump.sql
+  burkut --pipe-to "zstd -d -o data.tar" https://example.com/data.tar.zst
+  burkut --signature auto --pubkey release.pub https://example.com/tool.tar.gz
+  burkut --signature auto --keyring vendor.gpg https://example.com/image.iso
 
 Batch Download:
   burkut -i urls.txt                   Download all URLs from file
   burkut -i urls.txt -P /downloads     Download to specific directory
 
+Cache Maintenance:
+  burkut cache ls --cache-dir DIR                 List cached files
+  burkut cache prune --cache-dir DIR --max-size 10G  Evict down to 10G
+  burkut cache verify --cache-dir DIR             Re-hash and drop damaged files
+
+Checksum Manifests:
+  burkut verify [DIR]                  Check DIR against its SHA256SUMS, B3SUMS, ...
+  burkut verify -c SHA256SUMS          Check the files listed, relative to the manifest
+      --report FILE                    Also write a JSON report (- for stdout)
+      --jobs N                         Files verified in parallel (default: CPU count)
+      --ignore-missing                 Do not fail for files that are not present
+  burkut checksum [-a ALG] [--tag] PATH...   Print GNU (or BSD with --tag) lines
+  burkut checksum --write DIR          Write DIR/SHA256SUMS (-o FILE for another name)
+
+Metalink Repair:
+  burkut repair file.meta4             Re-fetch only the pieces of the local copy
+                                       failing their hashes (-o FILE for its path,
+                                       --metalink-select PATTERN for the file)
+  burkut metalink create FILE...       Print a metalink with whole-file and piece
+                                       hashes (-a ALG, -o FILE to write it)
+      --mirror URL                     URL prefix the files are served under (repeatable)
+      --piece-length SIZE              Piece length (default: from the file size)
+      --torrent URL                    Add a torrent of the files as a metaurl
+
+Zsync Control Files:
+  burkut zsync make FILE               Write FILE.zsync, so --seed-file downloads
+                                       of FILE fetch only changed blocks
+      -u URL                           Target URL (default: FILE next to FILE.zsync)
+      --block-size SIZE                Block size (default: 4K)
+      -o FILE                          Write the control file to FILE
+
 Spider Mode (list URLs without downloading):
   burkut --spider https://example.com/docs/           List all URLs
   burkut --spider -l 3 https://example.com/ > urls.txt  Save to file
@@ -956,6 +1809,27 @@ func runBatchDownload(cliCfg CLIConfig) int {
 		return ExitParseError
 	}
 
+	allocation, err := storage.ParseAllocationMode(cliCfg.FileAllocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if cliCfg.StripComponents < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --strip-components cannot be negative\n")
+		return ExitParseError
+	}
+
+	// Each file is checked against the signature found next to it
+	if cliCfg.Signature != "" && cliCfg.Signature != "auto" {
+		fmt.Fprintf(os.Stderr, "Error: batch downloads only support --signature auto\n")
+		return ExitParseError
+	}
+	signatureKeys, err := loadSignatureKeys(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
 	// Create queue and load URLs
 	queue := download.NewQueue(cliCfg.OutputDir)
 	if err := queue.LoadFromFile(cliCfg.InputFile); err != nil {
@@ -971,11 +1845,27 @@ func runBatchDownload(cliCfg CLIConfig) int {
 	fmt.Printf("Burkut %s - Batch Download\n", version.Version)
 	fmt.Printf("Loaded %d URLs from %s\n\n", queue.Count(), cliCfg.InputFile)
 
+	// Existing file policy
+	policy, err := collisionPolicy(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
 	// Build HTTP client options
 	httpOpts := buildHTTPOptions(cliCfg, cfg)
 
+	// All connections of the batch share one DNS cache
+	dialer, err := buildDialer(cliCfg, protocol.NewDNSCache(protocol.DefaultDNSCacheTTL))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+
 	// Create HTTP client
 	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
 
 	// Setup rate limiter
 	var rateLimiter *engine.RateLimiter
@@ -986,9 +1876,22 @@ func runBatchDownload(cliCfg CLIConfig) int {
 		}
 	}
 
+	fileCache, err := openCache(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
+	// Share per-host backoff between all downloads so a throttling server
+	// slows down the whole batch, not just the item that hit it
+	backoff := engine.NewHostBackoff(engine.DefaultBackoffConfig())
+
 	// Process each URL
 	completed := 0
 	failed := 0
+	skipped := 0
+	pipeFailed := false
+	signatureFailed := false
 	startTime := time.Now()
 
 	items := queue.Items()
@@ -1001,6 +1904,36 @@ func runBatchDownload(cliCfg CLIConfig) int {
 		}
 
 		fmt.Printf("[%d/%d] %s\n", i+1, len(items), item.URL)
+
+		// Apply existing file policy (remote size is only needed for skip-same-size)
+		if !cliCfg.Continue && !hasPartialDownload(cliCfg, item.OutputPath) {
+			remoteSize := int64(-1)
+			if policy == storage.CollisionSkipSameSize && storage.FileExists(item.OutputPath) {
+				if meta, headErr := httpClient.Stat(ctx, item.URL); headErr == nil {
+					remoteSize = meta.ContentLength
+				}
+			}
+
+			collision, err := storage.ResolveCollision(item.OutputPath, policy, remoteSize)
+			if err != nil {
+				queue.SetError(item.ID, err)
+				failed++
+				if !cliCfg.Quiet {
+					fmt.Printf("  ✗ Failed: %v\n", err)
+				}
+				continue
+			}
+			if collision.Skip {
+				queue.UpdateStatus(item.ID, download.QueueStatusSkipped)
+				skipped++
+				if !cliCfg.Quiet {
+					fmt.Printf("  - Skipped: %s\n", collision.Reason)
+				}
+				continue
+			}
+			item.OutputPath = collision.Path
+		}
+
 		queue.UpdateStatus(item.ID, download.QueueStatusDownloading)
 
 		// Create downloader config
@@ -1009,6 +1942,37 @@ func runBatchDownload(cliCfg CLIConfig) int {
 		if rateLimiter != nil {
 			dlConfig.RateLimiter = rateLimiter
 		}
+		dlConfig.Backoff = backoff
+		dlConfig.PartSuffix = cliCfg.PartSuffix
+		dlConfig.Allocation = allocation
+
+		// Checksum is verified before the file is moved into place
+		if item.Checksum != "" {
+			checksum, parseErr := engine.ParseChecksumAuto(item.Checksum)
+			if parseErr != nil {
+				queue.SetError(item.ID, parseErr)
+				failed++
+				if !cliCfg.Quiet {
+					fmt.Printf("  ✗ Invalid checksum: %v\n", parseErr)
+				}
+				continue
+			}
+			dlConfig.Checksum = checksum
+		}
+
+		verifier, sigErr := fetchSignature(ctx, cliCfg, httpClient, item.URL, signatureKeys)
+		if sigErr != nil {
+			queue.SetError(item.ID, sigErr)
+			failed++
+			signatureFailed = true
+			if !cliCfg.Quiet {
+				fmt.Printf("  ✗ %v\n", sigErr)
+			}
+			continue
+		}
+		if verifier != nil {
+			dlConfig.Signature = verifier
+		}
 
 		downloader := engine.NewDownloader(dlConfig, httpClient)
 
@@ -1023,40 +1987,89 @@ func runBatchDownload(cliCfg CLIConfig) int {
 						ui.FormatBytes(p.Speed))
 				}
 			})
+			downloader.SetNoticeCallback(func(msg string) {
+				fmt.Printf("\r  ! %s\n", msg)
+			})
+		}
+
+		// Use a cached copy if there is one, otherwise download
+		var err error
+		cached := false
+		if fileCache != nil {
+			if hit, _, findErr := fileCache.Find(ctx, httpClient, item.URL, dlConfig.Checksum); findErr == nil && hit != nil {
+				// A cached copy failing the signature is downloaded again
+				if verifier == nil || verifier.VerifyFile(hit.Object.Path) == nil {
+					cached = fileCache.Materialize(hit.Object, item.OutputPath) == nil
+				}
+			}
 		}
 
-		// Download
-		err := downloader.Download(ctx, item.URL, item.OutputPath)
+		if !cached {
+			itemStart := time.Now()
+			err = downloader.Download(ctx, item.URL, item.OutputPath)
+			recordDownloadMetrics(downloader.GetProgress(), time.Since(itemStart), err)
+		}
 
 		if err != nil {
 			queue.SetError(item.ID, err)
 			failed++
+			var sigErr *signature.Error
+			if errors.As(err, &sigErr) {
+				signatureFailed = true
+			}
 			if !cliCfg.Quiet {
-				fmt.Printf("\r  ✗ Failed: %v\n", err)
+				var mismatch *engine.ChecksumMismatchError
+				if errors.As(err, &mismatch) {
+					fmt.Printf("\r  ✗ Checksum mismatch\n")
+				} else if sigErr != nil {
+					fmt.Printf("\r  ✗ %v\n", err)
+				} else {
+					fmt.Printf("\r  ✗ Failed: %v\n", err)
+				}
 			}
 			continue
 		}
 
-		// Verify checksum if provided
-		if item.Checksum != "" {
-			checksum, parseErr := engine.ParseChecksumAuto(item.Checksum)
-			if parseErr == nil {
-				valid, verifyErr := engine.VerifyChecksum(item.OutputPath, checksum)
-				if verifyErr != nil || !valid {
-					queue.SetError(item.ID, fmt.Errorf("checksum mismatch"))
-					failed++
-					if !cliCfg.Quiet {
-						fmt.Printf("\r  ✗ Checksum mismatch\n")
-					}
-					continue
+		if fileCache != nil && !cached {
+			if cacheErr := cacheDownload(fileCache, item.URL, item.OutputPath, downloader.Metadata(), dlConfig.Checksum); cacheErr != nil && !cliCfg.Quiet {
+				fmt.Printf("\r  ! Could not add to the cache: %v\n", cacheErr)
+			}
+		}
+
+		if pipeErr := pipeFile(ctx, cliCfg, item.OutputPath, item.URL, filepath.Base(item.OutputPath)); pipeErr != nil {
+			queue.SetError(item.ID, pipeErr)
+			failed++
+			pipeFailed = true
+			if !cliCfg.Quiet {
+				fmt.Printf("\r  ✗ Failed: %v\n", pipeErr)
+			}
+			continue
+		}
+
+		// Archives are extracted once the download is verified
+		if archive := archiveFormat(cliCfg, item.OutputPath); archive != extract.FormatNone {
+			extracted, extractErr := extractDownload(cliCfg, item.OutputPath, archive, nil, 0)
+			if extractErr != nil {
+				queue.SetError(item.ID, extractErr)
+				failed++
+				if !cliCfg.Quiet {
+					fmt.Printf("\r  ✗ Failed: %v\n", extractErr)
 				}
+				continue
+			}
+			if !cliCfg.Quiet {
+				fmt.Printf("\r  ✓ Extracted %d files to %s\n", extracted.Files, extracted.Dir)
 			}
 		}
 
 		queue.UpdateStatus(item.ID, download.QueueStatusCompleted)
 		completed++
 		if !cliCfg.Quiet {
-			fmt.Printf("\r  ✓ Completed\n")
+			if cached {
+				fmt.Printf("\r  ✓ Completed (from cache)\n")
+			} else {
+				fmt.Printf("\r  ✓ Completed\n")
+			}
 		}
 	}
 
@@ -1067,8 +2080,17 @@ func runBatchDownload(cliCfg CLIConfig) int {
 	fmt.Printf("  Total:     %d\n", len(items))
 	fmt.Printf("  Completed: %d\n", completed)
 	fmt.Printf("  Failed:    %d\n", failed)
+	if skipped > 0 {
+		fmt.Printf("  Skipped:   %d\n", skipped)
+	}
 	fmt.Printf("  Time:      %s\n", elapsed.Round(time.Second))
 
+	if signatureFailed {
+		return ExitSignatureError
+	}
+	if pipeFailed {
+		return ExitPipeError
+	}
 	if failed > 0 {
 		return ExitGeneralError
 	}
@@ -1100,24 +2122,91 @@ func buildHTTPOptions(cliCfg CLIConfig, cfg *config.Config) []protocol.HTTPClien
 		opts = append(opts, protocol.WithInsecureSkipVerify(true))
 	}
 
+	// HTTP/3
+	if mode := protocol.HTTP3Mode(cliCfg.HTTP3); mode != "" && mode != protocol.HTTP3Off {
+		opts = append(opts, protocol.WithHTTP3(mode))
+	}
+
 	return opts
 }
 
-// setupHooks creates a hook manager from CLI options
-func setupHooks(cliCfg CLIConfig) *hooks.Manager {
-	manager := hooks.NewManager()
+// recordDownloadMetrics records a finished download when metrics are enabled
+func recordDownloadMetrics(progress engine.Progress, elapsed time.Duration, err error) {
+	if appMetrics == nil {
+		return
+	}
+
+	appMetrics.IncDownloadsTotal()
+	if err != nil {
+		appMetrics.IncDownloadsFailed()
+		return
+	}
+	appMetrics.IncDownloadsCompleted()
+	appMetrics.AddBytesDownloaded(progress.Downloaded)
+	appMetrics.RecordDownloadDuration(elapsed)
+	appMetrics.RecordProtocol(progress.Protocol)
+}
+
+// recordTorrentMetrics records a finished torrent download, and what it
+// uploaded, when metrics are enabled
+func recordTorrentMetrics(dl *btorrent.Download, err error) {
+	if appMetrics == nil {
+		return
+	}
+
+	appMetrics.IncDownloadsTotal()
+	appMetrics.AddBytesUploaded(dl.Uploaded)
+	if err != nil {
+		appMetrics.IncDownloadsFailed()
+		return
+	}
+	appMetrics.IncDownloadsCompleted()
+	appMetrics.AddBytesDownloaded(dl.Downloaded)
+	appMetrics.RecordDownloadDuration(time.Since(dl.StartTime))
+}
+
+// buildDialer creates the network dialer from endpoint options.
+// Returns nil if no option is set and no DNS cache is requested.
+func buildDialer(cliCfg CLIConfig, cache *protocol.DNSCache) (*protocol.Dialer, error) {
+	if cliCfg.IPv4Only && cliCfg.IPv6Only {
+		return nil, fmt.Errorf("-4 and -6 cannot be used together")
+	}
+
+	dialCfg := protocol.DialerConfig{
+		Resolve:   cliCfg.Resolve,
+		ConnectTo: cliCfg.ConnectTo,
+		Interface: cliCfg.Interface,
+		Timeout:   cliCfg.Timeout,
+		DNSCache:  cache,
+	}
+	if cliCfg.IPv4Only {
+		dialCfg.IPVersion = 4
+	} else if cliCfg.IPv6Only {
+		dialCfg.IPVersion = 6
+	}
+
+	if cache == nil && len(dialCfg.Resolve) == 0 && len(dialCfg.ConnectTo) == 0 &&
+		dialCfg.Interface == "" && dialCfg.IPVersion == 0 {
+		return nil, nil
+	}
+	return protocol.NewDialer(dialCfg)
+}
+
+// setupHooks creates a hook manager from CLI options
+func setupHooks(cliCfg CLIConfig) *hooks.Manager {
+	manager := hooks.NewManager()
 
 	// Add command hooks
 	if cliCfg.OnComplete != "" {
 		manager.AddCommand(cliCfg.OnComplete, hooks.EventComplete)
 	}
 	if cliCfg.OnError != "" {
-		manager.AddCommand(cliCfg.OnError, hooks.EventError)
+		manager.AddCommand(cliCfg.OnError, hooks.EventError, hooks.EventSignatureFailed)
 	}
 
 	// Add webhook
 	if cliCfg.WebhookURL != "" {
-		manager.AddWebhook(cliCfg.WebhookURL, hooks.EventComplete, hooks.EventError)
+		manager.AddWebhook(cliCfg.WebhookURL, hooks.EventComplete, hooks.EventError, hooks.EventSignatureFailed)
 	}
 
 	return manager
@@ -1147,6 +2236,23 @@ func runTorrentDownload(cliCfg CLIConfig, source string) int {
 			torrentCfg.DownloadLimit = limit
 		}
 	}
+	if cliCfg.UploadLimit != "" {
+		limit, err := config.ParseBandwidth(cliCfg.UploadLimit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --upload-limit: %v\n", err)
+			return ExitParseError
+		}
+		torrentCfg.UploadLimit = limit
+	}
+
+	// Seeding stops at the ratio or time given, whichever comes first
+	if cliCfg.SeedRatio < 0 || cliCfg.SeedTime < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --seed-ratio and --seed-time cannot be negative")
+		return ExitParseError
+	}
+	torrentCfg.Seed = cliCfg.Seed || cliCfg.SeedRatio > 0 || cliCfg.SeedTime > 0
+	torrentCfg.SeedRatio = cliCfg.SeedRatio
+	torrentCfg.SeedTime = cliCfg.SeedTime
 
 	// Create client
 	client, err := btorrent.NewClient(torrentCfg)
@@ -1174,35 +2280,34 @@ func runTorrentDownload(cliCfg CLIConfig, source string) int {
 		return ExitGeneralError
 	}
 
+	if err := applyTorrentFileOptions(cliCfg, dl); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if cliCfg.ShowFiles {
+		printTorrentFiles(dl)
+		return ExitSuccess
+	}
+
 	if !cliCfg.Quiet {
 		fmt.Fprintf(os.Stderr, "Downloading: %s\n", dl.Name)
+		if cliCfg.SelectFiles != "" {
+			var selected int
+			files := dl.Files()
+			for _, f := range files {
+				if f.Selected {
+					selected++
+				}
+			}
+			fmt.Fprintf(os.Stderr, "Files: %d of %d selected\n", selected, len(files))
+		}
 		fmt.Fprintf(os.Stderr, "Size: %s\n", formatBytes(dl.TotalSize))
 		fmt.Fprintf(os.Stderr, "Info Hash: %s\n", dl.InfoHash)
 	}
 
-	// Progress callback
-	progressCb := func(p btorrent.Progress) {
-		if cliCfg.Quiet {
-			return
-		}
-		switch cliCfg.Progress {
-		case "bar", "minimal":
-			fmt.Fprintf(os.Stderr, "\r\033[K%s: %.1f%% [%s/%s] %s/s P:%d S:%d",
-				p.Name,
-				p.Percent,
-				formatBytes(p.Downloaded),
-				formatBytes(p.TotalSize),
-				formatBytes(p.Speed),
-				p.Peers,
-				p.Seeds)
-		case "json":
-			fmt.Printf(`{"name":"%s","percent":%.1f,"downloaded":%d,"total":%d,"speed":%d,"peers":%d,"seeds":%d,"status":"%s"}`+"\n",
-				p.Name, p.Percent, p.Downloaded, p.TotalSize, p.Speed, p.Peers, p.Seeds, p.Status)
-		}
-	}
-
 	// Download
-	err = client.Download(ctx, dl, progressCb)
+	err = client.Download(ctx, dl, torrentProgress(cliCfg))
+	recordTorrentMetrics(dl, err)
 
 	if err != nil {
 		if ctx.Err() != nil {
@@ -1214,6 +2319,9 @@ func runTorrentDownload(cliCfg CLIConfig, source string) int {
 
 	if !cliCfg.Quiet {
 		fmt.Fprintf(os.Stderr, "\nDownload complete: %s\n", dl.Name)
+		if torrentCfg.Seed {
+			fmt.Fprintf(os.Stderr, "Uploaded: %s (ratio %.2f)\n", formatBytes(dl.Uploaded), dl.Ratio)
+		}
 	}
 
 	// Run hooks
@@ -1222,6 +2330,7 @@ func runTorrentDownload(cliCfg CLIConfig, source string) int {
 		elapsed := time.Since(dl.StartTime)
 		payload := hooks.CreatePayload(hooks.EventComplete, source, dl.Name, filepath.Join(cliCfg.OutputDir, dl.Name)).
 			WithProgress(dl.Downloaded, dl.TotalSize, 0, 100.0).
+			WithUpload(dl.Uploaded, dl.Ratio).
 			WithDuration(elapsed)
 		hookManager.ExecuteAsync(ctx, payload)
 	}
@@ -1229,6 +2338,78 @@ func runTorrentDownload(cliCfg CLIConfig, source string) int {
 	return ExitSuccess
 }
 
+// applyTorrentFileOptions applies --select-file and --file-priority to dl
+func applyTorrentFileOptions(cliCfg CLIConfig, dl *btorrent.Download) error {
+	if cliCfg.SelectFiles != "" {
+		if err := dl.SelectFiles(cliCfg.SelectFiles); err != nil {
+			return fmt.Errorf("--select-file: %w", err)
+		}
+	}
+	for _, value := range cliCfg.FilePriorities {
+		i := strings.LastIndex(value, "=")
+		if i < 0 {
+			return fmt.Errorf("--file-priority %q: want SPEC=LEVEL", value)
+		}
+		priority, err := btorrent.ParsePriority(value[i+1:])
+		if err != nil {
+			return fmt.Errorf("--file-priority: %w", err)
+		}
+		if err := dl.SetPriority(value[:i], priority); err != nil {
+			return fmt.Errorf("--file-priority: %w", err)
+		}
+	}
+	return nil
+}
+
+// printTorrentFiles lists the files of dl for --show-files, marking the
+// selected ones
+func printTorrentFiles(dl *btorrent.Download) {
+	fmt.Printf("%s (%s)\n", dl.Name, dl.InfoHash)
+	fmt.Printf("    %4s  %10s  %-8s  %s\n", "#", "Size", "Priority", "Path")
+	for _, f := range dl.Files() {
+		mark, priority := " ", "-"
+		if f.Selected {
+			mark, priority = "*", f.Priority.String()
+		}
+		fmt.Printf("  %s %4d  %10s  %-8s  %s\n", mark, f.Index, formatBytes(f.Size), priority, f.Path)
+	}
+	fmt.Printf("Selected: %s\n", formatBytes(dl.TotalSize))
+}
+
+// torrentProgress returns the progress callback of a torrent download
+func torrentProgress(cliCfg CLIConfig) func(btorrent.Progress) {
+	return func(p btorrent.Progress) {
+		if cliCfg.Quiet {
+			return
+		}
+		switch cliCfg.Progress {
+		case "bar", "minimal":
+			if p.Status == btorrent.StatusSeeding {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s: seeding, uploaded %s (ratio %.2f) %s/s P:%d",
+					p.Name,
+					formatBytes(p.Uploaded),
+					p.Ratio,
+					formatBytes(p.UpSpeed),
+					p.Peers)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "\r\033[K%s: %.1f%% [%s/%s] %s/s P:%d S:%d U:%s R:%.2f",
+				p.Name,
+				p.Percent,
+				formatBytes(p.Downloaded),
+				formatBytes(p.TotalSize),
+				formatBytes(p.Speed),
+				p.Peers,
+				p.Seeds,
+				formatBytes(p.Uploaded),
+				p.Ratio)
+		case "json":
+			fmt.Printf(`{"name":"%s","percent":%.1f,"downloaded":%d,"total":%d,"speed":%d,"uploaded":%d,"upload_speed":%d,"ratio":%.2f,"peers":%d,"seeds":%d,"status":"%s"}`+"\n",
+				p.Name, p.Percent, p.Downloaded, p.TotalSize, p.Speed, p.Uploaded, p.UpSpeed, p.Ratio, p.Peers, p.Seeds, p.Status)
+		}
+	}
+}
+
 // runDownloadTUI runs the download with interactive TUI
 func runDownloadTUI(cliCfg CLIConfig, url string) int {
 	// Load config
@@ -1238,29 +2419,14 @@ func runDownloadTUI(cliCfg CLIConfig, url string) int {
 		return ExitParseError
 	}
 
-	// Build HTTP client options
-	httpOpts := []protocol.HTTPClientOption{
-		protocol.WithTimeout(cliCfg.Timeout),
-		protocol.WithUserAgent(fmt.Sprintf("Burkut/%s", version.Version)),
-	}
-
-	// Add proxy
-	proxyURL := cliCfg.Proxy
-	if proxyURL == "" && cfg.Proxy.HTTP != "" {
-		proxyURL = cfg.Proxy.HTTP
-	}
-	if proxyURL != "" {
-		if strings.HasPrefix(proxyURL, "socks5://") {
-			httpOpts = append(httpOpts, protocol.WithSOCKS5Proxy(proxyURL, nil))
-		} else {
-			httpOpts = append(httpOpts, protocol.WithProxy(proxyURL))
-		}
+	allocation, err := storage.ParseAllocationMode(cliCfg.FileAllocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
 
-	// Skip certificate verification
-	if cliCfg.NoCheckCert || !cfg.TLS.Verify {
-		httpOpts = append(httpOpts, protocol.WithInsecureSkipVerify(true))
-	}
+	// Build HTTP client options (timeout, proxy, TLS and HTTP/3)
+	httpOpts := buildHTTPOptions(cliCfg, cfg)
 
 	// Handle authentication
 	if cliCfg.UseNetrc {
@@ -1292,11 +2458,22 @@ func runDownloadTUI(cliCfg CLIConfig, url string) int {
 		httpOpts = append(httpOpts, protocol.WithHeaders(headers))
 	}
 
+	// Network endpoints
+	dialer, err := buildDialer(cliCfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if dialer != nil {
+		httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+	}
+
 	// Create HTTP client
 	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
 
 	// Get file metadata
-	meta, err := httpClient.Head(context.Background(), url)
+	meta, err := httpClient.Stat(context.Background(), url)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to get file info: %v\n", err)
 		return ExitNetworkError
@@ -1305,12 +2482,50 @@ func runDownloadTUI(cliCfg CLIConfig, url string) int {
 	// Determine output path
 	outputPath := determineOutputPath(cliCfg, meta.Filename)
 
+	// Apply existing file policy
+	collision, err := resolveOutputCollision(cliCfg, outputPath, meta.ContentLength)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if collision.Skip {
+		fmt.Printf("File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
+		return ExitSuccess
+	}
+	outputPath = collision.Path
+
 	// Create TUI runner
 	tuiRunner := tui.NewRunner(url, meta.Filename, meta.ContentLength, cliCfg.Connections)
 
 	// Create downloader
 	downloaderConfig := engine.DefaultConfig()
 	downloaderConfig.Connections = cliCfg.Connections
+	downloaderConfig.PartSuffix = cliCfg.PartSuffix
+	downloaderConfig.Allocation = allocation
+
+	// Checksum is verified before the file is moved into place
+	if cliCfg.Checksum != "" {
+		expectedChecksum, err := engine.ParseChecksumAuto(cliCfg.Checksum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid checksum: %v\n", err)
+			return ExitParseError
+		}
+		downloaderConfig.Checksum = expectedChecksum
+	}
+
+	signatureKeys, err := loadSignatureKeys(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	verifier, err := fetchSignature(context.Background(), cliCfg, httpClient, url, signatureKeys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitSignatureError
+	}
+	if verifier != nil {
+		downloaderConfig.Signature = verifier
+	}
 
 	// Rate limiter
 	if cliCfg.LimitRate != "" {
@@ -1334,25 +2549,27 @@ func runDownloadTUI(cliCfg CLIConfig, url string) int {
 	go func() {
 		defer close(downloadDone)
 		downloadErr = downloader.Download(tuiRunner.Context(), url, outputPath)
+		progress := downloader.GetProgress()
+		recordDownloadMetrics(progress, progress.ElapsedTime, downloadErr)
 	}()
 
 	// Start TUI (blocks until user quits or download completes)
 	go func() {
 		<-downloadDone
-		if downloadErr != nil {
+		var mismatch *engine.ChecksumMismatchError
+		if errors.As(downloadErr, &mismatch) {
+			progress := downloader.GetProgress()
+			tuiRunner.SetComplete(meta.Filename, meta.ContentLength, progress.ElapsedTime, progress.Speed)
+			tuiRunner.SetVerified(false)
+		} else if downloadErr != nil {
 			tuiRunner.SetError(downloadErr)
 		} else {
 			progress := downloader.GetProgress()
 			tuiRunner.SetComplete(meta.Filename, meta.ContentLength, progress.ElapsedTime, progress.Speed)
 
-			// Verify checksum if specified
-			if cliCfg.Checksum != "" {
-				tuiRunner.SetVerifying()
-				expectedChecksum, _ := engine.ParseChecksumAuto(cliCfg.Checksum)
-				if expectedChecksum != nil {
-					valid, _ := engine.VerifyChecksum(outputPath, expectedChecksum)
-					tuiRunner.SetVerified(valid)
-				}
+			// The downloader verified the checksum before moving the file into place
+			if downloaderConfig.Checksum != nil {
+				tuiRunner.SetVerified(true)
 			}
 		}
 
@@ -1367,10 +2584,25 @@ func runDownloadTUI(cliCfg CLIConfig, url string) int {
 		return ExitGeneralError
 	}
 
+	var mismatch *engine.ChecksumMismatchError
+	if errors.As(downloadErr, &mismatch) {
+		return ExitChecksumError
+	}
+	var sigErr *signature.Error
+	if errors.As(downloadErr, &sigErr) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", downloadErr)
+		return ExitSignatureError
+	}
 	if downloadErr != nil {
 		return ExitNetworkError
 	}
 
+	// The command's output would garble the TUI, so it runs afterwards
+	if err := pipeFile(context.Background(), cliCfg, outputPath, url, meta.Filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitPipeError
+	}
+
 	return ExitSuccess
 }
 
@@ -1400,6 +2632,14 @@ func runRecursiveDownload(cliCfg CLIConfig, startURL string) int {
 	crawlConfig.OutputDir = outputDir
 	crawlConfig.RespectRobots = !cliCfg.RobotsOff
 	crawlConfig.ConvertLinks = cliCfg.ConvertLinks
+	if !cliCfg.Timestamping {
+		policy, err := collisionPolicy(cliCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitParseError
+		}
+		crawlConfig.OnConflict = policy
+	}
 	crawlConfig.Workers = cliCfg.Connections
 	if crawlConfig.Workers <= 0 {
 		crawlConfig.Workers = 2
@@ -1408,6 +2648,14 @@ func runRecursiveDownload(cliCfg CLIConfig, startURL string) int {
 	// Set user agent
 	crawlConfig.UserAgent = "Burkut/1.0 (Website Mirror; +https://github.com/kilimcininkoroglu/burkut)"
 
+	// Network endpoints, with one DNS cache for all workers
+	dialer, err := buildDialer(cliCfg, protocol.NewDNSCache(protocol.DefaultDNSCacheTTL))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	crawlConfig.Dialer = dialer
+
 	// Parse wait time
 	if cliCfg.WaitTime != "" {
 		if waitDuration, err := time.ParseDuration(cliCfg.WaitTime); err == nil {
@@ -1493,7 +2741,7 @@ func runRecursiveDownload(cliCfg CLIConfig, startURL string) int {
 	}
 
 	// Start crawling
-	err := c.Crawl(ctx, startURL)
+	err = c.Crawl(ctx, startURL)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nCrawl error: %v\n", err)
 		return ExitNetworkError
@@ -1552,6 +2800,14 @@ func runSpiderMode(cliCfg CLIConfig, startURL string) int {
 
 	crawlConfig.UserAgent = "Burkut/1.0 Spider (URL checker; +https://github.com/kilimcininkoroglu/burkut)"
 
+	// Network endpoints, with one DNS cache for all workers
+	dialer, err := buildDialer(cliCfg, protocol.NewDNSCache(protocol.DefaultDNSCacheTTL))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	crawlConfig.Dialer = dialer
+
 	// Parse wait time
 	if cliCfg.WaitTime != "" {
 		if waitDuration, err := time.ParseDuration(cliCfg.WaitTime); err == nil {
@@ -1612,7 +2868,7 @@ func runSpiderMode(cliCfg CLIConfig, startURL string) int {
 	}
 
 	// Start crawling
-	err := c.Crawl(ctx, startURL)
+	err = c.Crawl(ctx, startURL)
 	if err != nil && err != context.Canceled {
 		fmt.Fprintf(os.Stderr, "\nSpider error: %v\n", err)
 		return ExitNetworkError
@@ -1670,13 +2926,40 @@ func runMetalinkDownload(cliCfg CLIConfig, metalinkFile string) int {
 		return ExitParseError
 	}
 
-	// Get the first file (or handle multiple files)
-	file := ml.GetFile()
-	if file == nil {
+	if len(ml.Files) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: No files found in metalink")
 		return ExitParseError
 	}
 
+	// Every name is checked before anything is written
+	names := make(map[string]bool)
+	for _, f := range ml.Files {
+		name, err := protocol.SanitizeRelativePath(f.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Unsafe file name in metalink: %v\n", err)
+			return ExitParseError
+		}
+		if names[name] {
+			fmt.Fprintf(os.Stderr, "Error: Metalink lists %s more than once\n", name)
+			return ExitParseError
+		}
+		names[name] = true
+	}
+
+	files, err := ml.Select(splitList(cliCfg.MetalinkSelect))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --metalink-select: %v\n", err)
+		return ExitParseError
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No file in the metalink matches %q\n", cliCfg.MetalinkSelect)
+		return ExitParseError
+	}
+	if len(files) > 1 {
+		return runMetalinkFiles(cliCfg, metalinkFile, files)
+	}
+	file := files[0]
+
 	// Print metalink info
 	if !cliCfg.Quiet {
 		fmt.Fprintf(os.Stderr, "Metalink file: %s\n", metalinkFile)
@@ -1698,8 +2981,8 @@ func runMetalinkDownload(cliCfg CLIConfig, metalinkFile string) int {
 		fmt.Fprintln(os.Stderr)
 	}
 
-	// Get sorted URLs by priority
-	urls := file.SortedURLs()
+	// Get sorted URLs by priority, preferred locations first
+	urls := file.PreferredURLs(splitList(cliCfg.MetalinkLocations))
 	if len(urls) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: No download URLs in metalink")
 		return ExitParseError
@@ -1707,29 +2990,50 @@ func runMetalinkDownload(cliCfg CLIConfig, metalinkFile string) int {
 
 	// Set output filename from metalink if not specified
 	if cliCfg.Output == "" {
-		cliCfg.Output = file.Name
+		name, err := protocol.SanitizeRelativePath(file.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Unsafe file name in metalink: %v\n", err)
+			return ExitParseError
+		}
+		cliCfg.Output = name
 	}
 
 	// Set checksum from metalink if not specified
 	if cliCfg.Checksum == "" {
-		hashType, hashValue := file.GetPreferredChecksum()
-		if hashValue != "" {
-			// Convert metalink hash type to our format
-			switch hashType {
-			case "sha-256":
-				cliCfg.Checksum = "sha256:" + hashValue
-			case "sha-512":
-				cliCfg.Checksum = "sha512:" + hashValue
-			case "sha-1":
-				cliCfg.Checksum = "sha1:" + hashValue
-			case "md5":
-				cliCfg.Checksum = "md5:" + hashValue
-			}
+		if sum := metalinkChecksum(file); sum != nil {
+			cliCfg.Checksum = sum.String()
+		}
+	}
+
+	// A signature in the metalink is checked against --pubkey/--keyring
+	if file.Signature != nil {
+		cliCfg.SignatureData = strings.TrimSpace(file.Signature.Value)
+	}
+
+	cliCfg.ExpectedSize = file.Size
+
+	// Pieces failing their hashes are fetched again, from another mirror first
+	if pv := metalink.NewPieceVerifier(file); pv != nil {
+		cliCfg.Pieces = pv
+		for _, u := range urls {
+			cliCfg.PieceMirrors = append(cliCfg.PieceMirrors, u.URL)
+		}
+	}
+
+	// Peers of a torrent in the metalink share the work with the mirrors.
+	// Extraction only follows HTTP downloads.
+	var staging string
+	if metaURL := metalinkTorrent(file); metaURL != nil && cliCfg.MetalinkPeerTimeout > 0 && !cliCfg.Extract.Enabled {
+		var exitCode int
+		var handled bool
+		if exitCode, handled, staging = runMetalinkTorrent(cliCfg, file, metaURL, urls); handled {
+			return exitCode
 		}
 	}
 
 	// Try URLs in priority order
 	var lastErr error
+	var lastExit int
 	for i, urlEntry := range urls {
 		if !cliCfg.Quiet && cliCfg.Verbose {
 			fmt.Fprintf(os.Stderr, "Trying URL %d/%d: %s\n", i+1, len(urls), urlEntry.URL)
@@ -1737,6 +3041,10 @@ func runMetalinkDownload(cliCfg CLIConfig, metalinkFile string) int {
 
 		exitCode := runDownload(cliCfg, urlEntry.URL)
 		if exitCode == ExitSuccess {
+			// The torrent's partial data is of no more use
+			if staging != "" {
+				os.RemoveAll(staging)
+			}
 			return ExitSuccess
 		}
 
@@ -1744,80 +3052,905 @@ func runMetalinkDownload(cliCfg CLIConfig, metalinkFile string) int {
 			fmt.Fprintf(os.Stderr, "URL failed, trying next mirror...\n")
 		}
 		lastErr = fmt.Errorf("download failed with exit code %d", exitCode)
+		lastExit = exitCode
 	}
 
 	fmt.Fprintf(os.Stderr, "Error: All mirrors failed. Last error: %v\n", lastErr)
+	if lastExit == ExitSignatureError {
+		return ExitSignatureError
+	}
 	return ExitNetworkError
 }
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
+// maxTorrentSize caps the size of a torrent file named by a metalink
+const maxTorrentSize = 16 << 20
 
-// isFTPURL checks if URL is FTP or FTPS
-func isFTPURL(rawURL string) bool {
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return false
+// metalinkTorrent returns the torrent metaurl of a metalink file, if any
+func metalinkTorrent(file *metalink.File) *metalink.MetaURL {
+	for i, m := range file.MetaURLs {
+		if strings.EqualFold(m.MediaType, "torrent") {
+			return &file.MetaURLs[i]
+		}
 	}
-	scheme := strings.ToLower(u.Scheme)
-	return scheme == "ftp" || scheme == "ftps"
+	return nil
 }
 
-// runFTPDownload handles FTP/FTPS downloads
-func runFTPDownload(cliCfg CLIConfig, rawURL string) int {
-	ctx, cancel := context.WithCancel(context.Background())
+// runMetalinkTorrent downloads file with the torrent of a metalink metaurl,
+// from its peers and from the HTTP mirrors as web seeds. The torrent's
+// piece hashes check what either sends, then the metalink's own hashes
+// check the file. handled is false when the torrent cannot be used, finds
+// no peer within --metalink-peer-timeout or fails, for the mirrors to be
+// used on their own. The torrent downloads into staging, which is kept
+// until the file is complete so an interrupted download resumes.
+func runMetalinkTorrent(cliCfg CLIConfig, file *metalink.File, metaURL *metalink.MetaURL, urls []metalink.URL) (exitCode int, handled bool, staging string) {
+	ctx, cancel := interruptContext()
 	defer cancel()
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		fmt.Fprintln(os.Stderr, "\nInterrupted...")
-		cancel()
-	}()
+	cfg, err := loadConfig(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return ExitParseError, true, staging
+	}
+	httpOpts := buildHTTPOptions(cliCfg, cfg)
+	dialer, err := buildDialer(cliCfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError, true, staging
+	}
+	if dialer != nil {
+		httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+	}
+	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
 
-	// Parse URL to check scheme
-	parsedURL, err := url.Parse(rawURL)
+	outputPath := determineOutputPath(cliCfg, file.Name)
+	collision, err := resolveOutputCollision(cliCfg, outputPath, file.Size)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Invalid URL: %v\n", err)
-		return ExitParseError
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError, true, staging
+	}
+	if collision.Skip {
+		if !cliCfg.Quiet {
+			fmt.Printf("File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
+		}
+		return ExitSuccess, true, staging
 	}
+	outputPath = collision.Path
 
-	// Build FTP client options
-	ftpOpts := []protocol.FTPClientOption{
-		protocol.WithFTPTimeout(cliCfg.Timeout),
+	// Metalink signatures are checked against --pubkey/--keyring
+	keys, err := loadSignatureKeys(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError, true, staging
+	}
+	verifier, err := fetchSignature(ctx, cliCfg, httpClient, urls[0].URL, keys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitSignatureError, true, staging
 	}
 
-	// Enable TLS for ftps:// scheme
-	if strings.ToLower(parsedURL.Scheme) == "ftps" {
-		// Check if using implicit FTPS port (990)
-		port := parsedURL.Port()
-		if port == "990" || port == "" {
-			// Default FTPS port or explicit 990 = implicit TLS
-			ftpOpts = append(ftpOpts, protocol.WithFTPSImplicit(true))
-			if cliCfg.Verbose {
-				fmt.Fprintln(os.Stderr, "Using implicit FTPS (port 990)")
-			}
-		} else {
-			// Explicit FTPS (AUTH TLS) on non-standard port
-			ftpOpts = append(ftpOpts, protocol.WithFTPS(true))
-			if cliCfg.Verbose {
-				fmt.Fprintln(os.Stderr, "Using explicit FTPS (AUTH TLS)")
-			}
+	body, _, err := httpClient.Get(ctx, metaURL.URL)
+	if err != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent unavailable (%v), using mirrors\n", err)
 		}
-		if cliCfg.NoCheckCert {
-			ftpOpts = append(ftpOpts, protocol.WithFTPSkipTLSVerify(true))
+		return 0, false, staging
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxTorrentSize))
+	body.Close()
+	if err != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent unavailable (%v), using mirrors\n", err)
 		}
+		return 0, false, staging
 	}
 
-	// Handle authentication from URL or CLI
+	// The torrent downloads next to the output, into a directory named after
+	// its info hash that holds its state, and its file is moved into place
+	infoHash, err := btorrent.InfoHash(bytes.NewReader(data))
+	if err != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent unusable (%v), using mirrors\n", err)
+		}
+		return 0, false, staging
+	}
+	staging = filepath.Join(filepath.Dir(outputPath), ".burkut-torrent-"+infoHash)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError, true, staging
+	}
+
+	torrentCfg := btorrent.DefaultConfig()
+	torrentCfg.DownloadDir = staging
+	if cliCfg.LimitRate != "" {
+		if limit, err := config.ParseBandwidth(cliCfg.LimitRate); err == nil {
+			torrentCfg.DownloadLimit = limit
+		}
+	}
+	client, err := btorrent.NewClient(torrentCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating torrent client: %v\n", err)
+		return 0, false, staging
+	}
+	defer client.Close()
+
+	dl, err := client.AddTorrentReader(bytes.NewReader(data))
+	if err != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent unusable (%v), using mirrors\n", err)
+		}
+		return 0, false, staging
+	}
+	torrentPath, err := client.SelectFile(dl, metaURL.Name)
+	if err == nil && file.Size > 0 && dl.TotalSize != file.Size {
+		err = fmt.Errorf("torrent file is %d bytes, metalink says %d", dl.TotalSize, file.Size)
+	}
+	if err != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent unusable (%v), using mirrors\n", err)
+		}
+		return 0, false, staging
+	}
+
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "Torrent: %s, waiting up to %s for peers\n", dl.InfoHash, cliCfg.MetalinkPeerTimeout)
+	}
+	if !client.WaitForPeers(ctx, dl, cliCfg.MetalinkPeerTimeout) {
+		if ctx.Err() != nil {
+			return ExitInterrupted, true, staging
+		}
+		if !cliCfg.Quiet {
+			fmt.Fprintln(os.Stderr, "No peers found, using mirrors")
+		}
+		return 0, false, staging
+	}
+
+	var seeds []string
+	for _, u := range urls {
+		if seed := dl.WebSeedURL(u.URL); seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	client.AddWebSeeds(dl, seeds)
+	if cliCfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Web seeds: %d of %d mirrors\n", len(seeds), len(urls))
+	}
+
+	startTime := time.Now()
+	err = client.Download(ctx, dl, torrentProgress(cliCfg))
+	if !cliCfg.Quiet && cliCfg.Progress != "json" && cliCfg.Progress != "none" {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ExitInterrupted, true, staging
+		}
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Torrent failed (%v), using mirrors\n", err)
+		}
+		return 0, false, staging
+	}
+	// Dropping the torrent closes its files
+	client.Remove(dl, false)
+
+	// Pieces failing the metalink's hashes are fetched again from the mirrors
+	if pv := metalink.NewPieceVerifier(file); pv != nil {
+		bad, err := engine.FindBadPieces(torrentPath, dl.TotalSize, pv)
+		if err == nil && len(bad) > 0 {
+			var mirrors []string
+			for _, u := range urls {
+				mirrors = append(mirrors, u.URL)
+			}
+			err = engine.RepairPieces(ctx, httpClient, torrentPath, dl.TotalSize, pv, bad, mirrors)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitChecksumError, true, staging
+		}
+	}
+
+	if expected := metalinkChecksum(file); expected != nil {
+		actual, err := engine.CalculateChecksum(torrentPath, expected.Algorithm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError, true, staging
+		}
+		if actual.Value != expected.Value {
+			fmt.Fprintf(os.Stderr, "Error: Checksum mismatch!\n")
+			fmt.Fprintf(os.Stderr, "  Expected: %s\n", expected.Value)
+			fmt.Fprintf(os.Stderr, "  Actual:   %s\n", actual.Value)
+			return ExitChecksumError, true, staging
+		}
+	}
+	if verifier != nil {
+		if err := verifier.VerifyFile(torrentPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitSignatureError, true, staging
+		}
+	}
+
+	if err := os.Rename(torrentPath, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError, true, staging
+	}
+	os.RemoveAll(staging)
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "Download complete: %s (%s in %s)\n", outputPath, formatBytes(dl.TotalSize), time.Since(startTime).Round(time.Second))
+	}
+
+	hookManager := setupHooks(cliCfg)
+	if hookManager.Count() > 0 {
+		payload := hooks.CreatePayload(hooks.EventComplete, metaURL.URL, file.Name, outputPath).
+			WithProgress(dl.TotalSize, dl.TotalSize, 0, 100.0).
+			WithDuration(time.Since(startTime))
+		hookManager.ExecuteAsync(ctx, payload)
+	}
+	return ExitSuccess, true, staging
+}
+
+// metalinkChecksum returns the strongest whole-file checksum of a metalink
+// file that can be verified, or nil if it has none
+func metalinkChecksum(file *metalink.File) *engine.Checksum {
+	for _, hashType := range []string{"sha-512", "sha-256", "sha-1", "md5"} {
+		if value := file.GetChecksum(hashType); value != "" {
+			return &engine.Checksum{Algorithm: engine.AlgorithmFromIANA(hashType), Value: strings.ToLower(strings.TrimSpace(value))}
+		}
+	}
+	return nil
+}
+
+// metalinkResult is the outcome of one file of a multi-file metalink
+type metalinkResult struct {
+	path      string
+	size      int64
+	source    string // URL the file was downloaded from, or last tried
+	cached    bool   // Placed from the download cache
+	extracted *extract.Result
+	status    download.QueueStatus
+	err       error
+}
+
+// metalinkSession holds what the files of a metalink share while they
+// download concurrently
+type metalinkSession struct {
+	cliCfg      CLIConfig
+	client      *protocol.HTTPClient
+	backoff     *engine.HostBackoff
+	rateLimiter *engine.RateLimiter
+	allocation  storage.AllocationMode
+	keys        *signature.Keyring
+	locations   []string
+	cache       *cache.Cache
+	hooks       *hooks.Manager
+
+	mu      sync.Mutex // Serializes output
+	cacheMu sync.Mutex // Serializes additions to the cache
+}
+
+func (s *metalinkSession) printf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Printf(format, args...)
+}
+
+// runMetalinkFiles downloads the files of a metalink concurrently, each
+// into its relative path under --output-dir from its own mirrors
+func runMetalinkFiles(cliCfg CLIConfig, metalinkFile string, files []*metalink.File) int {
+	if cliCfg.Output != "" {
+		fmt.Fprintf(os.Stderr, "Error: -o names a single file; use -P for the %d files of a metalink\n", len(files))
+		return ExitParseError
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	cfg, err := loadConfig(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return ExitParseError
+	}
+	allocation, err := storage.ParseAllocationMode(cliCfg.FileAllocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if _, err := collisionPolicy(cliCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	signatureKeys, err := loadSignatureKeys(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	fileCache, err := openCache(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
+	// All files share one DNS cache
+	httpOpts := buildHTTPOptions(cliCfg, cfg)
+	dialer, err := buildDialer(cliCfg, protocol.NewDNSCache(protocol.DefaultDNSCacheTTL))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
+
+	session := &metalinkSession{
+		cliCfg:     cliCfg,
+		client:     httpClient,
+		backoff:    engine.NewHostBackoff(engine.DefaultBackoffConfig()),
+		allocation: allocation,
+		keys:       signatureKeys,
+		locations:  splitList(cliCfg.MetalinkLocations),
+		cache:      fileCache,
+		hooks:      setupHooks(cliCfg),
+	}
+	if cliCfg.LimitRate != "" {
+		bytesPerSec, err := config.ParseBandwidth(cliCfg.LimitRate)
+		if err == nil && bytesPerSec > 0 {
+			session.rateLimiter = engine.NewRateLimiter(bytesPerSec)
+		}
+	}
+
+	if !cliCfg.Quiet {
+		var total int64
+		for _, file := range files {
+			total += file.Size
+		}
+		fmt.Printf("Burkut %s - Metalink Download\n", version.Version)
+		fmt.Printf("%d files (%s) from %s\n\n", len(files), formatBytes(total), metalinkFile)
+	}
+
+	startTime := time.Now()
+	results := make([]metalinkResult, len(files))
+	semaphore := make(chan struct{}, max(cliCfg.MetalinkJobs, 1))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			results[i] = session.download(ctx, file)
+			r := results[i]
+			switch {
+			case r.status == download.QueueStatusCompleted && r.cached && !cliCfg.Quiet:
+				session.printf("  ✓ %s (%s) from cache\n", r.path, formatBytes(r.size))
+			case r.status == download.QueueStatusCompleted && cliCfg.Verbose:
+				session.printf("  ✓ %s (%s) from %s\n", r.path, formatBytes(r.size), r.source)
+			case r.status == download.QueueStatusCompleted && !cliCfg.Quiet:
+				session.printf("  ✓ %s (%s)\n", r.path, formatBytes(r.size))
+			case r.status == download.QueueStatusSkipped && !cliCfg.Quiet:
+				session.printf("  - %s: skipped (%v)\n", r.path, r.err)
+			case r.status == download.QueueStatusFailed && ctx.Err() == nil:
+				session.printf("  ✗ %s: %v\n", r.path, r.err)
+			}
+			if r.extracted != nil && !cliCfg.Quiet {
+				session.printf("  ✓ Extracted %d files to %s\n", r.extracted.Files, r.extracted.Dir)
+			}
+			session.notify(ctx, r, time.Since(start))
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "\nMetalink download interrupted\n")
+		return ExitInterrupted
+	}
+
+	// Print summary
+	var completed, failed, skipped int
+	var size int64
+	exitCode := ExitSuccess
+	for _, r := range results {
+		switch r.status {
+		case download.QueueStatusCompleted:
+			completed++
+			size += r.size
+		case download.QueueStatusSkipped:
+			skipped++
+		default:
+			failed++
+			exitCode = max(exitCode, metalinkExitCode(r.err))
+		}
+	}
+	if !cliCfg.Quiet {
+		fmt.Printf("\n")
+		fmt.Printf("Metalink download complete:\n")
+		fmt.Printf("  Total:     %d\n", len(results))
+		fmt.Printf("  Completed: %d (%s)\n", completed, formatBytes(size))
+		fmt.Printf("  Failed:    %d\n", failed)
+		if skipped > 0 {
+			fmt.Printf("  Skipped:   %d\n", skipped)
+		}
+		fmt.Printf("  Time:      %s\n", time.Since(startTime).Round(time.Second))
+	}
+	return exitCode
+}
+
+// metalinkExitCode returns the exit code for a file that failed with err;
+// the highest code of all files is the exit code of the download
+func metalinkExitCode(err error) int {
+	var sigErr *signature.Error
+	var mismatch *engine.ChecksumMismatchError
+	var pieceErr *engine.PieceError
+	switch {
+	case errors.As(err, &sigErr):
+		return ExitSignatureError
+	case errors.As(err, &mismatch), errors.As(err, &pieceErr):
+		return ExitChecksumError
+	}
+	return ExitNetworkError
+}
+
+// download fetches one file of the metalink from its mirrors in order of
+// preference, checking its size, checksum, pieces and signature
+func (s *metalinkSession) download(ctx context.Context, file *metalink.File) metalinkResult {
+	name, _ := protocol.SanitizeRelativePath(file.Name) // Checked before any download
+	result := metalinkResult{
+		path:   filepath.Join(s.cliCfg.OutputDir, name),
+		size:   file.Size,
+		status: download.QueueStatusFailed,
+	}
+
+	collision, err := resolveOutputCollision(s.cliCfg, result.path, file.Size)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if collision.Skip {
+		result.status = download.QueueStatusSkipped
+		result.err = errors.New(collision.Reason)
+		return result
+	}
+	result.path = collision.Path
+
+	urls := file.PreferredURLs(s.locations)
+	if len(urls) == 0 {
+		result.err = errors.New("no download URLs in metalink")
+		return result
+	}
+
+	dlConfig := engine.DefaultConfig()
+	dlConfig.Connections = s.cliCfg.Connections
+	dlConfig.RateLimiter = s.rateLimiter
+	dlConfig.Backoff = s.backoff
+	dlConfig.PartSuffix = s.cliCfg.PartSuffix
+	dlConfig.Allocation = s.allocation
+	dlConfig.ExpectedSize = file.Size
+	dlConfig.Checksum = metalinkChecksum(file)
+	if pv := metalink.NewPieceVerifier(file); pv != nil {
+		dlConfig.Pieces = pv
+		for _, u := range urls {
+			dlConfig.RepairURLs = append(dlConfig.RepairURLs, u.URL)
+		}
+	}
+
+	// A signature in the metalink is checked against --pubkey/--keyring
+	cliCfg := s.cliCfg
+	if file.Signature != nil {
+		cliCfg.SignatureData = strings.TrimSpace(file.Signature.Value)
+	}
+
+	if s.cache != nil {
+		result.source = s.fromCache(ctx, cliCfg, urls, dlConfig.Checksum, result.path)
+		result.cached = result.source != ""
+	}
+
+	for i, u := range urls {
+		if result.cached {
+			break
+		}
+		if i > 0 && s.cliCfg.Verbose {
+			s.printf("  ! %s: %v, trying %s\n", name, result.err, u.URL)
+		}
+		result.source = u.URL
+
+		verifier, err := fetchSignature(ctx, cliCfg, s.client, u.URL, s.keys)
+		if err != nil {
+			result.err = err
+			continue
+		}
+		dlConfig.Signature = nil
+		if verifier != nil {
+			dlConfig.Signature = verifier
+		}
+
+		downloader := engine.NewDownloader(dlConfig, s.client)
+		if s.cliCfg.Verbose {
+			downloader.SetNoticeCallback(func(msg string) {
+				s.printf("  ! %s: %s\n", name, msg)
+			})
+		}
+
+		start := time.Now()
+		result.err = downloader.Download(ctx, u.URL, result.path)
+		recordDownloadMetrics(downloader.GetProgress(), time.Since(start), result.err)
+		if result.err == nil {
+			if s.cache != nil {
+				s.cacheMu.Lock()
+				err := cacheDownload(s.cache, u.URL, result.path, downloader.Metadata(), dlConfig.Checksum)
+				s.cacheMu.Unlock()
+				if err != nil && !s.cliCfg.Quiet {
+					s.printf("  ! %s: could not add to the cache: %v\n", name, err)
+				}
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			return result
+		}
+	}
+	if result.err != nil {
+		return result
+	}
+
+	// Archives are extracted once the download is verified
+	if archive := archiveFormat(s.cliCfg, result.path); archive != extract.FormatNone {
+		result.extracted, result.err = extractDownload(s.cliCfg, result.path, archive, nil, 0)
+		if result.err != nil {
+			return result
+		}
+	}
+	result.status = download.QueueStatusCompleted
+	return result
+}
+
+// fromCache places a cached copy of the file at path when the cache has one
+// for its checksum or one of its mirrors, and returns that mirror. A copy
+// failing the signature is downloaded again.
+func (s *metalinkSession) fromCache(ctx context.Context, cliCfg CLIConfig, urls []metalink.URL, checksum *engine.Checksum, path string) string {
+	for _, u := range urls {
+		hit, _, err := s.cache.Find(ctx, s.client, u.URL, checksum)
+		if err != nil || hit == nil {
+			continue
+		}
+		verifier, err := fetchSignature(ctx, cliCfg, s.client, u.URL, s.keys)
+		if err != nil || verifier != nil && verifier.VerifyFile(hit.Object.Path) != nil {
+			return ""
+		}
+		if s.cache.Materialize(hit.Object, path) != nil {
+			return ""
+		}
+		return u.URL
+	}
+	return ""
+}
+
+// notify runs the completion or error hooks for a file. They run in the
+// file's worker, so they finish before the download exits.
+func (s *metalinkSession) notify(ctx context.Context, r metalinkResult, elapsed time.Duration) {
+	if s.hooks.Count() == 0 || r.status == download.QueueStatusSkipped || ctx.Err() != nil {
+		return
+	}
+
+	var payload *hooks.Payload
+	if r.status == download.QueueStatusCompleted {
+		payload = hooks.CreatePayload(hooks.EventComplete, r.source, filepath.Base(r.path), r.path).
+			WithProgress(r.size, r.size, 0, 100.0).
+			WithDuration(elapsed)
+		if r.extracted != nil {
+			payload.WithExtractDir(r.extracted.Dir)
+		}
+	} else {
+		event := hooks.EventError
+		var sigErr *signature.Error
+		if errors.As(r.err, &sigErr) {
+			event = hooks.EventSignatureFailed
+		}
+		payload = hooks.CreatePayload(event, r.source, filepath.Base(r.path), r.path).
+			WithError(r.err).
+			WithDuration(elapsed)
+	}
+	s.hooks.Execute(ctx, payload)
+}
+
+// runRepairCommand fixes a local copy of the file described by a metalink
+// in place, fetching only the pieces that fail their hashes:
+// burkut repair [-o FILE] [--metalink-select PATTERN] file.meta4
+func runRepairCommand(cliCfg CLIConfig, args []string) int {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	fs.StringVar(&cliCfg.Output, "o", cliCfg.Output, "Local copy of the file (default: its name in the metalink)")
+	fs.StringVar(&cliCfg.Output, "output", cliCfg.Output, "Local copy of the file (default: its name in the metalink)")
+	fs.StringVar(&cliCfg.MetalinkSelect, "metalink-select", cliCfg.MetalinkSelect, "File of the metalink to repair (default: the one named like -o)")
+	fs.BoolVar(&cliCfg.Quiet, "q", cliCfg.Quiet, "Only print errors")
+	fs.BoolVar(&cliCfg.Quiet, "quiet", cliCfg.Quiet, "Only print errors")
+	if err := fs.Parse(args); err != nil {
+		return ExitParseError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: burkut repair [-o FILE] [--metalink-select PATTERN] file.meta4")
+		return ExitParseError
+	}
+
+	ml, err := metalink.ParseFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing metalink file: %v\n", err)
+		return ExitParseError
+	}
+	if len(ml.Files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No files found in metalink")
+		return ExitParseError
+	}
+	// The copy's name picks the file unless it is chosen by pattern
+	patterns := splitList(cliCfg.MetalinkSelect)
+	if len(patterns) == 0 && cliCfg.Output != "" && len(ml.Files) > 1 {
+		patterns = []string{filepath.Base(cliCfg.Output)}
+	}
+	files, err := ml.Select(patterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if len(files) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: %d files of the metalink match; choose one with --metalink-select\n", len(files))
+		return ExitParseError
+	}
+	file := files[0]
+	pv := metalink.NewPieceVerifier(file)
+	if pv == nil || file.Size <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s has no piece hashes to find damaged parts with\n", fs.Arg(0))
+		return ExitParseError
+	}
+
+	if cliCfg.Output == "" {
+		name, err := protocol.SanitizeRelativePath(file.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Unsafe file name in metalink: %v\n", err)
+			return ExitParseError
+		}
+		cliCfg.Output = name
+	}
+	path := determineOutputPath(cliCfg, file.Name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	// A longer copy is refused; a shorter one is only extended when the
+	// pieces it holds verify, so a different file is never overwritten
+	bad, err := engine.FindBadPieces(path, file.Size, pv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		return ExitGeneralError
+	}
+	if info.Size() < file.Size {
+		if len(bad) > 0 && int64(bad[0]+1)*pv.PieceLength() <= info.Size() {
+			fmt.Fprintf(os.Stderr, "Error: %s is shorter than %d bytes and piece %d fails its hash; it is not a copy of %s\n", path, file.Size, bad[0], file.Name)
+			return ExitChecksumError
+		}
+		if err := os.Truncate(path, file.Size); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+	}
+
+	if len(bad) > 0 {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "%s: %d of %d pieces damaged, repairing\n", path, len(bad), pv.PieceCount())
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		cfg, err := loadConfig(cliCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return ExitParseError
+		}
+		httpOpts := buildHTTPOptions(cliCfg, cfg)
+		dialer, err := buildDialer(cliCfg, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitParseError
+		}
+		if dialer != nil {
+			httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+		}
+		httpClient := protocol.NewHTTPClient(httpOpts...)
+		defer httpClient.Close()
+
+		var urls []string
+		for _, u := range file.SortedURLs() {
+			urls = append(urls, u.URL)
+		}
+
+		err = engine.RepairPieces(ctx, httpClient, path, file.Size, pv, bad, urls)
+		var pieceErr *engine.PieceError
+		switch {
+		case ctx.Err() != nil:
+			return ExitInterrupted
+		case errors.As(err, &pieceErr):
+			fmt.Fprintf(os.Stderr, "Error: %v on every mirror\n", err)
+			return ExitChecksumError
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+	}
+
+	// The whole-file checksum confirms the pieces add up to the file
+	if expected := metalinkChecksum(file); expected != nil {
+		actual, err := engine.CalculateChecksum(path, expected.Algorithm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		if actual.Value != expected.Value {
+			fmt.Fprintf(os.Stderr, "Error: Checksum mismatch!\n")
+			fmt.Fprintf(os.Stderr, "  Expected: %s\n", expected.Value)
+			fmt.Fprintf(os.Stderr, "  Actual:   %s\n", actual.Value)
+			return ExitChecksumError
+		}
+	}
+
+	if !cliCfg.Quiet {
+		if len(bad) > 0 {
+			fmt.Printf("%s: repaired %d pieces\n", path, len(bad))
+		} else {
+			fmt.Printf("%s: all %d pieces OK\n", path, pv.PieceCount())
+		}
+	}
+	return ExitSuccess
+}
+
+// runMetalinkCommand handles metalink subcommands:
+// burkut metalink create [--mirror URL]... [--piece-length SIZE] FILE...
+func runMetalinkCommand(cliCfg CLIConfig, args []string) int {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprintln(os.Stderr, "Usage: burkut metalink create [--mirror URL]... [--piece-length SIZE] [--torrent URL] [-o FILE] FILE...")
+		return ExitParseError
+	}
+
+	var mirrors stringList
+	fs := flag.NewFlagSet("metalink create", flag.ContinueOnError)
+	fs.Var(&mirrors, "mirror", "URL prefix the files are served under (repeatable, in order of priority)")
+	pieceLengthStr := fs.String("piece-length", "", "Piece length, e.g. 1M (default: from the file size)")
+	algorithmName := fs.String("a", string(engine.AlgorithmSHA256), "Algorithm: md5, sha1, sha256, sha512")
+	torrent := fs.String("torrent", "", "URL of a torrent of the files, added as a metaurl")
+	output := fs.String("o", "", "Write the metalink to FILE instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return ExitParseError
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: burkut metalink create [--mirror URL]... [--piece-length SIZE] [--torrent URL] [-o FILE] FILE...")
+		return ExitParseError
+	}
+
+	var pieceLength int64
+	if *pieceLengthStr != "" {
+		length, err := config.ParseBandwidth(*pieceLengthStr)
+		if err != nil || length <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: Invalid piece length %q\n", *pieceLengthStr)
+			return ExitParseError
+		}
+		pieceLength = length
+	}
+	algorithm := engine.ChecksumAlgorithm(strings.ToLower(*algorithmName))
+
+	ml := &metalink.Metalink{Generator: "Burkut/" + version.Version}
+	seen := make(map[string]bool)
+	for _, path := range fs.Args() {
+		name := filepath.Base(path)
+		if seen[name] {
+			fmt.Fprintf(os.Stderr, "Error: More than one file named %s\n", name)
+			return ExitParseError
+		}
+		seen[name] = true
+
+		file, err := metalink.CreateFile(path, name, algorithm, pieceLength)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		file.AddMirrors(mirrors)
+		if *torrent != "" {
+			metaURL := metalink.MetaURL{MediaType: "torrent", URL: *torrent}
+			// A torrent of several files names the file it holds
+			if fs.NArg() > 1 {
+				metaURL.Name = name
+			}
+			file.MetaURLs = append(file.MetaURLs, metaURL)
+		}
+		ml.Files = append(ml.Files, *file)
+	}
+
+	data, err := metalink.Marshal(ml)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return ExitSuccess
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "Wrote %s (%d files)\n", *output, len(ml.Files))
+	}
+	return ExitSuccess
+}
+
+// min returns the minimum of two integers
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// isFTPURL checks if URL is FTP or FTPS
+func isFTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "ftp" || scheme == "ftps"
+}
+
+// runFTPDownload handles FTP/FTPS downloads
+func runFTPDownload(cliCfg CLIConfig, rawURL string) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Setup signal handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		fmt.Fprintln(os.Stderr, "\nInterrupted...")
+		cancel()
+	}()
+
+	// Parse URL to check scheme
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid URL: %v\n", err)
+		return ExitParseError
+	}
+
+	// Build FTP client options
+	ftpOpts := []protocol.FTPClientOption{
+		protocol.WithFTPTimeout(cliCfg.Timeout),
+	}
+
+	// Enable TLS for ftps:// scheme
+	if strings.ToLower(parsedURL.Scheme) == "ftps" {
+		// Check if using implicit FTPS port (990)
+		port := parsedURL.Port()
+		if port == "990" || port == "" {
+			// Default FTPS port or explicit 990 = implicit TLS
+			ftpOpts = append(ftpOpts, protocol.WithFTPSImplicit(true))
+			if cliCfg.Verbose {
+				fmt.Fprintln(os.Stderr, "Using implicit FTPS (port 990)")
+			}
+		} else {
+			// Explicit FTPS (AUTH TLS) on non-standard port
+			ftpOpts = append(ftpOpts, protocol.WithFTPS(true))
+			if cliCfg.Verbose {
+				fmt.Fprintln(os.Stderr, "Using explicit FTPS (AUTH TLS)")
+			}
+		}
+		if cliCfg.NoCheckCert {
+			ftpOpts = append(ftpOpts, protocol.WithFTPSkipTLSVerify(true))
+		}
+	}
+
+	// Handle authentication from URL or CLI
 	if parsedURL.User != nil {
 		username := parsedURL.User.Username()
 		password, _ := parsedURL.User.Password()
@@ -1829,139 +3962,947 @@ func runFTPDownload(cliCfg CLIConfig, rawURL string) int {
 		}
 	}
 
-	// Create FTP client
-	ftpClient := protocol.NewFTPClient(ftpOpts...)
+	// Network endpoints
+	dialer, err := buildDialer(cliCfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if dialer != nil {
+		ftpOpts = append(ftpOpts, protocol.WithFTPDialer(dialer))
+	}
+
+	// Create FTP client
+	ftpClient := protocol.NewFTPClient(ftpOpts...)
+
+	// Get file info
+	if cliCfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Connecting to %s\n", parsedURL.Host)
+	}
+
+	meta, err := ftpClient.Head(ctx, rawURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to get file info: %v\n", err)
+		return ExitNetworkError
+	}
+
+	// Determine output path
+	outputPath := determineOutputPath(cliCfg, meta.Filename)
+
+	// Apply existing file policy
+	collision, err := resolveOutputCollision(cliCfg, outputPath, meta.ContentLength)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if collision.Skip {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
+		}
+		return ExitSuccess
+	}
+	outputPath = collision.Path
+
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "File: %s\n", meta.Filename)
+		fmt.Fprintf(os.Stderr, "Size: %s\n", formatBytes(meta.ContentLength))
+		if !meta.LastModified.IsZero() {
+			fmt.Fprintf(os.Stderr, "Modified: %s\n", meta.LastModified.Format(time.RFC1123))
+		}
+		fmt.Fprintf(os.Stderr, "Saving to: %s\n", outputPath)
+		fmt.Fprintln(os.Stderr)
+	}
+
+	// Fail now rather than near the end if the file cannot fit
+	partPath := storage.PartPath(outputPath, cliCfg.PartSuffix)
+	if err := storage.CheckFreeSpace(partPath, meta.ContentLength); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	var expectedChecksum *engine.Checksum
+	if cliCfg.Checksum != "" {
+		expectedChecksum, err = engine.ParseChecksumAuto(cliCfg.Checksum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid checksum: %v\n", err)
+			return ExitChecksumError
+		}
+	}
+
+	// Download file
+	reader, _, err := ftpClient.Get(ctx, rawURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to download: %v\n", err)
+		return ExitNetworkError
+	}
+	defer reader.Close()
+
+	// Create output file under a temporary name until it is complete and verified
+	outFile, err := os.Create(partPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create file: %v\n", err)
+		return ExitGeneralError
+	}
+	defer outFile.Close()
+
+	// The file is hashed as it is written instead of being read again
+	var out io.Writer = outFile
+	var checksumWriter *engine.ChecksumWriter
+	if expectedChecksum != nil {
+		checksumWriter, err = engine.NewChecksumWriter(outFile, expectedChecksum.Algorithm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid checksum: %v\n", err)
+			return ExitChecksumError
+		}
+		out = checksumWriter
+	}
+
+	// Copy with progress
+	startTime := time.Now()
+	var downloaded int64
+	showProgress := cliCfg.Progress != "none" && !cliCfg.Quiet
+	lastProgressTime := time.Time{}
+
+	buf := make([]byte, 32*1024)
+	for {
+		select {
+		case <-ctx.Done():
+			return ExitInterrupted
+		default:
+		}
+
+		n, err := reader.Read(buf)
+		if n > 0 {
+			_, writeErr := out.Write(buf[:n])
+			if writeErr != nil {
+				fmt.Fprintf(os.Stderr, "\nError writing file: %v\n", writeErr)
+				return ExitGeneralError
+			}
+			downloaded += int64(n)
+
+			// Show progress every 100ms
+			if showProgress && time.Since(lastProgressTime) > 100*time.Millisecond {
+				lastProgressTime = time.Now()
+				elapsed := time.Since(startTime)
+				speed := int64(0)
+				if elapsed.Seconds() > 0 {
+					speed = int64(float64(downloaded) / elapsed.Seconds())
+				}
+				percent := float64(downloaded) / float64(meta.ContentLength) * 100
+				fmt.Fprintf(os.Stderr, "\r%s / %s (%.1f%%) %s/s    ",
+					formatBytes(downloaded),
+					formatBytes(meta.ContentLength),
+					percent,
+					formatBytes(speed))
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading: %v\n", err)
+			return ExitNetworkError
+		}
+	}
+
+	if showProgress {
+		fmt.Fprintln(os.Stderr) // New line after progress
+	}
+
+	if err := outFile.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to sync file: %v\n", err)
+		return ExitGeneralError
+	}
+	outFile.Close()
+
+	// Print summary
+	if !cliCfg.Quiet {
+		elapsed := time.Since(startTime)
+		speed := int64(float64(downloaded) / elapsed.Seconds())
+		fmt.Fprintf(os.Stderr, "\nDownloaded %s in %s (%s/s)\n",
+			formatBytes(downloaded),
+			elapsed.Round(time.Millisecond),
+			formatBytes(speed))
+	}
+
+	// Verify checksum if specified
+	if expectedChecksum != nil {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Verifying checksum...")
+		}
+
+		if checksumWriter.Checksum().Value != expectedChecksum.Value {
+			fmt.Fprintf(os.Stderr, " FAILED!\n")
+			storage.RemoveFile(partPath)
+			return ExitChecksumError
+		}
+
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, " OK\n")
+		}
+	}
+
+	if err := engine.SetFileModTime(partPath, meta.LastModified); err != nil && cliCfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: Could not set file modification time: %v\n", err)
+	}
+	if err := storage.CommitFile(partPath, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	if err := pipeFile(ctx, cliCfg, outputPath, rawURL, meta.Filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitPipeError
+	}
+
+	if archive := archiveFormat(cliCfg, outputPath); archive != extract.FormatNone {
+		extracted, err := extractDownload(cliCfg, outputPath, archive, nil, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		if !cliCfg.Quiet {
+			fmt.Printf("Extracted %d files to %s\n", extracted.Files, extracted.Dir)
+		}
+	}
+
+	return ExitSuccess
+}
+
+// runCacheHit places the cached copy of url in the output directory instead
+// of downloading it
+func runCacheHit(ctx context.Context, cliCfg CLIConfig, c *cache.Cache, url string, hit *cache.Hit, verifier *signature.Verifier) int {
+	filename := hit.Filename
+	if filename == "" {
+		filename = protocol.FilenameFromURL(url)
+	}
+	outputPath := determineOutputPath(cliCfg, filename)
+
+	collision, err := resolveOutputCollision(cliCfg, outputPath, hit.Object.Size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if collision.Skip {
+		if !cliCfg.Quiet {
+			fmt.Printf("File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
+		}
+		return ExitSuccess
+	}
+	outputPath = collision.Path
+
+	if cliCfg.Verbose {
+		how := "checksum"
+		if hit.Revalidated {
+			how = "server validators"
+		}
+		fmt.Fprintf(os.Stderr, "Cache hit by %s: %s\n", how, hit.Object.SHA256)
+	}
+
+	hookManager := setupHooks(cliCfg)
+	if verifier != nil {
+		if err := verifier.VerifyFile(hit.Object.Path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if hookManager.Count() > 0 {
+				payload := hooks.CreatePayload(hooks.EventSignatureFailed, url, filename, outputPath).WithError(err)
+				hookManager.ExecuteAsync(ctx, payload)
+			}
+			return ExitSignatureError
+		}
+	}
+
+	if err := c.Materialize(hit.Object, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	if err := pipeFile(ctx, cliCfg, outputPath, url, filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitPipeError
+	}
+
+	var extracted *extract.Result
+	if archive := archiveFormat(cliCfg, outputPath, filename); archive != extract.FormatNone {
+		extracted, err = extractDownload(cliCfg, outputPath, archive, nil, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if hookManager.Count() > 0 {
+				payload := hooks.CreatePayload(hooks.EventError, url, filename, outputPath).WithError(err)
+				hookManager.ExecuteAsync(ctx, payload)
+			}
+			return ExitGeneralError
+		}
+	}
+
+	if hookManager.Count() > 0 {
+		payload := hooks.CreatePayload(hooks.EventComplete, url, filename, outputPath).
+			WithProgress(hit.Object.Size, hit.Object.Size, 0, 100)
+		if extracted != nil {
+			payload.WithExtractDir(extracted.Dir)
+		}
+		hookManager.ExecuteAsync(ctx, payload)
+	}
+
+	if !cliCfg.Quiet {
+		fmt.Printf("Using cached copy: %s (%s)\n", outputPath, ui.FormatBytes(hit.Object.Size))
+		if extracted != nil {
+			fmt.Printf("Extracted %d files (%s) to %s\n", extracted.Files, ui.FormatBytes(extracted.Bytes), extracted.Dir)
+		}
+	}
+	return ExitSuccess
+}
+
+// runCacheCommand runs the cache maintenance commands: ls, prune and verify
+func runCacheCommand(cliCfg CLIConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: burkut cache ls|prune|verify [--cache-dir DIR] [--max-size SIZE]")
+		return ExitParseError
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ContinueOnError)
+	fs.StringVar(&cliCfg.CacheDir, "cache-dir", cliCfg.CacheDir, "Cache directory")
+	fs.StringVar(&cliCfg.CacheMaxSize, "cache-max-size", cliCfg.CacheMaxSize, "Size cap of the cache")
+	maxSize := fs.String("max-size", "", "Size to prune the cache down to (default: --cache-max-size, else empty it)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return ExitParseError
+	}
+
+	if cliCfg.CacheDir == "" {
+		fmt.Fprintln(os.Stderr, "Error: no cache directory, use --cache-dir")
+		return ExitParseError
+	}
+	c, err := openCache(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
+	switch args[0] {
+	case "ls":
+		objects, err := c.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		for _, obj := range objects {
+			fmt.Printf("%s  %10s  %s\n", obj.SHA256[:16], ui.FormatBytes(obj.Size), obj.LastUsed.Format("2006-01-02 15:04"))
+		}
+		fmt.Printf("%d files, %s\n", len(objects), ui.FormatBytes(cache.Size(objects)))
+
+	case "prune":
+		if *maxSize == "" {
+			*maxSize = cliCfg.CacheMaxSize
+		}
+		limit, err := config.ParseBandwidth(*maxSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --max-size: %v\n", err)
+			return ExitParseError
+		}
+		removed, err := c.Prune(limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		fmt.Printf("Removed %d files (%s)\n", len(removed), ui.FormatBytes(cache.Size(removed)))
+
+	case "verify":
+		damaged, err := c.Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		for _, obj := range damaged {
+			fmt.Printf("Removed damaged file %s\n", obj.SHA256)
+		}
+		if len(damaged) > 0 {
+			return ExitChecksumError
+		}
+		fmt.Println("Cache OK")
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown cache command %q (use ls, prune or verify)\n", args[0])
+		return ExitParseError
+	}
+	return ExitSuccess
+}
+
+// interruptContext returns a context cancelled on SIGINT or SIGTERM
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigChan:
+			fmt.Fprintln(os.Stderr, "\nInterrupted...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigChan)
+	}()
+	return ctx, cancel
+}
+
+// runVerifyCommand checks the files of a directory against its checksum
+// manifests: burkut verify [-c SHA256SUMS] [DIR]
+func runVerifyCommand(cliCfg CLIConfig, args []string) int {
+	var manifests stringList
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.Var(&manifests, "c", "Checksum manifest (repeatable; default: SHA256SUMS and the like in DIR)")
+	report := fs.String("report", "", "Write a JSON report to FILE (- for standard output)")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "Files verified in parallel")
+	ignoreMissing := fs.Bool("ignore-missing", false, "Do not fail for files that are not present")
+	fs.BoolVar(&cliCfg.Quiet, "q", cliCfg.Quiet, "Only print files that failed")
+	fs.BoolVar(&cliCfg.Quiet, "quiet", cliCfg.Quiet, "Only print files that failed")
+	if err := fs.Parse(args); err != nil {
+		return ExitParseError
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: burkut verify [-c MANIFEST] [--report FILE] [--jobs N] [--ignore-missing] [DIR]")
+		return ExitParseError
+	}
+
+	// Files are relative to DIR, else to the directory of the manifest
+	dir := fs.Arg(0)
+	if dir == "" {
+		dir = "."
+		if len(manifests) > 0 {
+			dir = filepath.Dir(manifests[0])
+		}
+	}
+	if len(manifests) == 0 {
+		manifests = manifest.Find(dir)
+		if len(manifests) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no checksum manifest (%s) in %s, use -c\n", strings.Join(manifest.Names, ", "), dir)
+			return ExitParseError
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	// The text output moves to standard error when the report takes standard output
+	out := os.Stdout
+	if *report == "-" {
+		out = os.Stderr
+	}
+
+	result := manifest.Report{Dir: dir, Manifests: manifests}
+	for _, path := range manifests {
+		entries, err := manifest.ParseFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitParseError
+		}
+
+		results := manifest.Verify(ctx, dir, path, entries, *jobs, func(r manifest.Result) {
+			if r.Status == manifest.StatusOK && cliCfg.Quiet {
+				return
+			}
+			if r.Error != "" {
+				fmt.Fprintf(out, "%s: %s (%s)\n", r.Path, r.Status, r.Error)
+			} else {
+				fmt.Fprintf(out, "%s: %s\n", r.Path, r.Status)
+			}
+		})
+		result.Tally(results)
+		if ctx.Err() != nil {
+			return ExitInterrupted
+		}
+	}
+
+	if *report != "" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		data = append(data, '\n')
+		if *report == "-" {
+			os.Stdout.Write(data)
+		} else if err := os.WriteFile(*report, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing report: %v\n", err)
+			return ExitGeneralError
+		}
+	}
+
+	if !cliCfg.Quiet || !result.Passed(*ignoreMissing) {
+		fmt.Fprintf(os.Stderr, "%d OK, %d FAILED, %d MISSING, %d unreadable\n",
+			result.OK, result.Failed, result.Missing, result.Errors)
+	}
+	if !result.Passed(*ignoreMissing) {
+		return ExitChecksumError
+	}
+	return ExitSuccess
+}
+
+// runChecksumCommand prints or writes a checksum manifest of files and
+// directories: burkut checksum [-a ALG] [--tag] [--write] [PATH...]
+func runChecksumCommand(cliCfg CLIConfig, args []string) int {
+	fs := flag.NewFlagSet("checksum", flag.ContinueOnError)
+	algorithmName := fs.String("a", string(engine.AlgorithmSHA256), "Algorithm: md5, sha1, sha256, sha512, blake3")
+	tag := fs.Bool("tag", false, "Write BSD-style lines: SHA256 (file) = ...")
+	write := fs.Bool("write", false, "Write the manifest (SHA256SUMS, B3SUMS, ...) into DIR instead of printing it")
+	output := fs.String("o", "", "Manifest file written by --write")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "Files hashed in parallel")
+	if err := fs.Parse(args); err != nil {
+		return ExitParseError
+	}
+
+	algorithm := engine.ChecksumAlgorithm(strings.ToLower(*algorithmName))
+	if _, err := engine.NewHasher(algorithm); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+
+	// A single directory is the base the listed paths are relative to
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	base := "."
+	if info, err := os.Stat(paths[0]); len(paths) == 1 && err == nil && info.IsDir() {
+		base = paths[0]
+		paths = nil
+	}
+
+	manifestPath := *output
+	if manifestPath == "" {
+		manifestPath = filepath.Join(base, manifest.DefaultName(algorithm))
+	}
+
+	var files []string
+	if paths == nil {
+		found, err := manifest.Files(base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		files = found
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		if !info.IsDir() {
+			files = append(files, filepath.ToSlash(path))
+			continue
+		}
+		found, err := manifest.Files(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		for _, f := range found {
+			files = append(files, filepath.ToSlash(filepath.Join(path, f)))
+		}
+	}
+
+	// A manifest with a custom name must not list itself
+	if *write {
+		kept := files[:0]
+		for _, f := range files {
+			if !sameFile(filepath.Join(base, f), manifestPath) {
+				kept = append(kept, f)
+			}
+		}
+		files = kept
+	}
 
-	// Get file info
-	if cliCfg.Verbose {
-		fmt.Fprintf(os.Stderr, "Connecting to %s\n", parsedURL.Host)
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if *write {
+		if err := manifest.Write(ctx, manifestPath, base, files, algorithm, *tag, *jobs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
+		}
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "Wrote %s (%d files)\n", manifestPath, len(files))
+		}
+		return ExitSuccess
 	}
 
-	meta, err := ftpClient.Head(ctx, rawURL)
+	lines, err := manifest.Lines(ctx, base, files, algorithm, *tag, *jobs)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to get file info: %v\n", err)
-		return ExitNetworkError
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	for _, line := range lines {
+		fmt.Println(line)
 	}
+	return ExitSuccess
+}
 
-	// Determine output path
-	outputPath := determineOutputPath(cliCfg, meta.Filename)
+// sameFile reports whether two paths name the same existing file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
 
-	if !cliCfg.Quiet {
-		fmt.Fprintf(os.Stderr, "File: %s\n", meta.Filename)
-		fmt.Fprintf(os.Stderr, "Size: %s\n", formatBytes(meta.ContentLength))
-		if !meta.LastModified.IsZero() {
-			fmt.Fprintf(os.Stderr, "Modified: %s\n", meta.LastModified.Format(time.RFC1123))
+// runZsyncDownload rebuilds the target of a zsync control file from the
+// --seed-file copies and the existing output file, fetching only the blocks
+// they lack. For a plain URL the control file is looked for at URL.zsync; if
+// there is none, the file is downloaded normally.
+func runZsyncDownload(cliCfg CLIConfig, source string) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		fmt.Fprintln(os.Stderr, "\nInterrupted...")
+		cancel()
+	}()
+
+	cfg, err := loadConfig(cliCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return ExitParseError
+	}
+
+	var expectedChecksum *engine.Checksum
+	if cliCfg.Checksum != "" {
+		expectedChecksum, err = engine.ParseChecksumAuto(cliCfg.Checksum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid checksum format: %v\n", err)
+			return ExitParseError
 		}
-		fmt.Fprintf(os.Stderr, "Saving to: %s\n", outputPath)
-		fmt.Fprintln(os.Stderr)
 	}
 
-	// Download file
-	reader, _, err := ftpClient.Get(ctx, rawURL)
+	signatureKeys, err := loadSignatureKeys(cliCfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to download: %v\n", err)
-		return ExitNetworkError
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
-	defer reader.Close()
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	httpOpts := buildHTTPOptions(cliCfg, cfg)
+	dialer, err := buildDialer(cliCfg, nil)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to create file: %v\n", err)
-		return ExitGeneralError
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
 	}
-	defer outFile.Close()
+	if dialer != nil {
+		httpOpts = append(httpOpts, protocol.WithDialer(dialer))
+	}
+	httpClient := protocol.NewHTTPClient(httpOpts...)
+	defer httpClient.Close()
 
-	// Copy with progress
-	startTime := time.Now()
-	var downloaded int64
-	showProgress := cliCfg.Progress != "none" && !cliCfg.Quiet
-	lastProgressTime := time.Time{}
+	// Load the control file
+	controlURL := source
+	if !zsync.IsZsync(source) {
+		controlURL = source + ".zsync"
+	}
+	ctl, err := loadZsyncControl(ctx, httpClient, controlURL)
+	if err != nil {
+		if controlURL != source {
+			if !cliCfg.Quiet {
+				fmt.Fprintf(os.Stderr, "No zsync file for %s (%v), downloading the whole file\n", source, err)
+			}
+			return runDownload(cliCfg, source)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
 
-	buf := make([]byte, 32*1024)
-	for {
-		select {
-		case <-ctx.Done():
-			return ExitInterrupted
-		default:
+	targetURL := source
+	if controlURL == source {
+		if targetURL, err = ctl.TargetURL(controlURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitParseError
 		}
+	}
 
-		n, err := reader.Read(buf)
-		if n > 0 {
-			_, writeErr := outFile.Write(buf[:n])
-			if writeErr != nil {
-				fmt.Fprintf(os.Stderr, "\nError writing file: %v\n", writeErr)
-				return ExitGeneralError
-			}
-			downloaded += int64(n)
+	verifier, err := fetchSignature(ctx, cliCfg, httpClient, targetURL, signatureKeys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitSignatureError
+	}
 
-			// Show progress every 100ms
-			if showProgress && time.Since(lastProgressTime) > 100*time.Millisecond {
-				lastProgressTime = time.Now()
-				elapsed := time.Since(startTime)
-				speed := int64(0)
-				if elapsed.Seconds() > 0 {
-					speed = int64(float64(downloaded) / elapsed.Seconds())
-				}
-				percent := float64(downloaded) / float64(meta.ContentLength) * 100
-				fmt.Fprintf(os.Stderr, "\r%s / %s (%.1f%%) %s/s    ",
-					formatBytes(downloaded),
-					formatBytes(meta.ContentLength),
-					percent,
-					formatBytes(speed))
-			}
+	filename := protocol.SanitizeFilename(ctl.Filename)
+	if filename == "" {
+		filename = protocol.FilenameFromURL(targetURL)
+	}
+	outputPath := determineOutputPath(cliCfg, filename)
+
+	// An existing copy of the file is the most likely seed
+	seeds := append([]string(nil), cliCfg.SeedFiles...)
+	if info, err := os.Stat(outputPath); err == nil && info.Mode().IsRegular() {
+		seeds = append(seeds, outputPath)
+	}
+
+	collision, err := resolveOutputCollision(cliCfg, outputPath, ctl.Length)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitParseError
+	}
+	if collision.Skip {
+		if !cliCfg.Quiet {
+			fmt.Fprintf(os.Stderr, "File '%s' already exists, skipping download (%s).\n", outputPath, collision.Reason)
 		}
+		return ExitSuccess
+	}
+	outputPath = collision.Path
 
-		if err == io.EOF {
-			break
+	// The old file is read while the new one is written, so never write in place
+	partPath := storage.PartPath(outputPath, cliCfg.PartSuffix)
+	if partPath == outputPath {
+		partPath = storage.PartPath(outputPath, storage.DefaultPartSuffix)
+	}
+	if err := storage.CheckFreeSpace(partPath, ctl.Length); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	// The part file is truncated below, so it cannot be a seed
+	usable := seeds[:0]
+	for _, seed := range seeds {
+		if sameFile(seed, partPath) {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping seed file %s: it is the file being written\n", seed)
+			continue
+		}
+		usable = append(usable, seed)
+	}
+	seeds = usable
+
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create directory: %v\n", err)
+		return ExitGeneralError
+	}
+	out, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create file: %v\n", err)
+		return ExitGeneralError
+	}
+	defer out.Close()
+	if err := out.Truncate(ctl.Length); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	// Take what the seeds have, then fetch the rest
+	asm := zsync.NewAssembler(ctl, out)
+	for _, seed := range seeds {
+		f, err := os.Open(seed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping seed file: %v\n", err)
+			continue
 		}
+		supplied, err := asm.Seed(f)
+		f.Close()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nError reading: %v\n", err)
-			return ExitNetworkError
+			fmt.Fprintf(os.Stderr, "Warning: Seed file %s: %v\n", seed, err)
+		}
+		if cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Seed %s: %s usable\n", seed, ui.FormatBytes(supplied))
 		}
 	}
 
-	if showProgress {
-		fmt.Fprintln(os.Stderr) // New line after progress
+	reused := asm.Have()
+	missing := ctl.Length - reused
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "File: %s (%s)\n", filename, ui.FormatBytes(ctl.Length))
+		fmt.Fprintf(os.Stderr, "Reusing %s from local copies, fetching %s in %d ranges\n",
+			ui.FormatBytes(reused), ui.FormatBytes(missing), len(asm.Missing()))
 	}
 
-	// Print summary
-	if !cliCfg.Quiet {
-		elapsed := time.Since(startTime)
-		speed := int64(float64(downloaded) / elapsed.Seconds())
-		fmt.Fprintf(os.Stderr, "\nDownloaded %s in %s (%s/s)\n",
-			formatBytes(downloaded),
-			elapsed.Round(time.Millisecond),
-			formatBytes(speed))
+	startTime := time.Now()
+	var progress func(n int64)
+	if cliCfg.Progress != "none" && !cliCfg.Quiet {
+		var mu sync.Mutex
+		var fetched int64
+		var lastPrint time.Time
+		progress = func(n int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched += n
+			if time.Since(lastPrint) >= 100*time.Millisecond || fetched == missing {
+				lastPrint = time.Now()
+				fmt.Fprintf(os.Stderr, "\r  %s / %s", ui.FormatBytes(fetched), ui.FormatBytes(missing))
+			}
+		}
 	}
 
-	// Verify checksum if specified
-	if cliCfg.Checksum != "" {
-		expectedChecksum, err := engine.ParseChecksumAuto(cliCfg.Checksum)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Invalid checksum: %v\n", err)
+	hookManager := setupHooks(cliCfg)
+	err = asm.Fetch(ctx, httpClient, targetURL, cliCfg.Connections, progress)
+	if progress != nil && missing > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		storage.RemoveFile(partPath)
+		if hookManager.Count() > 0 {
+			payload := hooks.CreatePayload(hooks.EventError, targetURL, filename, outputPath).WithError(err)
+			hookManager.ExecuteAsync(ctx, payload)
+		}
+		if ctx.Err() == context.Canceled {
+			return ExitInterrupted
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitNetworkError
+	}
+
+	// The rebuilt file must match the checksum of the whole target
+	checksums := []*engine.Checksum{expectedChecksum}
+	if ctl.SHA1 != "" {
+		checksums = append(checksums, &engine.Checksum{Algorithm: engine.AlgorithmSHA1, Value: ctl.SHA1})
+	}
+	for _, sum := range checksums {
+		if sum == nil {
+			continue
+		}
+		valid, err := engine.VerifyChecksum(partPath, sum)
+		if err != nil || !valid {
+			storage.RemoveFile(partPath)
+			fmt.Fprintf(os.Stderr, "Error: Checksum mismatch for %s (%s)\n", filename, sum.Algorithm)
 			return ExitChecksumError
 		}
+		if cliCfg.Verbose {
+			fmt.Fprintf(os.Stderr, "Checksum verified: %s\n", sum.Algorithm)
+		}
+	}
 
+	if verifier != nil {
+		if err := verifier.VerifyFile(partPath); err != nil {
+			storage.RemoveFile(partPath)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if hookManager.Count() > 0 {
+				payload := hooks.CreatePayload(hooks.EventSignatureFailed, targetURL, filename, outputPath).WithError(err)
+				hookManager.ExecuteAsync(ctx, payload)
+			}
+			return ExitSignatureError
+		}
 		if !cliCfg.Quiet {
-			fmt.Fprintf(os.Stderr, "Verifying checksum...")
+			fmt.Fprintf(os.Stderr, "Signature verified: %s\n", verifier.Signer())
 		}
+	}
+
+	if err := engine.SetFileModTime(partPath, ctl.MTime); err != nil && cliCfg.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: Could not set file modification time: %v\n", err)
+	}
+	if err := storage.CommitFile(partPath, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+
+	if err := pipeFile(ctx, cliCfg, outputPath, targetURL, filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitPipeError
+	}
 
-		valid, err := engine.VerifyChecksum(outputPath, expectedChecksum)
+	var extracted *extract.Result
+	if archive := archiveFormat(cliCfg, outputPath); archive != extract.FormatNone {
+		extracted, err = extractDownload(cliCfg, outputPath, archive, nil, 0)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, " error: %v\n", err)
-			return ExitChecksumError
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitGeneralError
 		}
+	}
 
-		if !valid {
-			fmt.Fprintf(os.Stderr, " FAILED!\n")
-			return ExitChecksumError
+	elapsed := time.Since(startTime)
+	if hookManager.Count() > 0 {
+		payload := hooks.CreatePayload(hooks.EventComplete, targetURL, filename, outputPath).
+			WithProgress(ctl.Length, ctl.Length, 0, 100).
+			WithDuration(elapsed)
+		if extracted != nil {
+			payload.WithExtractDir(extracted.Dir)
 		}
+		hookManager.ExecuteAsync(ctx, payload)
+	}
 
-		if !cliCfg.Quiet {
-			fmt.Fprintf(os.Stderr, " OK\n")
+	if !cliCfg.Quiet {
+		fmt.Printf("Download complete: %s (%s, %s fetched)\n", outputPath, ui.FormatBytes(ctl.Length), ui.FormatBytes(missing))
+		if extracted != nil {
+			fmt.Printf("Extracted %d files (%s) to %s\n", extracted.Files, ui.FormatBytes(extracted.Bytes), extracted.Dir)
+		}
+	}
+	return ExitSuccess
+}
+
+// runZsyncCommand handles zsync subcommands:
+// burkut zsync make [-u URL] [--block-size SIZE] [-o FILE] FILE
+func runZsyncCommand(cliCfg CLIConfig, args []string) int {
+	const usage = "Usage: burkut zsync make [-u URL] [--block-size SIZE] [-o FILE] FILE"
+	if len(args) == 0 || args[0] != "make" {
+		fmt.Fprintln(os.Stderr, usage)
+		return ExitParseError
+	}
+
+	fs := flag.NewFlagSet("zsync make", flag.ContinueOnError)
+	targetURL := fs.String("u", "", "URL of the target file, absolute or relative to the control file")
+	blockSizeStr := fs.String("block-size", "", "Block size, e.g. 8K (default: 4K)")
+	output := fs.String("o", "", "Write the control file to FILE (default: FILE.zsync)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return ExitParseError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		return ExitParseError
+	}
+	path := fs.Arg(0)
+
+	var blockSize int
+	if *blockSizeStr != "" {
+		size, err := config.ParseBandwidth(*blockSizeStr)
+		if err != nil || size <= 0 || size > math.MaxInt32 {
+			fmt.Fprintf(os.Stderr, "Error: Invalid block size %q\n", *blockSizeStr)
+			return ExitParseError
 		}
+		blockSize = int(size)
+	}
+
+	ctl, err := zsync.Generate(path, blockSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	// By default the target is served next to its control file
+	ctl.URLs = []string{ctl.Filename}
+	if *targetURL != "" {
+		ctl.URLs = []string{*targetURL}
 	}
 
+	outPath := *output
+	if outPath == "" {
+		outPath = ctl.Filename + ".zsync"
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitGeneralError
+	}
+	if _, err := ctl.WriteTo(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", outPath, err)
+		return ExitGeneralError
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", outPath, err)
+		return ExitGeneralError
+	}
+	if !cliCfg.Quiet {
+		fmt.Fprintf(os.Stderr, "Wrote %s (%d blocks of %s)\n", outPath, len(ctl.Blocks), formatBytes(int64(ctl.BlockSize)))
+	}
 	return ExitSuccess
 }
+
+// loadZsyncControl reads a zsync control file from a URL or a local path
+func loadZsyncControl(ctx context.Context, client *protocol.HTTPClient, source string) (*zsync.Control, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return zsync.ParseFile(source)
+	}
+
+	body, _, err := client.Get(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("fetching zsync file: %w", err)
+	}
+	defer body.Close()
+	return zsync.Parse(body)
+}
@@ -14,7 +14,14 @@ _burkut() {
           -h --help -V --version --limit-rate --checksum --proxy
           --no-check-certificate --config --profile --init-config
           -i --input-file --on-complete --on-error --webhook
-          --mirrors --http3 --netrc -u --user -H --header"
+          --mirrors --http3 --netrc -u --user -H --header
+          --resolve --connect-to -4 --ipv4 -6 --ipv6 --interface
+          --part-suffix --file-allocation --extract --strip-components
+          --remove-archive --cache-dir --cache-max-size --seed-file
+          --pipe-to --signature --pubkey --keyring
+          --metalink-location --metalink-select --metalink-jobs --metalink-peer-timeout
+          --select-file --file-priority --show-files --seed --seed-ratio
+          --seed-time --upload-limit"
 
     # Handle options that require arguments
     case "${prev}" in
@@ -22,7 +29,7 @@ _burkut() {
             COMPREPLY=( $(compgen -f -- "${cur}") )
             return 0
             ;;
-        -P|--output-dir)
+        -P|--output-dir|--cache-dir)
             COMPREPLY=( $(compgen -d -- "${cur}") )
             return 0
             ;;
@@ -38,7 +45,7 @@ _burkut() {
             COMPREPLY=( $(compgen -W "bar minimal json none" -- "${cur}") )
             return 0
             ;;
-        --limit-rate)
+        --limit-rate|--upload-limit)
             COMPREPLY=( $(compgen -W "100K 500K 1M 5M 10M 50M 100M" -- "${cur}") )
             return 0
             ;;
@@ -46,6 +53,14 @@ _burkut() {
             COMPREPLY=( $(compgen -W "md5: sha1: sha256: sha512: blake3:" -- "${cur}") )
             return 0
             ;;
+        --file-allocation)
+            COMPREPLY=( $(compgen -W "none sparse falloc trunc" -- "${cur}") )
+            return 0
+            ;;
+        --strip-components)
+            COMPREPLY=( $(compgen -W "0 1 2 3" -- "${cur}") )
+            return 0
+            ;;
         --proxy)
             COMPREPLY=( $(compgen -W "http:// https:// socks5://" -- "${cur}") )
             return 0
@@ -69,7 +84,15 @@ _burkut() {
             COMPREPLY=( $(compgen -f -X "!*.txt" -- "${cur}") $(compgen -f -X "!*.url" -- "${cur}") )
             return 0
             ;;
-        --on-complete|--on-error)
+        --seed-file|--pubkey|--keyring)
+            COMPREPLY=( $(compgen -f -- "${cur}") )
+            return 0
+            ;;
+        --signature)
+            COMPREPLY=( $(compgen -W "auto" -- "${cur}") $(compgen -f -- "${cur}") )
+            return 0
+            ;;
+        --on-complete|--on-error|--pipe-to)
             COMPREPLY=( $(compgen -c -- "${cur}") )
             return 0
             ;;
@@ -37,7 +37,49 @@ complete -c burkut -l on-complete -d "Command on success" -x -a "(__fish_complet
 complete -c burkut -l on-error -d "Command on error" -x -a "(__fish_complete_command)"
 complete -c burkut -l webhook -d "Webhook URL" -x
 complete -c burkut -l mirrors -d "Mirror URLs" -x
-complete -c burkut -l http3 -d "Use HTTP/3 (QUIC)"
+complete -c burkut -l http3 -d "HTTP/3 (QUIC) mode: on, auto, off"
+
+# Network
+complete -c burkut -l resolve -d "Use address for host:port (host:port:addr)" -x
+complete -c burkut -l connect-to -d "Connect to host2:port2 instead of host1:port1" -x
+complete -c burkut -s 4 -l ipv4 -d "Use IPv4 only"
+complete -c burkut -s 6 -l ipv6 -d "Use IPv6 only"
+complete -c burkut -l interface -d "Source interface or address" -x -a "(__fish_print_interfaces)"
+complete -c burkut -l part-suffix -d "Suffix of unfinished downloads" -x
+complete -c burkut -l file-allocation -d "Disk space allocation" -x -a "none sparse falloc trunc"
+
+# Archives
+complete -c burkut -l extract -d "Extract archives (--extract=DIR)"
+complete -c burkut -l strip-components -d "Strip leading path components" -x
+complete -c burkut -l remove-archive -d "Delete the archive after extracting"
+
+# Cache
+complete -c burkut -l cache-dir -d "Download cache directory" -r -a "(__fish_complete_directories)"
+complete -c burkut -l cache-max-size -d "Size cap of the cache" -x
+
+# Delta downloads
+complete -c burkut -l seed-file -d "Older local copy to reuse blocks from" -r -F
+
+# Output command
+complete -c burkut -l pipe-to -d "Command receiving the download on stdin" -x -a "(__fish_complete_command)"
+
+# Signatures
+complete -c burkut -l signature -d "Detached signature URL, file or auto" -r -F -a "auto"
+complete -c burkut -l pubkey -d "minisign or OpenPGP public key" -r -F
+complete -c burkut -l keyring -d "OpenPGP keyring" -r -F
+
+# Metalink
+complete -c burkut -l metalink-location -d "Preferred mirror countries (de,tr)" -x
+complete -c burkut -l metalink-select -d "Patterns of the metalink files to download" -x
+complete -c burkut -l metalink-jobs -d "Metalink files downloaded at once" -x
+complete -c burkut -l metalink-peer-timeout -d "Wait for peers of a metalink torrent" -x
+complete -c burkut -l select-file -d "Torrent files to download (1,3-5 or patterns)" -x
+complete -c burkut -l file-priority -d "Torrent file priority (SPEC=normal|high)" -x
+complete -c burkut -l show-files -d "List the files of a torrent and exit"
+complete -c burkut -l seed -d "Keep seeding a torrent until interrupted"
+complete -c burkut -l seed-ratio -d "Seed until this upload ratio" -x
+complete -c burkut -l seed-time -d "Seed for this long (e.g., 30m)" -x
+complete -c burkut -l upload-limit -d "Limit torrent upload speed" -x -a "100K 500K 1M 5M 10M"
 
 # URL argument - allow any input
 complete -c burkut -d "URL to download" -a "()"
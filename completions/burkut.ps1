@@ -38,7 +38,35 @@ Register-ArgumentCompleter -Native -CommandName burkut -ScriptBlock {
         @{ Name = '--on-error'; Tooltip = 'Error command' }
         @{ Name = '--webhook'; Tooltip = 'Webhook URL' }
         @{ Name = '--mirrors'; Tooltip = 'Mirror URLs' }
-        @{ Name = '--http3'; Tooltip = 'Use HTTP/3' }
+        @{ Name = '--http3'; Tooltip = 'HTTP/3 mode: on, auto, off' }
+        @{ Name = '--resolve'; Tooltip = 'Use address for host:port' }
+        @{ Name = '--connect-to'; Tooltip = 'Connect to another host:port' }
+        @{ Name = '-4'; Tooltip = 'IPv4 only' }
+        @{ Name = '-6'; Tooltip = 'IPv6 only' }
+        @{ Name = '--interface'; Tooltip = 'Source interface or address' }
+        @{ Name = '--part-suffix'; Tooltip = 'Suffix of unfinished downloads' }
+        @{ Name = '--file-allocation'; Tooltip = 'Disk space allocation' }
+        @{ Name = '--extract'; Tooltip = 'Extract archives (--extract=DIR)' }
+        @{ Name = '--strip-components'; Tooltip = 'Strip leading path components' }
+        @{ Name = '--remove-archive'; Tooltip = 'Delete the archive after extracting' }
+        @{ Name = '--cache-dir'; Tooltip = 'Download cache directory' }
+        @{ Name = '--cache-max-size'; Tooltip = 'Size cap of the cache' }
+        @{ Name = '--seed-file'; Tooltip = 'Older local copy to reuse blocks from' }
+        @{ Name = '--pipe-to'; Tooltip = 'Command receiving the download on stdin' }
+        @{ Name = '--signature'; Tooltip = 'Detached signature URL, file or auto' }
+        @{ Name = '--pubkey'; Tooltip = 'minisign or OpenPGP public key' }
+        @{ Name = '--keyring'; Tooltip = 'OpenPGP keyring' }
+        @{ Name = '--metalink-location'; Tooltip = 'Preferred mirror countries (de,tr)' }
+        @{ Name = '--metalink-select'; Tooltip = 'Patterns of the metalink files to download' }
+        @{ Name = '--metalink-jobs'; Tooltip = 'Metalink files downloaded at once' }
+        @{ Name = '--metalink-peer-timeout'; Tooltip = 'Wait for peers of a metalink torrent' }
+        @{ Name = '--select-file'; Tooltip = 'Torrent files to download (1,3-5 or patterns)' }
+        @{ Name = '--file-priority'; Tooltip = 'Torrent file priority (SPEC=normal|high)' }
+        @{ Name = '--show-files'; Tooltip = 'List the files of a torrent and exit' }
+        @{ Name = '--seed'; Tooltip = 'Keep seeding a torrent until interrupted' }
+        @{ Name = '--seed-ratio'; Tooltip = 'Seed until this upload ratio' }
+        @{ Name = '--seed-time'; Tooltip = 'Seed for this long (e.g., 30m)' }
+        @{ Name = '--upload-limit'; Tooltip = 'Limit torrent upload speed' }
         @{ Name = '--netrc'; Tooltip = 'Use netrc' }
         @{ Name = '-u'; Tooltip = 'Basic auth' }
         @{ Name = '--user'; Tooltip = 'Basic auth' }
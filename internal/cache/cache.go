@@ -0,0 +1,496 @@
+// Package cache keeps a local content-addressable cache of downloaded files.
+//
+// Files are stored once, named by their SHA-256, and found either by a
+// checksum the caller already expects or by the URL they were downloaded
+// from together with its HTTP validators (ETag, Last-Modified).
+//
+// Layout of the cache directory:
+//
+//	objects/ab/<sha256>       file content
+//	objects/ab/<sha256>.json  object metadata
+//	digests/<alg>/<hex>       SHA-256 of the object with another digest
+//	urls/<sha256 of URL>.json validators of the last download of a URL
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// Object is a file stored in the cache
+type Object struct {
+	SHA256   string                              `json:"sha256"`
+	Size     int64                               `json:"size"`
+	ModTime  time.Time                           `json:"mod_time"` // Of the content file, to notice edits through hard links
+	Digests  map[engine.ChecksumAlgorithm]string `json:"digests"`
+	Added    time.Time                           `json:"added"`
+	LastUsed time.Time                           `json:"last_used"`
+	Path     string                              `json:"-"` // Content file
+}
+
+// URLRecord remembers which object a URL served and the validators it had
+type URLRecord struct {
+	URL          string    `json:"url"`
+	Filename     string    `json:"filename"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+}
+
+// Cache is a cache directory
+type Cache struct {
+	dir     string
+	maxSize int64 // Total size objects are evicted down to after a Put (0 = unlimited)
+}
+
+// Open opens the cache in dir, creating it if needed. maxSize caps the
+// total size of cached files (0 = unlimited).
+func Open(dir string, maxSize int64) (*Cache, error) {
+	for _, sub := range []string{"objects", "digests", "urls"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("creating cache directory: %w", err)
+		}
+	}
+	return &Cache{dir: dir, maxSize: maxSize}, nil
+}
+
+// Dir returns the cache directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) objectPath(sum string) string {
+	return filepath.Join(c.dir, "objects", sum[:2], sum)
+}
+
+func (c *Cache) digestPath(alg engine.ChecksumAlgorithm, value string) string {
+	return filepath.Join(c.dir, "digests", string(alg), value)
+}
+
+func (c *Cache) urlPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, "urls", hex.EncodeToString(sum[:])+".json")
+}
+
+// Object returns the object with the given SHA-256. An object whose content
+// no longer matches its size and modification time, for example because a
+// hard-linked copy was edited, is removed and reported as missing.
+func (c *Cache) Object(sum string) (*Object, bool) {
+	sum = strings.ToLower(sum)
+	if len(sum) != sha256.Size*2 {
+		return nil, false
+	}
+
+	obj, err := c.loadObject(c.objectPath(sum))
+	if err != nil {
+		return nil, false
+	}
+
+	info, err := os.Stat(obj.Path)
+	if err != nil || info.Size() != obj.Size || !info.ModTime().Equal(obj.ModTime) {
+		c.remove(obj)
+		return nil, false
+	}
+	return obj, true
+}
+
+// Lookup returns the object with the expected checksum, if cached
+func (c *Cache) Lookup(sum *engine.Checksum) (*Object, bool) {
+	if sum == nil {
+		return nil, false
+	}
+
+	key := strings.ToLower(sum.Value)
+	if sum.Algorithm != engine.AlgorithmSHA256 {
+		data, err := os.ReadFile(c.digestPath(sum.Algorithm, key))
+		if err != nil {
+			return nil, false
+		}
+		key = strings.TrimSpace(string(data))
+	}
+
+	obj, ok := c.Object(key)
+	if !ok || !strings.EqualFold(obj.Digests[sum.Algorithm], sum.Value) {
+		return nil, false
+	}
+	return obj, true
+}
+
+// Matches reports whether obj has the expected checksum, hashing the content
+// if the digest was not recorded yet
+func (c *Cache) Matches(obj *Object, sum *engine.Checksum) bool {
+	if sum == nil {
+		return true
+	}
+	if value, ok := obj.Digests[sum.Algorithm]; ok {
+		return strings.EqualFold(value, sum.Value)
+	}
+
+	actual, err := engine.CalculateChecksum(obj.Path, sum.Algorithm)
+	if err != nil {
+		return false
+	}
+	obj.Digests[sum.Algorithm] = actual.Value
+	c.saveObject(obj)
+	c.writeDigest(sum.Algorithm, actual.Value, obj.SHA256)
+	return strings.EqualFold(actual.Value, sum.Value)
+}
+
+// LookupURL returns what is known about the last download of url
+func (c *Cache) LookupURL(url string) (*URLRecord, bool) {
+	data, err := os.ReadFile(c.urlPath(url))
+	if err != nil {
+		return nil, false
+	}
+
+	var rec URLRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.URL != url {
+		return nil, false
+	}
+	return &rec, true
+}
+
+// PutURL records that rec.URL served the object rec.SHA256
+func (c *Cache) PutURL(rec URLRecord) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding URL record: %w", err)
+	}
+	return writeFileAtomic(c.urlPath(rec.URL), data)
+}
+
+// Put adds the file at path to the cache, hard-linking it where possible.
+// Digests for algorithms are recorded in addition to SHA-256.
+func (c *Cache) Put(path string, algorithms ...engine.ChecksumAlgorithm) (*Object, error) {
+	digests, err := hashFile(path, algorithms)
+	if err != nil {
+		return nil, err
+	}
+	sum := digests[engine.AlgorithmSHA256]
+
+	obj, ok := c.Object(sum)
+	if !ok {
+		if obj, err = c.store(path, sum); err != nil {
+			return nil, err
+		}
+	}
+
+	for alg, value := range digests {
+		obj.Digests[alg] = value
+		if alg != engine.AlgorithmSHA256 {
+			c.writeDigest(alg, value, sum)
+		}
+	}
+	obj.LastUsed = time.Now()
+	if err := c.saveObject(obj); err != nil {
+		return nil, err
+	}
+
+	if c.maxSize > 0 {
+		c.Prune(c.maxSize)
+	}
+	return obj, nil
+}
+
+// store copies or links path into the cache as the object sum
+func (c *Cache) store(path, sum string) (*Object, error) {
+	target := c.objectPath(sum)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	tmp := target + ".tmp"
+	os.Remove(tmp)
+	if err := linkOrCopy(path, tmp); err != nil {
+		return nil, fmt.Errorf("adding %s to cache: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("adding %s to cache: %w", filepath.Base(path), err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, fmt.Errorf("adding %s to cache: %w", filepath.Base(path), err)
+	}
+
+	now := time.Now()
+	return &Object{
+		SHA256:   sum,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Digests:  map[engine.ChecksumAlgorithm]string{engine.AlgorithmSHA256: sum},
+		Added:    now,
+		LastUsed: now,
+		Path:     target,
+	}, nil
+}
+
+// Materialize places a copy of obj at dest, hard-linking it where possible,
+// and marks the object as used
+func (c *Cache) Materialize(obj *Object, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	tmp := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".cache")
+	os.Remove(tmp)
+	if err := linkOrCopy(obj.Path, tmp); err != nil {
+		return fmt.Errorf("copying from cache: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying from cache: %w", err)
+	}
+
+	obj.LastUsed = time.Now()
+	c.saveObject(obj)
+	return nil
+}
+
+// List returns the cached objects, most recently used first
+func (c *Cache) List() ([]*Object, error) {
+	var objects []*Object
+	err := filepath.WalkDir(filepath.Join(c.dir, "objects"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		if obj, err := c.loadObject(strings.TrimSuffix(path, ".json")); err == nil {
+			objects = append(objects, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing cache: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].LastUsed.After(objects[j].LastUsed)
+	})
+	return objects, nil
+}
+
+// Size returns the total size of the cached objects
+func Size(objects []*Object) int64 {
+	var total int64
+	for _, obj := range objects {
+		total += obj.Size
+	}
+	return total
+}
+
+// Prune evicts the least recently used objects until the cached files take
+// at most maxSize bytes, then drops records pointing at missing objects
+func (c *Cache) Prune(maxSize int64) ([]*Object, error) {
+	objects, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []*Object
+	total := Size(objects)
+	for i := len(objects) - 1; i >= 0 && total > maxSize; i-- {
+		c.remove(objects[i])
+		total -= objects[i].Size
+		removed = append(removed, objects[i])
+	}
+
+	c.dropDangling()
+	return removed, nil
+}
+
+// Verify hashes every cached object and removes those whose content no
+// longer matches their SHA-256. It returns the removed objects.
+func (c *Cache) Verify() ([]*Object, error) {
+	objects, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var damaged []*Object
+	for _, obj := range objects {
+		actual, err := engine.CalculateChecksum(obj.Path, engine.AlgorithmSHA256)
+		if err != nil || actual.Value != obj.SHA256 {
+			c.remove(obj)
+			damaged = append(damaged, obj)
+			continue
+		}
+
+		// Content is intact; accept a changed timestamp
+		if info, err := os.Stat(obj.Path); err == nil && !info.ModTime().Equal(obj.ModTime) {
+			obj.ModTime = info.ModTime()
+			c.saveObject(obj)
+		}
+	}
+
+	c.dropDangling()
+	return damaged, nil
+}
+
+// remove deletes an object and its metadata
+func (c *Cache) remove(obj *Object) {
+	os.Remove(obj.Path)
+	os.Remove(obj.Path + ".json")
+}
+
+// dropDangling removes digest aliases and URL records of missing objects
+func (c *Cache) dropDangling() {
+	exists := func(sum string) bool {
+		sum = strings.TrimSpace(sum)
+		if len(sum) != sha256.Size*2 {
+			return false
+		}
+		_, err := os.Stat(c.objectPath(sum))
+		return err == nil
+	}
+
+	filepath.WalkDir(filepath.Join(c.dir, "digests"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if data, err := os.ReadFile(path); err == nil && !exists(string(data)) {
+			os.Remove(path)
+		}
+		return nil
+	})
+
+	entries, _ := os.ReadDir(filepath.Join(c.dir, "urls"))
+	for _, entry := range entries {
+		path := filepath.Join(c.dir, "urls", entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var rec URLRecord
+		if json.Unmarshal(data, &rec) != nil || !exists(rec.SHA256) {
+			os.Remove(path)
+		}
+	}
+}
+
+func (c *Cache) loadObject(path string) (*Object, error) {
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	var obj Object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("parsing cache object: %w", err)
+	}
+	if obj.Digests == nil {
+		obj.Digests = make(map[engine.ChecksumAlgorithm]string)
+	}
+	obj.Path = path
+	return &obj, nil
+}
+
+func (c *Cache) saveObject(obj *Object) error {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cache object: %w", err)
+	}
+	return writeFileAtomic(obj.Path+".json", data)
+}
+
+func (c *Cache) writeDigest(alg engine.ChecksumAlgorithm, value, sum string) {
+	path := c.digestPath(alg, strings.ToLower(value))
+	if os.MkdirAll(filepath.Dir(path), 0755) == nil {
+		writeFileAtomic(path, []byte(sum))
+	}
+}
+
+// hashFile computes the SHA-256 of a file and the digests for algorithms in one pass
+func hashFile(path string, algorithms []engine.ChecksumAlgorithm) (map[engine.ChecksumAlgorithm]string, error) {
+	hashers := map[engine.ChecksumAlgorithm]hash.Hash{engine.AlgorithmSHA256: sha256.New()}
+	for _, alg := range algorithms {
+		if _, ok := hashers[alg]; ok {
+			continue
+		}
+		h, err := engine.NewHasher(alg)
+		if err != nil {
+			return nil, err
+		}
+		hashers[alg] = h
+	}
+
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	digests := make(map[engine.ChecksumAlgorithm]string, len(hashers))
+	for alg, h := range hashers {
+		digests[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return digests, nil
+}
+
+// linkOrCopy hard-links src to dst, copying it when linking is not possible
+// (different filesystems, or no hard link support)
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// writeFileAtomic replaces path with data, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
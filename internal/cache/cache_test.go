@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+)
+
+// writeFile creates a file with content in dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func openTestCache(t *testing.T, maxSize int64) *Cache {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "cache"), maxSize)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return c
+}
+
+func TestCache_PutLookup(t *testing.T) {
+	c := openTestCache(t, 0)
+	src := writeFile(t, t.TempDir(), "file.bin", "cached content")
+
+	obj, err := c.Put(src, engine.AlgorithmMD5)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if obj.SHA256 != sha256Hex("cached content") || obj.Size != int64(len("cached content")) {
+		t.Errorf("Put() = %s, %d bytes", obj.SHA256, obj.Size)
+	}
+
+	md5sum := md5.Sum([]byte("cached content"))
+	for _, sum := range []*engine.Checksum{
+		{Algorithm: engine.AlgorithmSHA256, Value: obj.SHA256},
+		{Algorithm: engine.AlgorithmMD5, Value: hex.EncodeToString(md5sum[:])},
+	} {
+		if _, ok := c.Lookup(sum); !ok {
+			t.Errorf("Lookup(%s) should find the object", sum.Algorithm)
+		}
+	}
+
+	if _, ok := c.Lookup(&engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: sha256Hex("other")}); ok {
+		t.Error("Lookup() should not find a different checksum")
+	}
+
+	dest := filepath.Join(t.TempDir(), "out", "file.bin")
+	if err := c.Materialize(obj, dest); err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "cached content" {
+		t.Errorf("materialized file = %q", data)
+	}
+}
+
+func TestCache_ObjectChanged(t *testing.T) {
+	c := openTestCache(t, 0)
+	src := writeFile(t, t.TempDir(), "file.bin", "original")
+
+	obj, err := c.Put(src)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// Editing the content through a hard link must not serve stale data
+	os.WriteFile(obj.Path, []byte("modified"), 0644)
+	os.Chtimes(obj.Path, time.Now(), time.Now().Add(time.Hour))
+
+	if _, ok := c.Object(obj.SHA256); ok {
+		t.Error("Object() should reject content whose modification time changed")
+	}
+	if _, err := os.Stat(obj.Path); !os.IsNotExist(err) {
+		t.Error("changed object should be removed")
+	}
+}
+
+func TestCache_Prune(t *testing.T) {
+	c := openTestCache(t, 0)
+	dir := t.TempDir()
+
+	var objects []*Object
+	for _, content := range []string{"first file", "second file", "third file"} {
+		obj, err := c.Put(writeFile(t, dir, content, content))
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		objects = append(objects, obj)
+	}
+	c.PutURL(URLRecord{URL: "http://example.com/first", SHA256: objects[0].SHA256})
+
+	// Using the first object makes the second the least recently used
+	time.Sleep(10 * time.Millisecond)
+	c.Materialize(objects[0], filepath.Join(dir, "out"))
+
+	removed, err := c.Prune(int64(len("first file") + len("third file")))
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].SHA256 != objects[1].SHA256 {
+		t.Fatalf("Prune() removed %d objects, want the second one", len(removed))
+	}
+
+	if _, err := c.Prune(0); err != nil {
+		t.Fatalf("Prune(0) error = %v", err)
+	}
+	if objs, _ := c.List(); len(objs) != 0 {
+		t.Errorf("List() = %d objects after emptying the cache", len(objs))
+	}
+	if _, ok := c.LookupURL("http://example.com/first"); ok {
+		t.Error("URL records of evicted objects should be dropped")
+	}
+}
+
+func TestCache_PutMaxSize(t *testing.T) {
+	c := openTestCache(t, 15)
+	dir := t.TempDir()
+
+	c.Put(writeFile(t, dir, "a", "0123456789"))
+	time.Sleep(10 * time.Millisecond)
+	c.Put(writeFile(t, dir, "b", "abcdefghij"))
+
+	objects, _ := c.List()
+	if len(objects) != 1 || objects[0].SHA256 != sha256Hex("abcdefghij") {
+		t.Errorf("cache should keep only the newest object, has %d", len(objects))
+	}
+}
+
+func TestCache_Verify(t *testing.T) {
+	c := openTestCache(t, 0)
+	dir := t.TempDir()
+
+	good, _ := c.Put(writeFile(t, dir, "good", "good content"))
+	bad, _ := c.Put(writeFile(t, dir, "bad", "bad content"))
+
+	// Same size, different bytes: only a re-hash notices
+	os.WriteFile(bad.Path, []byte("BAD content"), 0644)
+
+	damaged, err := c.Verify()
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(damaged) != 1 || damaged[0].SHA256 != bad.SHA256 {
+		t.Fatalf("Verify() removed %d objects, want the damaged one", len(damaged))
+	}
+	if _, ok := c.Object(good.SHA256); !ok {
+		t.Error("intact object should be kept")
+	}
+}
+
+// newValidatorServer serves content with an ETag and counts full responses
+func newValidatorServer(t *testing.T, etag, content string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var full int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &full
+}
+
+func TestCache_Find(t *testing.T) {
+	server, full := newValidatorServer(t, `"v1"`, "file content")
+	client := protocol.NewHTTPClient()
+	defer client.Close()
+	url := server.URL + "/file.bin"
+
+	c := openTestCache(t, 0)
+	obj, err := c.Put(writeFile(t, t.TempDir(), "file.bin", "file content"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	t.Run("no record", func(t *testing.T) {
+		hit, _, err := c.Find(context.Background(), client, url, nil)
+		if err != nil || hit != nil {
+			t.Errorf("Find() = %v, %v, want a miss", hit, err)
+		}
+	})
+
+	c.PutURL(URLRecord{URL: url, Filename: "file.bin", ETag: `"v1"`, Size: obj.Size, SHA256: obj.SHA256})
+
+	t.Run("revalidated", func(t *testing.T) {
+		hit, _, err := c.Find(context.Background(), client, url, nil)
+		if err != nil || hit == nil {
+			t.Fatalf("Find() = %v, %v, want a hit", hit, err)
+		}
+		if !hit.Revalidated || hit.Filename != "file.bin" {
+			t.Errorf("Hit = %+v", hit)
+		}
+		if n := atomic.LoadInt32(full); n != 0 {
+			t.Errorf("server sent the file %d times", n)
+		}
+	})
+
+	t.Run("by checksum without a request", func(t *testing.T) {
+		sum := &engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: obj.SHA256}
+		hit, _, err := c.Find(context.Background(), client, "http://127.0.0.1:1/unreachable", sum)
+		if err != nil || hit == nil || hit.Revalidated {
+			t.Errorf("Find() = %+v, %v, want a checksum hit", hit, err)
+		}
+	})
+
+	t.Run("changed on the server", func(t *testing.T) {
+		c.PutURL(URLRecord{URL: url, ETag: `"v0"`, Size: obj.Size, SHA256: obj.SHA256})
+		hit, meta, err := c.Find(context.Background(), client, url, nil)
+		if err != nil || hit != nil {
+			t.Fatalf("Find() = %v, %v, want a miss", hit, err)
+		}
+		if meta == nil || meta.ETag != `"v1"` {
+			t.Errorf("Find() should return the new metadata, got %+v", meta)
+		}
+	})
+}
+
+func TestURLRecord_Matches(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rec  URLRecord
+		meta protocol.Metadata
+		want bool
+	}{
+		{"strong etag", URLRecord{ETag: `"a"`, Size: 10}, protocol.Metadata{ETag: `"a"`, ContentLength: 10}, true},
+		{"etag differs", URLRecord{ETag: `"a"`, LastModified: modified, Size: 10}, protocol.Metadata{ETag: `"b"`, LastModified: modified, ContentLength: 10}, false},
+		{"size differs", URLRecord{ETag: `"a"`, Size: 10}, protocol.Metadata{ETag: `"a"`, ContentLength: 11}, false},
+		{"weak etag uses date", URLRecord{ETag: `W/"a"`, LastModified: modified, Size: 10}, protocol.Metadata{ETag: `W/"b"`, LastModified: modified, ContentLength: 10}, true},
+		{"date without size", URLRecord{LastModified: modified}, protocol.Metadata{LastModified: modified}, false},
+		{"no validators", URLRecord{Size: 10}, protocol.Metadata{ContentLength: 10}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rec.Matches(&tt.meta); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
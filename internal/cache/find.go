@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+)
+
+// Hit is a cached copy of a download
+type Hit struct {
+	Object      *Object
+	Filename    string // Name the URL was last downloaded under ("" if unknown)
+	Revalidated bool   // Confirmed with the server rather than by checksum alone
+}
+
+// Matches reports whether meta describes the same file the record was made
+// from. Strong ETags decide on their own; otherwise Last-Modified and the size
+// must both match.
+func (r *URLRecord) Matches(meta *protocol.Metadata) bool {
+	if meta == nil {
+		return false
+	}
+	if r.Size > 0 && meta.ContentLength > 0 && r.Size != meta.ContentLength {
+		return false
+	}
+
+	if r.ETag != "" && !strings.HasPrefix(r.ETag, "W/") && meta.ETag != "" {
+		return r.ETag == meta.ETag
+	}
+	return !r.LastModified.IsZero() && r.LastModified.Equal(meta.LastModified) &&
+		r.Size > 0 && r.Size == meta.ContentLength
+}
+
+// Find looks for a cached copy of url. When a checksum is expected, an object
+// having it is used without contacting the server. Otherwise the validators
+// of the URL's last download are checked with a conditional request.
+//
+// meta is the server's metadata if a request was made and the cached copy
+// could not be used, so the caller does not need to ask again; otherwise it
+// is nil.
+func (c *Cache) Find(ctx context.Context, client *protocol.HTTPClient, url string, expected *engine.Checksum) (hit *Hit, meta *protocol.Metadata, err error) {
+	rec, hasRecord := c.LookupURL(url)
+
+	if obj, ok := c.Lookup(expected); ok {
+		hit = &Hit{Object: obj}
+		if hasRecord {
+			hit.Filename = rec.Filename
+		}
+		return hit, nil, nil
+	}
+
+	if !hasRecord || rec.ETag == "" && rec.LastModified.IsZero() {
+		return nil, nil, nil
+	}
+
+	meta, notModified, err := client.Revalidate(ctx, url, rec.ETag, rec.LastModified)
+	if err != nil {
+		return nil, nil, err
+	}
+	if notModified || rec.Matches(meta) {
+		if obj, ok := c.Object(rec.SHA256); ok && c.Matches(obj, expected) {
+			return &Hit{Object: obj, Filename: rec.Filename, Revalidated: true}, nil, nil
+		}
+		if notModified {
+			return nil, nil, nil // A 304 response does not describe the file
+		}
+	}
+	return nil, meta, nil
+}
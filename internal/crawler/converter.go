@@ -210,7 +210,7 @@ func (c *LinkConverter) urlPathToLocal(u *url.URL) string {
 		urlPath += ".html"
 	}
 
-	path = filepath.Join(path, urlPath)
+	path = joinURLPath(path, urlPath)
 
 	return filepath.Join(c.outputDir, filepath.Clean(path))
 }
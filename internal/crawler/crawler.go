@@ -12,6 +12,10 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+	"github.com/kilimcininkoroglu/burkut/internal/storage"
 )
 
 // Config holds crawler configuration
@@ -54,22 +58,37 @@ type Config struct {
 
 	// HTTP client to use
 	HTTPClient *http.Client
+
+	// Endpoint settings (resolve, connect-to, address family, source address)
+	// used when HTTPClient is not set
+	Dialer *protocol.Dialer
+
+	// What to do when a local file already exists
+	OnConflict storage.CollisionPolicy
+
+	// Per-host backoff for 429/503 responses (shared with other downloads if set)
+	Backoff *engine.HostBackoff
+
+	// Retries per URL after a 429/503 response
+	ThrottleRetries int
 }
 
 // DefaultConfig returns default crawler configuration
 func DefaultConfig() *Config {
 	return &Config{
-		MaxDepth:      5,
-		WaitTime:      time.Second,
-		RandomWait:    500 * time.Millisecond,
-		RespectRobots: true,
-		UserAgent:     "Burkut/1.0 (Website Mirror)",
-		OutputDir:     ".",
-		ConvertLinks:  false,
-		DownloadFiles: true, // Default: download files (not spider mode)
-		Workers:       2,
-		Timeout:       30 * time.Second,
-		MaxFileSize:   0,
+		MaxDepth:        5,
+		WaitTime:        time.Second,
+		RandomWait:      500 * time.Millisecond,
+		RespectRobots:   true,
+		UserAgent:       "Burkut/1.0 (Website Mirror)",
+		OutputDir:       ".",
+		ConvertLinks:    false,
+		DownloadFiles:   true, // Default: download files (not spider mode)
+		Workers:         2,
+		Timeout:         30 * time.Second,
+		MaxFileSize:     0,
+		OnConflict:      storage.CollisionOverwrite,
+		ThrottleRetries: 5,
 	}
 }
 
@@ -126,12 +145,28 @@ func NewCrawler(config *Config) *Crawler {
 		httpClient = &http.Client{
 			Timeout: config.Timeout,
 		}
+		if config.Dialer != nil {
+			httpClient.Transport = &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         config.Dialer.DialContext,
+				MaxIdleConnsPerHost: config.Workers,
+				IdleConnTimeout:     90 * time.Second,
+			}
+		}
+	}
+
+	if config.Backoff == nil {
+		config.Backoff = engine.NewHostBackoff(engine.DefaultBackoffConfig())
 	}
 
+	// robots.txt is fetched over the same connections
+	robots := NewRobotsChecker(config.UserAgent, config.RespectRobots)
+	robots.httpClient.Transport = httpClient.Transport
+
 	return &Crawler{
 		config:     config,
 		queue:      NewURLQueue(),
-		robots:     NewRobotsChecker(config.UserAgent, config.RespectRobots),
+		robots:     robots,
 		stats:      &Stats{},
 		httpClient: httpClient,
 	}
@@ -305,24 +340,53 @@ func (c *Crawler) processItem(ctx context.Context, item *CrawlItem) {
 	}
 }
 
-// download downloads a URL and saves it locally (or just fetches in spider mode)
-func (c *Crawler) download(ctx context.Context, item *CrawlItem) (string, string, []byte, error) {
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.URL.String(), nil)
-	if err != nil {
-		return "", "", nil, err
-	}
+// fetch requests a URL, pausing the host and retrying when the server throttles.
+// The returned release function must be called once the body has been read.
+func (c *Crawler) fetch(ctx context.Context, item *CrawlItem) (*http.Response, func(), error) {
+	host := strings.ToLower(item.URL.Host)
+
+	for attempt := 0; ; attempt++ {
+		release, err := c.config.Backoff.Acquire(ctx, host)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.URL.String(), nil)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
 
-	req.Header.Set("User-Agent", c.config.UserAgent)
-	if item.Referrer != "" {
-		req.Header.Set("Referer", item.Referrer)
+		req.Header.Set("User-Agent", c.config.UserAgent)
+		if item.Referrer != "" {
+			req.Header.Set("Referer", item.Referrer)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+
+		throttled := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !throttled || attempt >= c.config.ThrottleRetries {
+			return resp, release, nil
+		}
+
+		c.config.Backoff.Throttle(host, protocol.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		resp.Body.Close()
+		release()
 	}
+}
 
+// download downloads a URL and saves it locally (or just fetches in spider mode)
+func (c *Crawler) download(ctx context.Context, item *CrawlItem) (string, string, []byte, error) {
 	// Execute request
-	resp, err := c.httpClient.Do(req)
+	resp, release, err := c.fetch(ctx, item)
 	if err != nil {
 		return "", "", nil, err
 	}
+	defer release()
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
@@ -356,6 +420,16 @@ func (c *Crawler) download(ctx context.Context, item *CrawlItem) (string, string
 		// Determine local path
 		localPath = c.urlToLocalPath(item.URL)
 
+		// Apply collision policy; skipped files still have their links followed
+		res, err := storage.ResolveCollision(localPath, c.config.OnConflict, int64(len(body)))
+		if err != nil {
+			return "", "", nil, err
+		}
+		localPath = res.Path
+		if res.Skip {
+			return localPath, contentType, body, nil
+		}
+
 		// Create directory
 		dir := filepath.Dir(localPath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -440,7 +514,7 @@ func (c *Crawler) urlToLocalPath(u *url.URL) string {
 		urlPath += ".html"
 	}
 
-	path = filepath.Join(path, urlPath)
+	path = joinURLPath(path, urlPath)
 
 	// Add query string to filename if present
 	if u.RawQuery != "" {
@@ -461,6 +535,21 @@ func (c *Crawler) urlToLocalPath(u *url.URL) string {
 	return filepath.Join(c.config.OutputDir, path)
 }
 
+// joinURLPath joins a URL path below host, sanitizing each segment so
+// ".." and reserved characters cannot escape the host directory
+func joinURLPath(host, urlPath string) string {
+	segments := []string{protocol.SanitizeFilename(host)}
+	for _, segment := range strings.Split(urlPath, "/") {
+		if clean := protocol.SanitizeFilename(segment); clean != "" {
+			segments = append(segments, clean)
+		}
+	}
+	if len(segments) == 1 {
+		segments = append(segments, "index.html")
+	}
+	return filepath.Join(segments...)
+}
+
 // hashString creates a simple hash of a string
 func hashString(s string) string {
 	h := uint64(0)
@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestCrawler_URLToLocalPath(t *testing.T) {
+	c := NewCrawler(&Config{OutputDir: "/out"})
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/", "example.com/index.html"},
+		{"https://example.com/docs/", "example.com/docs/index.html"},
+		{"https://example.com/docs/page", "example.com/docs/page.html"},
+		{"https://example.com/a/../../../etc/passwd", "example.com/a/etc/passwd.html"},
+		{"https://example.com/%2e%2e/%2e%2e/secret.txt", "example.com/secret.txt"},
+		{"https://example.com/dir/fi:le.txt", "example.com/dir/fi_le.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("url.Parse() error = %v", err)
+			}
+			want := filepath.Join("/out", filepath.FromSlash(tt.expected))
+			if got := c.urlToLocalPath(u); got != want {
+				t.Errorf("urlToLocalPath(%q) = %q, want %q", tt.url, got, want)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
 )
 
 // QueueItem represents a single download in the queue
@@ -329,25 +331,7 @@ func (q *Queue) Clear() {
 
 // extractFilename extracts filename from URL
 func extractFilename(rawURL string) string {
-	parsed, err := url.Parse(rawURL)
-	if err != nil {
-		return "download"
-	}
-
-	path := parsed.Path
-	if idx := strings.LastIndex(path, "/"); idx >= 0 {
-		path = path[idx+1:]
-	}
-
-	if decoded, err := url.QueryUnescape(path); err == nil {
-		path = decoded
-	}
-
-	if path == "" {
-		return "download"
-	}
-
-	return path
+	return protocol.FilenameFromURL(rawURL)
 }
 
 // QueueCallback is called for each download event
@@ -69,6 +69,11 @@ type State struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
+	// Set when the server did not honor range requests and the download
+	// fell back to one stream over the whole file
+	SingleStream    bool   `json:"single_stream,omitempty"`
+	DowngradeReason string `json:"downgrade_reason,omitempty"`
+
 	mu sync.RWMutex `json:"-"`
 }
 
@@ -132,6 +137,63 @@ func (s *State) InitializeChunks(numChunks int) {
 	}
 }
 
+// DowngradeToSingleStream replaces the chunks with a single chunk covering
+// the whole file. Without working ranges nothing already written can be
+// kept, so the download restarts from the beginning.
+func (s *State) DowngradeToSingleStream(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.TotalSize - 1
+	if s.TotalSize <= 0 {
+		end = -1
+	}
+
+	s.Chunks = []Chunk{{
+		ID:     0,
+		Start:  0,
+		End:    end,
+		Status: ChunkStatusPending,
+	}}
+	s.AcceptRange = false
+	s.SingleStream = true
+	s.DowngradeReason = reason
+	s.UpdatedAt = time.Now()
+	s.recalculateDownloaded()
+}
+
+// FinalizeSize records the size of a download whose length was unknown
+// once the stream has ended, closing its open-ended chunk
+func (s *State) FinalizeSize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.TotalSize = size
+	for i := range s.Chunks {
+		if s.Chunks[i].End < 0 {
+			s.Chunks[i].End = size - 1
+		}
+	}
+	s.UpdatedAt = time.Now()
+}
+
+// Downgraded returns why the download fell back to a single stream ("" if it did not)
+func (s *State) Downgraded() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.DowngradeReason
+}
+
+// CopyChunks returns a snapshot of the chunks
+func (s *State) CopyChunks() []Chunk {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chunks := make([]Chunk, len(s.Chunks))
+	copy(chunks, s.Chunks)
+	return chunks
+}
+
 // UpdateChunk updates a chunk's progress
 func (s *State) UpdateChunk(chunkID int, downloaded int64, status ChunkStatus) {
 	s.mu.Lock()
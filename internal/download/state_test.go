@@ -135,6 +135,60 @@ func TestState_InitializeChunks_UnknownSize(t *testing.T) {
 	}
 }
 
+func TestState_DowngradeToSingleStream(t *testing.T) {
+	state := NewState("http://example.com/file.zip", "file.zip", 1000, true)
+	state.InitializeChunks(4)
+	state.UpdateChunk(0, 250, ChunkStatusCompleted)
+	state.UpdateChunk(1, 100, ChunkStatusInProgress)
+
+	state.DowngradeToSingleStream("server ignored Range")
+
+	if len(state.Chunks) != 1 {
+		t.Fatalf("len(Chunks) = %d, want 1", len(state.Chunks))
+	}
+	chunk := state.Chunks[0]
+	if chunk.Start != 0 || chunk.End != 999 || chunk.Downloaded != 0 || chunk.Status != ChunkStatusPending {
+		t.Errorf("chunk = %+v, want pending 0-999 with nothing downloaded", chunk)
+	}
+	if state.Downloaded != 0 {
+		t.Errorf("Downloaded = %d, want 0", state.Downloaded)
+	}
+	if !state.SingleStream || state.AcceptRange {
+		t.Errorf("SingleStream = %v, AcceptRange = %v, want true, false", state.SingleStream, state.AcceptRange)
+	}
+	if got := state.Downgraded(); got != "server ignored Range" {
+		t.Errorf("Downgraded() = %q", got)
+	}
+
+	// The downgrade survives a save/load cycle
+	path := filepath.Join(t.TempDir(), "file.zip")
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if !loaded.SingleStream || loaded.DowngradeReason != "server ignored Range" {
+		t.Errorf("loaded SingleStream = %v, DowngradeReason = %q", loaded.SingleStream, loaded.DowngradeReason)
+	}
+}
+
+func TestState_FinalizeSize(t *testing.T) {
+	state := NewState("http://example.com/stream.tar", "stream.tar", 0, false)
+	state.InitializeChunks(4)
+	state.UpdateChunk(0, 1500, ChunkStatusInProgress)
+
+	state.FinalizeSize(1500)
+
+	if state.TotalSize != 1500 {
+		t.Errorf("TotalSize = %d, want 1500", state.TotalSize)
+	}
+	if chunk := state.Chunks[0]; chunk.End != 1499 || !chunk.IsComplete() {
+		t.Errorf("chunk = %+v, want End 1499 and complete", chunk)
+	}
+}
+
 func TestState_UpdateChunk(t *testing.T) {
 	state := NewState("http://example.com/file.zip", "file.zip", 1000, true)
 	state.InitializeChunks(4)
@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackoffConfig holds per-host backoff configuration
+type BackoffConfig struct {
+	InitialDelay     time.Duration // Pause used when the server sends no Retry-After
+	MaxDelay         time.Duration // Upper bound for any pause, including Retry-After
+	RecoveryInterval time.Duration // Time without throttling before one more connection is allowed
+	MinConcurrency   int           // Concurrency never drops below this
+}
+
+// DefaultBackoffConfig returns default backoff configuration
+func DefaultBackoffConfig() BackoffConfig {
+	return BackoffConfig{
+		InitialDelay:     2 * time.Second,
+		MaxDelay:         5 * time.Minute,
+		RecoveryInterval: 5 * time.Second,
+		MinConcurrency:   1,
+	}
+}
+
+// HostBackoff coordinates connections to servers that answer with 429/503.
+// When one connection is throttled, every connection to that host pauses,
+// the host's concurrency is halved, and it is raised again one step per
+// RecoveryInterval until the original concurrency is restored.
+// A single HostBackoff can be shared by many downloads and crawler workers.
+type HostBackoff struct {
+	config BackoffConfig
+	hosts  map[string]*hostBackoffState
+	mu     sync.Mutex
+}
+
+// hostBackoffState tracks a single host
+type hostBackoffState struct {
+	pausedUntil time.Time
+	limit       int // Current concurrency limit (0 = unlimited)
+	peak        int // Concurrency before the first throttle
+	active      int
+	strikes     int // Consecutive throttles without recovery
+	lastChange  time.Time
+	changed     chan struct{} // Closed and replaced whenever a slot frees up
+}
+
+// HostStatus is a snapshot of a host's backoff state
+type HostStatus struct {
+	Host        string
+	PausedUntil time.Time
+	Limit       int // 0 = unlimited
+	Active      int
+}
+
+// NewHostBackoff creates a new HostBackoff
+func NewHostBackoff(config BackoffConfig) *HostBackoff {
+	if config.MinConcurrency < 1 {
+		config.MinConcurrency = 1
+	}
+	return &HostBackoff{
+		config: config,
+		hosts:  make(map[string]*hostBackoffState),
+	}
+}
+
+// state returns the state for host, creating it if needed (caller holds mu)
+func (b *HostBackoff) state(host string) *hostBackoffState {
+	st, ok := b.hosts[host]
+	if !ok {
+		st = &hostBackoffState{changed: make(chan struct{})}
+		b.hosts[host] = st
+	}
+	return st
+}
+
+// notify wakes up waiters of st (caller holds mu)
+func (st *hostBackoffState) notify() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// Acquire waits until host is not paused and has a free connection slot.
+// The returned function must be called to release the slot.
+func (b *HostBackoff) Acquire(ctx context.Context, host string) (func(), error) {
+	for {
+		b.mu.Lock()
+		st := b.state(host)
+		now := time.Now()
+		b.recover(st, now)
+
+		var wait time.Duration
+		if now.Before(st.pausedUntil) {
+			wait = st.pausedUntil.Sub(now)
+		} else if st.limit > 0 && st.active >= st.limit {
+			// Re-check after the next recovery step even if no slot frees up
+			wait = b.config.RecoveryInterval
+		} else {
+			st.active++
+			b.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(func() { b.release(host) })
+			}, nil
+		}
+		changed := st.changed
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// release frees a connection slot on host
+func (b *HostBackoff) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.state(host)
+	if st.active > 0 {
+		st.active--
+	}
+	st.notify()
+}
+
+// Throttle records a 429/503 response from host and pauses it.
+// retryAfter is the server's Retry-After hint (0 if absent).
+// Returns how long the host is paused.
+func (b *HostBackoff) Throttle(host string, retryAfter time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.state(host)
+	now := time.Now()
+
+	// Throttles arriving while the host is already paused come from requests
+	// that were in flight at the same time; they count as one event
+	alreadyPaused := now.Before(st.pausedUntil)
+
+	delay := retryAfter
+	if delay <= 0 {
+		strikes := st.strikes
+		if alreadyPaused && strikes > 0 {
+			strikes--
+		}
+		delay = time.Duration(float64(b.config.InitialDelay) * math.Pow(2, float64(strikes)))
+	}
+	if b.config.MaxDelay > 0 && delay > b.config.MaxDelay {
+		delay = b.config.MaxDelay
+	}
+	if until := now.Add(delay); until.After(st.pausedUntil) {
+		st.pausedUntil = until
+	}
+
+	if !alreadyPaused {
+		st.strikes++
+
+		// Halve concurrency, remembering where we started from
+		current := st.limit
+		if current == 0 {
+			current = st.active
+			if current < 1 {
+				current = 1
+			}
+			if current > st.peak {
+				st.peak = current
+			}
+		}
+		st.limit = current / 2
+		if st.limit < b.config.MinConcurrency {
+			st.limit = b.config.MinConcurrency
+		}
+	}
+	st.lastChange = st.pausedUntil
+
+	st.notify()
+	return st.pausedUntil.Sub(now)
+}
+
+// recover raises the limit of st one step per RecoveryInterval (caller holds mu)
+func (b *HostBackoff) recover(st *hostBackoffState, now time.Time) {
+	if st.limit == 0 || b.config.RecoveryInterval <= 0 {
+		return
+	}
+
+	for st.limit > 0 && now.Sub(st.lastChange) >= b.config.RecoveryInterval {
+		st.limit++
+		st.strikes = 0
+		st.lastChange = st.lastChange.Add(b.config.RecoveryInterval)
+		if st.limit >= st.peak {
+			// Fully recovered
+			st.limit = 0
+			st.peak = 0
+		}
+	}
+}
+
+// Wait blocks while host is paused
+func (b *HostBackoff) Wait(ctx context.Context, host string) error {
+	for {
+		b.mu.Lock()
+		st := b.state(host)
+		wait := time.Until(st.pausedUntil)
+		changed := st.changed
+		b.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Status returns a snapshot of host's backoff state
+func (b *HostBackoff) Status(host string) HostStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.state(host)
+	b.recover(st, time.Now())
+	return HostStatus{
+		Host:        host,
+		PausedUntil: st.pausedUntil,
+		Limit:       st.limit,
+		Active:      st.active,
+	}
+}
+
+// HostKey returns the key used to group requests by host
+func HostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testBackoffConfig() BackoffConfig {
+	return BackoffConfig{
+		InitialDelay:     20 * time.Millisecond,
+		MaxDelay:         time.Second,
+		RecoveryInterval: 30 * time.Millisecond,
+		MinConcurrency:   1,
+	}
+}
+
+func TestHostBackoff_AcquireRelease(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+
+	release, err := b.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got := b.Status("example.com").Active; got != 1 {
+		t.Errorf("Active = %d, want 1", got)
+	}
+
+	release()
+	release() // Second call must be a no-op
+	if got := b.Status("example.com").Active; got != 0 {
+		t.Errorf("Active after release = %d, want 0", got)
+	}
+}
+
+func TestHostBackoff_ThrottlePausesHost(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+
+	pause := b.Throttle("example.com", 100*time.Millisecond)
+	if pause < 90*time.Millisecond || pause > 100*time.Millisecond {
+		t.Errorf("Throttle() = %v, want ~100ms", pause)
+	}
+
+	start := time.Now()
+	release, err := b.Acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	release()
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Acquire() returned after %v, want it to wait for the pause", elapsed)
+	}
+
+	// Other hosts are not affected
+	start = time.Now()
+	release, err = b.Acquire(context.Background(), "other.com")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Acquire() for other host waited %v", elapsed)
+	}
+}
+
+func TestHostBackoff_ThrottleHalvesConcurrency(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+	ctx := context.Background()
+
+	var releases []func()
+	for i := 0; i < 4; i++ {
+		release, err := b.Acquire(ctx, "example.com")
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	b.Throttle("example.com", 10*time.Millisecond)
+	// A second throttle from a request in flight at the same time counts once
+	b.Throttle("example.com", 10*time.Millisecond)
+
+	if got := b.Status("example.com").Limit; got != 2 {
+		t.Errorf("Limit = %d, want 2", got)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+
+	// Limit recovers step by step until it is lifted entirely
+	time.Sleep(10*time.Millisecond + 2*30*time.Millisecond + 10*time.Millisecond)
+	if got := b.Status("example.com").Limit; got != 0 {
+		t.Errorf("Limit after recovery = %d, want 0 (unlimited)", got)
+	}
+}
+
+func TestHostBackoff_ExponentialWithoutRetryAfter(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+
+	first := b.Throttle("example.com", 0)
+	time.Sleep(first + 5*time.Millisecond)
+	second := b.Throttle("example.com", 0)
+
+	if second < 2*first-5*time.Millisecond {
+		t.Errorf("second pause = %v, want about double of %v", second, first)
+	}
+}
+
+func TestHostBackoff_MaxDelay(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+
+	if pause := b.Throttle("example.com", time.Hour); pause > time.Second {
+		t.Errorf("Throttle() = %v, want capped at 1s", pause)
+	}
+}
+
+func TestHostBackoff_AcquireContextCanceled(t *testing.T) {
+	b := NewHostBackoff(testBackoffConfig())
+	b.Throttle("example.com", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := b.Acquire(ctx, "example.com"); err == nil {
+		t.Error("Acquire() should fail when context is canceled")
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://Example.com/file.zip", "example.com"},
+		{"http://example.com:8080/a", "example.com:8080"},
+	}
+
+	for _, tt := range tests {
+		if got := HostKey(tt.url); got != tt.want {
+			t.Errorf("HostKey(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
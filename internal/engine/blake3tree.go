@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"sync"
+
+	"lukechampine.com/blake3/guts"
+)
+
+// BLAKE3 splits its input into 1 KiB chunks that are the leaves of a binary
+// tree, so whole subtrees can be hashed on separate cores and joined in
+// order. lukechampine.com/blake3/guts exposes the chaining values of
+// subtrees; the joins are done here and checked against github.com/zeebo/blake3
+// in the tests.
+
+// Files from parallelHashThreshold bytes are hashed on several cores. The
+// guts compression is as fast per core as the single-stream hasher, so two
+// cores already outrun it.
+const (
+	parallelHashThreshold  = 64 * 1024 * 1024
+	parallelHashMinWorkers = 2
+)
+
+// blake3SegmentChunks is how many chunks one worker hashes at a time. It
+// must be a power of two so every segment is a complete subtree.
+var blake3SegmentChunks = 1024
+
+// blake3Tree joins complete subtrees from left to right, keeping at most one
+// pending subtree per height
+type blake3Tree struct {
+	stack   [64][8]uint32
+	counter uint64 // Chunks joined so far; bit i is set when stack[i] is in use
+}
+
+// push adds the subtree of 2^height chunks that follows those joined so far,
+// merging it with every finished neighbour of the same size
+func (t *blake3Tree) push(cv [8]uint32, height int) {
+	i := height
+	for ; t.counter&(1<<i) != 0; i++ {
+		cv = guts.ChainingValue(guts.ParentNode(t.stack[i], cv, &guts.IV, 0))
+	}
+	t.stack[i] = cv
+	t.counter += 1 << height
+}
+
+// sum joins the last chunk of the input with the pending subtrees and
+// returns the hash
+func (t *blake3Tree) sum(last []byte) []byte {
+	n := guts.CompressChunk(last, &guts.IV, t.counter, 0)
+	for i := bits.TrailingZeros64(t.counter); i < bits.Len64(t.counter); i++ {
+		if t.counter&(1<<i) != 0 {
+			n = guts.ParentNode(t.stack[i], guts.ChainingValue(n), &guts.IV, 0)
+		}
+	}
+	n.Flags |= guts.FlagRoot
+	out := guts.WordsToBytes(guts.CompressNode(n))
+	return out[:32]
+}
+
+// blake3Subtree returns the chaining value of the complete subtree over
+// data, whose first chunk is number counter
+func blake3Subtree(data []byte, counter uint64) [8]uint32 {
+	return guts.ChainingValue(guts.CompressEigentree(data, &guts.IV, counter, 0))
+}
+
+// blake3File returns the BLAKE3 hash of the size bytes of r, hashing whole
+// segments on up to workers goroutines
+func blake3File(r io.ReaderAt, size int64, workers int) ([]byte, error) {
+	segmentLen := int64(blake3SegmentChunks) * guts.ChunkSize
+	chunks := max(1, (size+guts.ChunkSize-1)/guts.ChunkSize)
+	// The segment holding the last chunk is hashed last, since its final
+	// compression is the root
+	full := (chunks - 1) / int64(blake3SegmentChunks)
+
+	cvs := make([][8]uint32, full)
+	errs := make([]error, full)
+	next := make(chan int64)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && int64(w) < full; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, segmentLen)
+			for i := range next {
+				if _, err := r.ReadAt(buf, i*segmentLen); err != nil {
+					errs[i] = err
+					continue
+				}
+				cvs[i] = blake3Subtree(buf, uint64(i)*uint64(blake3SegmentChunks))
+			}
+		}()
+	}
+	for i := int64(0); i < full; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var tree blake3Tree
+	height := bits.TrailingZeros(uint(blake3SegmentChunks))
+	for i, cv := range cvs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		tree.push(cv, height)
+	}
+
+	rest := make([]byte, size-full*segmentLen)
+	if _, err := r.ReadAt(rest, full*segmentLen); err != nil && err != io.EOF {
+		return nil, err
+	}
+	// The chunks before the last one form complete subtrees of the partial
+	// segment
+	if len(rest) > guts.ChunkSize {
+		for _, h := range guts.Eigentrees(tree.counter, uint64(len(rest)-1)/guts.ChunkSize) {
+			n := (1 << h) * guts.ChunkSize
+			tree.push(blake3Subtree(rest[:n:n], tree.counter), h)
+			rest = rest[n:]
+		}
+	}
+	return tree.sum(rest), nil
+}
+
+// useParallelBLAKE3 reports whether a file of size bytes is hashed faster
+// on workers cores than on one
+func useParallelBLAKE3(size int64, workers int) bool {
+	return size >= parallelHashThreshold && workers >= parallelHashMinWorkers
+}
+
+// calculateBLAKE3Parallel hashes a file of size bytes on workers cores
+func calculateBLAKE3Parallel(file *os.File, size int64, workers int) (*Checksum, error) {
+	sum, err := blake3File(file, size, workers)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return &Checksum{Algorithm: AlgorithmBLAKE3, Value: hex.EncodeToString(sum)}, nil
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/zeebo/blake3"
+	"lukechampine.com/blake3/guts"
+)
+
+// lowerSegmentChunks makes segments 4 chunks long for the test, so the tree
+// joins are exercised without large inputs
+func lowerSegmentChunks(t testing.TB) {
+	n := blake3SegmentChunks
+	t.Cleanup(func() { blake3SegmentChunks = n })
+	blake3SegmentChunks = 4
+}
+
+func TestBlake3File(t *testing.T) {
+	lowerSegmentChunks(t)
+
+	data := make([]byte, 40*guts.ChunkSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	sizes := []int{0, 1, 63, 64, 65, 1023, 1024, 1025, 2048, 3*1024 + 7,
+		4 * 1024, 4*1024 + 1, 8 * 1024, 8*1024 + 1, 12 * 1024, 17*1024 + 5,
+		32 * 1024, 32*1024 + 1, len(data)}
+	for _, size := range sizes {
+		want := blake3.Sum256(data[:size])
+		for _, workers := range []int{1, 3} {
+			got, err := blake3File(bytes.NewReader(data[:size]), int64(size), workers)
+			if err != nil {
+				t.Fatalf("blake3File(%d) error = %v", size, err)
+			}
+			if !bytes.Equal(got, want[:]) {
+				t.Errorf("blake3File(%d, workers=%d) = %s, want %s", size, workers, hex.EncodeToString(got), hex.EncodeToString(want[:]))
+			}
+		}
+	}
+}
+
+func FuzzBlake3File(f *testing.F) {
+	lowerSegmentChunks(f)
+
+	// Sizes around chunk and segment boundaries, and past a segment of
+	// segments where the joins go up another level
+	for _, chunks := range []int{0, 1, 3, 4, 5, 7, 8, 15, 16, 17, 31, 32, 33} {
+		for _, delta := range []int{-1, 0, 1} {
+			if size := chunks*guts.ChunkSize + delta; size >= 0 {
+				f.Add(uint32(size), int64(chunks), uint8(3))
+			}
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, size uint32, seed int64, workers uint8) {
+		size %= 80 * guts.ChunkSize
+		data := make([]byte, size)
+		rand.New(rand.NewSource(seed)).Read(data)
+
+		want := blake3.Sum256(data)
+		got, err := blake3File(bytes.NewReader(data), int64(size), int(workers%8)+1)
+		if err != nil {
+			t.Fatalf("blake3File(%d) error = %v", size, err)
+		}
+		if !bytes.Equal(got, want[:]) {
+			t.Errorf("blake3File(%d) = %s, want %s", size, hex.EncodeToString(got), hex.EncodeToString(want[:]))
+		}
+	})
+}
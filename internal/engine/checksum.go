@@ -10,8 +10,10 @@ import (
 	"hash"
 	"io"
 	"os"
+	"runtime"
 	"strings"
 
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
 	"github.com/zeebo/blake3"
 )
 
@@ -71,8 +73,8 @@ func (c *Checksum) String() string {
 	return fmt.Sprintf("%s:%s", c.Algorithm, c.Value)
 }
 
-// newHasher creates a new hash.Hash for the given algorithm
-func newHasher(algorithm ChecksumAlgorithm) (hash.Hash, error) {
+// NewHasher creates a new hash.Hash for the given algorithm
+func NewHasher(algorithm ChecksumAlgorithm) (hash.Hash, error) {
 	switch algorithm {
 	case AlgorithmMD5:
 		return md5.New(), nil
@@ -89,7 +91,8 @@ func newHasher(algorithm ChecksumAlgorithm) (hash.Hash, error) {
 	}
 }
 
-// CalculateChecksum calculates the checksum of a file
+// CalculateChecksum calculates the checksum of a file. Large files are
+// hashed on several cores with BLAKE3.
 func CalculateChecksum(filepath string, algorithm ChecksumAlgorithm) (*Checksum, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -97,7 +100,17 @@ func CalculateChecksum(filepath string, algorithm ChecksumAlgorithm) (*Checksum,
 	}
 	defer file.Close()
 
-	hasher, err := newHasher(algorithm)
+	if algorithm == AlgorithmBLAKE3 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		if workers := runtime.GOMAXPROCS(0); useParallelBLAKE3(info.Size(), workers) {
+			return calculateBLAKE3Parallel(file, info.Size(), workers)
+		}
+	}
+
+	hasher, err := NewHasher(algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +127,7 @@ func CalculateChecksum(filepath string, algorithm ChecksumAlgorithm) (*Checksum,
 
 // CalculateChecksumReader calculates checksum from a reader
 func CalculateChecksumReader(r io.Reader, algorithm ChecksumAlgorithm) (*Checksum, error) {
-	hasher, err := newHasher(algorithm)
+	hasher, err := NewHasher(algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +156,16 @@ func VerifyChecksum(filepath string, expected *Checksum) (bool, error) {
 	return actual.Value == expected.Value, nil
 }
 
+// ChecksumMismatchError is returned when a downloaded file does not match its expected checksum
+type ChecksumMismatchError struct {
+	Expected *Checksum
+	Actual   *Checksum
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
 // ChecksumWriter wraps an io.Writer and calculates checksum while writing
 type ChecksumWriter struct {
 	writer io.Writer
@@ -152,7 +175,7 @@ type ChecksumWriter struct {
 
 // NewChecksumWriter creates a writer that calculates checksum while writing
 func NewChecksumWriter(w io.Writer, algorithm ChecksumAlgorithm) (*ChecksumWriter, error) {
-	hasher, err := newHasher(algorithm)
+	hasher, err := NewHasher(algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -186,6 +209,37 @@ func (cw *ChecksumWriter) Reset() {
 	cw.hasher.Reset()
 }
 
+// AlgorithmFromIANA returns the algorithm of an IANA hash name as used by
+// metalinks and HTTP digest fields ("sha-256"), or "" if it is not supported
+func AlgorithmFromIANA(name string) ChecksumAlgorithm {
+	switch strings.ToLower(name) {
+	case "md5":
+		return AlgorithmMD5
+	case "sha-1", "sha":
+		return AlgorithmSHA1
+	case "sha-256":
+		return AlgorithmSHA256
+	case "sha-512":
+		return AlgorithmSHA512
+	case "blake3":
+		return AlgorithmBLAKE3
+	}
+	return ""
+}
+
+// ChecksumFromDigest converts a digest announced in a response header, or
+// returns nil if its algorithm is not supported or its length is wrong
+func ChecksumFromDigest(d protocol.Digest) *Checksum {
+	algorithm := AlgorithmFromIANA(d.Algorithm)
+	if algorithm == "" {
+		return nil
+	}
+	if hasher, _ := NewHasher(algorithm); hasher.Size() != len(d.Value) {
+		return nil
+	}
+	return &Checksum{Algorithm: algorithm, Value: hex.EncodeToString(d.Value)}
+}
+
 // DetectAlgorithmFromLength tries to detect the algorithm from checksum length
 func DetectAlgorithmFromLength(checksumValue string) ChecksumAlgorithm {
 	switch len(checksumValue) {
@@ -2,9 +2,13 @@ package engine
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
 )
 
 func TestParseChecksum(t *testing.T) {
@@ -430,3 +434,22 @@ func TestParseChecksumFile(t *testing.T) {
 		})
 	}
 }
+
+func TestChecksumFromDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+
+	got := ChecksumFromDigest(protocol.Digest{Algorithm: "sha-256", Value: sum[:]})
+	if got == nil || got.Algorithm != AlgorithmSHA256 || got.Value != hex.EncodeToString(sum[:]) {
+		t.Errorf("ChecksumFromDigest(sha-256) = %+v", got)
+	}
+
+	for _, d := range []protocol.Digest{
+		{Algorithm: "sha-384", Value: make([]byte, 48)},
+		{Algorithm: "sha-512", Value: sum[:]}, // Wrong length
+		{Algorithm: "unixsum", Value: []byte{1}},
+	} {
+		if got := ChecksumFromDigest(d); got != nil {
+			t.Errorf("ChecksumFromDigest(%s) = %+v, want nil", d.Algorithm, got)
+		}
+	}
+}
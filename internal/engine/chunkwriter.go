@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kilimcininkoroglu/burkut/internal/download"
+)
+
+// DefaultWriteBufferSize is how much of a chunk is collected before each write
+const DefaultWriteBufferSize = 1024 * 1024
+
+// bufferPools holds reusable write buffers, one pool per buffer size
+var bufferPools sync.Map // int -> *sync.Pool
+
+// getBuffer returns a buffer of size bytes from the pool
+func getBuffer(size int) *[]byte {
+	pool, ok := bufferPools.Load(size)
+	if !ok {
+		pool, _ = bufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() any {
+				buf := make([]byte, size)
+				return &buf
+			},
+		})
+	}
+	return pool.(*sync.Pool).Get().(*[]byte)
+}
+
+// putBuffer returns a buffer obtained from getBuffer to its pool
+func putBuffer(buf *[]byte) {
+	if pool, ok := bufferPools.Load(len(*buf)); ok {
+		pool.(*sync.Pool).Put(buf)
+	}
+}
+
+// chunkWriter collects the data of one chunk in a pooled buffer and writes
+// it to the file in large blocks. Network reads land directly in the buffer,
+// so each byte is copied once on its way to the file, and the chunk state is
+// only updated when a block is written.
+type chunkWriter struct {
+	d      *Downloader
+	id     int
+	buf    *[]byte
+	filled int   // Bytes in buf not yet written
+	offset int64 // File offset of the first byte in buf
+
+	written  int64 // Bytes of the chunk on disk
+	received int64 // Bytes of the chunk received (atomic, read by GetProgress)
+}
+
+// newChunkWriter prepares writing chunk id from file offset, with
+// downloaded bytes of the chunk already on disk
+func (d *Downloader) newChunkWriter(id int, offset, downloaded int64) *chunkWriter {
+	size := d.config.WriteBufferSize
+	if size < d.config.BufferSize {
+		size = d.config.BufferSize
+	}
+
+	cw := &chunkWriter{
+		d:        d,
+		id:       id,
+		buf:      getBuffer(size),
+		offset:   offset,
+		written:  downloaded,
+		received: downloaded,
+	}
+	d.activeChunks.Store(id, cw)
+	return cw
+}
+
+// readFrom reads at most max bytes from r into the free part of the buffer
+func (cw *chunkWriter) readFrom(r io.Reader, max int) (int, error) {
+	end := cw.filled + max
+	if end > len(*cw.buf) {
+		end = len(*cw.buf)
+	}
+
+	n, err := r.Read((*cw.buf)[cw.filled:end])
+	if n > 0 {
+		cw.filled += n
+		atomic.AddInt64(&cw.received, int64(n))
+		atomic.AddInt64(&cw.d.downloaded, int64(n))
+	}
+	return n, err
+}
+
+// full reports whether the buffer must be written before the next read
+func (cw *chunkWriter) full() bool {
+	return cw.filled == len(*cw.buf)
+}
+
+// flush writes the buffered data to the file and records it in the state.
+// Data that could not be written no longer counts as received.
+func (cw *chunkWriter) flush() error {
+	if cw.filled == 0 {
+		return nil
+	}
+
+	n := int64(cw.filled)
+	cw.filled = 0
+
+	if _, err := cw.d.writer.WriteAt((*cw.buf)[:n], cw.offset); err != nil {
+		atomic.AddInt64(&cw.received, -n)
+		atomic.AddInt64(&cw.d.downloaded, -n)
+		return err
+	}
+	if cw.d.streaming {
+		cw.d.streamCB((*cw.buf)[:n], cw.offset)
+	}
+	if cw.d.ordered != nil {
+		cw.d.ordered.add((*cw.buf)[:n], cw.offset)
+	}
+	if cw.d.pieces != nil {
+		cw.d.pieces.add(cw.offset, n)
+	}
+
+	cw.offset += n
+	cw.written += n
+	cw.d.state.UpdateChunk(cw.id, cw.written, download.ChunkStatusInProgress)
+	return nil
+}
+
+// release returns the buffer to the pool; unflushed data is dropped
+func (cw *chunkWriter) release() {
+	if cw.filled > 0 {
+		atomic.AddInt64(&cw.d.downloaded, -int64(cw.filled))
+		cw.filled = 0
+	}
+	cw.d.activeChunks.Delete(cw.id)
+	putBuffer(cw.buf)
+	cw.buf = nil
+}
@@ -3,8 +3,10 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +27,8 @@ type Progress struct {
 	ElapsedTime  time.Duration
 	ETA          time.Duration // Estimated time remaining
 	RemainingETA time.Duration // Deprecated: use ETA
+	Protocol     string        // Negotiated protocol, e.g. "HTTP/2.0" or "HTTP/3.0"
+	SingleStream string        // Why the download fell back to one stream ("" if it did not)
 }
 
 // ChunkProgress represents progress of a single chunk
@@ -41,33 +45,77 @@ type ChunkProgress struct {
 // ProgressCallback is called periodically with progress updates
 type ProgressCallback func(Progress)
 
+// NoticeCallback is called with messages worth logging, such as a fallback
+// to a single stream
+type NoticeCallback func(msg string)
+
+// StreamCallback receives the file's data in order as it is written, for
+// consumers such as on-the-fly extraction. p must not be kept after the call.
+type StreamCallback func(p []byte, offset int64)
+
+// SignatureVerifier checks a complete file against a detached signature
+type SignatureVerifier interface {
+	VerifyFile(path string) error
+}
+
 // DownloaderConfig holds configuration for the downloader
 type DownloaderConfig struct {
-	Connections      int
-	BufferSize       int
-	ProgressInterval time.Duration
-	SaveInterval     time.Duration
-	RateLimiter      *RateLimiter // Optional rate limiter
+	Connections       int
+	BufferSize        int // Largest single read from the network
+	WriteBufferSize   int // Bytes collected per chunk before each write
+	ProgressInterval  time.Duration
+	SaveInterval      time.Duration
+	RateLimiter       *RateLimiter           // Optional rate limiter
+	Backoff           *HostBackoff           // Optional per-host backoff shared between downloads
+	ThrottleRetries   int                    // Retries per request after a 429/503 response
+	PartSuffix        string                 // Suffix of the file written until the download is complete ("" writes in place)
+	Checksum          *Checksum              // Optional checksum verified before the file is moved into place
+	Signature         SignatureVerifier      // Optional detached signature verified after the checksum
+	Allocation        storage.AllocationMode // How disk space is reserved for a new file
+	ReorderBufferSize int64                  // Memory for data arriving ahead of the ordered writer or inline hash
+	Pieces            PieceVerifier          // Optional piece hashes checked as each piece is written
+	RepairURLs        []string               // Other sources of the file for pieces failing verification
+	ExpectedSize      int64                  // Size the file must have, 0 if unknown; checked before anything is written
 }
 
 // DefaultConfig returns default downloader configuration
 func DefaultConfig() DownloaderConfig {
 	return DownloaderConfig{
-		Connections:      4,
-		BufferSize:       32 * 1024, // 32KB buffer
-		ProgressInterval: 100 * time.Millisecond,
-		SaveInterval:     5 * time.Second,
-		RateLimiter:      nil,
+		Connections:       4,
+		BufferSize:        32 * 1024, // 32KB buffer
+		WriteBufferSize:   DefaultWriteBufferSize,
+		ProgressInterval:  100 * time.Millisecond,
+		SaveInterval:      5 * time.Second,
+		RateLimiter:       nil,
+		ThrottleRetries:   10,
+		PartSuffix:        storage.DefaultPartSuffix,
+		Allocation:        storage.DefaultAllocationMode,
+		ReorderBufferSize: DefaultReorderBufferSize,
 	}
 }
 
+// SizeMismatchError is returned when the server's file is not the expected size
+type SizeMismatchError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeMismatchError) Error() string {
+	return fmt.Sprintf("size mismatch: expected %d bytes, server has %d", e.Expected, e.Actual)
+}
+
 // Downloader manages the download of a single file
 type Downloader struct {
 	config     DownloaderConfig
 	httpClient *protocol.HTTPClient
+	backoff    *HostBackoff
 	state      *download.State
 	writer     *storage.FileWriter
 	outputPath string
+	partPath   string         // File written while downloading, renamed to outputPath on success
+	allocTime  time.Duration  // Time spent reserving disk space
+	probeBody  io.ReadCloser  // Whole-file response left over from the metadata probe
+	known      *knownMetadata // Metadata the caller already fetched, used once
 
 	// Progress tracking
 	downloaded   int64
@@ -75,7 +123,16 @@ type Downloader struct {
 	lastBytes    int64
 	lastTime     time.Time
 	speedSamples []int64
+	activeChunks sync.Map // Chunk ID -> *chunkWriter, for lock-free chunk progress
 	progressCB   ProgressCallback
+	noticeCB     NoticeCallback
+	streamCB     StreamCallback
+	streaming    bool // The download is one stream from the start of the file
+	orderedW     io.Writer
+	ordered      *orderedStream
+	inlineSum    *ChecksumWriter // Hashes the file as it is written, unless resumed
+	pieces       *pieceTracker   // Verifies pieces as they complete
+	meta         *protocol.Metadata
 
 	// Synchronization
 	mu       sync.RWMutex
@@ -84,11 +141,25 @@ type Downloader struct {
 	doneChan chan struct{}
 }
 
+// knownMetadata is the metadata of a URL fetched before the download
+type knownMetadata struct {
+	url  string
+	meta *protocol.Metadata
+	body io.ReadCloser
+}
+
 // NewDownloader creates a new Downloader
 func NewDownloader(config DownloaderConfig, httpClient *protocol.HTTPClient) *Downloader {
+	backoff := config.Backoff
+	if backoff == nil {
+		// Chunks of a single download still coordinate with each other
+		backoff = NewHostBackoff(DefaultBackoffConfig())
+	}
+
 	return &Downloader{
 		config:       config,
 		httpClient:   httpClient,
+		backoff:      backoff,
 		speedSamples: make([]int64, 0, 10),
 		doneChan:     make(chan struct{}),
 	}
@@ -99,23 +170,94 @@ func (d *Downloader) SetProgressCallback(cb ProgressCallback) {
 	d.progressCB = cb
 }
 
+// SetNoticeCallback sets the function receiving notices
+func (d *Downloader) SetNoticeCallback(cb NoticeCallback) {
+	d.noticeCB = cb
+}
+
+// SetStreamCallback sets the function receiving the file's data in order.
+// It is only called when the download runs as a single stream from the
+// beginning of the file; parallel and resumed downloads do not use it.
+func (d *Downloader) SetStreamCallback(cb StreamCallback) {
+	d.streamCB = cb
+}
+
+// SetOrderedWriter sets a writer receiving the whole file in byte order while
+// it downloads, whatever the number of connections. Data arriving ahead of
+// the writer is held in memory up to ReorderBufferSize bytes and read back
+// from the file beyond that. Download returns once w has received the whole
+// file, and fails if w does.
+func (d *Downloader) SetOrderedWriter(w io.Writer) {
+	d.orderedW = w
+}
+
+// SetMetadata gives the metadata of url the caller already fetched, so the
+// next download of url does not request it again. body is the response left
+// over from HTTPClient.Probe, or nil; the downloader closes it.
+func (d *Downloader) SetMetadata(url string, meta *protocol.Metadata, body io.ReadCloser) {
+	d.takeKnownMetadata("")
+	d.known = &knownMetadata{url: url, meta: meta, body: body}
+}
+
+// takeKnownMetadata returns the metadata set for url and its probe body, and
+// forgets it; metadata set for another URL is dropped
+func (d *Downloader) takeKnownMetadata(url string) (*protocol.Metadata, io.ReadCloser) {
+	known := d.known
+	d.known = nil
+	if known == nil {
+		return nil, nil
+	}
+	if known.url != url {
+		if known.body != nil {
+			known.body.Close()
+		}
+		return nil, nil
+	}
+	return known.meta, known.body
+}
+
+// notice reports msg to the notice callback, if any
+func (d *Downloader) notice(format string, args ...any) {
+	if d.noticeCB != nil {
+		d.noticeCB(fmt.Sprintf(format, args...))
+	}
+}
+
 // Download starts downloading from the given URL to the output path
 func (d *Downloader) Download(ctx context.Context, url, outputPath string) error {
 	d.outputPath = outputPath
+	d.partPath = storage.PartPath(outputPath, d.config.PartSuffix)
 
 	// Create cancellable context
 	ctx, d.cancel = context.WithCancel(ctx)
 	defer d.cancel()
 
-	// Get file metadata
-	meta, err := d.httpClient.Head(ctx, url)
-	if err != nil {
-		return fmt.Errorf("getting file metadata: %w", err)
+	// Get file metadata, unless the caller already did
+	var err error
+	meta, body := d.takeKnownMetadata(url)
+	d.probeBody = body
+	if meta == nil {
+		err = d.withBackoff(ctx, url, func() error {
+			var probeErr error
+			meta, d.probeBody, probeErr = d.httpClient.Probe(ctx, url)
+			return probeErr
+		})
+		if err != nil {
+			return fmt.Errorf("getting file metadata: %w", err)
+		}
+	}
+	defer d.closeProbeBody()
+	d.meta = meta
+
+	// A source serving a file of another size has the wrong file
+	if d.config.ExpectedSize > 0 && meta.ContentLength > 0 && meta.ContentLength != d.config.ExpectedSize {
+		return &SizeMismatchError{Expected: d.config.ExpectedSize, Actual: meta.ContentLength}
 	}
 
 	// Check for existing state (resume)
-	if download.StateExists(outputPath) {
-		d.state, err = download.LoadState(outputPath)
+	d.adoptInPlaceDownload()
+	if download.StateExists(d.partPath) {
+		d.state, err = download.LoadState(d.partPath)
 		if err != nil {
 			// Corrupted state, start fresh
 			d.state = nil
@@ -137,17 +279,55 @@ func (d *Downloader) Download(ctx context.Context, url, outputPath string) error
 		d.state.InitializeChunks(numChunks)
 	}
 
+	// A resumed download continues where it stopped instead of using the probe
+	if d.state.Downloaded > 0 {
+		d.closeProbeBody()
+	}
+	d.streaming = d.streamCB != nil && d.state.Downloaded == 0 && len(d.state.CopyChunks()) == 1
+
+	// Fail now rather than near the end if the rest of the file cannot fit
+	if d.state.TotalSize > 0 {
+		if err := storage.CheckFreeSpace(d.partPath, d.state.TotalSize-d.state.Downloaded); err != nil {
+			return err
+		}
+	}
+
 	// Create or open file writer
-	if storage.FileExists(outputPath) && d.state.Downloaded > 0 {
-		d.writer, err = storage.OpenFileWriter(outputPath, meta.ContentLength)
+	if storage.FileExists(d.partPath) && d.state.Downloaded > 0 {
+		d.writer, err = storage.OpenFileWriter(d.partPath, meta.ContentLength)
 	} else {
-		d.writer, err = storage.NewFileWriter(outputPath, meta.ContentLength)
+		d.writer, err = d.createWriter(meta.ContentLength)
 	}
 	if err != nil {
 		return fmt.Errorf("creating file writer: %w", err)
 	}
 	defer d.writer.Close()
 
+	// A fresh download is hashed as it arrives so it is not read again to
+	// verify it; a resumed one is hashed after it completes
+	if d.config.Checksum != nil && d.state.Downloaded == 0 {
+		d.inlineSum, _ = NewChecksumWriter(io.Discard, d.config.Checksum.Algorithm)
+	}
+
+	if d.orderedW != nil || d.inlineSum != nil {
+		file, err := d.startOrderedStream()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		defer d.ordered.abort()
+	}
+
+	if d.config.Pieces != nil && d.state.TotalSize > 0 {
+		file, err := d.startPieceTracker()
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			defer file.Close()
+		}
+	}
+
 	// Record start time
 	d.startTime = time.Now()
 	d.lastTime = d.startTime
@@ -162,29 +342,165 @@ func (d *Downloader) Download(ctx context.Context, url, outputPath string) error
 	// Download chunks
 	if err := d.downloadChunks(ctx, url); err != nil {
 		// Save state on error for resume
-		d.state.Save(outputPath)
+		d.state.Save(d.partPath)
+		if d.ordered != nil {
+			if writeErr := d.ordered.failed(); writeErr != nil {
+				return &OrderedWriterError{Err: writeErr}
+			}
+		}
 		return err
 	}
 
-	// Download complete - remove state file
-	download.DeleteState(outputPath)
+	// Truncate file to its exact size (known up front or found at EOF)
+	if d.state.TotalSize >= 0 {
+		d.writer.Truncate(d.state.TotalSize)
+	}
+
+	// Only the pieces that failed verification are fetched again
+	if d.pieces != nil {
+		if err := d.repairPieces(ctx, url, d.pieces.badPieces()); err != nil {
+			d.state.Save(d.partPath)
+			return err
+		}
+	}
+
+	// The ordered writer catches up before the file is moved into place
+	if d.ordered != nil {
+		if err := d.ordered.finish(d.state.TotalSize); err != nil {
+			d.state.Save(d.partPath)
+			return &OrderedWriterError{Err: err}
+		}
+	}
 
-	// Truncate file to exact size if known
-	if meta.ContentLength > 0 {
-		d.writer.Truncate(meta.ContentLength)
+	if err := d.finalize(meta.LastModified); err != nil {
+		return err
 	}
 
+	// Download complete - remove state file
+	download.DeleteState(d.partPath)
+
 	close(d.doneChan)
 	return nil
 }
 
-// downloadChunks downloads all chunks in parallel
+// startOrderedStream starts passing the file in order to the ordered writer
+// and the inline hash, beginning with the parts an earlier run already wrote
+func (d *Downloader) startOrderedStream() (*os.File, error) {
+	file, err := os.Open(d.partPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for ordered output: %w", err)
+	}
+
+	limit := d.config.ReorderBufferSize
+	if limit <= 0 {
+		limit = DefaultReorderBufferSize
+	}
+	var w io.Writer
+	switch {
+	case d.orderedW == nil:
+		w = d.inlineSum
+	case d.inlineSum == nil:
+		w = d.orderedW
+	default:
+		w = io.MultiWriter(d.inlineSum, d.orderedW)
+	}
+	d.ordered = newOrderedStream(w, file, limit, d.cancel)
+	for _, chunk := range d.state.CopyChunks() {
+		d.ordered.addOnDisk(chunk.Start, chunk.Downloaded)
+	}
+	return file, nil
+}
+
+// startPieceTracker starts verifying pieces as they complete, beginning
+// with those an earlier run already wrote. It returns the file the pieces
+// are read from, or nil if the piece hashes do not fit the file.
+func (d *Downloader) startPieceTracker() (*os.File, error) {
+	if !piecesFit(d.config.Pieces, d.state.TotalSize) {
+		d.notice("%d pieces of %d bytes do not fit a file of %d bytes, not verifying pieces",
+			d.config.Pieces.PieceCount(), d.config.Pieces.PieceLength(), d.state.TotalSize)
+		return nil, nil
+	}
+
+	file, err := os.Open(d.partPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for piece verification: %w", err)
+	}
+	d.pieces = newPieceTracker(d.config.Pieces, d.state.TotalSize, file, func(err error) {
+		d.notice("cannot verify pieces: %v", err)
+	})
+	for _, chunk := range d.state.CopyChunks() {
+		d.pieces.add(chunk.Start, chunk.Downloaded)
+	}
+	return file, nil
+}
+
+// repairPieces fetches the bad pieces again, trying the other sources of the
+// file before url
+func (d *Downloader) repairPieces(ctx context.Context, url string, bad []int) error {
+	if len(bad) == 0 {
+		return nil
+	}
+	// Data already passed on while downloading cannot be taken back
+	if d.orderedW != nil || d.streaming {
+		return &PieceError{Pieces: bad}
+	}
+	d.notice("%d of %d pieces failed verification, fetching them again", len(bad), d.config.Pieces.PieceCount())
+
+	// The inline hash has seen the bad data, so the file is hashed again
+	if d.inlineSum != nil {
+		d.ordered.abort()
+		d.ordered = nil
+		d.inlineSum = nil
+	}
+
+	var urls []string
+	for _, u := range d.config.RepairURLs {
+		if u != url {
+			urls = append(urls, u)
+		}
+	}
+	urls = append(urls, url)
+	return RepairPieces(ctx, d.httpClient, d.partPath, d.state.TotalSize, d.config.Pieces, bad, urls)
+}
+
+// downloadChunks downloads all chunks in parallel.
+// If the server turns out not to honor ranges, the download is restarted as
+// a single stream.
 func (d *Downloader) downloadChunks(ctx context.Context, url string) error {
+	err := d.runChunks(ctx, url)
+
+	var rangeErr *protocol.RangeError
+	if errors.As(err, &rangeErr) && !d.state.SingleStream && ctx.Err() == nil {
+		d.downgrade(rangeErr.Reason)
+		return d.runChunks(ctx, url)
+	}
+	return err
+}
+
+// downgrade switches the download to a single stream over the whole file
+func (d *Downloader) downgrade(reason string) {
+	d.notice("server does not honor range requests (%s), falling back to a single stream", reason)
+
+	d.state.DowngradeToSingleStream(reason)
+	atomic.StoreInt64(&d.downloaded, 0)
+	if d.pieces != nil {
+		d.pieces.reset()
+	}
+	d.streaming = d.streamCB != nil // The file is fetched again from its start
+	d.state.Save(d.partPath)
+}
+
+// runChunks downloads the pending chunks in parallel.
+// A range error stops the other chunks, since their data cannot be trusted.
+func (d *Downloader) runChunks(ctx context.Context, url string) error {
 	pendingChunks := d.state.GetPendingChunks()
 	if len(pendingChunks) == 0 {
 		return nil // Already complete
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	errChan := make(chan error, len(pendingChunks))
 	semaphore := make(chan struct{}, d.config.Connections)
 
@@ -197,6 +513,9 @@ func (d *Downloader) downloadChunks(ctx context.Context, url string) error {
 			defer func() { <-semaphore }() // Release
 
 			if err := d.downloadChunk(ctx, url, c); err != nil {
+				if protocol.IsRangeError(err) {
+					cancel()
+				}
 				select {
 				case errChan <- fmt.Errorf("chunk %d: %w", c.ID, err):
 				default:
@@ -209,16 +528,54 @@ func (d *Downloader) downloadChunks(ctx context.Context, url string) error {
 	d.wg.Wait()
 	close(errChan)
 
-	// Check for errors
-	if err := <-errChan; err != nil {
-		return err
+	// Check for errors, preferring a range error over the cancellations it caused
+	var firstErr error
+	for err := range errChan {
+		if protocol.IsRangeError(err) {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	return nil
+	return firstErr
 }
 
-// downloadChunk downloads a single chunk
+// withBackoff runs fn while holding a connection slot for the URL's host.
+// If the server throttles the request, the host is paused and fn is retried.
+func (d *Downloader) withBackoff(ctx context.Context, url string, fn func() error) error {
+	host := HostKey(url)
+
+	for attempt := 0; ; attempt++ {
+		release, err := d.backoff.Acquire(ctx, host)
+		if err != nil {
+			return err
+		}
+		err = fn()
+
+		retryAfter, throttled := protocol.IsThrottled(err)
+		if throttled {
+			// Throttle while still holding the slot so it counts towards current concurrency
+			d.backoff.Throttle(host, retryAfter)
+		}
+		release()
+
+		if !throttled || attempt >= d.config.ThrottleRetries {
+			return err
+		}
+	}
+}
+
+// downloadChunk downloads a single chunk, backing off when the server throttles
 func (d *Downloader) downloadChunk(ctx context.Context, url string, chunk download.Chunk) error {
+	return d.withBackoff(ctx, url, func() error {
+		return d.fetchChunk(ctx, url, chunk)
+	})
+}
+
+// fetchChunk performs a single request for a chunk and writes the data
+func (d *Downloader) fetchChunk(ctx context.Context, url string, chunk download.Chunk) error {
 	// Mark chunk as in progress
 	d.state.UpdateChunk(chunk.ID, chunk.Downloaded, download.ChunkStatusInProgress)
 
@@ -229,8 +586,24 @@ func (d *Downloader) downloadChunk(ctx context.Context, url string, chunk downlo
 	start := chunk.CurrentPosition()
 	end := chunk.End
 
-	if end < 0 {
-		// Unknown size - download everything
+	if body := d.takeProbeBody(start, end); body != nil {
+		// The probe request is already streaming the whole file
+		reader = body
+	} else if end < 0 && chunk.Downloaded > 0 && !d.state.SingleStream {
+		// Unknown size - continue after the bytes already written if the
+		// server allows it, otherwise start over
+		reader, err = d.httpClient.GetRangeFrom(ctx, url, start)
+		if protocol.IsRangeError(err) {
+			d.notice("server cannot resume a download of unknown length (%v), restarting", err)
+			d.discardChunk(&chunk)
+			start = 0
+			reader, _, err = d.httpClient.Get(ctx, url)
+		}
+	} else if end < 0 || d.state.SingleStream {
+		// Unknown size or no range support - download everything from the
+		// beginning, dropping anything an earlier attempt wrote
+		d.discardChunk(&chunk)
+		start = 0
 		reader, _, err = d.httpClient.Get(ctx, url)
 	} else if start > end {
 		// Chunk already complete
@@ -247,57 +620,196 @@ func (d *Downloader) downloadChunk(ctx context.Context, url string, chunk downlo
 	}
 	defer reader.Close()
 
-	// Download with buffer
-	buffer := make([]byte, d.config.BufferSize)
-	offset := start
-	downloaded := chunk.Downloaded
+	// Never write past the end of the chunk
+	var body io.Reader = reader
+	if end >= 0 {
+		body = io.LimitReader(reader, end-start+1)
+	}
+
+	// Reads land in a pooled buffer that is written out in large blocks
+	cw := d.newChunkWriter(chunk.ID, start, chunk.Downloaded)
+	defer cw.release()
 
 	for {
 		select {
 		case <-ctx.Done():
-			d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusPending)
+			cw.flush()
+			d.state.UpdateChunk(chunk.ID, cw.written, download.ChunkStatusPending)
 			return ctx.Err()
 		default:
 		}
 
-		n, err := reader.Read(buffer)
+		n, err := cw.readFrom(body, d.config.BufferSize)
 		if n > 0 {
 			// Apply rate limiting if configured
 			if d.config.RateLimiter != nil {
 				if limitErr := d.config.RateLimiter.Acquire(ctx, int64(n)); limitErr != nil {
-					d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusPending)
+					cw.flush()
+					d.state.UpdateChunk(chunk.ID, cw.written, download.ChunkStatusPending)
 					return limitErr
 				}
 			}
 
-			// Write to file
-			if _, writeErr := d.writer.WriteAt(buffer[:n], offset); writeErr != nil {
-				d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusFailed)
-				return writeErr
+			// Write to file once the buffer is full
+			if cw.full() {
+				if writeErr := cw.flush(); writeErr != nil {
+					d.state.UpdateChunk(chunk.ID, cw.written, download.ChunkStatusFailed)
+					return writeErr
+				}
 			}
-
-			offset += int64(n)
-			downloaded += int64(n)
-
-			// Update progress
-			atomic.AddInt64(&d.downloaded, int64(n))
-			d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusInProgress)
 		}
 
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusFailed)
+			cw.flush()
+			d.state.UpdateChunk(chunk.ID, cw.written, download.ChunkStatusFailed)
 			return err
 		}
 	}
 
+	if err := cw.flush(); err != nil {
+		d.state.UpdateChunk(chunk.ID, cw.written, download.ChunkStatusFailed)
+		return err
+	}
+	offset, downloaded := cw.offset, cw.written
+
+	// The stream has ended, so a download of unknown length now has a size
+	if end < 0 {
+		d.state.FinalizeSize(offset)
+	}
+
+	// A body that ends early leaves a hole in the file
+	if end >= 0 && downloaded < chunk.Size() {
+		d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusFailed)
+		return fmt.Errorf("received %d of %d bytes: %w", downloaded, chunk.Size(), io.ErrUnexpectedEOF)
+	}
+
 	// Mark chunk complete
 	d.state.UpdateChunk(chunk.ID, downloaded, download.ChunkStatusCompleted)
 	return nil
 }
 
+// createWriter creates the part file, reserving space with the configured
+// allocation mode. Where fallocate is unavailable, the size is set with
+// ftruncate instead.
+func (d *Downloader) createWriter(size int64) (*storage.FileWriter, error) {
+	mode := d.config.Allocation
+	if mode == "" {
+		mode = storage.DefaultAllocationMode
+	}
+
+	start := time.Now()
+	writer, err := storage.NewFileWriterWithAllocation(d.partPath, size, mode)
+	if errors.Is(err, storage.ErrFallocateUnsupported) {
+		d.notice("%v, using trunc allocation", err)
+		writer, err = storage.NewFileWriterWithAllocation(d.partPath, size, storage.AllocTrunc)
+	}
+	d.allocTime = time.Since(start)
+
+	return writer, err
+}
+
+// AllocationTime returns how long reserving disk space for the file took
+func (d *Downloader) AllocationTime() time.Duration {
+	return d.allocTime
+}
+
+// finalize flushes the finished file to disk, verifies its checksum and
+// moves it to the output path. A file failing verification is removed, so
+// nothing is ever left under the final name.
+func (d *Downloader) finalize(modTime time.Time) error {
+	if err := d.writer.Sync(); err != nil {
+		return fmt.Errorf("syncing file: %w", err)
+	}
+	if err := d.writer.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
+
+	if expected := d.config.Checksum; expected != nil {
+		actual, err := d.checksum(expected.Algorithm)
+		if err != nil {
+			return fmt.Errorf("verifying checksum: %w", err)
+		}
+		if actual.Value != expected.Value {
+			storage.RemoveFile(d.partPath)
+			download.DeleteState(d.partPath)
+			return &ChecksumMismatchError{Expected: expected, Actual: actual}
+		}
+	}
+
+	if d.config.Signature != nil {
+		if err := d.config.Signature.VerifyFile(d.partPath); err != nil {
+			storage.RemoveFile(d.partPath)
+			download.DeleteState(d.partPath)
+			return err
+		}
+	}
+
+	// Set before the rename so watchers never see the file with the wrong time
+	if err := SetFileModTime(d.partPath, modTime); err != nil {
+		d.notice("could not set modification time: %v", err)
+	}
+
+	return storage.CommitFile(d.partPath, d.outputPath)
+}
+
+// checksum returns the checksum of the finished part file, reading it again
+// only if it was not hashed while downloading
+func (d *Downloader) checksum(algorithm ChecksumAlgorithm) (*Checksum, error) {
+	if d.inlineSum != nil {
+		return d.inlineSum.Checksum(), nil
+	}
+	return CalculateChecksum(d.partPath, algorithm)
+}
+
+// adoptInPlaceDownload moves an unfinished download that was written
+// directly to the output path over to the part file, so it can resume
+func (d *Downloader) adoptInPlaceDownload() {
+	if d.partPath == d.outputPath || download.StateExists(d.partPath) || !download.StateExists(d.outputPath) {
+		return
+	}
+
+	if err := os.Rename(d.outputPath, d.partPath); err != nil {
+		return
+	}
+	os.Rename(download.StateFilePath(d.outputPath), download.StateFilePath(d.partPath))
+}
+
+// discardChunk forgets the bytes of chunk written by earlier attempts
+func (d *Downloader) discardChunk(chunk *download.Chunk) {
+	if chunk.Downloaded > 0 {
+		atomic.AddInt64(&d.downloaded, -chunk.Downloaded)
+		chunk.Downloaded = 0
+		if d.pieces != nil {
+			d.pieces.reset()
+		}
+	}
+}
+
+// takeProbeBody hands out the probe response if the range start-end covers
+// the whole file. It returns nil if there is no such response or it was taken.
+func (d *Downloader) takeProbeBody(start, end int64) io.ReadCloser {
+	if start != 0 || (end >= 0 && end != d.state.TotalSize-1) {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	body := d.probeBody
+	d.probeBody = nil
+	return body
+}
+
+// closeProbeBody closes the probe response if no chunk used it
+func (d *Downloader) closeProbeBody() {
+	if body := d.takeProbeBody(0, -1); body != nil {
+		body.Close()
+	}
+}
+
 // progressReporter periodically reports progress
 func (d *Downloader) progressReporter(ctx context.Context) {
 	ticker := time.NewTicker(d.config.ProgressInterval)
@@ -329,16 +841,27 @@ func (d *Downloader) stateSaver(ctx context.Context) {
 		case <-d.doneChan:
 			return
 		case <-ticker.C:
-			d.state.Save(d.outputPath)
+			d.state.Save(d.partPath)
 		}
 	}
 }
 
+// Metadata returns the file metadata the server reported when the last
+// download started, or nil before a download
+func (d *Downloader) Metadata() *protocol.Metadata {
+	return d.meta
+}
+
 // GetProgress returns current download progress
 func (d *Downloader) GetProgress() Progress {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
+	// A download failing before it starts, e.g. at the probe, has no progress
+	if d.state == nil {
+		return Progress{}
+	}
+
 	now := time.Now()
 	currentBytes := atomic.LoadInt64(&d.downloaded)
 	elapsed := now.Sub(d.startTime)
@@ -384,13 +907,20 @@ func (d *Downloader) GetProgress() Progress {
 	}
 
 	// Build chunk progress
-	chunkProgress := make([]ChunkProgress, len(d.state.Chunks))
-	for i, chunk := range d.state.Chunks {
+	chunks := d.state.CopyChunks()
+	chunkProgress := make([]ChunkProgress, len(chunks))
+	for i, chunk := range chunks {
+		// Running chunks count bytes not yet written to disk
+		downloaded := chunk.Downloaded
+		if cw, ok := d.activeChunks.Load(chunk.ID); ok {
+			downloaded = atomic.LoadInt64(&cw.(*chunkWriter).received)
+		}
+
 		chunkProgress[i] = ChunkProgress{
 			ID:         chunk.ID,
 			Start:      chunk.Start,
 			End:        chunk.End,
-			Downloaded: chunk.Downloaded,
+			Downloaded: downloaded,
 			Total:      chunk.Size(),
 			Status:     chunk.Status,
 		}
@@ -406,6 +936,8 @@ func (d *Downloader) GetProgress() Progress {
 		ElapsedTime:  elapsed,
 		ETA:          eta,
 		RemainingETA: eta, // Deprecated
+		Protocol:     d.httpClient.Protocol(),
+		SingleStream: d.state.Downgraded(),
 	}
 }
 
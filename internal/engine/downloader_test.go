@@ -1,20 +1,27 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/kilimcininkoroglu/burkut/internal/download"
 	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+	"github.com/kilimcininkoroglu/burkut/internal/storage"
 )
 
 // createTestServer creates a test HTTP server with the given content
@@ -304,3 +311,763 @@ func TestDefaultConfig(t *testing.T) {
 
 // Ensure imports are used
 var _ = io.EOF
+
+func TestDownloader_ThrottledChunksBackOff(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.Read(content)
+
+	inner := createTestServer(t, content)
+	defer inner.Close()
+
+	// Reject the first two range requests with 429 + Retry-After
+	var throttled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" && atomic.AddInt32(&throttled, 1) <= 2 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		req, _ := http.NewRequest(r.Method, inner.URL+r.URL.Path, nil)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "throttled.bin")
+
+	config := DefaultConfig()
+	config.Connections = 4
+	config.Backoff = NewHostBackoff(BackoffConfig{
+		InitialDelay:     10 * time.Millisecond,
+		MaxDelay:         50 * time.Millisecond, // Cap Retry-After to keep the test fast
+		RecoveryInterval: 10 * time.Millisecond,
+	})
+	downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+	start := time.Now()
+	if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Download() finished in %v, expected it to pause after 429", elapsed)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(data) != string(content) {
+		t.Error("downloaded content does not match")
+	}
+}
+
+func TestDownloader_IgnoredRangeFallsBack(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.Read(content)
+
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter)
+	}{
+		{
+			name: "200 instead of 206",
+			respond: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusOK)
+				w.Write(content)
+			},
+		},
+		{
+			name: "wrong Content-Range",
+			respond: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// HEAD advertises range support, but GETs always return the whole file
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				if r.Method == http.MethodHead {
+					return
+				}
+				if r.Header.Get("Range") == "" {
+					w.WriteHeader(http.StatusOK)
+					w.Write(content)
+					return
+				}
+				tt.respond(w)
+			}))
+			defer server.Close()
+
+			outputPath := filepath.Join(t.TempDir(), "ignored.bin")
+
+			config := DefaultConfig()
+			config.Connections = 4
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			var notices int32
+			downloader.SetNoticeCallback(func(msg string) {
+				atomic.AddInt32(&notices, 1)
+			})
+
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("downloaded %d bytes, content does not match", len(data))
+			}
+			if atomic.LoadInt32(&notices) == 0 {
+				t.Error("expected a notice about the single-stream fallback")
+			}
+			if downloader.GetProgress().SingleStream == "" {
+				t.Error("Progress.SingleStream should report the downgrade reason")
+			}
+		})
+	}
+}
+
+func TestDownloader_HeadRejected(t *testing.T) {
+	content := make([]byte, 256*1024)
+	rand.Read(content)
+
+	tests := []struct {
+		name        string
+		honorRange  bool
+		wantMaxGets int32
+	}{
+		{"ranged GET probe", true, 1 + 4},
+		{"probe response reused", false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				atomic.AddInt32(&gets, 1)
+				if !tt.honorRange {
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					w.Write(content)
+					return
+				}
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			outputPath := filepath.Join(t.TempDir(), "presigned.bin")
+
+			config := DefaultConfig()
+			config.Connections = 4
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin?sig=abc", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("downloaded %d bytes, content does not match", len(data))
+			}
+			if got := atomic.LoadInt32(&gets); got > tt.wantMaxGets {
+				t.Errorf("GET requests = %d, want at most %d", got, tt.wantMaxGets)
+			}
+		})
+	}
+}
+
+func TestDownloader_ResumeUnknownLength(t *testing.T) {
+	content := make([]byte, 512*1024)
+	rand.Read(content)
+	cut := len(content) / 3
+
+	var ranges []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return // No Content-Length: the size is unknown
+		}
+
+		rangeHeader := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rangeHeader)
+		mu.Unlock()
+
+		if rangeHeader == "" {
+			// Stream part of the file with chunked encoding, then drop the connection
+			w.Write(content[:cut])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		var start int
+		fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, len(content)-1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.(http.Flusher).Flush()
+		w.Write(content[start:])
+	}))
+	defer server.Close()
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+	outputPath := filepath.Join(t.TempDir(), "stream.tar")
+
+	// First attempt is interrupted and leaves state behind
+	first := NewDownloader(DefaultConfig(), protocol.NewHTTPClient())
+	if err := first.Download(context.Background(), server.URL+"/stream.tar", outputPath); err == nil {
+		t.Fatal("first Download() should fail")
+	}
+	if !download.StateExists(outputPath + ".part") {
+		t.Fatal("state file not saved next to the part file")
+	}
+	if storage.FileExists(outputPath) {
+		t.Fatal("unfinished download left under the final name")
+	}
+
+	// Second attempt continues after the bytes already written
+	second := NewDownloader(DefaultConfig(), protocol.NewHTTPClient())
+	if err := second.Download(context.Background(), server.URL+"/stream.tar", outputPath); err != nil {
+		t.Fatalf("second Download() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes, content does not match", len(data))
+	}
+	if want := fmt.Sprintf("bytes=%d-", cut); len(ranges) != 2 || ranges[1] != want {
+		t.Errorf("Range headers = %q, want second request with %q", ranges, want)
+	}
+	if got := second.State().TotalSize; got != int64(len(content)) {
+		t.Errorf("TotalSize = %d, want %d", got, len(content))
+	}
+}
+
+// rejectingVerifier fails every signature check
+type rejectingVerifier struct{}
+
+func (rejectingVerifier) VerifyFile(path string) error {
+	return errors.New("bad signature")
+}
+
+func TestDownloader_AtomicFinalize(t *testing.T) {
+	content := make([]byte, 128*1024)
+	rand.Read(content)
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	good, err := CalculateChecksumReader(bytes.NewReader(content), AlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("CalculateChecksumReader() error = %v", err)
+	}
+	bad := &Checksum{Algorithm: AlgorithmSHA256, Value: strings.Repeat("0", 64)}
+
+	t.Run("verified", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+		config := DefaultConfig()
+		config.Checksum = good
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+		if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+
+		info, err := os.Stat(outputPath)
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("ModTime = %v, want %v", info.ModTime(), modTime)
+		}
+		if storage.FileExists(outputPath+".part") || download.StateExists(outputPath+".part") {
+			t.Error("part file or state left behind")
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+		config := DefaultConfig()
+		config.Checksum = bad
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+		err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath)
+		var mismatch *ChecksumMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("Download() error = %v, want ChecksumMismatchError", err)
+		}
+		if mismatch.Actual.Value != good.Value {
+			t.Errorf("Actual = %s, want %s", mismatch.Actual, good)
+		}
+		if storage.FileExists(outputPath) {
+			t.Error("file failing verification left under the final name")
+		}
+		if storage.FileExists(outputPath+".part") || download.StateExists(outputPath+".part") {
+			t.Error("part file or state left behind")
+		}
+	})
+
+	t.Run("signature rejected", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+		config := DefaultConfig()
+		config.Checksum = good
+		config.Signature = rejectingVerifier{}
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+		err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath)
+		if err == nil || err.Error() != "bad signature" {
+			t.Fatalf("Download() error = %v, want the verifier's error", err)
+		}
+		if storage.FileExists(outputPath) || storage.FileExists(outputPath+".part") {
+			t.Error("file failing signature verification left behind")
+		}
+	})
+
+	t.Run("in place", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+		config := DefaultConfig()
+		config.PartSuffix = ""
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+		if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("ReadFile() = %d bytes, %v", len(data), err)
+		}
+	})
+}
+
+func TestDownloader_InsufficientSpace(t *testing.T) {
+	if _, err := storage.FreeSpace(t.TempDir()); err != nil {
+		t.Skipf("free space unavailable: %v", err)
+	}
+
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.FormatInt(1<<62, 10))
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "huge.bin")
+	downloader := NewDownloader(DefaultConfig(), protocol.NewHTTPClient())
+
+	err := downloader.Download(context.Background(), server.URL+"/huge.bin", outputPath)
+	var noSpace *storage.InsufficientSpaceError
+	if !errors.As(err, &noSpace) {
+		t.Fatalf("Download() error = %v, want InsufficientSpaceError", err)
+	}
+	if atomic.LoadInt32(&gets) != 0 {
+		t.Error("Download() fetched data despite the lack of space")
+	}
+	if storage.FileExists(outputPath + ".part") {
+		t.Error("part file created despite the lack of space")
+	}
+}
+
+func TestDownloader_WriteBufferSizes(t *testing.T) {
+	content := make([]byte, 3*1024*1024+17)
+	rand.Read(content)
+
+	server := createTestServer(t, content)
+	defer server.Close()
+
+	// Buffer sizes that do not divide the chunks evenly, and one smaller than a read
+	for _, size := range []int{1000, 100_003, DefaultWriteBufferSize} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+			config := DefaultConfig()
+			config.WriteBufferSize = size
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("downloaded %d bytes, content does not match", len(data))
+			}
+			if p := downloader.GetProgress(); p.Downloaded != int64(len(content)) {
+				t.Errorf("Progress.Downloaded = %d, want %d", p.Downloaded, len(content))
+			}
+		})
+	}
+}
+
+// BenchmarkDownloader_Loopback measures download throughput from a local
+// server. write=32KB writes after every read, as the downloader used to;
+// write=1MB coalesces reads into large writes.
+func BenchmarkDownloader_Loopback(b *testing.B) {
+	content := make([]byte, 64*1024*1024)
+	rand.Read(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "bench.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{"write=32KB", 32 * 1024},
+		{"write=1MB", DefaultWriteBufferSize},
+	}
+
+	for _, s := range sizes {
+		b.Run(s.name, func(b *testing.B) {
+			dir := b.TempDir()
+			client := protocol.NewHTTPClient()
+
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				outputPath := filepath.Join(dir, fmt.Sprintf("bench-%d.bin", i))
+
+				config := DefaultConfig()
+				config.Connections = 8
+				config.WriteBufferSize = s.size
+				downloader := NewDownloader(config, client)
+
+				if err := downloader.Download(context.Background(), server.URL+"/bench.bin", outputPath); err != nil {
+					b.Fatalf("Download() error = %v", err)
+				}
+
+				b.StopTimer()
+				os.Remove(outputPath)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestDownloader_StreamCallback(t *testing.T) {
+	content := make([]byte, 3*1024*1024+5)
+	rand.Read(content)
+
+	server := createTestServer(t, content)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		connections int
+		wantStream  bool
+	}{
+		{"single stream", 1, true},
+		{"parallel", 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Connections = tt.connections
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			var streamed bytes.Buffer
+			inOrder := true
+			downloader.SetStreamCallback(func(p []byte, offset int64) {
+				if offset != int64(streamed.Len()) {
+					inOrder = false
+				}
+				streamed.Write(p)
+			})
+
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if !tt.wantStream {
+				if streamed.Len() != 0 {
+					t.Errorf("callback received %d bytes of a parallel download", streamed.Len())
+				}
+				return
+			}
+			if !inOrder {
+				t.Error("callback received data out of order")
+			}
+			if !bytes.Equal(streamed.Bytes(), content) {
+				t.Errorf("callback received %d bytes, content does not match", streamed.Len())
+			}
+		})
+	}
+}
+
+// slowWriter collects data in a buffer, pausing on each write so chunks
+// run ahead of it
+type slowWriter struct {
+	bytes.Buffer
+	fail int // Fail once this many bytes were written, if > 0
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if w.fail > 0 && w.Len()+len(p) > w.fail {
+		return 0, errors.New("broken pipe")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestDownloader_OrderedWriter(t *testing.T) {
+	content := make([]byte, 2*1024*1024+3)
+	rand.Read(content)
+
+	server := createTestServer(t, content)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		connections int
+		reorder     int64
+	}{
+		{"single stream", 1, DefaultReorderBufferSize},
+		{"parallel in memory", 4, DefaultReorderBufferSize},
+		{"parallel read back from disk", 4, 64 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Connections = tt.connections
+			config.ReorderBufferSize = tt.reorder
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			w := &slowWriter{}
+			downloader.SetOrderedWriter(w)
+
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if !bytes.Equal(w.Bytes(), content) {
+				t.Errorf("writer received %d bytes, content does not match", w.Len())
+			}
+		})
+	}
+
+	t.Run("writer fails", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Connections = 4
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+		downloader.SetOrderedWriter(&slowWriter{fail: 100 * 1024})
+
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath)
+		var writeErr *OrderedWriterError
+		if !errors.As(err, &writeErr) || writeErr.Err.Error() != "broken pipe" {
+			t.Fatalf("Download() error = %v, want the writer's error", err)
+		}
+		if storage.FileExists(outputPath) {
+			t.Error("file should not be moved into place")
+		}
+	})
+}
+
+func TestDownloader_InlineChecksum(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.Read(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, alg := range []ChecksumAlgorithm{AlgorithmSHA256, AlgorithmBLAKE3} {
+		want, _ := CalculateChecksumReader(bytes.NewReader(content), alg)
+
+		t.Run(string(alg)+"/parallel", func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+			config := DefaultConfig()
+			config.Connections = 4
+			config.ReorderBufferSize = 64 * 1024 // Most of the file is read back from disk
+			config.Checksum = want
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if downloader.inlineSum == nil {
+				t.Error("fresh download was not hashed inline")
+			}
+		})
+
+		t.Run(string(alg)+"/resumed", func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			partPath := outputPath + ".part"
+
+			// An earlier run wrote the first half of the first chunk
+			state := download.NewState(server.URL+"/file.bin", "file.bin", int64(len(content)), true)
+			state.InitializeChunks(2)
+			state.UpdateChunk(0, 256*1024, download.ChunkStatusInProgress)
+			part := make([]byte, len(content))
+			copy(part, content[:256*1024])
+			if err := os.WriteFile(partPath, part, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := state.Save(partPath); err != nil {
+				t.Fatal(err)
+			}
+
+			config := DefaultConfig()
+			config.Connections = 2
+			config.Checksum = want
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if downloader.inlineSum != nil {
+				t.Error("resumed download was hashed inline")
+			}
+			got, _ := os.ReadFile(outputPath)
+			if !bytes.Equal(got, content) {
+				t.Error("content mismatch")
+			}
+		})
+
+		t.Run(string(alg)+"/mismatch", func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+			config := DefaultConfig()
+			config.Connections = 4
+			config.Checksum = &Checksum{Algorithm: alg, Value: strings.Repeat("0", len(want.Value))}
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath)
+			var mismatch *ChecksumMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Download() error = %v, want ChecksumMismatchError", err)
+			}
+			if mismatch.Actual.Value != want.Value {
+				t.Errorf("Actual = %s, want %s", mismatch.Actual, want)
+			}
+		})
+	}
+}
+
+func TestDownloader_ExpectedSize(t *testing.T) {
+	content := []byte("a file of forty-two bytes, give or take..")
+	server := createTestServer(t, content)
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "file.bin")
+	config := DefaultConfig()
+	config.ExpectedSize = int64(len(content)) + 1
+	downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+	err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath)
+	var sizeErr *SizeMismatchError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Download() error = %v, want SizeMismatchError", err)
+	}
+	if storage.FileExists(outputPath) || storage.FileExists(outputPath+storage.DefaultPartSuffix) {
+		t.Error("a file was written for a source of the wrong size")
+	}
+
+	config.ExpectedSize = int64(len(content))
+	downloader = NewDownloader(config, protocol.NewHTTPClient())
+	if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+}
+
+func TestDownloader_KnownMetadata(t *testing.T) {
+	content := make([]byte, 256*1024)
+	rand.Read(content)
+
+	// The server refuses HEAD and ignores ranges, so the probe response is
+	// the whole file
+	var heads, gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/file.bin"
+	client := protocol.NewHTTPClient()
+	meta, body, err := client.Probe(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "file.bin")
+	config := DefaultConfig()
+	config.Connections = 4
+	downloader := NewDownloader(config, client)
+	downloader.SetMetadata(url, meta, body)
+	if err := downloader.Download(context.Background(), url, outputPath); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(outputPath)
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes, content does not match", len(data))
+	}
+	if h, g := atomic.LoadInt32(&heads), atomic.LoadInt32(&gets); h != 1 || g != 1 {
+		t.Errorf("requests = %d HEAD, %d GET, want the probe's 1 and 1", h, g)
+	}
+
+	// Metadata of another URL is not used
+	downloader = NewDownloader(config, client)
+	downloader.SetMetadata(server.URL+"/other.bin", &protocol.Metadata{ContentLength: 1}, nil)
+	if err := downloader.Download(context.Background(), url, filepath.Join(t.TempDir(), "file.bin")); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if h := atomic.LoadInt32(&heads); h != 2 {
+		t.Errorf("HEAD requests = %d, want the download to probe again", h)
+	}
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DefaultReorderBufferSize is how much data arriving ahead of an ordered
+// writer is held in memory
+const DefaultReorderBufferSize = 32 * 1024 * 1024
+
+// OrderedWriterError is returned when the writer set with SetOrderedWriter fails
+type OrderedWriterError struct {
+	Err error
+}
+
+func (e *OrderedWriterError) Error() string {
+	return fmt.Sprintf("writing ordered output: %v", e.Err)
+}
+
+func (e *OrderedWriterError) Unwrap() error {
+	return e.Err
+}
+
+// orderedBlock is data of the file not yet passed to the ordered writer
+type orderedBlock struct {
+	offset int64
+	length int64
+	data   []byte // nil if the block is read back from the file
+}
+
+// orderedStream passes the file to a writer in byte order while parallel
+// chunks write it out of order. Blocks ahead of the writer are held in
+// memory up to limit bytes; past that only their position is kept and they
+// are read back from the file, which already holds them. Chunks never wait
+// for the writer.
+type orderedStream struct {
+	w       io.Writer
+	file    io.ReaderAt
+	limit   int64
+	onError func() // Called once if w fails
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	blocks []orderedBlock // Sorted by offset
+	held   int64          // Bytes of blocks kept in memory
+	next   int64          // Offset of the next byte w needs
+	size   int64          // File size once the download is complete, -1 before
+	closed bool           // Set by abort
+	err    error
+	done   chan struct{}
+}
+
+// newOrderedStream starts writing the file read through file to w
+func newOrderedStream(w io.Writer, file io.ReaderAt, limit int64, onError func()) *orderedStream {
+	s := &orderedStream{
+		w:       w,
+		file:    file,
+		limit:   limit,
+		onError: onError,
+		size:    -1,
+		done:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// add records that p was written to the file at offset. p is copied if it
+// fits in the memory limit.
+func (s *orderedStream) add(p []byte, offset int64) {
+	s.addBlock(offset, int64(len(p)), p)
+}
+
+// addOnDisk records that length bytes at offset are in the file
+func (s *orderedStream) addOnDisk(offset, length int64) {
+	s.addBlock(offset, length, nil)
+}
+
+func (s *orderedStream) addBlock(offset, length int64, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil || s.closed || offset+length <= s.next || length == 0 {
+		return
+	}
+
+	b := orderedBlock{offset: offset, length: length}
+	if p != nil && s.held+length <= s.limit {
+		b.data = append([]byte(nil), p...)
+		s.held += length
+	}
+
+	i := sort.Search(len(s.blocks), func(i int) bool { return s.blocks[i].offset > offset })
+	s.blocks = append(s.blocks, orderedBlock{})
+	copy(s.blocks[i+1:], s.blocks[i:])
+	s.blocks[i] = b
+	s.cond.Signal()
+}
+
+// run writes blocks to w as soon as the next one is available. Once the
+// size is known every block is on disk, so gaps are read from the file.
+func (s *orderedStream) run() {
+	defer close(s.done)
+
+	for {
+		s.mu.Lock()
+		for !s.closed && s.err == nil && !s.ready() {
+			s.cond.Wait()
+		}
+		if s.closed || s.err != nil || (s.size >= 0 && s.next >= s.size) {
+			s.mu.Unlock()
+			return
+		}
+
+		var b orderedBlock
+		if len(s.blocks) > 0 && s.blocks[0].offset <= s.next {
+			b = s.blocks[0]
+			s.blocks = s.blocks[1:]
+			if b.data != nil {
+				s.held -= b.length
+			}
+		} else {
+			// The download is complete but nothing reported this range
+			end := s.size
+			if len(s.blocks) > 0 && s.blocks[0].offset < end {
+				end = s.blocks[0].offset
+			}
+			b = orderedBlock{offset: s.next, length: end - s.next}
+		}
+		skip := s.next - b.offset
+		s.mu.Unlock()
+
+		if skip >= b.length {
+			continue
+		}
+		n, err := s.write(b, skip)
+
+		s.mu.Lock()
+		s.next += n
+		if err != nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			if s.onError != nil {
+				s.onError()
+			}
+			return
+		}
+	}
+}
+
+// ready reports whether the next block can be written
+func (s *orderedStream) ready() bool {
+	if len(s.blocks) > 0 && s.blocks[0].offset <= s.next {
+		return true
+	}
+	return s.size >= 0
+}
+
+// write passes block b from skip bytes in to w
+func (s *orderedStream) write(b orderedBlock, skip int64) (int64, error) {
+	if b.data != nil {
+		n, err := s.w.Write(b.data[skip:])
+		return int64(n), err
+	}
+
+	section := io.NewSectionReader(s.file, b.offset+skip, b.length-skip)
+	n, err := io.CopyBuffer(s.w, section, make([]byte, 256*1024))
+	if err == nil && n < b.length-skip {
+		err = fmt.Errorf("reading back %d bytes at %d: %w", b.length-skip, b.offset+skip, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// finish waits until w has received the whole file of size bytes
+func (s *orderedStream) finish(size int64) error {
+	s.mu.Lock()
+	s.size = size
+	s.cond.Signal()
+	s.mu.Unlock()
+
+	<-s.done
+	return s.err
+}
+
+// abort stops the stream without waiting for the rest of the file. A write
+// already in progress is not waited for, since w may never take it.
+func (s *orderedStream) abort() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+// failed returns the error of w, if it failed
+func (s *orderedStream) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
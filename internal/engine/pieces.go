@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+)
+
+// PieceVerifier checks pieces of a file against known hashes, such as the
+// piece hashes of a metalink
+type PieceVerifier interface {
+	PieceLength() int64
+	PieceCount() int
+	VerifyPieceData(index int, data []byte) (bool, string, error)
+}
+
+// PieceError is returned when pieces of a file fail verification and could
+// not be fetched again
+type PieceError struct {
+	Pieces []int // Indexes of the pieces still failing
+}
+
+func (e *PieceError) Error() string {
+	if len(e.Pieces) == 1 {
+		return fmt.Sprintf("piece %d failed verification", e.Pieces[0])
+	}
+	return fmt.Sprintf("%d pieces failed verification: %v", len(e.Pieces), e.Pieces)
+}
+
+// pieceRange returns the byte range start-end (inclusive) of piece i in a
+// file of size bytes
+func pieceRange(pv PieceVerifier, size int64, i int) (start, end int64) {
+	start = int64(i) * pv.PieceLength()
+	end = start + pv.PieceLength() - 1
+	if end >= size {
+		end = size - 1
+	}
+	return start, end
+}
+
+// piecesFit reports whether the pieces of pv cover a file of size bytes
+func piecesFit(pv PieceVerifier, size int64) bool {
+	length := pv.PieceLength()
+	return length > 0 && size > 0 && int64(pv.PieceCount()) == (size+length-1)/length
+}
+
+// verifyPiece reads piece i of a file of size bytes from r and checks it
+func verifyPiece(r io.ReaderAt, pv PieceVerifier, size int64, i int, buf []byte) (bool, error) {
+	start, end := pieceRange(pv, size, i)
+	data := buf[:end-start+1]
+	if _, err := r.ReadAt(data, start); err != nil {
+		return false, fmt.Errorf("reading piece %d: %w", i, err)
+	}
+	ok, _, err := pv.VerifyPieceData(i, data)
+	return ok, err
+}
+
+// FindBadPieces returns the pieces of the file at path that fail
+// verification, for a file of size bytes. The file may be shorter; pieces
+// past its end are bad.
+func FindBadPieces(path string, size int64, pv PieceVerifier) ([]int, error) {
+	if !piecesFit(pv, size) {
+		return nil, fmt.Errorf("%d pieces of %d bytes do not fit a file of %d bytes", pv.PieceCount(), pv.PieceLength(), size)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	if info.Size() > size {
+		return nil, fmt.Errorf("file is %d bytes, longer than %d", info.Size(), size)
+	}
+
+	var bad []int
+	buf := make([]byte, pv.PieceLength())
+	for i := 0; i < pv.PieceCount(); i++ {
+		if _, end := pieceRange(pv, size, i); end >= info.Size() {
+			bad = append(bad, i)
+			continue
+		}
+		ok, err := verifyPiece(file, pv, size, i, buf)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			bad = append(bad, i)
+		}
+	}
+	return bad, nil
+}
+
+// RepairPieces fetches the given pieces of the file at path again and writes
+// them in place. Each piece is tried from urls in order and only written
+// once it verifies. A *PieceError lists the pieces no URL had a good copy of.
+func RepairPieces(ctx context.Context, client *protocol.HTTPClient, path string, size int64, pv PieceVerifier, pieces []int, urls []string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	var failed []int
+	buf := make([]byte, pv.PieceLength())
+	for _, i := range pieces {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !repairPiece(ctx, client, file, pv, size, i, buf, urls) {
+			failed = append(failed, i)
+		}
+	}
+	if len(failed) > 0 {
+		return &PieceError{Pieces: failed}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("syncing file: %w", err)
+	}
+	return nil
+}
+
+// repairPiece writes the first good copy of piece i found at urls to file
+func repairPiece(ctx context.Context, client *protocol.HTTPClient, file *os.File, pv PieceVerifier, size int64, i int, buf []byte, urls []string) bool {
+	start, end := pieceRange(pv, size, i)
+	data := buf[:end-start+1]
+
+	for _, url := range urls {
+		reader, err := client.GetRange(ctx, url, start, end)
+		if err != nil {
+			continue
+		}
+		_, err = io.ReadFull(reader, data)
+		reader.Close()
+		if err != nil {
+			continue
+		}
+		if ok, _, err := pv.VerifyPieceData(i, data); err != nil || !ok {
+			continue
+		}
+		if _, err := file.WriteAt(data, start); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pieceTracker verifies each piece of a download as soon as all of its
+// bytes are written, reading it back from the part file
+type pieceTracker struct {
+	pv      PieceVerifier
+	size    int64
+	file    io.ReaderAt
+	onError func(error)
+
+	mu      sync.Mutex
+	covered []int64 // Bytes of each piece written
+	bad     map[int]bool
+	broken  bool // Verification failed for a reason other than a bad piece
+}
+
+func newPieceTracker(pv PieceVerifier, size int64, file io.ReaderAt, onError func(error)) *pieceTracker {
+	return &pieceTracker{
+		pv:      pv,
+		size:    size,
+		file:    file,
+		onError: onError,
+		covered: make([]int64, pv.PieceCount()),
+		bad:     make(map[int]bool),
+	}
+}
+
+// add records that length bytes at offset were written, verifying the
+// pieces this completes
+func (t *pieceTracker) add(offset, length int64) {
+	if length <= 0 {
+		return
+	}
+
+	var complete []int
+	t.mu.Lock()
+	for i := int(offset / t.pv.PieceLength()); i < len(t.covered); i++ {
+		start, end := pieceRange(t.pv, t.size, i)
+		if start >= offset+length {
+			break
+		}
+		overlap := min(end+1, offset+length) - max(start, offset)
+		t.covered[i] += overlap
+		if t.covered[i] == end-start+1 {
+			complete = append(complete, i)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, i := range complete {
+		t.verify(i)
+	}
+}
+
+// verify checks piece i, recording it if it is bad
+func (t *pieceTracker) verify(i int) {
+	buf := getBuffer(int(t.pv.PieceLength()))
+	defer putBuffer(buf)
+
+	ok, err := verifyPiece(t.file, t.pv, t.size, i, *buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		if !t.broken && t.onError != nil {
+			t.onError(err)
+		}
+		t.broken = true
+		return
+	}
+	if !ok {
+		t.bad[i] = true
+	}
+}
+
+// reset forgets everything written, for a download starting over
+func (t *pieceTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.covered)
+	clear(t.bad)
+	t.broken = false
+}
+
+// badPieces returns the pieces that failed verification, in order
+func (t *pieceTracker) badPieces() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pieces := make([]int, 0, len(t.bad))
+	for i := range t.bad {
+		pieces = append(pieces, i)
+	}
+	sort.Ints(pieces)
+	return pieces
+}
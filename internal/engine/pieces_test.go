@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+)
+
+// sha256Pieces verifies pieces against their SHA-256 hashes
+type sha256Pieces struct {
+	length int64
+	hashes []string
+}
+
+func newSHA256Pieces(content []byte, length int64) *sha256Pieces {
+	pv := &sha256Pieces{length: length}
+	for start := int64(0); start < int64(len(content)); start += length {
+		sum := sha256.Sum256(content[start:min(start+length, int64(len(content)))])
+		pv.hashes = append(pv.hashes, hex.EncodeToString(sum[:]))
+	}
+	return pv
+}
+
+func (pv *sha256Pieces) PieceLength() int64 { return pv.length }
+func (pv *sha256Pieces) PieceCount() int    { return len(pv.hashes) }
+
+func (pv *sha256Pieces) VerifyPieceData(i int, data []byte) (bool, string, error) {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	return actual == pv.hashes[i], actual, nil
+}
+
+// pieceServer serves content, counting the requests it gets
+func pieceServer(t *testing.T, content []byte, requests *int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloader_RepairsBadPieces(t *testing.T) {
+	const pieceLength = 64 * 1024
+	content := make([]byte, 1024*1024+1000)
+	rand.Read(content)
+	pieces := newSHA256Pieces(content, pieceLength)
+
+	// The first source corrupts pieces 5 and the short last one
+	corrupt := bytes.Clone(content)
+	corrupt[5*pieceLength+10] ^= 0xff
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	var badRequests, goodRequests int64
+	bad := pieceServer(t, corrupt, &badRequests)
+	good := pieceServer(t, content, &goodRequests)
+	want, _ := CalculateChecksumReader(bytes.NewReader(content), AlgorithmSHA256)
+
+	for _, connections := range []int{1, 4} {
+		t.Run(fmt.Sprintf("connections=%d", connections), func(t *testing.T) {
+			atomic.StoreInt64(&goodRequests, 0)
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+			config := DefaultConfig()
+			config.Connections = connections
+			config.Checksum = want
+			config.Pieces = pieces
+			config.RepairURLs = []string{bad.URL + "/file.bin", good.URL + "/file.bin"}
+			downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+			if err := downloader.Download(context.Background(), bad.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			got, _ := os.ReadFile(outputPath)
+			if !bytes.Equal(got, content) {
+				t.Error("content mismatch after repair")
+			}
+			if n := atomic.LoadInt64(&goodRequests); n != 2 {
+				t.Errorf("good source got %d requests, want one per bad piece", n)
+			}
+		})
+	}
+
+	t.Run("no good source", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+		config := DefaultConfig()
+		config.Pieces = pieces
+		downloader := NewDownloader(config, protocol.NewHTTPClient())
+
+		err := downloader.Download(context.Background(), bad.URL+"/file.bin", outputPath)
+		var pieceErr *PieceError
+		if !errors.As(err, &pieceErr) {
+			t.Fatalf("Download() error = %v, want PieceError", err)
+		}
+		if !slices.Equal(pieceErr.Pieces, []int{5, pieces.PieceCount() - 1}) {
+			t.Errorf("Pieces = %v", pieceErr.Pieces)
+		}
+	})
+}
+
+func TestRepairPieces(t *testing.T) {
+	const pieceLength = 4096
+	content := make([]byte, 50000)
+	rand.Read(content)
+	pieces := newSHA256Pieces(content, pieceLength)
+
+	var requests int64
+	server := pieceServer(t, content, &requests)
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	damaged := bytes.Clone(content)
+	damaged[0] ^= 1
+	damaged[3*pieceLength] ^= 1
+	if err := os.WriteFile(path, damaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bad, err := FindBadPieces(path, int64(len(content)), pieces)
+	if err != nil {
+		t.Fatalf("FindBadPieces() error = %v", err)
+	}
+	if !slices.Equal(bad, []int{0, 3}) {
+		t.Fatalf("FindBadPieces() = %v, want [0 3]", bad)
+	}
+
+	// A source that cannot serve the range is skipped
+	urls := []string{"http://127.0.0.1:1/file.bin", server.URL + "/file.bin"}
+	if err := RepairPieces(context.Background(), protocol.NewHTTPClient(), path, int64(len(content)), pieces, bad, urls); err != nil {
+		t.Fatalf("RepairPieces() error = %v", err)
+	}
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(got, content) {
+		t.Error("content mismatch after repair")
+	}
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2", requests)
+	}
+
+	if _, err := FindBadPieces(path, int64(len(content))+pieceLength, pieces); err == nil {
+		t.Error("FindBadPieces() accepted pieces not fitting the file size")
+	}
+
+	// Pieces past the end of a short copy are bad; a long one is refused
+	os.WriteFile(path, content[:3*pieceLength+10], 0644)
+	bad, err = FindBadPieces(path, int64(len(content)), pieces)
+	if err != nil {
+		t.Fatalf("FindBadPieces() of a short file error = %v", err)
+	}
+	if len(bad) != pieces.PieceCount()-3 || bad[0] != 3 {
+		t.Errorf("FindBadPieces() of a short file = %v, want pieces 3 and on", bad)
+	}
+	os.WriteFile(path, append(bytes.Clone(content), 0), 0644)
+	if _, err := FindBadPieces(path, int64(len(content)), pieces); err == nil {
+		t.Error("FindBadPieces() accepted a file longer than the pieces")
+	}
+}
@@ -3,17 +3,16 @@ package engine
 import (
 	"context"
 	"io"
+	"math"
 	"sync"
-	"time"
+
+	"golang.org/x/time/rate"
 )
 
-// RateLimiter controls bandwidth usage
+// RateLimiter controls bandwidth usage with a token bucket. The bucket can
+// be shared with other users, such as the torrent client.
 type RateLimiter struct {
-	bytesPerSecond int64
-	tokens         int64
-	maxTokens      int64
-	lastUpdate     time.Time
-	mu             sync.Mutex
+	bucket *rate.Limiter
 }
 
 // NewRateLimiter creates a new rate limiter with the given bytes per second limit
@@ -24,87 +23,70 @@ func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
 	}
 
 	// Allow burst of up to 1 second worth of bytes
-	maxTokens := bytesPerSecond
-
 	return &RateLimiter{
-		bytesPerSecond: bytesPerSecond,
-		tokens:         maxTokens,
-		maxTokens:      maxTokens,
-		lastUpdate:     time.Now(),
+		bucket: rate.NewLimiter(rate.Limit(bytesPerSecond), burstFor(bytesPerSecond)),
 	}
 }
 
+// burstFor returns the bucket size for a limit: one second worth of bytes
+func burstFor(bytesPerSecond int64) int {
+	if bytesPerSecond > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(bytesPerSecond)
+}
+
 // Acquire waits until n bytes can be consumed
 func (rl *RateLimiter) Acquire(ctx context.Context, n int64) error {
-	if rl == nil || rl.bytesPerSecond <= 0 {
+	if rl == nil || rl.bucket.Limit() == rate.Inf {
 		return nil // No limiting
 	}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	// Refill tokens based on elapsed time
-	now := time.Now()
-	elapsed := now.Sub(rl.lastUpdate)
-	rl.lastUpdate = now
-
-	// Add tokens for elapsed time
-	newTokens := int64(float64(elapsed.Nanoseconds()) / float64(time.Second.Nanoseconds()) * float64(rl.bytesPerSecond))
-	rl.tokens += newTokens
-	if rl.tokens > rl.maxTokens {
-		rl.tokens = rl.maxTokens
-	}
-
-	// If we have enough tokens, consume them immediately
-	if rl.tokens >= n {
-		rl.tokens -= n
-		return nil
-	}
-
-	// Calculate wait time for remaining tokens
-	needed := n - rl.tokens
-	waitTime := time.Duration(float64(needed) / float64(rl.bytesPerSecond) * float64(time.Second))
-
-	// Consume available tokens
-	rl.tokens = 0
-
-	// Wait for remaining tokens
-	rl.mu.Unlock()
-	select {
-	case <-ctx.Done():
-		rl.mu.Lock()
-		return ctx.Err()
-	case <-time.After(waitTime):
-		rl.mu.Lock()
-		return nil
+	// Take at most a burst at a time, so reads larger than the bucket wait
+	// instead of failing
+	for n > 0 {
+		take := min(n, int64(rl.bucket.Burst()))
+		if err := rl.bucket.WaitN(ctx, int(take)); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// The wait would outlast the context's deadline
+			return context.DeadlineExceeded
+		}
+		n -= take
 	}
+	return nil
 }
 
-// SetLimit changes the rate limit
+// SetLimit changes the rate limit. A limit of 0 or less removes it.
 func (rl *RateLimiter) SetLimit(bytesPerSecond int64) {
 	if rl == nil {
 		return
 	}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	rl.bytesPerSecond = bytesPerSecond
-	rl.maxTokens = bytesPerSecond
-	if rl.tokens > rl.maxTokens {
-		rl.tokens = rl.maxTokens
+	if bytesPerSecond <= 0 {
+		rl.bucket.SetLimit(rate.Inf)
+		return
 	}
+	rl.bucket.SetBurst(burstFor(bytesPerSecond))
+	rl.bucket.SetLimit(rate.Limit(bytesPerSecond))
 }
 
 // Limit returns the current limit in bytes per second
 func (rl *RateLimiter) Limit() int64 {
-	if rl == nil {
+	if rl == nil || rl.bucket.Limit() == rate.Inf {
 		return 0
 	}
+	return int64(rl.bucket.Limit())
+}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	return rl.bytesPerSecond
+// Bucket returns the token bucket behind rl, for clients that take a
+// rate.Limiter. Bytes they consume count against rl's limit.
+func (rl *RateLimiter) Bucket() *rate.Limiter {
+	if rl == nil {
+		return nil
+	}
+	return rl.bucket
 }
 
 // RateLimitedReader wraps an io.Reader with rate limiting
@@ -331,3 +331,36 @@ func TestMatchHostPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestRateLimiter_Bucket(t *testing.T) {
+	var none *RateLimiter
+	if none.Bucket() != nil {
+		t.Error("nil.Bucket() should be nil")
+	}
+
+	rl := NewRateLimiter(100)
+	bucket := rl.Bucket()
+	if bucket == nil || bucket.Burst() != 100 {
+		t.Fatalf("Bucket() = %+v, want a burst of 100", bucket)
+	}
+
+	// Tokens taken through the bucket count against the limiter
+	if !bucket.AllowN(time.Now(), 100) {
+		t.Fatal("AllowN() refused the burst")
+	}
+	start := time.Now()
+	if err := rl.Acquire(context.Background(), 50); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Acquire waited only %v after the bucket was drained", elapsed)
+	}
+
+	rl.SetLimit(0)
+	if rl.Limit() != 0 {
+		t.Errorf("Limit() after SetLimit(0) = %d, want 0", rl.Limit())
+	}
+	if err := rl.Acquire(context.Background(), 1<<20); err != nil {
+		t.Errorf("unlimited Acquire() error = %v", err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"math/rand"
 	"net"
 	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
 )
 
 // RetryConfig holds retry configuration
@@ -85,8 +87,8 @@ func (r *Retrier) Do(ctx context.Context, fn RetryFunc) RetryResult {
 			return result
 		}
 
-		// Calculate delay with exponential backoff
-		delay := r.calculateDelay(attempt)
+		// Calculate delay with exponential backoff (or the server's Retry-After)
+		delay := r.delayFor(err, attempt)
 
 		// Wait before next retry
 		select {
@@ -114,6 +116,11 @@ func (r *Retrier) shouldRetry(err error) bool {
 		return false
 	}
 
+	// Servers asking us to slow down (429/503) are always worth another try
+	if _, throttled := protocol.IsThrottled(err); throttled {
+		return true
+	}
+
 	// Check specific retryable errors if configured
 	if len(r.config.RetryableErrs) > 0 {
 		for _, retryableErr := range r.config.RetryableErrs {
@@ -147,6 +154,16 @@ func (r *Retrier) calculateDelay(attempt int) time.Duration {
 	return time.Duration(delay)
 }
 
+// delayFor returns the delay before retrying after err.
+// A Retry-After hint from the server wins if it is longer than the backoff delay.
+func (r *Retrier) delayFor(err error, attempt int) time.Duration {
+	delay := r.calculateDelay(attempt)
+	if retryAfter, throttled := protocol.IsThrottled(err); throttled && retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
 // isNetworkError checks if an error is a network-related error
 func isNetworkError(err error) bool {
 	if err == nil {
@@ -235,7 +252,7 @@ func WithRetryNotify(ctx context.Context, config RetryConfig, fn func() error, o
 			return lastErr
 		}
 
-		delay := retrier.calculateDelay(attempt)
+		delay := retrier.delayFor(err, attempt)
 		
 		if onRetry != nil {
 			onRetry(attempt+1, err, delay)
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/http"
 	"testing"
 	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
 )
 
 func TestDefaultRetryConfig(t *testing.T) {
@@ -197,6 +200,35 @@ func TestRetrier_calculateDelay(t *testing.T) {
 	}
 }
 
+func TestRetrier_delayFor_RetryAfter(t *testing.T) {
+	cfg := RetryConfig{
+		MaxRetries:   3,
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2.0,
+	}
+	retrier := NewRetrier(cfg)
+
+	throttled := &protocol.StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable", RetryAfter: 45 * time.Second}
+	if !retrier.shouldRetry(throttled) {
+		t.Error("shouldRetry() should be true for 503")
+	}
+	if delay := retrier.delayFor(throttled, 0); delay != 45*time.Second {
+		t.Errorf("delayFor() = %v, want 45s from Retry-After", delay)
+	}
+
+	// A shorter Retry-After does not shorten the backoff
+	throttled.RetryAfter = 100 * time.Millisecond
+	if delay := retrier.delayFor(throttled, 2); delay != 4*time.Second {
+		t.Errorf("delayFor() = %v, want 4s", delay)
+	}
+
+	notFound := &protocol.StatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	if retrier.shouldRetry(notFound) {
+		t.Error("shouldRetry() should be false for 404")
+	}
+}
+
 func TestRetrier_calculateDelay_WithJitter(t *testing.T) {
 	cfg := RetryConfig{
 		MaxRetries:   5,
@@ -0,0 +1,454 @@
+// Package extract unpacks downloaded archives.
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format identifies an archive format
+type Format string
+
+const (
+	FormatNone   Format = ""        // Not a supported archive
+	FormatTar    Format = "tar"     // Uncompressed tar
+	FormatTarGz  Format = "tar.gz"  // Gzip-compressed tar
+	FormatTarZst Format = "tar.zst" // Zstandard-compressed tar
+	FormatTarXz  Format = "tar.xz"  // XZ-compressed tar
+	FormatZip    Format = "zip"     // Zip archive
+)
+
+// suffixes maps file name suffixes to formats, longest first
+var suffixes = []struct {
+	suffix string
+	format Format
+}{
+	{".tar.gz", FormatTarGz},
+	{".tar.zst", FormatTarZst},
+	{".tar.xz", FormatTarXz},
+	{".tgz", FormatTarGz},
+	{".tzst", FormatTarZst},
+	{".txz", FormatTarXz},
+	{".tar", FormatTar},
+	{".zip", FormatZip},
+}
+
+// ErrUnsafePath is returned for archive entries that would be written
+// outside the extraction directory
+var ErrUnsafePath = errors.New("path escapes the extraction directory")
+
+// DetectFormat returns the archive format of a file from its name
+func DetectFormat(name string) Format {
+	lower := strings.ToLower(name)
+	for _, s := range suffixes {
+		if strings.HasSuffix(lower, s.suffix) {
+			return s.format
+		}
+	}
+	return FormatNone
+}
+
+// Streamable reports whether the format can be extracted while it is read
+// front to back. Zip archives keep their index at the end of the file.
+func (f Format) Streamable() bool {
+	switch f {
+	case FormatTar, FormatTarGz, FormatTarZst, FormatTarXz:
+		return true
+	}
+	return false
+}
+
+// Options controls extraction
+type Options struct {
+	StripComponents int // Leading path components removed from entry names
+}
+
+// Result describes a finished extraction
+type Result struct {
+	Dir     string   // Extraction directory
+	Files   int      // Regular files written
+	Bytes   int64    // Bytes written to regular files
+	Created []string // Paths created by the extraction, in creation order
+}
+
+// File extracts the archive at archivePath into dir
+func File(archivePath string, format Format, dir string, opts Options) (*Result, error) {
+	if format == FormatZip {
+		return Zip(archivePath, dir, opts)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	return Tar(f, format, dir, opts)
+}
+
+// Tar extracts a tar archive, compressed as format says, read from r into dir
+func Tar(r io.Reader, format Format, dir string, opts Options) (*Result, error) {
+	var err error
+	switch format {
+	case FormatTar:
+	case FormatTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(r); err != nil {
+			return nil, fmt.Errorf("reading gzip header: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case FormatTarZst:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(r); err != nil {
+			return nil, fmt.Errorf("creating zstd reader: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case FormatTarXz:
+		if r, err = xz.NewReader(r); err != nil {
+			return nil, fmt.Errorf("reading xz header: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%q is not a tar format", format)
+	}
+
+	x, err := newExtractor(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return &x.result, nil
+		}
+		if err != nil {
+			return &x.result, fmt.Errorf("reading tar entry: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(hdr.Name, hdr.FileInfo().Mode())
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.file(hdr.Name, hdr.FileInfo().Mode(), tr)
+			if err == nil && !hdr.ModTime.IsZero() {
+				if target, ok, _ := x.target(hdr.Name); ok {
+					os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+				}
+			}
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(hdr.Name, hdr.Linkname)
+		default:
+			// Devices, FIFOs and metadata entries are not extracted
+		}
+		if err != nil {
+			return &x.result, err
+		}
+	}
+}
+
+// Zip extracts the zip archive at archivePath into dir
+func Zip(archivePath, dir string, opts Options) (*Result, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening zip archive: %w", err)
+	}
+	defer zr.Close()
+
+	x, err := newExtractor(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(f.Name, mode)
+		case mode&os.ModeSymlink != 0:
+			err = x.zipSymlink(f)
+		case mode.IsRegular():
+			err = x.zipFile(f)
+		}
+		if err != nil {
+			return &x.result, err
+		}
+	}
+	return &x.result, nil
+}
+
+// Remove deletes what an extraction created, newest first. Directories are
+// only removed once empty, so files that were already there are kept.
+func Remove(created []string) {
+	for i := len(created) - 1; i >= 0; i-- {
+		os.Remove(created[i])
+	}
+}
+
+// extractor writes archive entries below a root directory
+type extractor struct {
+	root   string
+	opts   Options
+	result Result
+}
+
+func newExtractor(dir string, opts Options) (*extractor, error) {
+	if opts.StripComponents < 0 {
+		return nil, fmt.Errorf("invalid number of components to strip: %d", opts.StripComponents)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving extraction directory: %w", err)
+	}
+
+	x := &extractor{root: root, opts: opts, result: Result{Dir: dir}}
+	if err := x.mkdirAll(root); err != nil {
+		return nil, fmt.Errorf("creating extraction directory: %w", err)
+	}
+	return x, nil
+}
+
+// target maps an entry name to its path on disk. ok is false for entries
+// removed entirely by StripComponents.
+func (x *extractor) target(name string) (target string, ok bool, err error) {
+	rel, ok, err := x.relative(name)
+	if !ok || err != nil {
+		return "", ok, err
+	}
+	return filepath.Join(x.root, rel), true, nil
+}
+
+// relative cleans an entry name and strips leading components
+func (x *extractor) relative(name string) (string, bool, error) {
+	// Archives use forward slashes; backslashes only appear in broken zips
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) {
+		return "", false, fmt.Errorf("%s: %w", name, ErrUnsafePath)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) <= x.opts.StripComponents {
+		return "", false, nil
+	}
+
+	rel := filepath.FromSlash(path.Join(parts[x.opts.StripComponents:]...))
+	if !filepath.IsLocal(rel) {
+		return "", false, fmt.Errorf("%s: %w", name, ErrUnsafePath)
+	}
+	return rel, true, nil
+}
+
+// prepare returns the path for an entry after making sure its parent
+// directories exist and do not lead outside the root through symlinks
+func (x *extractor) prepare(name string) (string, bool, error) {
+	target, ok, err := x.target(name)
+	if !ok || err != nil {
+		return "", ok, err
+	}
+
+	parent := filepath.Dir(target)
+	if err := x.checkInside(name, parent); err != nil {
+		return "", false, err
+	}
+	if err := x.mkdirAll(parent); err != nil {
+		return "", false, fmt.Errorf("creating directory for %s: %w", name, err)
+	}
+	return target, true, nil
+}
+
+// checkInside rejects dir if an existing symlink on its way resolves outside the root
+func (x *extractor) checkInside(name, dir string) error {
+	for p := dir; len(p) > len(x.root); p = filepath.Dir(p) {
+		info, err := os.Lstat(p)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, ErrUnsafePath)
+		}
+		root, err := filepath.EvalSymlinks(x.root)
+		if err != nil {
+			return fmt.Errorf("resolving extraction directory: %w", err)
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+			return fmt.Errorf("%s: %w", name, ErrUnsafePath)
+		}
+	}
+	return nil
+}
+
+// mkdirAll creates dir and its missing parents, recording each one created
+func (x *extractor) mkdirAll(dir string) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", dir)
+		}
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := x.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	x.result.Created = append(x.result.Created, dir)
+	return nil
+}
+
+// dir creates a directory entry
+func (x *extractor) dir(name string, mode os.FileMode) error {
+	target, ok, err := x.prepare(name)
+	if !ok || err != nil {
+		return err
+	}
+	if err := x.checkInside(name, target); err != nil {
+		return err
+	}
+	if err := x.mkdirAll(target); err != nil {
+		return fmt.Errorf("creating directory %s: %w", name, err)
+	}
+	return os.Chmod(target, mode.Perm()|0700)
+}
+
+// file writes a regular file entry with the content of r
+func (x *extractor) file(name string, mode os.FileMode, r io.Reader) error {
+	target, ok, err := x.prepare(name)
+	if !ok || err != nil {
+		return err
+	}
+
+	// Replace rather than write through whatever is there, such as a symlink
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		os.Remove(target)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", name, err)
+	}
+	x.result.Created = append(x.result.Created, target)
+
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+
+	x.result.Files++
+	x.result.Bytes += n
+	return nil
+}
+
+// symlink creates a symbolic link entry pointing at linkname, which must
+// stay inside the root
+func (x *extractor) symlink(name, linkname string) error {
+	rel, ok, err := x.relative(name)
+	if !ok || err != nil {
+		return err
+	}
+
+	linkname = filepath.FromSlash(strings.ReplaceAll(linkname, `\`, "/"))
+	if filepath.IsAbs(linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(rel), linkname)) {
+		return fmt.Errorf("%s -> %s: %w", name, linkname, ErrUnsafePath)
+	}
+
+	target, _, err := x.prepare(name)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		os.Remove(target)
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return fmt.Errorf("creating symlink %s: %w", name, err)
+	}
+	x.result.Created = append(x.result.Created, target)
+	return nil
+}
+
+// hardlink creates a hard link entry to an earlier entry of the archive
+func (x *extractor) hardlink(name, linkname string) error {
+	source, ok, err := x.target(linkname)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil // The original was stripped away
+	}
+	if err := x.checkInside(linkname, filepath.Dir(source)); err != nil {
+		return err
+	}
+
+	target, ok, err := x.prepare(name)
+	if !ok || err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		os.Remove(target)
+	}
+	if err := os.Link(source, target); err != nil {
+		return fmt.Errorf("creating hard link %s: %w", name, err)
+	}
+	x.result.Created = append(x.result.Created, target)
+	return nil
+}
+
+// zipFile extracts a regular file entry of a zip archive
+func (x *extractor) zipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	if err := x.file(f.Name, f.Mode(), rc); err != nil {
+		return err
+	}
+	if target, ok, _ := x.target(f.Name); ok && !f.Modified.IsZero() {
+		os.Chtimes(target, f.Modified, f.Modified)
+	}
+	return nil
+}
+
+// zipSymlink extracts a zip symlink entry, whose content is the link target
+func (x *extractor) zipSymlink(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	linkname, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", f.Name, err)
+	}
+	return x.symlink(f.Name, string(linkname))
+}
@@ -0,0 +1,262 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// entry describes one member of a test archive
+type entry struct {
+	name     string
+	body     string
+	linkname string
+	typeflag byte
+}
+
+// buildTar returns a tar archive of entries, compressed as format says
+func buildTar(t *testing.T, format Format, entries []entry) []byte {
+	t.Helper()
+
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: e.typeflag, Linkname: e.linkname}
+		switch e.typeflag {
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeReg:
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if e.typeflag == tar.TypeReg {
+			tw.Write([]byte(e.body))
+		}
+	}
+	tw.Close()
+
+	var out bytes.Buffer
+	switch format {
+	case FormatTar:
+		return raw.Bytes()
+	case FormatTarGz:
+		w := gzip.NewWriter(&out)
+		w.Write(raw.Bytes())
+		w.Close()
+	case FormatTarZst:
+		w, _ := zstd.NewWriter(&out)
+		w.Write(raw.Bytes())
+		w.Close()
+	case FormatTarXz:
+		w, _ := xz.NewWriter(&out)
+		w.Write(raw.Bytes())
+		w.Close()
+	}
+	return out.Bytes()
+}
+
+func file(name, body string) entry {
+	return entry{name: name, body: body, typeflag: tar.TypeReg}
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("ReadFile(%s) error = %v", path, err)
+		return
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", path, data, want)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"release.tar", FormatTar},
+		{"release.tar.gz", FormatTarGz},
+		{"release.TGZ", FormatTarGz},
+		{"release.tar.zst", FormatTarZst},
+		{"release.tar.xz", FormatTarXz},
+		{"release.zip", FormatZip},
+		{"release.gz", FormatNone},
+		{"release.iso", FormatNone},
+	}
+
+	for _, tt := range tests {
+		if got := DetectFormat(tt.name); got != tt.want {
+			t.Errorf("DetectFormat(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if FormatZip.Streamable() || !FormatTarZst.Streamable() {
+		t.Error("only tar formats should be streamable")
+	}
+}
+
+func TestTar_Formats(t *testing.T) {
+	entries := []entry{
+		{name: "pkg/", typeflag: tar.TypeDir},
+		file("pkg/bin/tool", "binary"),
+		file("pkg/README", "readme"),
+		{name: "pkg/bin/alias", linkname: "tool", typeflag: tar.TypeSymlink},
+	}
+
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatTarZst, FormatTarXz} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			result, err := Tar(bytes.NewReader(buildTar(t, format, entries)), format, dir, Options{})
+			if err != nil {
+				t.Fatalf("Tar() error = %v", err)
+			}
+
+			if result.Files != 2 || result.Bytes != int64(len("binary")+len("readme")) {
+				t.Errorf("Result = %d files, %d bytes", result.Files, result.Bytes)
+			}
+			assertFile(t, filepath.Join(dir, "pkg", "bin", "tool"), "binary")
+			assertFile(t, filepath.Join(dir, "pkg", "bin", "alias"), "binary")
+			assertFile(t, filepath.Join(dir, "pkg", "README"), "readme")
+		})
+	}
+}
+
+func TestTar_StripComponents(t *testing.T) {
+	archive := buildTar(t, FormatTar, []entry{
+		{name: "tool-1.0/", typeflag: tar.TypeDir},
+		file("tool-1.0/bin/tool", "binary"),
+		file("top-level", "dropped"),
+	})
+
+	dir := t.TempDir()
+	if _, err := Tar(bytes.NewReader(archive), FormatTar, dir, Options{StripComponents: 1}); err != nil {
+		t.Fatalf("Tar() error = %v", err)
+	}
+
+	assertFile(t, filepath.Join(dir, "bin", "tool"), "binary")
+	if _, err := os.Stat(filepath.Join(dir, "top-level")); !os.IsNotExist(err) {
+		t.Error("entry with too few components should be skipped")
+	}
+}
+
+func TestTar_PathTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"parent", []entry{file("../evil", "x")}},
+		{"nested parent", []entry{file("pkg/../../evil", "x")}},
+		{"absolute", []entry{file("/tmp/evil", "x")}},
+		{"symlink out", []entry{{name: "link", linkname: "../..", typeflag: tar.TypeSymlink}}},
+		{"absolute symlink", []entry{{name: "link", linkname: "/etc", typeflag: tar.TypeSymlink}}},
+		{"hard link out", []entry{{name: "link", linkname: "../evil", typeflag: tar.TypeLink}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "out")
+
+			_, err := Tar(bytes.NewReader(buildTar(t, FormatTar, tt.entries)), FormatTar, dir, Options{})
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("Tar() error = %v, want ErrUnsafePath", err)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+				t.Error("file was written outside the extraction directory")
+			}
+		})
+	}
+}
+
+func TestTar_ExistingSymlinkOut(t *testing.T) {
+	outside := t.TempDir()
+	dir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	archive := buildTar(t, FormatTar, []entry{file("escape/evil", "x")})
+	_, err := Tar(bytes.NewReader(archive), FormatTar, dir, Options{})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Tar() error = %v, want ErrUnsafePath", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil")); !os.IsNotExist(err) {
+		t.Error("file was written through a symlink leading outside")
+	}
+}
+
+func TestZip(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "release.zip")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("release/data.txt")
+	w.Write([]byte("data"))
+	zw.Create("release/empty/")
+	zw.Close()
+	f.Close()
+
+	dir := t.TempDir()
+	result, err := File(archivePath, FormatZip, dir, Options{StripComponents: 1})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if result.Files != 1 {
+		t.Errorf("Files = %d, want 1", result.Files)
+	}
+	assertFile(t, filepath.Join(dir, "data.txt"), "data")
+	if info, err := os.Stat(filepath.Join(dir, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("directory entry not created: %v", err)
+	}
+}
+
+func TestZip_PathTraversal(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "evil.zip")
+	f, _ := os.Create(archivePath)
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create(`..\evil`)
+	w.Write([]byte("x"))
+	zw.Close()
+	f.Close()
+
+	_, err := File(archivePath, FormatZip, t.TempDir(), Options{})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("File() error = %v, want ErrUnsafePath", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "pkg", "keep")
+	os.MkdirAll(filepath.Dir(existing), 0755)
+	os.WriteFile(existing, []byte("keep"), 0644)
+
+	archive := buildTar(t, FormatTar, []entry{file("pkg/new", "x"), file("other/new", "y")})
+	result, err := Tar(bytes.NewReader(archive), FormatTar, dir, Options{})
+	if err != nil {
+		t.Fatalf("Tar() error = %v", err)
+	}
+
+	Remove(result.Created)
+
+	assertFile(t, existing, "keep")
+	for _, name := range []string{"pkg/new", "other"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrNotStreamed is returned by Stream.Close when the stream did not see the
+// whole file in order, so the archive has to be extracted from disk instead
+var ErrNotStreamed = errors.New("archive was not received as a single stream")
+
+// Stream extracts a tar archive while it is being downloaded. Blocks of the
+// file are passed to Write with their offset; blocks seen before are skipped,
+// so a download that restarts from the beginning can keep feeding it.
+type Stream struct {
+	mu     sync.Mutex
+	pw     *io.PipeWriter
+	next   int64 // Offset of the next byte the extraction needs
+	broken error // Set once the stream stops following the file
+
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+// NewStream starts extracting a tar archive of format into dir
+func NewStream(format Format, dir string, opts Options) *Stream {
+	pr, pw := io.Pipe()
+	s := &Stream{pw: pw, done: make(chan struct{})}
+
+	go func() {
+		defer close(s.done)
+		s.result, s.err = Tar(pr, format, dir, opts)
+		if s.err == nil {
+			// Consume the padding after the end of the archive
+			_, s.err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(s.err)
+	}()
+	return s
+}
+
+// Write feeds the block of the file starting at offset to the extraction.
+// A block past a gap ends streaming; extraction errors are reported by Close.
+func (s *Stream) Write(p []byte, offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.broken != nil {
+		return
+	}
+	if offset > s.next {
+		s.stop(ErrNotStreamed)
+		return
+	}
+	if skip := s.next - offset; skip > 0 {
+		if skip >= int64(len(p)) {
+			return
+		}
+		p = p[skip:]
+	}
+
+	n, err := s.pw.Write(p)
+	s.next += int64(n)
+	if err != nil {
+		s.broken = err
+	}
+}
+
+// stop aborts the extraction with err
+func (s *Stream) stop(err error) {
+	s.broken = err
+	s.pw.CloseWithError(err)
+}
+
+// Close ends the stream once the file is complete at size bytes and waits
+// for the extraction. It returns ErrNotStreamed if the stream missed part of
+// the file.
+func (s *Stream) Close(size int64) (*Result, error) {
+	s.mu.Lock()
+	if s.broken == nil {
+		if s.next != size || size == 0 {
+			s.stop(ErrNotStreamed)
+		} else {
+			s.pw.Close()
+		}
+	}
+	broken := s.broken
+	s.mu.Unlock()
+
+	<-s.done
+	if errors.Is(broken, ErrNotStreamed) {
+		return s.result, ErrNotStreamed
+	}
+	return s.result, s.err
+}
+
+// Abort stops the extraction and removes what it has written so far
+func (s *Stream) Abort() {
+	s.mu.Lock()
+	if s.broken == nil {
+		s.stop(errors.New("extraction aborted"))
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	if s.result != nil {
+		Remove(s.result.Created)
+	}
+}
@@ -0,0 +1,84 @@
+package extract
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// feed writes data to s in blocks of size bytes, starting at offset from
+func feed(s *Stream, data []byte, from int64, size int) {
+	for off := from; off < int64(len(data)); off += int64(size) {
+		end := off + int64(size)
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		s.Write(data[off:end], off)
+	}
+}
+
+func TestStream(t *testing.T) {
+	archive := buildTar(t, FormatTarGz, []entry{file("pkg/a", "alpha"), file("pkg/b", "beta")})
+
+	dir := t.TempDir()
+	s := NewStream(FormatTarGz, dir, Options{})
+	feed(s, archive, 0, 7)
+
+	result, err := s.Close(int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if result.Files != 2 {
+		t.Errorf("Files = %d, want 2", result.Files)
+	}
+	assertFile(t, filepath.Join(dir, "pkg", "a"), "alpha")
+	assertFile(t, filepath.Join(dir, "pkg", "b"), "beta")
+}
+
+func TestStream_Restart(t *testing.T) {
+	archive := buildTar(t, FormatTar, []entry{file("a", "alpha")})
+
+	// The download starts over after part of the file; seen blocks are skipped
+	dir := t.TempDir()
+	s := NewStream(FormatTar, dir, Options{})
+	feed(s, archive[:600], 0, 100)
+	feed(s, archive, 0, 256)
+
+	if _, err := s.Close(int64(len(archive))); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	assertFile(t, filepath.Join(dir, "a"), "alpha")
+}
+
+func TestStream_NotStreamed(t *testing.T) {
+	archive := buildTar(t, FormatTar, []entry{file("a", "alpha")})
+
+	t.Run("gap", func(t *testing.T) {
+		s := NewStream(FormatTar, t.TempDir(), Options{})
+		feed(s, archive, 512, 512)
+		if _, err := s.Close(int64(len(archive))); !errors.Is(err, ErrNotStreamed) {
+			t.Errorf("Close() error = %v, want ErrNotStreamed", err)
+		}
+	})
+
+	t.Run("nothing", func(t *testing.T) {
+		s := NewStream(FormatTar, t.TempDir(), Options{})
+		if _, err := s.Close(int64(len(archive))); !errors.Is(err, ErrNotStreamed) {
+			t.Errorf("Close() error = %v, want ErrNotStreamed", err)
+		}
+	})
+}
+
+func TestStream_Abort(t *testing.T) {
+	archive := buildTar(t, FormatTar, []entry{file("pkg/a", "alpha"), file("pkg/b", "beta")})
+
+	dir := filepath.Join(t.TempDir(), "out")
+	s := NewStream(FormatTar, dir, Options{})
+	feed(s, archive[:len(archive)-1024], 0, 512)
+	s.Abort()
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Abort() should remove the extracted files, Stat() error = %v", err)
+	}
+}
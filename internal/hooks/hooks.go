@@ -17,11 +17,12 @@ import (
 type Event string
 
 const (
-	EventStart    Event = "start"    // Download started
-	EventProgress Event = "progress" // Progress update
-	EventComplete Event = "complete" // Download completed successfully
-	EventError    Event = "error"    // Download failed
-	EventCancel   Event = "cancel"   // Download cancelled
+	EventStart           Event = "start"            // Download started
+	EventProgress        Event = "progress"         // Progress update
+	EventComplete        Event = "complete"         // Download completed successfully
+	EventError           Event = "error"            // Download failed
+	EventCancel          Event = "cancel"           // Download cancelled
+	EventSignatureFailed Event = "signature_failed" // Signature verification failed
 )
 
 // Payload contains information about the download event
@@ -37,6 +38,9 @@ type Payload struct {
 	Error      string    `json:"error,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	Duration   float64   `json:"duration_seconds,omitempty"`
+	ExtractDir string    `json:"extract_dir,omitempty"`
+	Uploaded   int64     `json:"uploaded,omitempty"`
+	Ratio      float64   `json:"ratio,omitempty"`
 }
 
 // Hook is the interface for all hook types
@@ -80,16 +84,7 @@ func (h *CommandHook) Execute(ctx context.Context, payload *Payload) error {
 	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
 	defer cancel()
 
-	// Determine shell based on OS
-	var cmd *exec.Cmd
-	if isWindows() {
-		cmd = exec.CommandContext(ctx, "cmd", "/C", h.Command)
-	} else {
-		cmd = exec.CommandContext(ctx, "sh", "-c", h.Command)
-	}
-
-	// Set environment variables
-	cmd.Env = append(os.Environ(), h.buildEnv(payload)...)
+	cmd := h.shellCommand(ctx, payload)
 
 	// Capture output
 	var stdout, stderr bytes.Buffer
@@ -104,6 +99,20 @@ func (h *CommandHook) Execute(ctx context.Context, payload *Payload) error {
 	return nil
 }
 
+// shellCommand prepares the command to run in the system shell, with the
+// environment variables of payload set
+func (h *CommandHook) shellCommand(ctx context.Context, payload *Payload) *exec.Cmd {
+	var cmd *exec.Cmd
+	if isWindows() {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", h.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", h.Command)
+	}
+
+	cmd.Env = append(os.Environ(), h.buildEnv(payload)...)
+	return cmd
+}
+
 func (h *CommandHook) shouldHandle(event Event) bool {
 	for _, e := range h.Events {
 		if e == event {
@@ -125,6 +134,9 @@ func (h *CommandHook) buildEnv(payload *Payload) []string {
 		fmt.Sprintf("BURKUT_SPEED=%d", payload.Speed),
 		fmt.Sprintf("BURKUT_ERROR=%s", payload.Error),
 		fmt.Sprintf("BURKUT_DURATION=%.2f", payload.Duration),
+		fmt.Sprintf("BURKUT_EXTRACT_DIR=%s", payload.ExtractDir),
+		fmt.Sprintf("BURKUT_UPLOADED=%d", payload.Uploaded),
+		fmt.Sprintf("BURKUT_RATIO=%.2f", payload.Ratio),
 	}
 }
 
@@ -319,3 +331,16 @@ func (p *Payload) WithDuration(d time.Duration) *Payload {
 	p.Duration = d.Seconds()
 	return p
 }
+
+// WithExtractDir adds the directory an archive was extracted to
+func (p *Payload) WithExtractDir(dir string) *Payload {
+	p.ExtractDir = dir
+	return p
+}
+
+// WithUpload adds the bytes a torrent uploaded and its share ratio
+func (p *Payload) WithUpload(uploaded int64, ratio float64) *Payload {
+	p.Uploaded = uploaded
+	p.Ratio = ratio
+	return p
+}
@@ -1,8 +1,11 @@
 package hooks
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -81,6 +84,7 @@ func TestCommandHook_BuildEnv(t *testing.T) {
 		Speed:      100,
 		Error:      "test error",
 		Duration:   10.5,
+		ExtractDir: "/tmp/file",
 	}
 	
 	env := hook.buildEnv(payload)
@@ -91,6 +95,7 @@ func TestCommandHook_BuildEnv(t *testing.T) {
 		"BURKUT_FILENAME=file.zip":  true,
 		"BURKUT_SIZE=1000":          true,
 		"BURKUT_DOWNLOADED=500":     true,
+		"BURKUT_EXTRACT_DIR=/tmp/file": true,
 	}
 	
 	for _, e := range env {
@@ -260,7 +265,9 @@ func TestPayload_Fluent(t *testing.T) {
 	payload := CreatePayload(EventComplete, "", "", "").
 		WithProgress(500, 1000, 100, 50.0).
 		WithError(os.ErrNotExist).
-		WithDuration(10 * time.Second)
+		WithDuration(10 * time.Second).
+		WithExtractDir("/tmp/out").
+		WithUpload(1500, 1.5)
 	
 	if payload.Downloaded != 500 {
 		t.Errorf("Downloaded = %d, want 500", payload.Downloaded)
@@ -277,6 +284,14 @@ func TestPayload_Fluent(t *testing.T) {
 	if payload.Duration != 10.0 {
 		t.Errorf("Duration = %f, want 10.0", payload.Duration)
 	}
+
+	if payload.ExtractDir != "/tmp/out" {
+		t.Errorf("ExtractDir = %q, want /tmp/out", payload.ExtractDir)
+	}
+
+	if payload.Uploaded != 1500 || payload.Ratio != 1.5 {
+		t.Errorf("Uploaded, Ratio = %d, %.2f, want 1500, 1.50", payload.Uploaded, payload.Ratio)
+	}
 }
 
 func TestIsWindows(t *testing.T) {
@@ -284,3 +299,39 @@ func TestIsWindows(t *testing.T) {
 	result := isWindows()
 	_ = result // We can't really test the result portably
 }
+
+func TestCommandHook_StartPipe(t *testing.T) {
+	if isWindows() {
+		t.Skip("Skipping on Windows")
+	}
+
+	payload := CreatePayload(EventStart, "http://example.com/file.txt", "file.txt", "/tmp/file.txt")
+
+	t.Run("receives input", func(t *testing.T) {
+		var out bytes.Buffer
+		pipe, err := NewCommandHook(`printf '%s:' "$BURKUT_FILENAME"; cat`).StartPipe(context.Background(), payload, &out, io.Discard)
+		if err != nil {
+			t.Fatalf("StartPipe() error = %v", err)
+		}
+		pipe.Write([]byte("piped data"))
+		if err := pipe.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if out.String() != "file.txt:piped data" {
+			t.Errorf("command output = %q", out.String())
+		}
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		pipe, err := NewCommandHook("cat > /dev/null; exit 3").StartPipe(context.Background(), payload, io.Discard, io.Discard)
+		if err != nil {
+			t.Fatalf("StartPipe() error = %v", err)
+		}
+		err = pipe.Close()
+
+		var pipeErr *PipeError
+		if !errors.As(err, &pipeErr) || pipeErr.ExitCode != 3 {
+			t.Errorf("Close() error = %v, want exit status 3", err)
+		}
+	})
+}
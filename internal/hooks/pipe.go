@@ -0,0 +1,89 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// PipeError reports a piped command that failed
+type PipeError struct {
+	Command  string
+	ExitCode int // -1 if the command did not exit normally
+	Err      error
+}
+
+func (e *PipeError) Error() string {
+	if e.ExitCode > 0 {
+		return fmt.Sprintf("pipe command %q exited with status %d", e.Command, e.ExitCode)
+	}
+	return fmt.Sprintf("pipe command %q failed: %v", e.Command, e.Err)
+}
+
+func (e *PipeError) Unwrap() error {
+	return e.Err
+}
+
+// Pipe is a running command that receives a download on its standard input
+type Pipe struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	waited  bool
+	err     error
+}
+
+// StartPipe starts the hook's command in the shell, with the same environment
+// variables as for hooks, and returns the pipe to its standard input. The
+// command's output goes to stdout and stderr. Unlike hooks, the command has
+// no timeout; it runs until its input ends or ctx is done.
+func (h *CommandHook) StartPipe(ctx context.Context, payload *Payload, stdout, stderr io.Writer) (*Pipe, error) {
+	cmd := h.shellCommand(ctx, payload)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, &PipeError{Command: h.Command, ExitCode: -1, Err: err}
+	}
+	return &Pipe{command: h.Command, cmd: cmd, stdin: stdin}, nil
+}
+
+// Write writes b to the command's standard input
+func (p *Pipe) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Close closes the command's standard input and waits for it to exit.
+// A command that fails or exits with a non-zero status is reported as a
+// *PipeError.
+func (p *Pipe) Close() error {
+	if p.waited {
+		return p.err
+	}
+	p.stdin.Close()
+	p.waited = true
+
+	if err := p.cmd.Wait(); err != nil {
+		pipeErr := &PipeError{Command: p.command, ExitCode: -1, Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			pipeErr.ExitCode = exitErr.ExitCode()
+		}
+		p.err = pipeErr
+	}
+	return p.err
+}
+
+// Kill stops the command and waits for it to exit
+func (p *Pipe) Kill() {
+	if !p.waited {
+		p.cmd.Process.Kill()
+		p.Close()
+	}
+}
@@ -0,0 +1,200 @@
+// Package manifest reads, writes and verifies checksum manifests such as
+// SHA256SUMS.
+//
+// Both line formats of GNU coreutils are understood, and may be mixed in one
+// file along with several algorithms:
+//
+//	<hex>  file            (sha256sum, b3sum; " *file" marks binary mode)
+//	SHA256 (file) = <hex>  (BSD style, sha256sum --tag)
+//
+// The algorithm of a GNU line is taken from the manifest name (SHA512SUMS,
+// B3SUMS, ...) when the length of the digest fits it, and guessed from the
+// length otherwise.
+package manifest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// Names are the manifest file names looked for in a directory, in order
+var Names = []string{
+	"SHA256SUMS", "SHA512SUMS", "SHA1SUMS", "MD5SUMS", "B3SUMS", "BLAKE3SUMS", "CHECKSUMS",
+}
+
+// Entry is one file listed in a manifest
+type Entry struct {
+	Path     string // As written in the manifest, relative to its directory
+	Checksum engine.Checksum
+	Line     int
+}
+
+// bsdNames maps the algorithm names of BSD-style lines
+var bsdNames = map[string]engine.ChecksumAlgorithm{
+	"MD5":    engine.AlgorithmMD5,
+	"SHA1":   engine.AlgorithmSHA1,
+	"SHA256": engine.AlgorithmSHA256,
+	"SHA512": engine.AlgorithmSHA512,
+	"BLAKE3": engine.AlgorithmBLAKE3,
+}
+
+// digestLengths is the hex length of each algorithm's digest
+var digestLengths = map[engine.ChecksumAlgorithm]int{
+	engine.AlgorithmMD5:    32,
+	engine.AlgorithmSHA1:   40,
+	engine.AlgorithmSHA256: 64,
+	engine.AlgorithmSHA512: 128,
+	engine.AlgorithmBLAKE3: 64,
+}
+
+// AlgorithmFromName returns the algorithm a manifest file name implies, or
+// "" if it names none
+func AlgorithmFromName(name string) engine.ChecksumAlgorithm {
+	name = strings.ToLower(filepath.Base(name))
+	switch {
+	case strings.Contains(name, "sha512"):
+		return engine.AlgorithmSHA512
+	case strings.Contains(name, "sha256"):
+		return engine.AlgorithmSHA256
+	case strings.Contains(name, "sha1"):
+		return engine.AlgorithmSHA1
+	case strings.Contains(name, "md5"):
+		return engine.AlgorithmMD5
+	case strings.Contains(name, "blake3"), strings.HasPrefix(name, "b3"):
+		return engine.AlgorithmBLAKE3
+	}
+	return ""
+}
+
+// DefaultName returns the conventional manifest name for an algorithm
+func DefaultName(algorithm engine.ChecksumAlgorithm) string {
+	if algorithm == engine.AlgorithmBLAKE3 {
+		return "B3SUMS"
+	}
+	return strings.ToUpper(string(algorithm)) + "SUMS"
+}
+
+// Find returns the manifests in dir, in the order of Names
+func Find(dir string) []string {
+	var found []string
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// ParseFile reads the manifest at path
+func ParseFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := Parse(f, AlgorithmFromName(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Parse reads manifest lines from r. GNU lines use algorithm if their
+// digest has its length; "" guesses from the length alone. Blank lines and
+// # comments are skipped.
+func Parse(r io.Reader, algorithm engine.ChecksumAlgorithm) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseLine(line, algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entry.Line = n
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return entries, nil
+}
+
+func parseLine(line string, algorithm engine.ChecksumAlgorithm) (Entry, error) {
+	// Names with a backslash or newline are escaped, marked by a leading \
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var entry Entry
+	if open := strings.Index(line, " ("); open > 0 && bsdNames[line[:open]] != "" {
+		closing := strings.LastIndex(line, ") = ")
+		if closing < open {
+			return Entry{}, fmt.Errorf("malformed line %q", line)
+		}
+		entry.Checksum.Algorithm = bsdNames[line[:open]]
+		entry.Checksum.Value = strings.ToLower(line[closing+4:])
+		entry.Path = line[open+2 : closing]
+	} else {
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || name == "" {
+			return Entry{}, fmt.Errorf("malformed line %q", line)
+		}
+		// " *" marks binary mode, "  " text mode; both read the same bytes
+		if name[0] == ' ' || name[0] == '*' {
+			name = name[1:]
+		}
+		entry.Checksum.Value = strings.ToLower(sum)
+		entry.Path = name
+
+		entry.Checksum.Algorithm = algorithm
+		if digestLengths[algorithm] != len(sum) {
+			entry.Checksum.Algorithm = engine.DetectAlgorithmFromLength(sum)
+		}
+	}
+
+	if escaped {
+		entry.Path = unescape(entry.Path)
+	}
+	if entry.Path == "" {
+		return Entry{}, fmt.Errorf("missing file name in %q", line)
+	}
+	if _, err := hex.DecodeString(entry.Checksum.Value); err != nil || len(entry.Checksum.Value) != digestLengths[entry.Checksum.Algorithm] {
+		return Entry{}, fmt.Errorf("invalid %s digest %q", entry.Checksum.Algorithm, entry.Checksum.Value)
+	}
+	return entry, nil
+}
+
+func unescape(name string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+}
+
+// FormatLine returns the manifest line for path in GNU style, or BSD style
+// if tag is set, escaping names like coreutils does
+func FormatLine(path string, sum *engine.Checksum, tag bool) string {
+	prefix := ""
+	if strings.ContainsAny(path, "\\\n") {
+		prefix = "\\"
+		path = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(path)
+	}
+	if tag {
+		name := strings.ToUpper(string(sum.Algorithm))
+		return fmt.Sprintf("%s%s (%s) = %s", prefix, name, path, sum.Value)
+	}
+	return fmt.Sprintf("%s%s  %s", prefix, sum.Value, path)
+}
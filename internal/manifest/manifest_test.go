@@ -0,0 +1,163 @@
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// checksum returns the digest of content with algorithm
+func checksum(t *testing.T, content string, algorithm engine.ChecksumAlgorithm) string {
+	t.Helper()
+	sum, err := engine.CalculateChecksumReader(strings.NewReader(content), algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum.Value
+}
+
+func TestParse(t *testing.T) {
+	sha256 := strings.Repeat("ab", 32)
+	sha512 := strings.Repeat("cd", 64)
+	md5 := strings.Repeat("ef", 16)
+
+	input := "# release checksums\n" +
+		sha256 + "  app.tar.gz\n" +
+		sha256 + " *app.exe\n" +
+		sha512 + "  big.iso\n" +
+		"SHA256 (notes.txt) = " + strings.ToUpper(sha256) + "\n" +
+		"MD5 (file (1).txt) = " + md5 + "\r\n" +
+		"\\" + sha256 + "  dir\\\\back\\nslash\n" +
+		"\n"
+
+	entries, err := Parse(strings.NewReader(input), engine.AlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []Entry{
+		{Path: "app.tar.gz", Checksum: engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: sha256}, Line: 2},
+		{Path: "app.exe", Checksum: engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: sha256}, Line: 3},
+		{Path: "big.iso", Checksum: engine.Checksum{Algorithm: engine.AlgorithmSHA512, Value: sha512}, Line: 4},
+		{Path: "notes.txt", Checksum: engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: sha256}, Line: 5},
+		{Path: "file (1).txt", Checksum: engine.Checksum{Algorithm: engine.AlgorithmMD5, Value: md5}, Line: 6},
+		{Path: "dir\\back\nslash", Checksum: engine.Checksum{Algorithm: engine.AlgorithmSHA256, Value: sha256}, Line: 7},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Parse() returned %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	t.Run("algorithm from manifest name", func(t *testing.T) {
+		entries, err := Parse(strings.NewReader(sha256+"  a\n"), AlgorithmFromName("/rel/B3SUMS"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries[0].Checksum.Algorithm != engine.AlgorithmBLAKE3 {
+			t.Errorf("Algorithm = %s, want blake3", entries[0].Checksum.Algorithm)
+		}
+	})
+
+	for _, bad := range []string{
+		"nothex!!  file\n",
+		sha256 + "\n",
+		"SHA256 (file) = " + md5 + "\n",
+		"SHA256 (file = " + sha256 + "\n",
+	} {
+		if _, err := Parse(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestFormatLine_RoundTrip(t *testing.T) {
+	sum := &engine.Checksum{Algorithm: engine.AlgorithmSHA1, Value: strings.Repeat("01", 20)}
+	for _, tag := range []bool{false, true} {
+		for _, name := range []string{"plain.txt", "sub/dir/file", "odd\\name\nhere"} {
+			line := FormatLine(name, sum, tag)
+			entries, err := Parse(strings.NewReader(line+"\n"), engine.AlgorithmSHA1)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", line, err)
+			}
+			if entries[0].Path != name || entries[0].Checksum != *sum {
+				t.Errorf("round trip of %q (tag=%v) = %+v", name, tag, entries[0])
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "good.txt"), []byte("good"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "bad.txt"), []byte("tampered"), 0644)
+
+	manifest := checksum(t, "good", engine.AlgorithmSHA256) + "  good.txt\n" +
+		"BLAKE3 (./sub/bad.txt) = " + checksum(t, "original", engine.AlgorithmBLAKE3) + "\n" +
+		checksum(t, "gone", engine.AlgorithmMD5) + "  missing.txt\n"
+	entries, err := Parse(strings.NewReader(manifest), engine.AlgorithmSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen int
+	results := Verify(context.Background(), dir, "SHA256SUMS", entries, 3, func(Result) { seen++ })
+	if seen != 3 {
+		t.Errorf("onResult called %d times, want 3", seen)
+	}
+
+	want := []Status{StatusOK, StatusFailed, StatusMissing}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("%s: Status = %s, want %s", r.Path, r.Status, want[i])
+		}
+	}
+
+	var report Report
+	report.Tally(results)
+	if report.OK != 1 || report.Failed != 1 || report.Missing != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Passed(true) || report.Passed(false) {
+		t.Error("report with a failed file passed")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "app.bin"), []byte("binary"), 0644)
+	os.WriteFile(filepath.Join(dir, "docs", "README"), []byte("readme"), 0644)
+	os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte("stale"), 0644)
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if strings.Join(files, ",") != "app.bin,docs/README" {
+		t.Errorf("Files() = %v", files)
+	}
+
+	path := filepath.Join(dir, DefaultName(engine.AlgorithmSHA256))
+	if err := Write(context.Background(), path, dir, files, engine.AlgorithmSHA256, false, 2); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	entries, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	var report Report
+	report.Tally(Verify(context.Background(), dir, path, entries, 2, nil))
+	if report.OK != 2 || !report.Passed(false) {
+		t.Errorf("verifying the written manifest: %+v", report)
+	}
+}
@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// Status is the outcome of verifying one file
+type Status string
+
+const (
+	StatusOK      Status = "OK"
+	StatusFailed  Status = "FAILED"
+	StatusMissing Status = "MISSING"
+	StatusError   Status = "ERROR" // The file exists but could not be read
+)
+
+// Result is the outcome of verifying one manifest entry
+type Result struct {
+	Path      string                   `json:"path"`
+	Manifest  string                   `json:"manifest"`
+	Algorithm engine.ChecksumAlgorithm `json:"algorithm"`
+	Expected  string                   `json:"expected"`
+	Actual    string                   `json:"actual,omitempty"`
+	Status    Status                   `json:"status"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+// Report is the outcome of verifying a directory
+type Report struct {
+	Dir       string   `json:"dir"`
+	Manifests []string `json:"manifests"`
+	OK        int      `json:"ok"`
+	Failed    int      `json:"failed"`
+	Missing   int      `json:"missing"`
+	Errors    int      `json:"errors"`
+	Files     []Result `json:"files"`
+}
+
+// Passed reports whether every file verified, counting missing files as
+// failures unless ignoreMissing is set
+func (r *Report) Passed(ignoreMissing bool) bool {
+	return r.Failed == 0 && r.Errors == 0 && (ignoreMissing || r.Missing == 0)
+}
+
+// Verify checks the entries of manifest against the files in dir on up to
+// workers goroutines. onResult, if set, is called as each file finishes.
+// Results are returned in manifest order.
+func Verify(ctx context.Context, dir, manifest string, entries []Entry, workers int, onResult func(Result)) []Result {
+	results := make([]Result, len(entries))
+	var mu sync.Mutex
+	forEach(ctx, len(entries), workers, func(i int) {
+		results[i] = verifyEntry(dir, manifest, entries[i])
+		if onResult != nil {
+			mu.Lock()
+			onResult(results[i])
+			mu.Unlock()
+		}
+	})
+
+	// Entries never reached after cancellation are left out
+	done := results[:0]
+	for _, r := range results {
+		if r.Status != "" {
+			done = append(done, r)
+		}
+	}
+	return done
+}
+
+func verifyEntry(dir, manifest string, entry Entry) Result {
+	result := Result{
+		Path:      entry.Path,
+		Manifest:  manifest,
+		Algorithm: entry.Checksum.Algorithm,
+		Expected:  entry.Checksum.Value,
+	}
+
+	actual, err := engine.CalculateChecksum(resolve(dir, entry.Path), entry.Checksum.Algorithm)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		result.Status = StatusMissing
+	case err != nil:
+		result.Status = StatusError
+		result.Error = err.Error()
+	case actual.Value != entry.Checksum.Value:
+		result.Status = StatusFailed
+		result.Actual = actual.Value
+	default:
+		result.Status = StatusOK
+		result.Actual = actual.Value
+	}
+	return result
+}
+
+// resolve returns the path of a manifest entry, which is relative to dir
+// unless absolute
+func resolve(dir, path string) string {
+	path = filepath.FromSlash(strings.TrimPrefix(path, "./"))
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Tally adds results to the report
+func (r *Report) Tally(results []Result) {
+	for _, result := range results {
+		switch result.Status {
+		case StatusOK:
+			r.OK++
+		case StatusFailed:
+			r.Failed++
+		case StatusMissing:
+			r.Missing++
+		default:
+			r.Errors++
+		}
+	}
+	r.Files = append(r.Files, results...)
+}
+
+// forEach calls fn for 0..n-1 on up to workers goroutines, starting no new
+// calls once ctx is done
+func forEach(ctx context.Context, n, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+}
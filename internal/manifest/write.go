@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// Files returns the regular files under root, relative to it with forward
+// slashes and sorted, leaving out manifests named in Names
+func Files(root string) ([]string, error) {
+	skip := make(map[string]bool, len(Names))
+	for _, name := range Names {
+		skip[name] = true
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if !skip[rel] {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Write hashes files, given relative to dir, on up to workers goroutines
+// and writes a manifest of them to path through a temporary file
+func Write(ctx context.Context, path, dir string, files []string, algorithm engine.ChecksumAlgorithm, tag bool, workers int) error {
+	lines, err := Lines(ctx, dir, files, algorithm, tag, workers)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Lines hashes files, given relative to dir, on up to workers goroutines
+// and returns their manifest lines in the same order
+func Lines(ctx context.Context, dir string, files []string, algorithm engine.ChecksumAlgorithm, tag bool, workers int) ([]string, error) {
+	lines := make([]string, len(files))
+	errs := make([]error, len(files))
+	forEach(ctx, len(files), workers, func(i int) {
+		sum, err := engine.CalculateChecksum(resolve(dir, files[i]), algorithm)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		lines[i] = FormatLine(files[i], sum, tag)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("hashing %s: %w", files[i], err)
+		}
+	}
+	return lines, nil
+}
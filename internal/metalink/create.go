@@ -0,0 +1,132 @@
+package metalink
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+// Namespace is the XML namespace of Metalink 4 documents
+const Namespace = "urn:ietf:params:xml:ns:metalink"
+
+// Piece lengths chosen for a file when none is given: a power of two
+// keeping the number of pieces near maxAutoPieces
+const (
+	minAutoPieceLength = 256 * 1024
+	maxAutoPieceLength = 16 * 1024 * 1024
+	maxAutoPieces      = 2048
+)
+
+// hashTypes are the IANA names of the algorithms a metalink can carry, and
+// its pieces be verified with
+var hashTypes = map[engine.ChecksumAlgorithm]string{
+	engine.AlgorithmMD5:    "md5",
+	engine.AlgorithmSHA1:   "sha-1",
+	engine.AlgorithmSHA256: "sha-256",
+	engine.AlgorithmSHA512: "sha-512",
+}
+
+// PieceLength returns the piece length used for a file of size bytes
+func PieceLength(size int64) int64 {
+	length := int64(minAutoPieceLength)
+	for length < maxAutoPieceLength && size > length*maxAutoPieces {
+		length *= 2
+	}
+	return length
+}
+
+// CreateFile describes the local file at path as the metalink file name,
+// with the hash of the whole file and of every pieceLength bytes (chosen
+// from its size if 0), both computed with algorithm in one read
+func CreateFile(path, name string, algorithm engine.ChecksumAlgorithm, pieceLength int64) (*File, error) {
+	hashType, ok := hashTypes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%s hashes cannot be used in a metalink", algorithm)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("getting file info: %w", err)
+	}
+	if pieceLength <= 0 {
+		pieceLength = PieceLength(info.Size())
+	}
+
+	whole, err := engine.NewChecksumWriter(io.Discard, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{Name: name, Size: info.Size()}
+	pieces := &Pieces{Type: hashType, Length: pieceLength}
+
+	buf := make([]byte, pieceLength)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			whole.Write(buf[:n])
+			piece, hashErr := engine.CalculateChecksumReader(bytes.NewReader(buf[:n]), algorithm)
+			if hashErr != nil {
+				return nil, hashErr
+			}
+			pieces.Hashes = append(pieces.Hashes, PieceHash{Value: piece.Value})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+
+	file.Hashes = []Hash{{Type: hashType, Value: whole.Checksum().Value}}
+	if len(pieces.Hashes) > 0 {
+		file.Pieces = pieces
+	}
+	return file, nil
+}
+
+// AddMirrors adds a URL for the file under each prefix, in order of priority
+func (f *File) AddMirrors(prefixes []string) {
+	segments := strings.Split(f.Name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	escaped := strings.Join(segments, "/")
+
+	for _, prefix := range prefixes {
+		f.URLs = append(f.URLs, URL{
+			Priority: len(f.URLs) + 1,
+			URL:      strings.TrimRight(prefix, "/") + "/" + escaped,
+		})
+	}
+}
+
+// document is the Metalink 4 subset of Metalink written by Marshal
+type document struct {
+	XMLName   xml.Name `xml:"metalink"`
+	XMLNS     string   `xml:"xmlns,attr"`
+	Generator string   `xml:"generator,omitempty"`
+	Files     []File   `xml:"file"`
+}
+
+// Marshal returns ml as a Metalink 4 (RFC 5854) document
+func Marshal(ml *Metalink) ([]byte, error) {
+	doc := document{XMLNS: Namespace, Generator: ml.Generator, Files: ml.Files}
+	data, err := xml.MarshalIndent(&doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding metalink: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
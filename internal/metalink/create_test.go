@@ -0,0 +1,107 @@
+package metalink
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
+)
+
+func TestPieceLength(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{0, 256 * 1024},
+		{100 * 1024 * 1024, 256 * 1024},
+		{1024 * 1024 * 1024, 512 * 1024},
+		{1 << 40, 16 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		if got := PieceLength(tt.size); got != tt.want {
+			t.Errorf("PieceLength(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCreateFile_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("burkut metalink "), 1000) // 16000 bytes
+	path := filepath.Join(dir, "release 1.0.tar.gz")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := CreateFile(path, "release 1.0.tar.gz", engine.AlgorithmSHA256, 4096)
+	if err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	file.AddMirrors([]string{"https://a.example.com/pub/", "https://b.example.com"})
+	file.MetaURLs = []MetaURL{{MediaType: "torrent", URL: "https://a.example.com/release.torrent"}}
+
+	data, err := Marshal(&Metalink{Generator: "test", Files: []File{*file}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `<metalink xmlns="urn:ietf:params:xml:ns:metalink">`) {
+		t.Errorf("document lacks the Metalink 4 namespace:\n%s", data)
+	}
+	if strings.Contains(string(data), "<files>") {
+		t.Errorf("document has a Metalink 3 files element:\n%s", data)
+	}
+
+	ml, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got := ml.GetFile()
+	if got == nil || got.Name != file.Name || got.Size != int64(len(content)) {
+		t.Fatalf("parsed file = %+v", got)
+	}
+
+	want, _ := engine.CalculateChecksumReader(bytes.NewReader(content), engine.AlgorithmSHA256)
+	if v := got.GetChecksum("sha-256"); v != want.Value {
+		t.Errorf("sha-256 = %s, want %s", v, want.Value)
+	}
+
+	urls := got.SortedURLs()
+	if len(urls) != 2 || urls[0].URL != "https://a.example.com/pub/release%201.0.tar.gz" || urls[1].URL != "https://b.example.com/release%201.0.tar.gz" {
+		t.Errorf("URLs = %+v", urls)
+	}
+	if len(got.MetaURLs) != 1 || got.MetaURLs[0].MediaType != "torrent" {
+		t.Errorf("MetaURLs = %+v", got.MetaURLs)
+	}
+
+	pv := NewPieceVerifier(got)
+	if pv == nil || pv.PieceCount() != 4 || pv.PieceLength() != 4096 {
+		t.Fatalf("piece verifier = %+v", pv)
+	}
+	if _, ok, err := pv.VerifyFilePieces(path); err != nil || !ok {
+		t.Errorf("VerifyFilePieces() = %v, %v", ok, err)
+	}
+}
+
+func TestCreateFile_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := CreateFile(path, "empty", engine.AlgorithmMD5, 0)
+	if err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	if file.Pieces != nil {
+		t.Errorf("empty file has pieces: %+v", file.Pieces)
+	}
+
+	if _, err := CreateFile(path, "empty", engine.AlgorithmBLAKE3, 0); err == nil {
+		t.Error("CreateFile() accepted blake3")
+	}
+	if _, err := CreateFile(filepath.Join(t.TempDir(), "missing"), "missing", engine.AlgorithmSHA256, 0); err == nil {
+		t.Error("CreateFile() accepted a missing file")
+	}
+}
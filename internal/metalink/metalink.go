@@ -7,15 +7,18 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"sort"
 	"strings"
 )
 
 // Metalink represents a Metalink 4 (RFC 5854) or Metalink 3 document
 type Metalink struct {
-	XMLName xml.Name `xml:"metalink"`
-	Version string   `xml:"version,attr"` // Metalink 3 only
-	XMLNS   string   `xml:"xmlns,attr"`   // Metalink 4: urn:ietf:params:xml:ns:metalink
-	Files   []File   `xml:"file"`
+	XMLName   xml.Name `xml:"metalink"`
+	Version   string   `xml:"version,attr"`           // Metalink 3 only
+	XMLNS     string   `xml:"xmlns,attr"`             // Metalink 4: urn:ietf:params:xml:ns:metalink
+	Generator string   `xml:"generator,omitempty"`
+	Files     []File   `xml:"file"`
 	// Metalink 3 format
 	FilesV3 []FileV3 `xml:"files>file"`
 }
@@ -28,6 +31,7 @@ type File struct {
 	Publisher   *Publisher `xml:"publisher,omitempty"`
 	Hashes      []Hash   `xml:"hash"`
 	Pieces      *Pieces  `xml:"pieces,omitempty"`
+	Signature   *Signature `xml:"signature,omitempty"`
 	URLs        []URL    `xml:"url"`
 	MetaURLs    []MetaURL `xml:"metaurl,omitempty"`
 }
@@ -64,6 +68,7 @@ type Hash struct {
 type VerificationV3 struct {
 	Hashes []HashV3 `xml:"hash"`
 	Pieces *PiecesV3 `xml:"pieces,omitempty"`
+	Signature *SignatureV3 `xml:"signature,omitempty"`
 }
 
 // HashV3 represents a hash in Metalink 3 format
@@ -72,6 +77,18 @@ type HashV3 struct {
 	Value string `xml:",chardata"`
 }
 
+// Signature represents a detached signature of the file
+type Signature struct {
+	MediaType string `xml:"mediatype,attr"` // e.g. application/pgp-signature
+	Value     string `xml:",chardata"`
+}
+
+// SignatureV3 represents a signature in Metalink 3 format
+type SignatureV3 struct {
+	Type  string `xml:"type,attr"` // e.g. pgp
+	Value string `xml:",chardata"`
+}
+
 // Pieces represents piece hashes for segmented download verification
 type Pieces struct {
 	Type   string  `xml:"type,attr"`
@@ -86,9 +103,10 @@ type PiecesV3 struct {
 	Hashes []PieceHashV3 `xml:"hash"`
 }
 
-// PieceHash represents a single piece hash
+// PieceHash represents a single piece hash. Metalink 4 lists them in order
+// without piece numbers.
 type PieceHash struct {
-	Piece int    `xml:"piece,attr"`
+	Piece int    `xml:"piece,attr,omitempty"`
 	Value string `xml:",chardata"`
 }
 
@@ -175,6 +193,13 @@ func convertV3ToV4(filesV3 []FileV3) []File {
 				})
 			}
 
+			if f3.Verification.Signature != nil {
+				file.Signature = &Signature{
+					MediaType: f3.Verification.Signature.Type,
+					Value:     f3.Verification.Signature.Value,
+				}
+			}
+
 			// Convert pieces
 			if f3.Verification.Pieces != nil {
 				file.Pieces = &Pieces{
@@ -249,6 +274,62 @@ func (f *File) SortedURLs() []URL {
 	return urls
 }
 
+// PreferredURLs returns the URLs sorted by priority, with those in one of
+// locations (ISO 3166-1 country codes, most preferred first) ahead of the rest
+func (f *File) PreferredURLs(locations []string) []URL {
+	urls := f.SortedURLs()
+	if len(locations) == 0 {
+		return urls
+	}
+
+	rank := func(u URL) int {
+		for i, location := range locations {
+			if strings.EqualFold(strings.TrimSpace(location), u.Location) {
+				return i
+			}
+		}
+		return len(locations)
+	}
+	sort.SliceStable(urls, func(i, j int) bool {
+		return rank(urls[i]) < rank(urls[j])
+	})
+	return urls
+}
+
+// Select returns the files whose name, or its last element, matches one of
+// the glob patterns. Without patterns every file is returned.
+func (m *Metalink) Select(patterns []string) ([]*File, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	var files []*File
+	for i := range m.Files {
+		if matchesAny(m.Files[i].Name, patterns) {
+			files = append(files, &m.Files[i])
+		}
+	}
+	return files, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	name = strings.ReplaceAll(name, "\\", "/")
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // GetChecksum returns the checksum of the specified type
 // Returns empty string if not found
 func (f *File) GetChecksum(hashType string) string {
@@ -313,8 +394,19 @@ func NewPieceVerifier(f *File) *PieceVerifier {
 		totalSize:   f.Size,
 	}
 
+	// Metalink 4 lists piece hashes in order; Metalink 3 numbers them
+	numbered := false
 	for _, ph := range f.Pieces.Hashes {
-		pv.hashes[ph.Piece] = strings.ToLower(strings.TrimSpace(ph.Value))
+		if ph.Piece != 0 {
+			numbered = true
+			break
+		}
+	}
+	for i, ph := range f.Pieces.Hashes {
+		if numbered {
+			i = ph.Piece
+		}
+		pv.hashes[i] = strings.ToLower(strings.TrimSpace(ph.Value))
 	}
 
 	return pv
@@ -192,6 +192,75 @@ func TestMetalink_GetFileByName(t *testing.T) {
 	}
 }
 
+func TestMetalink_Select(t *testing.T) {
+	ml := Metalink{
+		Files: []File{
+			{Name: "iso/distro.iso"},
+			{Name: "iso/distro.iso.sig"},
+			{Name: "docs/README"},
+		},
+	}
+
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{nil, []string{"iso/distro.iso", "iso/distro.iso.sig", "docs/README"}},
+		{[]string{"*.iso"}, []string{"iso/distro.iso"}},
+		{[]string{"iso/*"}, []string{"iso/distro.iso", "iso/distro.iso.sig"}},
+		{[]string{"README", "*.sig"}, []string{"iso/distro.iso.sig", "docs/README"}},
+		{[]string{"*.zip"}, nil},
+	}
+
+	for _, tt := range tests {
+		files, err := ml.Select(tt.patterns)
+		if err != nil {
+			t.Fatalf("Select(%v) error = %v", tt.patterns, err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Select(%v) = %v, want %v", tt.patterns, names, tt.want)
+		}
+	}
+
+	if _, err := ml.Select([]string{"[a-"}); err == nil {
+		t.Error("Select() accepted a malformed pattern")
+	}
+}
+
+func TestFile_PreferredURLs(t *testing.T) {
+	file := File{
+		URLs: []URL{
+			{Priority: 1, Location: "us", URL: "http://us1"},
+			{Priority: 2, Location: "tr", URL: "http://tr"},
+			{Priority: 3, Location: "DE", URL: "http://de"},
+			{Priority: 2, Location: "us", URL: "http://us2"},
+		},
+	}
+
+	tests := []struct {
+		locations []string
+		want      string
+	}{
+		{nil, "http://us1,http://tr,http://us2,http://de"},
+		{[]string{"de", "tr"}, "http://de,http://tr,http://us1,http://us2"},
+		{[]string{"tr"}, "http://tr,http://us1,http://us2,http://de"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, u := range file.PreferredURLs(tt.locations) {
+			got = append(got, u.URL)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("PreferredURLs(%v) = %v, want %s", tt.locations, got, tt.want)
+		}
+	}
+}
+
 func TestIsMetalink(t *testing.T) {
 	tests := []struct {
 		filename string
@@ -252,3 +321,29 @@ func TestParse_WithPieces(t *testing.T) {
 		t.Errorf("Piece hashes count = %d, want 3", len(file.Pieces.Hashes))
 	}
 }
+
+func TestParse_Signature(t *testing.T) {
+	v4 := `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="example.iso">
+    <signature mediatype="application/pgp-signature">-----BEGIN PGP SIGNATURE-----
+iQEzBAABCAAdFiEE
+-----END PGP SIGNATURE-----</signature>
+    <url>https://example.com/example.iso</url>
+  </file>
+</metalink>`
+	v3 := `<metalink version="3.0"><files><file name="example.zip">
+  <verification><signature type="pgp">-----BEGIN PGP SIGNATURE-----</signature></verification>
+  <resources><url type="http">https://example.com/example.zip</url></resources>
+</file></files></metalink>`
+
+	for name, input := range map[string]string{"metalink 4": v4, "metalink 3": v3} {
+		ml, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("%s: Parse error: %v", name, err)
+		}
+		sig := ml.GetFile().Signature
+		if sig == nil || !strings.HasPrefix(sig.Value, "-----BEGIN PGP SIGNATURE-----") {
+			t.Errorf("%s: Signature = %+v", name, sig)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -132,6 +133,36 @@ func TestPieceVerifier(t *testing.T) {
 	}
 }
 
+func TestPieceVerifier_UnnumberedHashes(t *testing.T) {
+	// RFC 5854 lists piece hashes in order, without piece numbers
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="test.bin">
+    <size>6</size>
+    <pieces type="sha-256" length="4">
+      <hash>` + sha256Hex("abcd") + `</hash>
+      <hash>` + sha256Hex("ef") + `</hash>
+    </pieces>
+  </file>
+</metalink>`
+
+	ml, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pv := NewPieceVerifier(ml.GetFile())
+	for i, data := range []string{"abcd", "ef"} {
+		if valid, _, err := pv.VerifyPieceData(i, []byte(data)); err != nil || !valid {
+			t.Errorf("VerifyPieceData(%d) = %v, %v", i, valid, err)
+		}
+	}
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
 func TestPieceVerifier_NoPieces(t *testing.T) {
 	file := &File{
 		Name: "test.bin",
@@ -4,6 +4,7 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +17,7 @@ type Metrics struct {
 	downloadsCompleted  int64 // Successfully completed downloads
 	downloadsFailed     int64 // Failed downloads
 	bytesDownloadedTotal int64 // Total bytes downloaded
+	bytesUploadedTotal   int64 // Total bytes uploaded to torrent peers
 
 	// Gauges
 	activeDownloads     int64 // Currently active downloads
@@ -25,6 +27,9 @@ type Metrics struct {
 	// Histogram buckets for download duration
 	durationBuckets map[string]int64 // bucket label -> count
 
+	// Downloads by negotiated protocol (e.g., "HTTP/3.0")
+	protocols map[string]int64
+
 	// Start time for uptime calculation
 	startTime time.Time
 
@@ -43,6 +48,7 @@ func New() *Metrics {
 			"le_300s":  0,
 			"le_inf":   0,
 		},
+		protocols: make(map[string]int64),
 	}
 }
 
@@ -66,6 +72,11 @@ func (m *Metrics) AddBytesDownloaded(bytes int64) {
 	atomic.AddInt64(&m.bytesDownloadedTotal, bytes)
 }
 
+// AddBytesUploaded adds to the total bytes uploaded
+func (m *Metrics) AddBytesUploaded(bytes int64) {
+	atomic.AddInt64(&m.bytesUploadedTotal, bytes)
+}
+
 // SetActiveDownloads sets the number of active downloads
 func (m *Metrics) SetActiveDownloads(count int64) {
 	atomic.StoreInt64(&m.activeDownloads, count)
@@ -113,6 +124,28 @@ func (m *Metrics) RecordDownloadDuration(d time.Duration) {
 	}
 }
 
+// RecordProtocol counts a download served over the given protocol
+func (m *Metrics) RecordProtocol(proto string) {
+	if proto == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.protocols[proto]++
+}
+
+// GetProtocols returns download counts per negotiated protocol
+func (m *Metrics) GetProtocols() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	protocols := make(map[string]int64, len(m.protocols))
+	for k, v := range m.protocols {
+		protocols[k] = v
+	}
+	return protocols
+}
+
 // GetStats returns current metrics as a map
 func (m *Metrics) GetStats() map[string]int64 {
 	m.mu.RLock()
@@ -123,6 +156,7 @@ func (m *Metrics) GetStats() map[string]int64 {
 		"downloads_completed":   atomic.LoadInt64(&m.downloadsCompleted),
 		"downloads_failed":      atomic.LoadInt64(&m.downloadsFailed),
 		"bytes_downloaded_total": atomic.LoadInt64(&m.bytesDownloadedTotal),
+		"bytes_uploaded_total":   atomic.LoadInt64(&m.bytesUploadedTotal),
 		"active_downloads":      atomic.LoadInt64(&m.activeDownloads),
 		"active_connections":    atomic.LoadInt64(&m.activeConnections),
 		"current_speed":         atomic.LoadInt64(&m.currentSpeed),
@@ -162,6 +196,10 @@ func (m *Metrics) Handler() http.Handler {
 		fmt.Fprintln(w, "# TYPE burkut_bytes_downloaded_total counter")
 		fmt.Fprintf(w, "burkut_bytes_downloaded_total %d\n", stats["bytes_downloaded_total"])
 
+		fmt.Fprintln(w, "# HELP burkut_bytes_uploaded_total Total bytes uploaded to torrent peers")
+		fmt.Fprintln(w, "# TYPE burkut_bytes_uploaded_total counter")
+		fmt.Fprintf(w, "burkut_bytes_uploaded_total %d\n", stats["bytes_uploaded_total"])
+
 		fmt.Fprintln(w, "# HELP burkut_active_downloads Currently active downloads")
 		fmt.Fprintln(w, "# TYPE burkut_active_downloads gauge")
 		fmt.Fprintf(w, "burkut_active_downloads %d\n", stats["active_downloads"])
@@ -187,6 +225,20 @@ func (m *Metrics) Handler() http.Handler {
 		fmt.Fprintf(w, "burkut_download_duration_seconds_bucket{le=\"60\"} %d\n", stats["download_duration_seconds_bucket_le_60s"])
 		fmt.Fprintf(w, "burkut_download_duration_seconds_bucket{le=\"300\"} %d\n", stats["download_duration_seconds_bucket_le_300s"])
 		fmt.Fprintf(w, "burkut_download_duration_seconds_bucket{le=\"+Inf\"} %d\n", stats["download_duration_seconds_bucket_le_inf"])
+
+		// Downloads by protocol
+		protocols := m.GetProtocols()
+		names := make([]string, 0, len(protocols))
+		for name := range protocols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(w, "# HELP burkut_downloads_by_protocol_total Downloads by negotiated protocol")
+		fmt.Fprintln(w, "# TYPE burkut_downloads_by_protocol_total counter")
+		for _, name := range names {
+			fmt.Fprintf(w, "burkut_downloads_by_protocol_total{protocol=%q} %d\n", name, protocols[name])
+		}
 	})
 }
 
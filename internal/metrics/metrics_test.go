@@ -100,7 +100,10 @@ func TestMetrics_Handler(t *testing.T) {
 	m.IncDownloadsTotal()
 	m.IncDownloadsCompleted()
 	m.AddBytesDownloaded(1024)
+	m.AddBytesUploaded(512)
 	m.SetActiveDownloads(2)
+	m.RecordProtocol("HTTP/3.0")
+	m.RecordProtocol("HTTP/3.0")
 
 	// Create test server
 	handler := m.Handler()
@@ -122,9 +125,11 @@ func TestMetrics_Handler(t *testing.T) {
 		"burkut_downloads_total 1",
 		"burkut_downloads_completed_total 1",
 		"burkut_bytes_downloaded_total 1024",
+		"burkut_bytes_uploaded_total 512",
 		"burkut_active_downloads 2",
 		"# TYPE burkut_downloads_total counter",
 		"# TYPE burkut_active_downloads gauge",
+		`burkut_downloads_by_protocol_total{protocol="HTTP/3.0"} 2`,
 	}
 
 	for _, expected := range expectedMetrics {
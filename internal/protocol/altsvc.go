@@ -0,0 +1,285 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Mode controls whether HTTPClient uses HTTP/3 (QUIC)
+type HTTP3Mode string
+
+const (
+	// HTTP3Off never uses HTTP/3
+	HTTP3Off HTTP3Mode = "off"
+	// HTTP3On sends every request over HTTP/3 and fails if QUIC is unavailable
+	HTTP3On HTTP3Mode = "on"
+	// HTTP3Auto upgrades to HTTP/3 when the server advertises it via Alt-Svc
+	// and falls back to HTTP/2 or HTTP/1.1 when QUIC is blocked
+	HTTP3Auto HTTP3Mode = "auto"
+)
+
+// Defaults for HTTP/3 connection handling
+const (
+	defaultH3HandshakeTimeout = 3 * time.Second
+	defaultAltSvcMaxAge       = 24 * time.Hour
+	h3BrokenDuration          = 5 * time.Minute
+)
+
+// errHTTP3Proxy is returned when HTTP/3 is forced but a proxy is configured
+var errHTTP3Proxy = errors.New("HTTP/3 cannot be used through a proxy")
+
+// ParseHTTP3Mode parses an HTTP/3 mode name
+func ParseHTTP3Mode(s string) (HTTP3Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "false", "no":
+		return HTTP3Off, nil
+	case "on", "true", "yes", "force":
+		return HTTP3On, nil
+	case "auto":
+		return HTTP3Auto, nil
+	default:
+		return "", fmt.Errorf("unknown HTTP/3 mode: %s (use on, auto or off)", s)
+	}
+}
+
+// WithHTTP3 enables HTTP/3 for the client.
+// The QUIC transport shares TLS settings with the TCP transport; requests
+// always carry the client's headers.
+func WithHTTP3(mode HTTP3Mode) HTTPClientOption {
+	return func(c *HTTPClient) {
+		c.http3Mode = mode
+	}
+}
+
+// altSvcEntry is an HTTP/3 alternative for an origin
+type altSvcEntry struct {
+	authority string // host:port to dial over QUIC
+	expires   time.Time
+}
+
+// altSvcTransport routes requests over HTTP/3 or TCP.
+// In auto mode, origins are upgraded after they advertise "h3" in Alt-Svc and
+// downgraded again for a while if QUIC fails.
+type altSvcTransport struct {
+	tcp     http.RoundTripper
+	h3      *http3.Transport
+	mode    HTTP3Mode
+	proxied bool
+	dialer  *Dialer // Endpoint settings shared with the TCP transport (optional)
+
+	mu     sync.Mutex
+	alts   map[string]altSvcEntry // origin authority -> alternative
+	broken map[string]time.Time   // origin authority -> retry QUIC after
+}
+
+// newAltSvcTransport wraps tcp with an HTTP/3 transport using tlsConfig
+func newAltSvcTransport(tcp http.RoundTripper, tlsConfig *tls.Config, mode HTTP3Mode, proxied bool, handshakeTimeout time.Duration) *altSvcTransport {
+	var h3TLS *tls.Config
+	if tlsConfig != nil {
+		h3TLS = tlsConfig.Clone()
+	} else {
+		h3TLS = &tls.Config{}
+	}
+
+	t := &altSvcTransport{
+		tcp:     tcp,
+		mode:    mode,
+		proxied: proxied,
+		alts:    make(map[string]altSvcEntry),
+		broken:  make(map[string]time.Time),
+	}
+
+	t.h3 = &http3.Transport{
+		TLSClientConfig:    h3TLS,
+		DisableCompression: true,
+		QUICConfig: &quic.Config{
+			HandshakeIdleTimeout: handshakeTimeout,
+		},
+		Dial: t.dialQUIC,
+	}
+
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *altSvcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == HTTP3On {
+		if t.proxied {
+			return nil, errHTTP3Proxy
+		}
+		return t.h3.RoundTrip(req)
+	}
+
+	origin := authorityOf(req)
+	if !t.proxied && req.URL.Scheme == "https" && t.useHTTP3(origin) {
+		resp, err := t.h3.RoundTrip(req)
+		if err == nil {
+			return resp, nil
+		}
+
+		// Only fall back when the request can be replayed and was not canceled
+		if req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return nil, err
+		}
+		t.markBroken(origin)
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	resp, err := t.tcp.RoundTrip(req)
+	if err == nil && req.URL.Scheme == "https" {
+		t.recordAltSvc(origin, resp.Header.Get("Alt-Svc"))
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes idle connections on both transports
+func (t *altSvcTransport) CloseIdleConnections() {
+	if ci, ok := t.tcp.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+	t.h3.CloseIdleConnections()
+}
+
+// Close shuts down the QUIC transport
+func (t *altSvcTransport) Close() error {
+	return t.h3.Close()
+}
+
+// useHTTP3 reports whether origin has a live, working HTTP/3 alternative
+func (t *altSvcTransport) useHTTP3(origin string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := t.broken[origin]; ok {
+		if now.Before(until) {
+			return false
+		}
+		delete(t.broken, origin)
+	}
+
+	entry, ok := t.alts[origin]
+	if !ok {
+		return false
+	}
+	if now.After(entry.expires) {
+		delete(t.alts, origin)
+		return false
+	}
+	return true
+}
+
+// markBroken disables HTTP/3 for origin for a while
+func (t *altSvcTransport) markBroken(origin string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.broken[origin] = time.Now().Add(h3BrokenDuration)
+}
+
+// recordAltSvc remembers the h3 alternative advertised for origin
+func (t *altSvcTransport) recordAltSvc(origin, header string) {
+	if header == "" {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(origin)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if strings.TrimSpace(header) == "clear" {
+		delete(t.alts, origin)
+		return
+	}
+
+	if authority, maxAge, ok := parseAltSvcH3(header, host); ok {
+		t.alts[origin] = altSvcEntry{authority: authority, expires: time.Now().Add(maxAge)}
+	}
+}
+
+// dialQUIC dials the advertised alternative for addr instead of addr itself
+func (t *altSvcTransport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	t.mu.Lock()
+	if entry, ok := t.alts[addr]; ok {
+		addr = entry.authority
+	}
+	t.mu.Unlock()
+
+	if t.dialer == nil {
+		return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+	}
+	return t.dialer.dialQUIC(ctx, addr, tlsCfg, cfg)
+}
+
+// authorityOf returns host:port for the request URL, adding the default port
+func authorityOf(req *http.Request) string {
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if port == "" {
+		if req.URL.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// parseAltSvcH3 finds the first "h3" alternative in an Alt-Svc header (RFC 7838).
+// Returns the authority to dial and how long the alternative is valid.
+func parseAltSvcH3(header, originHost string) (string, time.Duration, bool) {
+	for _, alt := range strings.Split(header, ",") {
+		params := strings.Split(alt, ";")
+		protoAuth := strings.SplitN(strings.TrimSpace(params[0]), "=", 2)
+		if len(protoAuth) != 2 || strings.TrimSpace(protoAuth[0]) != "h3" {
+			continue
+		}
+
+		authority := strings.Trim(strings.TrimSpace(protoAuth[1]), `"`)
+		host, port, err := net.SplitHostPort(authority)
+		if err != nil || port == "" {
+			continue
+		}
+		if host == "" {
+			host = originHost
+		}
+
+		maxAge := defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "ma" {
+				if secs, err := strconv.ParseInt(strings.Trim(kv[1], `"`), 10, 64); err == nil {
+					maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+		if maxAge <= 0 {
+			continue
+		}
+
+		return net.JoinHostPort(host, port), maxAge, true
+	}
+	return "", 0, false
+}
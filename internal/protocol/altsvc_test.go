@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestParseHTTP3Mode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    HTTP3Mode
+		wantErr bool
+	}{
+		{"", HTTP3Off, false},
+		{"off", HTTP3Off, false},
+		{"false", HTTP3Off, false},
+		{"on", HTTP3On, false},
+		{"true", HTTP3On, false},
+		{"AUTO", HTTP3Auto, false},
+		{"sometimes", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHTTP3Mode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHTTP3Mode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHTTP3Mode(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAltSvcH3(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		wantAuthority string
+		wantMaxAge    time.Duration
+		wantOK        bool
+	}{
+		{"same host", `h3=":443"`, "example.com:443", defaultAltSvcMaxAge, true},
+		{"other host", `h3="alt.example.com:8443"`, "alt.example.com:8443", defaultAltSvcMaxAge, true},
+		{"max age", `h3=":443"; ma=3600`, "example.com:443", time.Hour, true},
+		{"h3 after h2", `h2=":443", h3=":4433"; ma=60`, "example.com:4433", time.Minute, true},
+		{"draft only", `h3-29=":443"`, "", 0, false},
+		{"expired", `h3=":443"; ma=0`, "", 0, false},
+		{"missing port", `h3="alt.example.com"`, "", 0, false},
+		{"clear", `clear`, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authority, maxAge, ok := parseAltSvcH3(tt.header, "example.com")
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if authority != tt.wantAuthority {
+				t.Errorf("authority = %q, want %q", authority, tt.wantAuthority)
+			}
+			if maxAge != tt.wantMaxAge {
+				t.Errorf("maxAge = %v, want %v", maxAge, tt.wantMaxAge)
+			}
+		})
+	}
+}
+
+// startAltSvcServers starts a TLS server advertising h3 on a local QUIC server.
+// If quicUp is false, the advertised UDP port has nothing listening on it.
+func startAltSvcServers(t *testing.T, quicUp bool) *httptest.Server {
+	t.Helper()
+
+	content := strings.Repeat("burkut", 1000)
+	var altSvc string
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	port := udpConn.LocalAddr().(*net.UDPAddr).Port
+	altSvc = fmt.Sprintf(`h3=":%d"; ma=60`, port)
+
+	if !quicUp {
+		udpConn.Close()
+		return server
+	}
+
+	h3Server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: server.TLS.Certificates}),
+	}
+	go h3Server.Serve(udpConn)
+	t.Cleanup(func() {
+		h3Server.Close()
+		udpConn.Close()
+	})
+
+	return server
+}
+
+func TestHTTPClient_HTTP3AutoUpgrade(t *testing.T) {
+	server := startAltSvcServers(t, true)
+
+	client := NewHTTPClient(WithInsecureSkipVerify(true), WithHTTP3(HTTP3Auto))
+	defer client.Close()
+
+	ctx := context.Background()
+
+	// First request goes over TCP and learns about the h3 alternative
+	meta, err := client.Head(ctx, server.URL+"/file.bin")
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	if meta.Protocol == "HTTP/3.0" {
+		t.Errorf("first request used %s, want TCP", meta.Protocol)
+	}
+
+	// Segmented requests now use QUIC
+	body, err := client.GetRange(ctx, server.URL+"/file.bin", 0, 5)
+	if err != nil {
+		t.Fatalf("GetRange() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "burkut" {
+		t.Errorf("GetRange() = %q, want %q", data, "burkut")
+	}
+	if got := client.Protocol(); got != "HTTP/3.0" {
+		t.Errorf("Protocol() = %q, want HTTP/3.0", got)
+	}
+}
+
+func TestHTTPClient_HTTP3AutoFallback(t *testing.T) {
+	server := startAltSvcServers(t, false)
+
+	shortHandshake := func(c *HTTPClient) {
+		c.h3HandshakeTimeout = 300 * time.Millisecond
+	}
+	client := NewHTTPClient(WithInsecureSkipVerify(true), WithHTTP3(HTTP3Auto), shortHandshake)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.Head(ctx, server.URL+"/file.bin"); err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+
+	// QUIC is blocked; the request must still succeed over TCP
+	body, err := client.GetRange(ctx, server.URL+"/file.bin", 6, 11)
+	if err != nil {
+		t.Fatalf("GetRange() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "burkut" {
+		t.Errorf("GetRange() = %q, want %q", data, "burkut")
+	}
+	if got := client.Protocol(); got == "HTTP/3.0" {
+		t.Errorf("Protocol() = %q, want TCP fallback", got)
+	}
+}
+
+func TestHTTPClient_HTTP3OnWithProxy(t *testing.T) {
+	client := NewHTTPClient(WithProxy("http://127.0.0.1:1"), WithHTTP3(HTTP3On))
+	defer client.Close()
+
+	_, err := client.Head(context.Background(), "https://example.com/file.bin")
+	if err == nil {
+		t.Fatal("Head() through a proxy with HTTP/3 forced should fail")
+	}
+	if !strings.Contains(err.Error(), "proxy") {
+		t.Errorf("error = %v, want proxy error", err)
+	}
+}
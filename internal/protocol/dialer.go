@@ -0,0 +1,515 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Defaults for connection establishment
+const (
+	DefaultDNSCacheTTL = 60 * time.Second
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+	dialFallbackDelay  = 300 * time.Millisecond // Head start of the preferred address family
+)
+
+// DialerConfig controls how network connections are established
+type DialerConfig struct {
+	Resolve   []string      // Static addresses, curl-style "host:port:addr[,addr...]"
+	ConnectTo []string      // Endpoint rewrites, curl-style "host1:port1:host2:port2"
+	IPVersion int           // 4 or 6 to use only that address family, 0 for both
+	Interface string        // Source interface name or IP address to bind to
+	Timeout   time.Duration // Connect timeout (0 = 30s)
+	DNSCache  *DNSCache     // Resolver cache, may be shared between clients (nil = no caching)
+}
+
+// connectToRule rewrites connections to host:port (empty fields match anything)
+type connectToRule struct {
+	host, port     string
+	toHost, toPort string
+}
+
+// Dialer establishes TCP connections honoring static resolves, endpoint
+// rewrites, address family and source address settings. It is shared by the
+// HTTP, FTP and SFTP clients and by the crawler.
+type Dialer struct {
+	resolve   map[string][]net.IP // lowercase host:port -> addresses
+	connectTo []connectToRule
+	ipVersion int
+	localIP   net.IP         // Fixed source address
+	iface     *net.Interface // Source interface (address picked per family)
+	timeout   time.Duration
+	cache     *DNSCache
+}
+
+// NewDialer creates a Dialer from config
+func NewDialer(config DialerConfig) (*Dialer, error) {
+	d := &Dialer{
+		resolve:   make(map[string][]net.IP),
+		ipVersion: config.IPVersion,
+		timeout:   config.Timeout,
+		cache:     config.DNSCache,
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultDialTimeout
+	}
+
+	switch config.IPVersion {
+	case 0, 4, 6:
+	default:
+		return nil, fmt.Errorf("invalid IP version: %d", config.IPVersion)
+	}
+
+	for _, entry := range config.Resolve {
+		key, ips, err := parseResolveEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		d.resolve[key] = append(d.resolve[key], ips...)
+	}
+
+	for _, entry := range config.ConnectTo {
+		rule, err := parseConnectToEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		d.connectTo = append(d.connectTo, rule)
+	}
+
+	if config.Interface != "" {
+		if ip := net.ParseIP(config.Interface); ip != nil {
+			d.localIP = ip
+			if d.ipVersion == 0 {
+				d.ipVersion = ipVersionOf(ip)
+			} else if d.ipVersion != ipVersionOf(ip) {
+				return nil, fmt.Errorf("source address %s is not IPv%d", ip, d.ipVersion)
+			}
+		} else {
+			iface, err := net.InterfaceByName(config.Interface)
+			if err != nil {
+				return nil, fmt.Errorf("looking up interface %s: %w", config.Interface, err)
+			}
+			d.iface = iface
+		}
+	}
+
+	return d, nil
+}
+
+// parseResolveEntry parses "host:port:addr[,addr...]"
+func parseResolveEntry(entry string) (string, []net.IP, error) {
+	parts := strings.SplitN(strings.TrimPrefix(entry, "+"), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", nil, fmt.Errorf("invalid resolve entry %q (want host:port:addr)", entry)
+	}
+
+	var ips []net.IP
+	for _, addr := range strings.Split(parts[2], ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return "", nil, fmt.Errorf("invalid address %q in resolve entry %q", addr, entry)
+		}
+		ips = append(ips, ip)
+	}
+
+	return strings.ToLower(net.JoinHostPort(parts[0], parts[1])), ips, nil
+}
+
+// parseConnectToEntry parses "host1:port1:host2:port2"; IPv6 hosts use brackets
+func parseConnectToEntry(entry string) (connectToRule, error) {
+	var fields []string
+	rest := entry
+	for len(fields) < 3 {
+		var field string
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return connectToRule{}, fmt.Errorf("invalid connect-to entry %q", entry)
+			}
+			field, rest = rest[1:end], rest[end+1:]
+			if !strings.HasPrefix(rest, ":") {
+				return connectToRule{}, fmt.Errorf("invalid connect-to entry %q", entry)
+			}
+			rest = rest[1:]
+		} else {
+			i := strings.Index(rest, ":")
+			if i < 0 {
+				return connectToRule{}, fmt.Errorf("invalid connect-to entry %q (want host1:port1:host2:port2)", entry)
+			}
+			field, rest = rest[:i], rest[i+1:]
+		}
+		fields = append(fields, field)
+	}
+	if strings.Contains(rest, ":") {
+		return connectToRule{}, fmt.Errorf("invalid connect-to entry %q (want host1:port1:host2:port2)", entry)
+	}
+	fields = append(fields, rest)
+
+	return connectToRule{
+		host:   strings.ToLower(fields[0]),
+		port:   fields[1],
+		toHost: fields[2],
+		toPort: fields[3],
+	}, nil
+}
+
+// rewrite applies the first matching connect-to rule to host and port
+func (d *Dialer) rewrite(host, port string) (string, string) {
+	for _, rule := range d.connectTo {
+		if rule.host != "" && rule.host != strings.ToLower(host) {
+			continue
+		}
+		if rule.port != "" && rule.port != port {
+			continue
+		}
+		if rule.toHost != "" {
+			host = rule.toHost
+		}
+		if rule.toPort != "" {
+			port = rule.toPort
+		}
+		break
+	}
+	return host, port
+}
+
+// Lookup returns the addresses ("ip:port") a connection to addr would try,
+// in order, after connect-to rewrites, static resolves and family filtering
+func (d *Dialer) Lookup(ctx context.Context, addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	host, port = d.rewrite(host, port)
+
+	var ips []net.IP
+	if static, ok := d.resolve[strings.ToLower(net.JoinHostPort(host, port))]; ok {
+		ips = static
+	} else if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if d.cache != nil {
+		ips, err = d.cache.LookupIP(ctx, host)
+	} else {
+		ips, err = lookupIP(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, ip := range ips {
+		if d.ipVersion != 0 && ipVersionOf(ip) != d.ipVersion {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	if len(addrs) == 0 {
+		if d.ipVersion != 0 {
+			return nil, fmt.Errorf("no IPv%d address for %s", d.ipVersion, host)
+		}
+		return nil, fmt.Errorf("no address for %s", host)
+	}
+	return addrs, nil
+}
+
+// NetDialer returns a net.Dialer bound to the configured source address for
+// connections to the IP address addr ("ip:port"), for libraries that take one
+func (d *Dialer) NetDialer(addr string) (net.Dialer, error) {
+	nd := net.Dialer{
+		Timeout:   d.timeout,
+		KeepAlive: defaultKeepAlive,
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nd, err
+	}
+	local, err := d.localAddr(net.ParseIP(host))
+	if err != nil {
+		return nd, err
+	}
+	if local != nil {
+		nd.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	return nd, nil
+}
+
+// localAddr returns the source address to use for remote (nil = any)
+func (d *Dialer) localAddr(remote net.IP) (net.IP, error) {
+	if d.localIP != nil {
+		return d.localIP, nil
+	}
+	if d.iface == nil {
+		return nil, nil
+	}
+
+	addrs, err := d.iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("reading addresses of %s: %w", d.iface.Name, err)
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if remote == nil || ipVersionOf(ipNet.IP) == ipVersionOf(remote) {
+			// Link-local IPv6 addresses only reach link-local destinations
+			if ipNet.IP.IsLinkLocalUnicast() && (remote == nil || !remote.IsLinkLocalUnicast()) {
+				continue
+			}
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no usable IPv%d address", d.iface.Name, ipVersionOf(remote))
+}
+
+// DialContext connects to addr. Addresses of the preferred family are tried
+// in order, with the other family starting shortly after (Happy Eyeballs).
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	addrs, err := d.Lookup(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	var primaries, fallbacks []string
+	for _, a := range addrs {
+		if isIPv4Addr(a) == isIPv4Addr(addrs[0]) {
+			primaries = append(primaries, a)
+		} else {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries)
+	}
+	return d.dialParallel(ctx, network, primaries, fallbacks)
+}
+
+// Dial connects to addr
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// dialSerial tries addrs in order and returns the first connection
+func (d *Dialer) dialSerial(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var lastErr error
+	for _, addr := range addrs {
+		nd, err := d.NetDialer(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn, err := nd.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// dialParallel races the primary addresses against the fallbacks, giving
+// the primaries a head start
+func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []string) (net.Conn, error) {
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, 2)
+	start := func(addrs []string, primary bool) {
+		conn, err := d.dialSerial(ctx, network, addrs)
+		results <- result{conn: conn, err: err, primary: primary}
+	}
+
+	go start(primaries, true)
+	timer := time.NewTimer(dialFallbackDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	pending, fallbackStarted := 1, false
+	for pending > 0 || !fallbackStarted {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close a connection that lost the race
+				if pending > 0 {
+					go func() {
+						if other := <-results; other.conn != nil {
+							other.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// dialQUIC opens a QUIC connection to addr from the configured source address
+func (d *Dialer) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	addrs, err := d.Lookup(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	remote, err := net.ResolveUDPAddr("udp", addrs[0])
+	if err != nil {
+		return nil, err
+	}
+	local, err := d.localAddr(remote.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: local})
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.DialEarly(ctx, udpConn, remote, tlsCfg, cfg)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+
+	// The socket belongs to this connection alone
+	go func() {
+		<-conn.Context().Done()
+		udpConn.Close()
+	}()
+	return conn, nil
+}
+
+// ipVersionOf returns 4 or 6
+func ipVersionOf(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// isIPv4Addr reports whether "ip:port" holds an IPv4 address
+func isIPv4Addr(addr string) bool {
+	host, _, _ := net.SplitHostPort(addr)
+	return net.ParseIP(host).To4() != nil
+}
+
+// lookupIP resolves host with the system resolver
+func lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// DNSCache caches host lookups so that many connections to the same hosts
+// (segments of a download, items of a batch) resolve each name only once
+type DNSCache struct {
+	ttl     time.Duration
+	lookup  func(ctx context.Context, host string) ([]net.IP, error)
+	entries map[string]*dnsEntry
+	mu      sync.Mutex
+}
+
+// dnsEntry is a cached or in-flight lookup
+type dnsEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+	ready   chan struct{} // Closed when the lookup finishes
+}
+
+// NewDNSCache creates a DNS cache keeping results for ttl
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	if ttl <= 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+	return &DNSCache{
+		ttl:     ttl,
+		lookup:  lookupIP,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// LookupIP returns the addresses of host, resolving it at most once per TTL.
+// Concurrent lookups of the same host wait for a single query.
+func (c *DNSCache) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	key := strings.ToLower(host)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			if time.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		// Not tied to ctx so a canceled caller doesn't fail the others
+		lookupCtx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+		entry.ips, entry.err = c.lookup(lookupCtx, host)
+		cancel()
+		entry.expires = time.Now().Add(c.ttl)
+		if entry.err != nil {
+			// Failures are not cached
+			entry.expires = time.Now()
+		}
+		close(entry.ready)
+	} else {
+		c.mu.Unlock()
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return entry.ips, entry.err
+}
@@ -0,0 +1,262 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseResolveEntry(t *testing.T) {
+	tests := []struct {
+		entry   string
+		wantKey string
+		wantIPs []string
+		wantErr bool
+	}{
+		{"example.com:443:203.0.113.7", "example.com:443", []string{"203.0.113.7"}, false},
+		{"Example.COM:80:10.0.0.1,10.0.0.2", "example.com:80", []string{"10.0.0.1", "10.0.0.2"}, false},
+		{"example.com:443:[2001:db8::1]", "example.com:443", []string{"2001:db8::1"}, false},
+		{"+example.com:443:127.0.0.1", "example.com:443", []string{"127.0.0.1"}, false},
+		{"example.com:443", "", nil, true},
+		{"example.com:443:not-an-ip", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			key, ips, err := parseResolveEntry(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResolveEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if key != tt.wantKey {
+				t.Errorf("key = %q, want %q", key, tt.wantKey)
+			}
+			var got []string
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			if !reflect.DeepEqual(got, tt.wantIPs) {
+				t.Errorf("ips = %v, want %v", got, tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestParseConnectToEntry(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    connectToRule
+		wantErr bool
+	}{
+		{"example.com:443:cdn1.example.net:8443", connectToRule{"example.com", "443", "cdn1.example.net", "8443"}, false},
+		{"::other.example.com:", connectToRule{"", "", "other.example.com", ""}, false},
+		{"example.com:443:[2001:db8::1]:443", connectToRule{"example.com", "443", "2001:db8::1", "443"}, false},
+		{"[::1]:80:127.0.0.1:8080", connectToRule{"::1", "80", "127.0.0.1", "8080"}, false},
+		{"example.com:443", connectToRule{}, true},
+		{"a:1:b:2:3", connectToRule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := parseConnectToEntry(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConnectToEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseConnectToEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialer_Lookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DialerConfig
+		addr    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "static resolve",
+			config: DialerConfig{Resolve: []string{"example.com:443:203.0.113.7,203.0.113.8"}},
+			addr:   "example.com:443",
+			want:   []string{"203.0.113.7:443", "203.0.113.8:443"},
+		},
+		{
+			name:   "resolve only matches its port",
+			config: DialerConfig{Resolve: []string{"example.com:443:203.0.113.7"}},
+			addr:   "192.0.2.1:80",
+			want:   []string{"192.0.2.1:80"},
+		},
+		{
+			name: "connect-to then resolve",
+			config: DialerConfig{
+				ConnectTo: []string{"example.com:443:cdn.example.net:8443"},
+				Resolve:   []string{"cdn.example.net:8443:198.51.100.1"},
+			},
+			addr: "example.com:443",
+			want: []string{"198.51.100.1:8443"},
+		},
+		{
+			name:   "connect-to keeps port",
+			config: DialerConfig{ConnectTo: []string{"example.com::127.0.0.1:"}},
+			addr:   "example.com:8080",
+			want:   []string{"127.0.0.1:8080"},
+		},
+		{
+			name: "IPv4 only",
+			config: DialerConfig{
+				Resolve:   []string{"example.com:443:2001:db8::1,203.0.113.7"},
+				IPVersion: 4,
+			},
+			addr: "example.com:443",
+			want: []string{"203.0.113.7:443"},
+		},
+		{
+			name: "IPv6 only",
+			config: DialerConfig{
+				Resolve:   []string{"example.com:443:2001:db8::1,203.0.113.7"},
+				IPVersion: 6,
+			},
+			addr: "example.com:443",
+			want: []string{"[2001:db8::1]:443"},
+		},
+		{
+			name: "no address of family",
+			config: DialerConfig{
+				Resolve:   []string{"example.com:443:203.0.113.7"},
+				IPVersion: 6,
+			},
+			addr:    "example.com:443",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDialer(tt.config)
+			if err != nil {
+				t.Fatalf("NewDialer() error = %v", err)
+			}
+			got, err := d.Lookup(context.Background(), tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDialer_InvalidConfig(t *testing.T) {
+	configs := []DialerConfig{
+		{IPVersion: 5},
+		{Resolve: []string{"example.com"}},
+		{ConnectTo: []string{"example.com:443"}},
+		{Interface: "127.0.0.1", IPVersion: 6},
+		{Interface: "no-such-interface0"},
+	}
+
+	for _, config := range configs {
+		if _, err := NewDialer(config); err == nil {
+			t.Errorf("NewDialer(%+v) should fail", config)
+		}
+	}
+}
+
+func TestDNSCache_LookupOnce(t *testing.T) {
+	cache := NewDNSCache(time.Minute)
+
+	var lookups int32
+	cache.lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+		atomic.AddInt32(&lookups, 1)
+		time.Sleep(20 * time.Millisecond)
+		return []net.IP{net.ParseIP("203.0.113.7")}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := cache.LookupIP(context.Background(), "Example.com")
+			if err != nil || len(ips) != 1 {
+				t.Errorf("LookupIP() = %v, %v", ips, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := cache.LookupIP(context.Background(), "example.com"); err != nil {
+		t.Fatalf("LookupIP() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&lookups); got != 1 {
+		t.Errorf("lookups = %d, want 1", got)
+	}
+}
+
+func TestDNSCache_ErrorsNotCached(t *testing.T) {
+	cache := NewDNSCache(time.Minute)
+
+	var lookups int32
+	cache.lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+		if atomic.AddInt32(&lookups, 1) == 1 {
+			return nil, fmt.Errorf("temporary failure")
+		}
+		return []net.IP{net.ParseIP("203.0.113.7")}, nil
+	}
+
+	if _, err := cache.LookupIP(context.Background(), "example.com"); err == nil {
+		t.Fatal("first LookupIP() should fail")
+	}
+	if _, err := cache.LookupIP(context.Background(), "example.com"); err != nil {
+		t.Errorf("second LookupIP() error = %v", err)
+	}
+}
+
+func TestHTTPClient_WithDialer(t *testing.T) {
+	var gotHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		w.Write([]byte("pinned"))
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// The name does not exist; --resolve makes it reach the local server
+	dialer, err := NewDialer(DialerConfig{
+		Resolve:   []string{fmt.Sprintf("download.burkut.invalid:%s:127.0.0.1", port)},
+		Interface: "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("NewDialer() error = %v", err)
+	}
+
+	client := NewHTTPClient(WithDialer(dialer))
+	body, _, err := client.Get(context.Background(), fmt.Sprintf("http://download.burkut.invalid:%s/file", port))
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(data) != "pinned" {
+		t.Errorf("body = %q, want %q", data, "pinned")
+	}
+	if want := "download.burkut.invalid:" + port; gotHost != want {
+		t.Errorf("Host = %q, want %q", gotHost, want)
+	}
+}
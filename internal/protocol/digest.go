@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Digest is a checksum of the whole file announced in a response header
+type Digest struct {
+	Algorithm string // Lowercase IANA name, e.g. "sha-256", "sha-512", "md5"
+	Value     []byte
+	Header    string // Repr-Digest, Content-Digest, Digest or Content-MD5
+}
+
+// parseDigests returns the digests of the file in the headers of resp,
+// RFC 9530 fields first, then the legacy Digest (RFC 3230) and Content-MD5.
+// Content-Digest and Content-MD5 cover only the content of this response,
+// so they are skipped for partial responses. Nothing is returned for an
+// encoded response, whose digests do not describe the bytes saved.
+func parseDigests(resp *http.Response) []Digest {
+	if resp.Uncompressed {
+		return nil
+	}
+	if enc := strings.TrimSpace(resp.Header.Get("Content-Encoding")); enc != "" && !strings.EqualFold(enc, "identity") {
+		return nil
+	}
+	whole := resp.StatusCode == http.StatusOK
+
+	var digests []Digest
+	digests = append(digests, parseDigestDictionary(resp.Header, "Repr-Digest")...)
+	if whole {
+		digests = append(digests, parseDigestDictionary(resp.Header, "Content-Digest")...)
+	}
+	digests = append(digests, parseLegacyDigest(resp.Header)...)
+	if whole {
+		if value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(resp.Header.Get("Content-MD5"))); err == nil && len(value) == 16 {
+			digests = append(digests, Digest{Algorithm: "md5", Value: value, Header: "Content-MD5"})
+		}
+	}
+	return digests
+}
+
+// parseDigestDictionary reads an RFC 9530 field, a structured dictionary
+// of byte sequences: sha-256=:<base64>:, sha-512=:<base64>:
+func parseDigestDictionary(h http.Header, name string) []Digest {
+	var digests []Digest
+	for _, field := range h.Values(name) {
+		for _, member := range strings.Split(field, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				continue
+			}
+			value, _, _ = strings.Cut(value, ";") // Parameters
+			value = strings.TrimSpace(value)
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil || len(decoded) == 0 {
+				continue
+			}
+			digests = append(digests, Digest{Algorithm: strings.ToLower(strings.TrimSpace(key)), Value: decoded, Header: name})
+		}
+	}
+	return digests
+}
+
+// parseLegacyDigest reads the RFC 3230 Digest field: SHA-256=<base64>,MD5=<base64>
+func parseLegacyDigest(h http.Header) []Digest {
+	var digests []Digest
+	for _, field := range h.Values("Digest") {
+		for _, member := range strings.Split(field, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+			if err != nil || len(decoded) == 0 {
+				continue
+			}
+			algorithm := strings.ToLower(strings.TrimSpace(key))
+			if algorithm == "sha" {
+				algorithm = "sha-1"
+			}
+			digests = append(digests, Digest{Algorithm: algorithm, Value: decoded, Header: "Digest"})
+		}
+	}
+	return digests
+}
+
+// parseMetalinkLinks returns the metalinks describing the file, from
+// RFC 6249 headers: Link: <file.meta4>; rel=describedby; type="application/metalink4+xml"
+func parseMetalinkLinks(resp *http.Response) []string {
+	var base *url.URL
+	if resp.Request != nil {
+		base = resp.Request.URL
+	}
+
+	var links []string
+	for _, field := range resp.Header.Values("Link") {
+		for field != "" {
+			start := strings.IndexByte(field, '<')
+			end := strings.IndexByte(field, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := field[start+1 : end]
+			params := field[end+1:]
+			// The parameters run to the next link value
+			if next := strings.IndexByte(params, '<'); next >= 0 {
+				field = params[next:]
+				params = params[:next]
+			} else {
+				field = ""
+			}
+			params = strings.TrimRight(strings.TrimSpace(params), ",")
+
+			var describedBy bool
+			var linkType string
+			for _, param := range strings.Split(params, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "rel":
+					for _, rel := range strings.Fields(value) {
+						if strings.EqualFold(rel, "describedby") {
+							describedBy = true
+						}
+					}
+				case "type":
+					linkType = strings.ToLower(value)
+				}
+			}
+			if !describedBy {
+				continue
+			}
+
+			isMetalink := linkType == "application/metalink4+xml" || linkType == "application/metalink+xml"
+			if linkType == "" {
+				lower := strings.ToLower(target)
+				isMetalink = strings.HasSuffix(lower, ".meta4") || strings.HasSuffix(lower, ".metalink")
+			}
+			if !isMetalink {
+				continue
+			}
+
+			ref, err := url.Parse(target)
+			if err != nil {
+				continue
+			}
+			if base != nil {
+				ref = base.ResolveReference(ref)
+			}
+			links = append(links, ref.String())
+		}
+	}
+	return links
+}
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseDigests(t *testing.T) {
+	content := []byte("file content")
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	md5Sum := md5.Sum(content)
+	b64 := base64.StdEncoding.EncodeToString
+
+	header := http.Header{}
+	header.Set("Repr-Digest", "sha-512=:"+b64(sha512Sum[:])+":, unknown=?1, sha-256=:"+b64(sha256Sum[:])+":;param=1")
+	header.Set("Content-Digest", "sha-256=:"+b64(sha256Sum[:])+":")
+	header.Set("Digest", "SHA=notbase64!, MD5="+b64(md5Sum[:]))
+	header.Set("Content-MD5", b64(md5Sum[:]))
+
+	digests := parseDigests(&http.Response{StatusCode: http.StatusOK, Header: header})
+	want := []Digest{
+		{Algorithm: "sha-512", Value: sha512Sum[:], Header: "Repr-Digest"},
+		{Algorithm: "sha-256", Value: sha256Sum[:], Header: "Repr-Digest"},
+		{Algorithm: "sha-256", Value: sha256Sum[:], Header: "Content-Digest"},
+		{Algorithm: "md5", Value: md5Sum[:], Header: "Digest"},
+		{Algorithm: "md5", Value: md5Sum[:], Header: "Content-MD5"},
+	}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("parseDigests() = %+v, want %+v", digests, want)
+	}
+
+	// A partial response's content digests cover only the range
+	partial := parseDigests(&http.Response{StatusCode: http.StatusPartialContent, Header: header})
+	for _, d := range partial {
+		if d.Header == "Content-Digest" || d.Header == "Content-MD5" {
+			t.Errorf("partial response: got digest from %s", d.Header)
+		}
+	}
+	if len(partial) != 3 {
+		t.Errorf("partial response: %d digests, want 3", len(partial))
+	}
+
+	encoded := header.Clone()
+	encoded.Set("Content-Encoding", "gzip")
+	if got := parseDigests(&http.Response{StatusCode: http.StatusOK, Header: encoded}); got != nil {
+		t.Errorf("encoded response: parseDigests() = %+v, want none", got)
+	}
+
+	legacy := http.Header{}
+	legacy.Set("Digest", "SHA="+b64(bytes.Repeat([]byte{1}, 20)))
+	if got := parseDigests(&http.Response{StatusCode: http.StatusOK, Header: legacy}); len(got) != 1 || got[0].Algorithm != "sha-1" {
+		t.Errorf("legacy SHA: parseDigests() = %+v", got)
+	}
+}
+
+func TestParseMetalinkLinks(t *testing.T) {
+	header := http.Header{}
+	header.Add("Link", `<https://mirror.example.org/file.iso>; rel=duplicate; pri=1, </meta/file.iso.meta4>; rel=describedby; type="application/metalink4+xml"`)
+	header.Add("Link", `<file.iso.metalink>; rel="describedby"`)
+	header.Add("Link", `<file.iso.torrent>; rel=describedby; type="application/x-bittorrent"`)
+
+	reqURL, _ := url.Parse("https://example.com/releases/file.iso")
+	links := parseMetalinkLinks(&http.Response{Header: header, Request: &http.Request{URL: reqURL}})
+	want := []string{
+		"https://example.com/meta/file.iso.meta4",
+		"https://example.com/releases/file.iso.metalink",
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("parseMetalinkLinks() = %v, want %v", links, want)
+	}
+}
@@ -0,0 +1,312 @@
+// Package protocol provides protocol adapters for different download protocols.
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFilenameLength is the longest filename (in bytes) most filesystems accept
+const maxFilenameLength = 255
+
+// windowsReservedNames are device names that cannot be used as filenames on Windows,
+// with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ResolveFilename picks the local filename for a response.
+// Content-Disposition (RFC 6266) wins over the last URL path segment.
+func ResolveFilename(rawURL string, header http.Header) string {
+	if header != nil {
+		if cd := header.Get("Content-Disposition"); cd != "" {
+			if filename := parseContentDisposition(cd); filename != "" {
+				return filename
+			}
+		}
+	}
+	return FilenameFromURL(rawURL)
+}
+
+// FilenameFromURL extracts a sanitized filename from the last path segment of a URL.
+// Returns "download" if no usable name can be derived.
+func FilenameFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "download"
+	}
+
+	// Work on the escaped path so encoded slashes (%2F) stay inside the segment
+	segment := u.EscapedPath()
+	if idx := strings.LastIndex(segment, "/"); idx >= 0 {
+		segment = segment[idx+1:]
+	}
+
+	if decoded, err := url.PathUnescape(segment); err == nil {
+		segment = decoded
+	}
+
+	if name := SanitizeFilename(segment); name != "" {
+		return name
+	}
+	return "download"
+}
+
+// parseContentDisposition extracts filename from Content-Disposition header
+// Supports RFC 2616 (Basic), RFC 5987 (UTF-8/encoded), and RFC 6266 standards
+func parseContentDisposition(cd string) string {
+	// Handle: attachment; filename="example.zip"
+	// Handle: attachment; filename=example.zip
+	// Handle: attachment; filename*=UTF-8''example.zip
+	// Handle: attachment; filename*=utf-8'en'%E4%B8%AD%E6%96%87.zip
+	// Handle: attachment; filename*=ISO-8859-1''%F6rnek.zip
+	// Handle: inline; filename="file.pdf"
+	params := parseDispositionParams(cd)
+
+	// RFC 5987 filename* takes priority over filename
+	if value, ok := params["filename*"]; ok {
+		if decoded, err := decodeExtValue(value); err == nil {
+			if name := SanitizeFilename(decoded); name != "" {
+				return name
+			}
+		}
+	}
+
+	if value, ok := params["filename"]; ok {
+		return SanitizeFilename(decodeLegacyValue(value))
+	}
+
+	return ""
+}
+
+// parseDispositionParams splits a Content-Disposition header into its parameters.
+// Parameter names are lowercased; quoted-string values are unescaped.
+func parseDispositionParams(cd string) map[string]string {
+	params := make(map[string]string)
+
+	// Skip the disposition type (attachment, inline, ...)
+	idx := strings.Index(cd, ";")
+	if idx < 0 {
+		return params
+	}
+	rest := cd[idx+1:]
+
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " \t;")
+		if rest == "" {
+			break
+		}
+
+		eq := strings.IndexAny(rest, "=;")
+		if eq < 0 || rest[eq] == ';' {
+			// Parameter without value, skip it
+			if eq < 0 {
+				break
+			}
+			rest = rest[eq+1:]
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimLeft(rest[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest = readQuotedString(rest)
+		} else {
+			end := strings.Index(rest, ";")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+
+			// Some servers wrap tokens in single quotes
+			if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+		}
+
+		// First occurrence wins, duplicates are ignored
+		if _, exists := params[name]; !exists {
+			params[name] = value
+		}
+	}
+
+	return params
+}
+
+// readQuotedString reads an RFC 7230 quoted-string starting at s[0] == '"'.
+// Returns the unescaped value and the remainder after the closing quote.
+func readQuotedString(s string) (string, string) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case '"':
+			return sb.String(), s[i+1:]
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	// Unterminated quote, take everything
+	return sb.String(), ""
+}
+
+// decodeExtValue decodes an RFC 5987 ext-value: charset'language'percent-encoded
+func decodeExtValue(value string) (string, error) {
+	charset := "utf-8"
+	encoded := value
+
+	if first := strings.Index(value, "'"); first >= 0 {
+		second := strings.Index(value[first+1:], "'")
+		if second < 0 {
+			return "", fmt.Errorf("malformed ext-value: %q", value)
+		}
+		charset = strings.ToLower(value[:first])
+		encoded = value[first+1+second+1:]
+	}
+
+	raw, err := url.PathUnescape(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decoding ext-value: %w", err)
+	}
+
+	switch charset {
+	case "utf-8", "utf8", "":
+		if !utf8.ValidString(raw) {
+			return "", fmt.Errorf("invalid UTF-8 in ext-value")
+		}
+		return raw, nil
+	case "iso-8859-1", "latin1", "us-ascii":
+		return latin1ToUTF8(raw), nil
+	default:
+		return "", fmt.Errorf("unsupported charset: %s", charset)
+	}
+}
+
+// decodeLegacyValue handles plain filename= values. Some servers send raw
+// ISO-8859-1 bytes, which are converted so the result is always valid UTF-8.
+func decodeLegacyValue(value string) string {
+	if utf8.ValidString(value) {
+		return value
+	}
+	return latin1ToUTF8(value)
+}
+
+// latin1ToUTF8 maps each ISO-8859-1 byte to its Unicode code point
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// SanitizeFilename removes potentially dangerous characters from filename.
+// Path separators, control characters and characters reserved on Windows are
+// replaced, Windows device names are escaped and the length is capped at 255 bytes.
+// Returns an empty string if nothing usable is left.
+func SanitizeFilename(name string) string {
+	// Drop control characters (including null bytes) and invalid UTF-8
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Remove path separators to prevent directory traversal
+	name = strings.ReplaceAll(name, "/", "_")
+	name = strings.ReplaceAll(name, "\\", "_")
+
+	// Remove leading/trailing whitespace and dots
+	name = strings.TrimSpace(name)
+	name = strings.Trim(name, ". ")
+
+	// Replace other problematic characters
+	replacer := strings.NewReplacer(
+		"<", "_",
+		">", "_",
+		":", "_",
+		"\"", "_",
+		"|", "_",
+		"?", "_",
+		"*", "_",
+	)
+	name = replacer.Replace(name)
+
+	// Escape Windows device names (CON, NUL.txt, com1.tar.gz, ...)
+	base := name
+	if idx := strings.Index(base, "."); idx >= 0 {
+		base = base[:idx]
+	}
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = base + "_" + name[len(base):]
+	}
+
+	// Limit length
+	if len(name) > maxFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 50 {
+			ext = truncateUTF8(ext, 50)
+		}
+		name = truncateUTF8(name, maxFilenameLength-len(ext)) + ext
+	}
+
+	return name
+}
+
+// SanitizeRelativePath sanitizes a relative path such as a Metalink file name
+// or an archive entry. Every segment is sanitized with SanitizeFilename; absolute
+// paths and ".." segments are rejected instead of being rewritten.
+func SanitizeRelativePath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") || filepath.IsAbs(p) || (len(p) >= 2 && p[1] == ':') {
+		return "", fmt.Errorf("absolute path not allowed: %q", p)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		if segment == ".." {
+			return "", fmt.Errorf("path traversal not allowed: %q", p)
+		}
+		clean := SanitizeFilename(segment)
+		if clean == "" {
+			return "", fmt.Errorf("invalid path segment %q in %q", segment, p)
+		}
+		segments = append(segments, clean)
+	}
+
+	if len(segments) == 0 {
+		return "", fmt.Errorf("empty path")
+	}
+
+	return filepath.Join(segments...), nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
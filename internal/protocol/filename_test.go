@@ -0,0 +1,180 @@
+package protocol
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContentDisposition_RFC6266(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "ISO-8859-1 ext-value",
+			input:    "attachment; filename*=ISO-8859-1''%F6rnek.txt",
+			expected: "örnek.txt",
+		},
+		{
+			name:     "plus sign is not a space",
+			input:    "attachment; filename*=UTF-8''a+b.txt",
+			expected: "a+b.txt",
+		},
+		{
+			name:     "semicolon inside quotes",
+			input:    `attachment; filename="part1;part2.txt"`,
+			expected: "part1;part2.txt",
+		},
+		{
+			name:     "filename* before filename",
+			input:    `attachment; filename*=UTF-8''%E2%82%AC.txt; filename="EUR.txt"`,
+			expected: "€.txt",
+		},
+		{
+			name:     "unsupported charset falls back to filename",
+			input:    `attachment; filename*=KOI8-R''%C1.txt; filename="fallback.txt"`,
+			expected: "fallback.txt",
+		},
+		{
+			name:     "invalid UTF-8 falls back to filename",
+			input:    `attachment; filename*=UTF-8''%FF%FE.txt; filename="fallback.txt"`,
+			expected: "fallback.txt",
+		},
+		{
+			name:     "uppercase parameter name",
+			input:    `ATTACHMENT; FILENAME="upper.txt"`,
+			expected: "upper.txt",
+		},
+		{
+			name:     "raw latin1 bytes",
+			input:    "attachment; filename=\"caf\xe9.txt\"",
+			expected: "café.txt",
+		},
+		{
+			name:     "encoded path separator",
+			input:    "attachment; filename*=UTF-8''..%2F..%2Fetc%2Fpasswd",
+			expected: "_.._etc_passwd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseContentDisposition(tt.input)
+			if result != tt.expected {
+				t.Errorf("parseContentDisposition(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename_ReservedAndControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"control characters", "fi\x01le\x1f.txt\x7f", "file.txt"},
+		{"newline injection", "file\r\nname.txt", "filename.txt"},
+		{"reserved device", "CON", "CON_"},
+		{"reserved with extension", "nul.txt", "nul_.txt"},
+		{"reserved with double extension", "com1.tar.gz", "com1_.tar.gz"},
+		{"not reserved", "console.txt", "console.txt"},
+		{"trailing space and dot", "file.txt .", "file.txt"},
+		{"only dots", "...", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SanitizeFilename(tt.input)
+			if result != tt.expected {
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename_MultibyteTruncation(t *testing.T) {
+	input := strings.Repeat("ö", 200) + ".txt"
+	result := SanitizeFilename(input)
+
+	if len(result) > maxFilenameLength {
+		t.Errorf("len(result) = %d, want <= %d", len(result), maxFilenameLength)
+	}
+	if !strings.HasSuffix(result, ".txt") {
+		t.Errorf("result %q lost its extension", result)
+	}
+	if strings.ContainsRune(result, '\uFFFD') {
+		t.Errorf("result %q contains a broken rune", result)
+	}
+}
+
+func TestFilenameFromURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/file.zip", "file.zip"},
+		{"https://example.com/a/b/c.tar.gz?x=1", "c.tar.gz"},
+		{"https://example.com/my%20file.zip", "my file.zip"},
+		{"https://example.com/100%25.zip", "100%.zip"},
+		{"https://example.com/a+b.zip", "a+b.zip"},
+		{"https://example.com/dir%2F..%2Fevil", "dir_.._evil"},
+		{"https://example.com/", "download"},
+		{"https://example.com/..", "download"},
+		{"://invalid", "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := FilenameFromURL(tt.url); got != tt.expected {
+				t.Errorf("FilenameFromURL(%q) = %q, want %q", tt.url, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveFilename(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Disposition", `attachment; filename="report.pdf"`)
+
+	if got := ResolveFilename("https://example.com/download?id=1", header); got != "report.pdf" {
+		t.Errorf("ResolveFilename() with header = %q, want report.pdf", got)
+	}
+	if got := ResolveFilename("https://example.com/file.bin", nil); got != "file.bin" {
+		t.Errorf("ResolveFilename() without header = %q, want file.bin", got)
+	}
+}
+
+func TestSanitizeRelativePath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"file.iso", "file.iso", false},
+		{"dir/sub/file.iso", "dir/sub/file.iso", false},
+		{"dir\\file.iso", "dir/file.iso", false},
+		{"./dir//file.iso", "dir/file.iso", false},
+		{"dir/fi:le.iso", "dir/fi_le.iso", false},
+		{"../file.iso", "", true},
+		{"dir/../../file.iso", "", true},
+		{"/etc/passwd", "", true},
+		{"C:\\Windows\\file", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := SanitizeRelativePath(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SanitizeRelativePath(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != filepath.FromSlash(tt.expected) {
+				t.Errorf("SanitizeRelativePath(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ type FTPClient struct {
 	tlsConfig      *tls.Config   // Custom TLS configuration
 	implicitTLS    bool          // Use implicit TLS (port 990)
 	skipTLSVerify  bool          // Skip TLS certificate verification
+	dialer         *Dialer       // Endpoint settings (optional)
 }
 
 // FTPClientOption is a function that configures FTPClient
@@ -85,6 +86,14 @@ func WithFTPSkipTLSVerify(skip bool) FTPClientOption {
 	}
 }
 
+// WithFTPDialer connects through d, applying its resolve, connect-to,
+// address family and source address settings to control and data connections
+func WithFTPDialer(d *Dialer) FTPClientOption {
+	return func(c *FTPClient) {
+		c.dialer = d
+	}
+}
+
 // NewFTPClient creates a new FTP client with the given options
 func NewFTPClient(opts ...FTPClientOption) *FTPClient {
 	c := &FTPClient{
@@ -101,6 +110,40 @@ func NewFTPClient(opts ...FTPClientOption) *FTPClient {
 	return c
 }
 
+// dial opens the control connection to host, trying each address the dialer
+// resolves. Data connections go to the server's address from the same source.
+func (c *FTPClient) dial(ctx context.Context, host string, dialOpts []ftp.DialOption) (*ftp.ServerConn, error) {
+	if c.dialer == nil {
+		return ftp.Dial(host, dialOpts...)
+	}
+
+	addrs, err := c.dialer.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		nd, err := c.dialer.NetDialer(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		nd.Timeout = c.timeout
+
+		opts := append(dialOpts[:len(dialOpts):len(dialOpts)], ftp.DialWithDialer(nd), ftp.DialWithContext(ctx))
+		conn, err := ftp.Dial(addr, opts...)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
 // Supports checks if the URL is supported by this protocol
 func (c *FTPClient) Supports(u *url.URL) bool {
 	scheme := strings.ToLower(u.Scheme)
@@ -157,7 +200,7 @@ func (c *FTPClient) connect(ctx context.Context, rawURL string) (*ftp.ServerConn
 	}
 
 	// Connect
-	conn, err := ftp.Dial(host, dialOpts...)
+	conn, err := c.dial(ctx, host, dialOpts)
 	if err != nil {
 		return nil, "", fmt.Errorf("connecting to FTP server: %w", err)
 	}
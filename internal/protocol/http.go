@@ -12,9 +12,9 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -29,7 +29,9 @@ type Metadata struct {
 	ContentType   string
 	LastModified  time.Time
 	ETag          string
-	Protocol      string // HTTP protocol version (e.g., "HTTP/1.1", "HTTP/2.0")
+	Protocol      string   // HTTP protocol version (e.g., "HTTP/1.1", "HTTP/2.0")
+	Digests       []Digest // Checksums of the file announced in the headers
+	MetalinkURLs  []string // Metalinks describing the file (Link: rel=describedby)
 }
 
 // HTTPClient is an HTTP protocol adapter for downloading files
@@ -39,6 +41,14 @@ type HTTPClient struct {
 	headers    map[string]string
 	forceHTTP1 bool // Force HTTP/1.1 instead of HTTP/2
 	forceHTTP2 bool // Force HTTP/2 (fail if not supported)
+	proxied    bool // A proxy is configured
+	dialer     *Dialer
+
+	http3Mode          HTTP3Mode     // HTTP/3 usage (off, on, auto)
+	h3HandshakeTimeout time.Duration // QUIC handshake timeout before falling back
+	altSvc             *altSvcTransport
+
+	protocol atomic.Value // Last negotiated protocol (string)
 }
 
 // HTTPClientOption is a function that configures HTTPClient
@@ -134,6 +144,7 @@ func WithProxy(proxyURL string) HTTPClientOption {
 
 		transport := c.getTransport()
 		transport.Proxy = http.ProxyURL(parsed)
+		c.proxied = true
 	}
 }
 
@@ -160,7 +171,7 @@ func WithSOCKS5Proxy(proxyAddr string, auth *proxy.Auth) HTTPClientOption {
 			}
 		}
 
-		dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, proxy.Direct)
+		dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, proxyForward{c})
 		if err != nil {
 			return
 		}
@@ -169,6 +180,28 @@ func WithSOCKS5Proxy(proxyAddr string, auth *proxy.Auth) HTTPClientOption {
 		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
 			return dialer.Dial(network, addr)
 		}
+		c.proxied = true
+	}
+}
+
+// proxyForward connects to a proxy through the client's Dialer, if any
+type proxyForward struct {
+	c *HTTPClient
+}
+
+func (f proxyForward) Dial(network, addr string) (net.Conn, error) {
+	if f.c.dialer != nil {
+		return f.c.dialer.Dial(network, addr)
+	}
+	return proxy.Direct.Dial(network, addr)
+}
+
+// WithDialer makes connections (including to proxies and over QUIC) go
+// through d, applying its resolve, connect-to, address family and source
+// address settings
+func WithDialer(d *Dialer) HTTPClientOption {
+	return func(c *HTTPClient) {
+		c.dialer = d
 	}
 }
 
@@ -337,17 +370,57 @@ func NewHTTPClient(opts ...HTTPClientOption) *HTTPClient {
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
-		userAgent: "Burkut/0.1",
-		headers:   make(map[string]string),
+		userAgent:          "Burkut/0.1",
+		headers:            make(map[string]string),
+		h3HandshakeTimeout: defaultH3HandshakeTimeout,
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	// The SOCKS5 dialer already forwards through c.dialer
+	if c.dialer != nil {
+		if transport := c.getTransport(); transport.DialContext == nil {
+			transport.DialContext = c.dialer.DialContext
+		}
+	}
+
+	// HTTP/3 is layered on top once all TLS options have been applied
+	if c.http3Mode == HTTP3On || c.http3Mode == HTTP3Auto {
+		var tlsConfig *tls.Config
+		if t, ok := c.client.Transport.(*http.Transport); ok {
+			tlsConfig = t.TLSClientConfig
+		}
+		tcp := c.client.Transport
+		if tcp == nil {
+			tcp = http.DefaultTransport
+		}
+		c.altSvc = newAltSvcTransport(tcp, tlsConfig, c.http3Mode, c.proxied, c.h3HandshakeTimeout)
+		c.altSvc.dialer = c.dialer
+		c.client.Transport = c.altSvc
+	}
+
 	return c
 }
 
+// Protocol returns the protocol negotiated by the most recent response
+// (e.g., "HTTP/1.1", "HTTP/2.0", "HTTP/3.0"), or "" before the first request
+func (c *HTTPClient) Protocol() string {
+	if proto, ok := c.protocol.Load().(string); ok {
+		return proto
+	}
+	return ""
+}
+
+// Close releases the QUIC transport, if any
+func (c *HTTPClient) Close() error {
+	if c.altSvc != nil {
+		return c.altSvc.Close()
+	}
+	return nil
+}
+
 // Supports checks if the URL is supported by this protocol
 func (c *HTTPClient) Supports(u *url.URL) bool {
 	scheme := strings.ToLower(u.Scheme)
@@ -368,9 +441,10 @@ func (c *HTTPClient) Head(ctx context.Context, rawURL string) (*Metadata, error)
 		return nil, fmt.Errorf("executing HEAD request: %w", err)
 	}
 	defer resp.Body.Close()
+	c.protocol.Store(resp.Proto)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HEAD request failed: %s", resp.Status)
+		return nil, newStatusError("HEAD request", resp)
 	}
 
 	return c.parseMetadata(rawURL, resp)
@@ -389,10 +463,11 @@ func (c *HTTPClient) Get(ctx context.Context, rawURL string) (io.ReadCloser, *Me
 	if err != nil {
 		return nil, nil, fmt.Errorf("executing GET request: %w", err)
 	}
+	c.protocol.Store(resp.Proto)
 
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, nil, fmt.Errorf("GET request failed: %s", resp.Status)
+		return nil, nil, newStatusError("GET request", resp)
 	}
 
 	meta, err := c.parseMetadata(rawURL, resp)
@@ -406,6 +481,17 @@ func (c *HTTPClient) Get(ctx context.Context, rawURL string) (io.ReadCloser, *Me
 
 // GetRange downloads a specific byte range of the file
 func (c *HTTPClient) GetRange(ctx context.Context, rawURL string, start, end int64) (io.ReadCloser, error) {
+	return c.getRange(ctx, rawURL, start, end)
+}
+
+// GetRangeFrom downloads the file from byte start to its end ("bytes=N-").
+// It resumes downloads whose length is unknown.
+func (c *HTTPClient) GetRangeFrom(ctx context.Context, rawURL string, start int64) (io.ReadCloser, error) {
+	return c.getRange(ctx, rawURL, start, -1)
+}
+
+// getRange requests bytes start-end, or start to the end of the file if end < 0
+func (c *HTTPClient) getRange(ctx context.Context, rawURL string, start, end int64) (io.ReadCloser, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating range GET request: %w", err)
@@ -415,24 +501,36 @@ func (c *HTTPClient) GetRange(ctx context.Context, rawURL string, start, end int
 
 	// Set Range header for partial content
 	// Range is inclusive on both ends: bytes=0-99 fetches first 100 bytes
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if end < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("executing range GET request: %w", err)
 	}
+	c.protocol.Store(resp.Proto)
+
+	// Nothing left past start: the file ends exactly there
+	if end < 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable &&
+		resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", start) {
+		resp.Body.Close()
+		return http.NoBody, nil
+	}
 
 	// 206 Partial Content is expected for range requests
 	// 200 OK means server doesn't support ranges (will send full file)
 	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, fmt.Errorf("range GET request failed: %s", resp.Status)
+		return nil, newStatusError("range GET request", resp)
 	}
 
-	// If server returned 200 instead of 206, it doesn't support ranges
-	if resp.StatusCode == http.StatusOK {
+	// The response must hold exactly the requested bytes
+	if err := checkRangeResponse(resp, start, end); err != nil {
 		resp.Body.Close()
-		return nil, fmt.Errorf("server does not support range requests")
+		return nil, err
 	}
 
 	return resp.Body, nil
@@ -477,6 +575,9 @@ func (c *HTTPClient) parseMetadata(rawURL string, resp *http.Response) (*Metadat
 	// Extract filename from Content-Disposition or URL
 	meta.Filename = c.extractFilename(rawURL, resp)
 
+	meta.Digests = parseDigests(resp)
+	meta.MetalinkURLs = parseMetalinkLinks(resp)
+
 	// Check if HTTP/2 was forced but not used
 	if c.forceHTTP2 && !strings.HasPrefix(resp.Proto, "HTTP/2") {
 		return nil, fmt.Errorf("HTTP/2 was forced but server responded with %s", resp.Proto)
@@ -487,135 +588,5 @@ func (c *HTTPClient) parseMetadata(rawURL string, resp *http.Response) (*Metadat
 
 // extractFilename extracts filename from Content-Disposition header or URL
 func (c *HTTPClient) extractFilename(rawURL string, resp *http.Response) string {
-	// Try Content-Disposition header first
-	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
-		if filename := parseContentDisposition(cd); filename != "" {
-			return filename
-		}
-	}
-
-	// Fall back to URL path
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return "download"
-	}
-
-	// Get the last segment of the path
-	path := u.Path
-	if idx := strings.LastIndex(path, "/"); idx >= 0 {
-		path = path[idx+1:]
-	}
-
-	// Remove query string if present
-	if idx := strings.Index(path, "?"); idx >= 0 {
-		path = path[:idx]
-	}
-
-	// URL decode the filename
-	if decoded, err := url.QueryUnescape(path); err == nil {
-		path = decoded
-	}
-
-	if path == "" {
-		return "download"
-	}
-
-	return path
-}
-
-// parseContentDisposition extracts filename from Content-Disposition header
-// Supports RFC 2616 (Basic), RFC 5987 (UTF-8/encoded), and RFC 6266 standards
-func parseContentDisposition(cd string) string {
-	// Handle: attachment; filename="example.zip"
-	// Handle: attachment; filename=example.zip
-	// Handle: attachment; filename*=UTF-8''example.zip
-	// Handle: attachment; filename*=utf-8'en'%E4%B8%AD%E6%96%87.zip
-	// Handle: inline; filename="file.pdf"
-
-	var filename string
-	var filenameEncoded string
-
-	parts := strings.Split(cd, ";")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		lowerPart := strings.ToLower(part)
-
-		// Check for filename*= (RFC 5987) - takes priority
-		if strings.HasPrefix(lowerPart, "filename*=") {
-			value := part[10:]
-			// Handle encoding''filename format (e.g., UTF-8''name or UTF-8'en'name)
-			if idx := strings.Index(value, "''"); idx >= 0 {
-				value = value[idx+2:]
-			} else if idx := strings.Index(value, "'"); idx >= 0 {
-				// Handle single quote format (language tag)
-				if idx2 := strings.Index(value[idx+1:], "'"); idx2 >= 0 {
-					value = value[idx+1+idx2+1:]
-				}
-			}
-			// URL decode
-			if decoded, err := url.QueryUnescape(value); err == nil {
-				filenameEncoded = decoded
-			} else {
-				filenameEncoded = value
-			}
-		}
-
-		// Check for filename=
-		if strings.HasPrefix(lowerPart, "filename=") && !strings.HasPrefix(lowerPart, "filename*=") {
-			value := part[9:]
-			// Remove surrounding quotes
-			value = strings.Trim(value, `"'`)
-			// Handle escaped quotes within filename
-			value = strings.ReplaceAll(value, `\"`, `"`)
-			value = strings.ReplaceAll(value, `\\`, `\`)
-			filename = value
-		}
-	}
-
-	// RFC 5987 filename* takes priority over filename
-	if filenameEncoded != "" {
-		return sanitizeFilename(filenameEncoded)
-	}
-	if filename != "" {
-		return sanitizeFilename(filename)
-	}
-
-	return ""
-}
-
-// sanitizeFilename removes potentially dangerous characters from filename
-func sanitizeFilename(name string) string {
-	// Remove path separators to prevent directory traversal
-	name = strings.ReplaceAll(name, "/", "_")
-	name = strings.ReplaceAll(name, "\\", "_")
-	
-	// Remove null bytes
-	name = strings.ReplaceAll(name, "\x00", "")
-	
-	// Remove leading/trailing whitespace and dots
-	name = strings.TrimSpace(name)
-	name = strings.Trim(name, ".")
-	
-	// Replace other problematic characters
-	replacer := strings.NewReplacer(
-		"<", "_",
-		">", "_",
-		":", "_",
-		"\"", "_",
-		"|", "_",
-		"?", "_",
-		"*", "_",
-	)
-	name = replacer.Replace(name)
-	
-	// Limit length
-	if len(name) > 255 {
-		ext := filepath.Ext(name)
-		if len(ext) > 50 {
-			ext = ext[:50]
-		}
-		name = name[:255-len(ext)] + ext
-	}
-	
-	return name
+	return ResolveFilename(rawURL, resp.Header)
 }
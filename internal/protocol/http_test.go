@@ -190,6 +190,9 @@ func TestHTTPClient_GetRange_NoSupport(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error when server doesn't support ranges")
 	}
+	if !IsRangeError(err) {
+		t.Errorf("Expected a RangeError, got %v", err)
+	}
 }
 
 func TestHTTPClient_WithOptions(t *testing.T) {
@@ -538,9 +541,9 @@ func TestSanitizeFilename(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := sanitizeFilename(tt.input)
+			result := SanitizeFilename(tt.input)
 			if result != tt.expected {
-				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
 			}
 		})
 	}
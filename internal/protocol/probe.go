@@ -0,0 +1,168 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// probeDrainLimit caps how much of a probe response is drained so the
+// connection can go back to the pool
+const probeDrainLimit = 64 * 1024
+
+// headRejected reports whether a failed HEAD is worth retrying as a ranged GET.
+// Presigned URLs, CDNs and API gateways often refuse HEAD but serve GET.
+func headRejected(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// Probe fetches file metadata like Head, falling back to a GET for the first
+// byte ("Range: bytes=0-0") when the server rejects HEAD.
+// If the server ignored the range and is sending the whole file, its body is
+// returned so the caller can use it instead of a new request; otherwise the
+// body is nil. The caller must close a non-nil body.
+func (c *HTTPClient) Probe(ctx context.Context, rawURL string) (*Metadata, io.ReadCloser, error) {
+	meta, err := c.Head(ctx, rawURL)
+	if err == nil || !headRejected(err) {
+		return meta, nil, err
+	}
+
+	meta, body, getErr := c.probeGet(ctx, rawURL)
+	if getErr != nil {
+		return nil, nil, fmt.Errorf("%v, then %w", err, getErr)
+	}
+	return meta, body, nil
+}
+
+// Stat fetches file metadata using Probe, without keeping a response body open
+func (c *HTTPClient) Stat(ctx context.Context, rawURL string) (*Metadata, error) {
+	meta, body, err := c.Probe(ctx, rawURL)
+	if body != nil {
+		body.Close()
+	}
+	return meta, err
+}
+
+// probeGet requests the first byte of the file and derives the metadata
+// from the response headers
+func (c *HTTPClient) probeGet(ctx context.Context, rawURL string) (*Metadata, io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating probe request: %w", err)
+	}
+
+	c.setHeaders(req)
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("executing probe request: %w", err)
+	}
+	c.protocol.Store(resp.Proto)
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Read the single byte so the connection is reused for the first chunk
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, probeDrainLimit))
+
+		meta, err := c.parseMetadata(rawURL, resp)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, _, total, err := ParseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("probe request: %w", err)
+		}
+		meta.ContentLength = 0 // Unknown unless the server sent a total
+		if total >= 0 {
+			meta.ContentLength = total
+		}
+		meta.AcceptRanges = true
+		return meta, nil, nil
+
+	case http.StatusOK:
+		// Range ignored: the body is the whole file
+		meta, err := c.parseMetadata(rawURL, resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		meta.AcceptRanges = false
+		return meta, resp.Body, nil
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The first byte does not exist, so the file is empty
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, probeDrainLimit))
+
+		if strings.TrimSpace(resp.Header.Get("Content-Range")) == "bytes */0" {
+			meta, err := c.parseMetadata(rawURL, resp)
+			if err != nil {
+				return nil, nil, err
+			}
+			meta.ContentLength = 0
+			return meta, nil, nil
+		}
+	}
+
+	resp.Body.Close()
+	return nil, nil, newStatusError("probe request", resp)
+}
+
+// Revalidate checks whether the file changed since a response carrying etag
+// and lastModified, with a conditional HEAD request (If-None-Match,
+// If-Modified-Since). notModified is true if the server answered 304 Not
+// Modified; otherwise the current metadata is returned for the caller to
+// compare. Servers that reject HEAD are asked with Stat instead.
+func (c *HTTPClient) Revalidate(ctx context.Context, rawURL, etag string, lastModified time.Time) (meta *Metadata, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating HEAD request: %w", err)
+	}
+
+	c.setHeaders(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if !lastModified.IsZero() {
+		req.Header.Set("If-Modified-Since", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("executing HEAD request: %w", err)
+	}
+	defer resp.Body.Close()
+	c.protocol.Store(resp.Proto)
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		meta, err := c.parseMetadata(rawURL, resp)
+		return meta, true, err
+	case http.StatusOK:
+		meta, err := c.parseMetadata(rawURL, resp)
+		return meta, false, err
+	}
+
+	statusErr := newStatusError("HEAD request", resp)
+	if !headRejected(statusErr) {
+		return nil, false, statusErr
+	}
+	meta, err = c.Stat(ctx, rawURL)
+	return meta, false, err
+}
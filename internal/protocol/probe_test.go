@@ -0,0 +1,194 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHeadRejectingServer serves content for GET but answers HEAD with status
+func newHeadRejectingServer(t *testing.T, status int, content string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server, &conns
+}
+
+func TestHTTPClient_ProbeFallsBackToRangedGet(t *testing.T) {
+	content := strings.Repeat("burkut", 100)
+
+	for _, status := range []int{http.StatusForbidden, http.StatusMethodNotAllowed} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server, conns := newHeadRejectingServer(t, status, content)
+
+			client := NewHTTPClient()
+			ctx := context.Background()
+
+			meta, body, err := client.Probe(ctx, server.URL+"/download?id=7")
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if body != nil {
+				body.Close()
+				t.Error("Probe() returned a body for a 206 response")
+			}
+
+			if meta.ContentLength != int64(len(content)) {
+				t.Errorf("ContentLength = %d, want %d", meta.ContentLength, len(content))
+			}
+			if !meta.AcceptRanges {
+				t.Error("AcceptRanges = false, want true")
+			}
+			if meta.Filename != "report.csv" {
+				t.Errorf("Filename = %q, want %q", meta.Filename, "report.csv")
+			}
+			if meta.ETag != `"v1"` {
+				t.Errorf("ETag = %q, want %q", meta.ETag, `"v1"`)
+			}
+			if meta.LastModified.IsZero() {
+				t.Error("LastModified not parsed")
+			}
+
+			// The first chunk reuses the probe connection
+			rangeBody, err := client.GetRange(ctx, server.URL+"/download?id=7", 0, 5)
+			if err != nil {
+				t.Fatalf("GetRange() error = %v", err)
+			}
+			data, _ := io.ReadAll(rangeBody)
+			rangeBody.Close()
+
+			if string(data) != "burkut" {
+				t.Errorf("GetRange() = %q, want %q", data, "burkut")
+			}
+			if got := atomic.LoadInt32(conns); got != 1 {
+				t.Errorf("connections = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_ProbeRangeIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte("full content"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	meta, body, err := client.Probe(context.Background(), server.URL+"/file.txt")
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if body == nil {
+		t.Fatal("Probe() should return the whole-file body")
+	}
+	defer body.Close()
+
+	if meta.ContentLength != 12 || meta.AcceptRanges {
+		t.Errorf("ContentLength = %d, AcceptRanges = %v, want 12, false", meta.ContentLength, meta.AcceptRanges)
+	}
+	data, _ := io.ReadAll(body)
+	if string(data) != "full content" {
+		t.Errorf("body = %q, want %q", data, "full content")
+	}
+}
+
+func TestHTTPClient_ProbeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		headStatus int
+		getStatus  int
+		wantStatus int
+	}{
+		{"not found is not retried", http.StatusNotFound, http.StatusOK, http.StatusNotFound},
+		{"GET also rejected", http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.WriteHeader(tt.headStatus)
+					return
+				}
+				atomic.AddInt32(&gets, 1)
+				w.WriteHeader(tt.getStatus)
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient()
+			_, _, err := client.Probe(context.Background(), server.URL+"/file")
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+				t.Fatalf("Probe() error = %v, want status %d", err, tt.wantStatus)
+			}
+			if tt.headStatus == http.StatusNotFound && atomic.LoadInt32(&gets) != 0 {
+				t.Error("Probe() sent a GET after 404")
+			}
+		})
+	}
+}
+
+func TestHTTPClient_Revalidate(t *testing.T) {
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == `"v2"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", "7")
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+
+	_, notModified, err := client.Revalidate(context.Background(), server.URL+"/file", `"v2"`, lastModified)
+	if err != nil {
+		t.Fatalf("Revalidate() error = %v", err)
+	}
+	if !notModified {
+		t.Error("matching ETag should be reported as not modified")
+	}
+
+	meta, notModified, err := client.Revalidate(context.Background(), server.URL+"/file", `"v1"`, time.Time{})
+	if err != nil {
+		t.Fatalf("Revalidate() error = %v", err)
+	}
+	if notModified || meta.ETag != `"v2"` || meta.ContentLength != 7 {
+		t.Errorf("notModified = %v, ETag = %q, ContentLength = %d", notModified, meta.ETag, meta.ContentLength)
+	}
+}
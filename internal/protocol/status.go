@@ -0,0 +1,180 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when a server responds with an unexpected HTTP status
+type StatusError struct {
+	Op         string        // Request kind, e.g. "HEAD request"
+	StatusCode int           // HTTP status code
+	Status     string        // Full status line, e.g. "503 Service Unavailable"
+	Host       string        // Host the request was sent to
+	RetryAfter time.Duration // Parsed Retry-After header (0 if absent)
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Status)
+}
+
+// Throttled reports whether the server asked the client to slow down (429 or 503)
+func (e *StatusError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// newStatusError builds a StatusError from a response
+func newStatusError(op string, resp *http.Response) *StatusError {
+	e := &StatusError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		e.Host = resp.Request.URL.Host
+	}
+	return e
+}
+
+// MaxRetryAfter caps the delay ParseRetryAfter returns, so that huge values
+// cannot overflow a time.Duration
+const MaxRetryAfter = 24 * time.Hour
+
+// ParseRetryAfter parses a Retry-After header value (delay-seconds or HTTP-date).
+// Returns 0 if the value is empty, invalid or already in the past, and at
+// most MaxRetryAfter.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(min(secs, int64(MaxRetryAfter/time.Second))) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return min(d, MaxRetryAfter)
+		}
+	}
+
+	return 0
+}
+
+// IsThrottled reports whether err carries a 429/503 response.
+// The returned duration is the server's Retry-After hint (0 if none).
+func IsThrottled(err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Throttled() {
+		return statusErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// RangeError is returned when a server does not honor a range request:
+// it answers 200 with the full body, or a 206 whose Content-Range does not
+// match the requested bytes. Continuing with several connections would corrupt
+// the file, so callers should fall back to a single stream.
+type RangeError struct {
+	Start, End   int64  // Requested range (inclusive)
+	StatusCode   int    // Response status
+	ContentRange string // Content-Range header as received
+	Reason       string
+}
+
+func (e *RangeError) Error() string {
+	if e.End < 0 {
+		return fmt.Sprintf("range %d- not honored: %s", e.Start, e.Reason)
+	}
+	return fmt.Sprintf("range %d-%d not honored: %s", e.Start, e.End, e.Reason)
+}
+
+// IsRangeError reports whether err is a RangeError
+func IsRangeError(err error) bool {
+	var rangeErr *RangeError
+	return errors.As(err, &rangeErr)
+}
+
+// ParseContentRange parses a "bytes first-last/total" Content-Range value.
+// total is -1 if the server sent "*".
+func ParseContentRange(value string) (first, last, total int64, err error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(strings.TrimSpace(value[len("bytes "):]), "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil || total < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+		}
+	}
+
+	firstPart, lastPart, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	first, err1 := strconv.ParseInt(firstPart, 10, 64)
+	last, err2 := strconv.ParseInt(lastPart, 10, 64)
+	if err1 != nil || err2 != nil || first < 0 || last < first || (total >= 0 && last >= total) {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	return first, last, total, nil
+}
+
+// checkRangeResponse verifies that resp carries exactly bytes start-end.
+// A range reaching past the end of the file may be cut short at the last byte.
+// If end < 0 the range is open-ended and must run to the end of the file.
+func checkRangeResponse(resp *http.Response, start, end int64) error {
+	rangeErr := &RangeError{
+		Start:        start,
+		End:          end,
+		StatusCode:   resp.StatusCode,
+		ContentRange: resp.Header.Get("Content-Range"),
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		rangeErr.Reason = "server ignored Range and sent the full file (200 OK)"
+		return rangeErr
+	}
+
+	if strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "multipart/byteranges") {
+		rangeErr.Reason = "server sent a multipart response"
+		return rangeErr
+	}
+
+	first, last, total, err := ParseContentRange(rangeErr.ContentRange)
+	if err != nil {
+		rangeErr.Reason = "missing or invalid Content-Range"
+		return rangeErr
+	}
+
+	openEnded := end < 0 && (total < 0 || last == total-1)
+	truncatedAtEOF := total >= 0 && last == total-1 && last < end
+	if first != start || (last != end && !truncatedAtEOF && !openEnded) {
+		rangeErr.Reason = fmt.Sprintf("server sent bytes %d-%d", first, last)
+		return rangeErr
+	}
+
+	if resp.ContentLength >= 0 && resp.ContentLength != last-first+1 {
+		rangeErr.Reason = fmt.Sprintf("Content-Length %d does not match Content-Range", resp.ContentLength)
+		return rangeErr
+	}
+
+	return nil
+}
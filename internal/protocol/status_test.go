@@ -0,0 +1,190 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 120 * time.Second},
+		{"zero", "0", 0},
+		{"negative", "-5", 0},
+		{"http date", "Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second},
+		{"date in the past", "Wed, 01 Jan 2025 11:00:00 GMT", 0},
+		{"huge seconds", "9223372036854775807", MaxRetryAfter},
+		{"overflowing seconds", "99999999999999999999", 0},
+		{"far future date", "Fri, 01 Jan 9999 00:00:00 GMT", MaxRetryAfter},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_ThrottledStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	_, err := client.GetRange(context.Background(), server.URL+"/file", 0, 9)
+	if err == nil {
+		t.Fatal("GetRange() should fail on 429")
+	}
+
+	retryAfter, throttled := IsThrottled(fmt.Errorf("chunk 0: %w", err))
+	if !throttled {
+		t.Fatalf("IsThrottled(%v) = false, want true", err)
+	}
+	if retryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %v, want 7s", retryAfter)
+	}
+}
+
+func TestIsThrottled_OtherStatus(t *testing.T) {
+	err := &StatusError{Op: "HEAD request", StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	if _, throttled := IsThrottled(err); throttled {
+		t.Error("IsThrottled() should be false for 404")
+	}
+	if err.Error() != "HEAD request failed: 404 Not Found" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value               string
+		wantFirst, wantLast int64
+		wantTotal           int64
+		wantErr             bool
+	}{
+		{"bytes 0-499/1234", 0, 499, 1234, false},
+		{"bytes 500-1233/1234", 500, 1233, 1234, false},
+		{"bytes 0-0/*", 0, 0, -1, false},
+		{"bytes */1234", 0, 0, 0, true},
+		{"bytes 10-5/100", 0, 0, 0, true},
+		{"bytes 0-100/100", 0, 0, 0, true},
+		{"items 0-5/10", 0, 0, 0, true},
+		{"", 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			first, last, total, err := ParseContentRange(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContentRange(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if first != tt.wantFirst || last != tt.wantLast || total != tt.wantTotal {
+				t.Errorf("ParseContentRange(%q) = %d, %d, %d, want %d, %d, %d",
+					tt.value, first, last, total, tt.wantFirst, tt.wantLast, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_GetRange_Validation(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		contentRange string
+		body         string
+		wantErr      bool
+	}{
+		{"matching range", http.StatusPartialContent, "bytes 10-19/100", "0123456789", false},
+		{"range cut at end of file", http.StatusPartialContent, "bytes 10-14/15", "01234", false},
+		{"full body with 200", http.StatusOK, "", "full content", true},
+		{"wrong start", http.StatusPartialContent, "bytes 0-9/100", "0123456789", true},
+		{"wrong end", http.StatusPartialContent, "bytes 10-15/100", "012345", true},
+		{"missing Content-Range", http.StatusPartialContent, "", "0123456789", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient()
+			body, err := client.GetRange(context.Background(), server.URL+"/file", 10, 19)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !IsRangeError(err) {
+					t.Errorf("GetRange() error = %v, want a RangeError", err)
+				}
+				return
+			}
+			body.Close()
+		})
+	}
+}
+
+func TestHTTPClient_GetRangeFrom(t *testing.T) {
+	content := "0123456789abcdefghij"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/norange" {
+			fmt.Fprint(w, content)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	ctx := context.Background()
+
+	body, err := client.GetRangeFrom(ctx, server.URL+"/file", 15)
+	if err != nil {
+		t.Fatalf("GetRangeFrom() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "fghij" {
+		t.Errorf("GetRangeFrom() = %q, want %q", data, "fghij")
+	}
+
+	// Resuming exactly at the end yields an empty body
+	body, err = client.GetRangeFrom(ctx, server.URL+"/file", int64(len(content)))
+	if err != nil {
+		t.Fatalf("GetRangeFrom() at EOF error = %v", err)
+	}
+	data, _ = io.ReadAll(body)
+	body.Close()
+	if len(data) != 0 {
+		t.Errorf("GetRangeFrom() at EOF = %q, want empty", data)
+	}
+
+	if _, err := client.GetRangeFrom(ctx, server.URL+"/norange", 15); !IsRangeError(err) {
+		t.Errorf("GetRangeFrom() without range support error = %v, want a RangeError", err)
+	}
+}
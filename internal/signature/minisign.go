@@ -0,0 +1,148 @@
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	minisignAlgEd         = "Ed" // Signature of the file itself
+	minisignAlgEdPrehash  = "ED" // Signature of the BLAKE2b-512 of the file
+	minisignKeyLen        = 2 + 8 + ed25519.PublicKeySize
+	minisignSignatureLen  = 2 + 8 + ed25519.SignatureSize
+	minisignTrustedPrefix = "trusted comment: "
+)
+
+// maxLegacyMinisignSize is the largest file checked against a legacy (Ed)
+// minisign signature, which signs the file itself and so needs it in memory
+var maxLegacyMinisignSize int64 = 64 << 20
+
+// minisignKey is a minisign public key
+type minisignKey struct {
+	id  uint64
+	key ed25519.PublicKey
+}
+
+// minisignSignature is a parsed .minisig file
+type minisignSignature struct {
+	algorithm      string
+	keyID          uint64
+	signature      []byte
+	trustedComment string
+	globalSig      []byte // Signs signature and trustedComment
+}
+
+// parseMinisignKey parses a minisign public key file, or the bare base64
+// key printed by minisign -R
+func parseMinisignKey(data []byte) (*minisignKey, error) {
+	var encoded string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			encoded = line
+			break
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != minisignKeyLen || string(raw[:2]) != minisignAlgEd {
+		return nil, errors.New("not a minisign public key")
+	}
+	return &minisignKey{
+		id:  binary.LittleEndian.Uint64(raw[2:10]),
+		key: ed25519.PublicKey(raw[10:]),
+	}, nil
+}
+
+// parseMinisignSignature parses a .minisig file: an untrusted comment, the
+// signature, a trusted comment and the global signature, one per line
+func parseMinisignSignature(data []byte) (*minisignSignature, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], minisignTrustedPrefix) {
+		return nil, errors.New("invalid minisign signature")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(raw) != minisignSignatureLen {
+		return nil, errors.New("invalid minisign signature")
+	}
+	algorithm := string(raw[:2])
+	if algorithm != minisignAlgEd && algorithm != minisignAlgEdPrehash {
+		return nil, fmt.Errorf("unsupported minisign algorithm %q", algorithm)
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return nil, errors.New("invalid minisign global signature")
+	}
+
+	return &minisignSignature{
+		algorithm:      algorithm,
+		keyID:          binary.LittleEndian.Uint64(raw[2:10]),
+		signature:      raw[10:],
+		trustedComment: strings.TrimPrefix(lines[2], minisignTrustedPrefix),
+		globalSig:      globalSig,
+	}, nil
+}
+
+// verifyMinisign checks file against a minisign signature and its trusted
+// comment
+func (k *Keyring) verifyMinisign(file io.Reader, data []byte) (string, error) {
+	sig, err := parseMinisignSignature(data)
+	if err != nil {
+		return "", err
+	}
+
+	var key *minisignKey
+	for _, candidate := range k.minisign {
+		if candidate.id == sig.keyID {
+			key = candidate
+			break
+		}
+	}
+	if key == nil {
+		return "", fmt.Errorf("signed with minisign key %016X, which is not among the public keys", sig.keyID)
+	}
+
+	var message []byte
+	if sig.algorithm == minisignAlgEdPrehash {
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, file); err != nil {
+			return "", fmt.Errorf("reading file: %w", err)
+		}
+		message = h.Sum(nil)
+	} else {
+		if message, err = io.ReadAll(io.LimitReader(file, maxLegacyMinisignSize+1)); err != nil {
+			return "", fmt.Errorf("reading file: %w", err)
+		}
+		if int64(len(message)) > maxLegacyMinisignSize {
+			return "", fmt.Errorf("legacy minisign signatures are only checked for files up to %d MB; the file needs a prehashed signature (minisign -S without -l)",
+				maxLegacyMinisignSize>>20)
+		}
+	}
+
+	if !ed25519.Verify(key.key, message, sig.signature) {
+		return "", errors.New("file does not match the minisign signature")
+	}
+	global := append(append([]byte(nil), sig.signature...), sig.trustedComment...)
+	if !ed25519.Verify(key.key, global, sig.globalSig) {
+		return "", errors.New("minisign trusted comment was altered")
+	}
+
+	return fmt.Sprintf("minisign key %016X (%s)", key.id, sig.trustedComment), nil
+}
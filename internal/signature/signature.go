@@ -0,0 +1,218 @@
+// Package signature verifies detached signatures of downloaded files against
+// local public keys. It supports minisign (Ed25519) signatures and OpenPGP
+// signatures, armored or binary.
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Format is the format of a detached signature
+type Format string
+
+const (
+	FormatMinisign Format = "minisign"
+	FormatOpenPGP  Format = "openpgp"
+)
+
+// Extensions are the file extensions of detached signatures, in the order
+// they are looked for next to a download
+var Extensions = []string{".minisig", ".sig", ".asc"}
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	pgpPublicKeyHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+)
+
+// Error is returned when a file does not match its signature or the
+// signature cannot be checked with the local keys
+type Error struct {
+	Source string // Where the signature came from
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("signature verification failed (%s): %v", e.Source, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Keyring holds the public keys signatures are verified against
+type Keyring struct {
+	minisign []*minisignKey
+	openpgp  openpgp.EntityList
+}
+
+// LoadKeys reads minisign or armored OpenPGP public keys from pubkeys and
+// OpenPGP keyrings, armored or binary, from keyrings
+func LoadKeys(pubkeys, keyrings []string) (*Keyring, error) {
+	k := &Keyring{}
+	for _, path := range pubkeys {
+		if err := k.addPublicKeyFile(path); err != nil {
+			return nil, fmt.Errorf("reading public key %s: %w", path, err)
+		}
+	}
+	for _, path := range keyrings {
+		if err := k.addKeyringFile(path); err != nil {
+			return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+		}
+	}
+	return k, nil
+}
+
+// Empty reports whether the keyring holds no keys
+func (k *Keyring) Empty() bool {
+	return len(k.minisign) == 0 && len(k.openpgp) == 0
+}
+
+func (k *Keyring) addPublicKeyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte(pgpPublicKeyHeader)) {
+		return k.addOpenPGPKeys(data)
+	}
+
+	key, err := parseMinisignKey(data)
+	if err != nil {
+		return err
+	}
+	k.minisign = append(k.minisign, key)
+	return nil
+}
+
+func (k *Keyring) addKeyringFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return k.addOpenPGPKeys(data)
+}
+
+func (k *Keyring) addOpenPGPKeys(data []byte) error {
+	var entities openpgp.EntityList
+	var err error
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	k.openpgp = append(k.openpgp, entities...)
+	return nil
+}
+
+// Verifier checks files against one detached signature
+type Verifier struct {
+	source string
+	format Format
+	data   []byte
+	keys   *Keyring
+	signer string
+}
+
+// New returns a verifier for the detached signature data, which came from
+// source, checked against keys
+func New(data []byte, source string, keys *Keyring) (*Verifier, error) {
+	v := &Verifier{source: source, data: data, keys: keys}
+	trimmed := bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("untrusted comment:")):
+		v.format = FormatMinisign
+		if _, err := parseMinisignSignature(data); err != nil {
+			return nil, &Error{Source: source, Err: err}
+		}
+	case bytes.HasPrefix(trimmed, []byte(pgpSignatureHeader)):
+		v.format = FormatOpenPGP
+		if _, err := armor.Decode(bytes.NewReader(trimmed)); err != nil {
+			return nil, &Error{Source: source, Err: fmt.Errorf("invalid armored signature: %w", err)}
+		}
+	case len(data) > 0 && data[0]&0x80 != 0:
+		// Binary OpenPGP packets start with a tag byte with the high bit set
+		v.format = FormatOpenPGP
+	default:
+		return nil, &Error{Source: source, Err: errors.New("not a minisign or OpenPGP signature")}
+	}
+	return v, nil
+}
+
+// Format returns the format of the signature
+func (v *Verifier) Format() Format {
+	return v.format
+}
+
+// Source returns where the signature came from
+func (v *Verifier) Source() string {
+	return v.source
+}
+
+// Signer describes the key that made the signature, once VerifyFile succeeded
+func (v *Verifier) Signer() string {
+	return v.signer
+}
+
+// VerifyFile checks the file at path against the signature. Failures are
+// reported as *Error.
+func (v *Verifier) VerifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	var signer string
+	switch v.format {
+	case FormatMinisign:
+		signer, err = v.keys.verifyMinisign(f, v.data)
+	default:
+		signer, err = v.keys.verifyOpenPGP(f, v.data)
+	}
+	if err != nil {
+		return &Error{Source: v.source, Err: err}
+	}
+	v.signer = signer
+	return nil
+}
+
+// verifyOpenPGP checks file against an armored or binary OpenPGP signature
+func (k *Keyring) verifyOpenPGP(file io.Reader, sig []byte) (string, error) {
+	if len(k.openpgp) == 0 {
+		return "", errors.New("OpenPGP signature but no OpenPGP public keys loaded")
+	}
+
+	var entity *openpgp.Entity
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte(pgpSignatureHeader)) {
+		entity, err = openpgp.CheckArmoredDetachedSignature(k.openpgp, file, bytes.NewReader(sig), nil)
+	} else {
+		entity, err = openpgp.CheckDetachedSignature(k.openpgp, file, bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	signer := fmt.Sprintf("OpenPGP key %X", entity.PrimaryKey.KeyId)
+	names := make([]string, 0, len(entity.Identities))
+	for name := range entity.Identities {
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		signer += " (" + names[0] + ")"
+	}
+	return signer, nil
+}
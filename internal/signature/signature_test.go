@@ -0,0 +1,230 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"golang.org/x/crypto/blake2b"
+)
+
+// writeFile creates a file with content in dir and returns its path
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// minisignKeyPair returns a key pair and its public key file in the format
+// minisign writes
+func minisignKeyPair(t *testing.T, id uint64) (ed25519.PrivateKey, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := make([]byte, 0, minisignKeyLen)
+	raw = append(raw, minisignAlgEd...)
+	raw = binary.LittleEndian.AppendUint64(raw, id)
+	raw = append(raw, pub...)
+	return priv, []byte("untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n")
+}
+
+// minisign signs content like minisign -S, prehashed unless legacy is set
+func minisign(priv ed25519.PrivateKey, id uint64, content []byte, legacy bool) []byte {
+	algorithm, message := minisignAlgEdPrehash, content
+	if legacy {
+		algorithm = minisignAlgEd
+	} else {
+		sum := blake2b.Sum512(content)
+		message = sum[:]
+	}
+
+	sig := ed25519.Sign(priv, message)
+	raw := append([]byte(algorithm), binary.LittleEndian.AppendUint64(nil, id)...)
+	raw = append(raw, sig...)
+
+	comment := "timestamp:1700000000\tfile:release.tar.gz"
+	global := ed25519.Sign(priv, append(append([]byte(nil), sig...), comment...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestVerifier_Minisign(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("release archive content")
+	file := writeFile(t, dir, "release.tar.gz", content)
+
+	priv, pub := minisignKeyPair(t, 0x1122334455667788)
+	keys, err := LoadKeys([]string{writeFile(t, dir, "key.pub", pub)}, nil)
+	if err != nil {
+		t.Fatalf("LoadKeys() error = %v", err)
+	}
+
+	for _, legacy := range []bool{false, true} {
+		v, err := New(minisign(priv, 0x1122334455667788, content, legacy), "release.tar.gz.minisig", keys)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if v.Format() != FormatMinisign {
+			t.Errorf("Format() = %s", v.Format())
+		}
+		if err := v.VerifyFile(file); err != nil {
+			t.Errorf("VerifyFile(legacy=%v) error = %v", legacy, err)
+		}
+		if !strings.Contains(v.Signer(), "1122334455667788") {
+			t.Errorf("Signer() = %q", v.Signer())
+		}
+	}
+
+	t.Run("tampered file", func(t *testing.T) {
+		v, _ := New(minisign(priv, 0x1122334455667788, content, false), "sig", keys)
+		err := v.VerifyFile(writeFile(t, dir, "tampered", []byte("release archive CONTENT")))
+		var sigErr *Error
+		if !errors.As(err, &sigErr) {
+			t.Errorf("VerifyFile() error = %v, want *Error", err)
+		}
+	})
+
+	t.Run("legacy signature of a large file", func(t *testing.T) {
+		defer func(n int64) { maxLegacyMinisignSize = n }(maxLegacyMinisignSize)
+		maxLegacyMinisignSize = int64(len(content)) - 1
+
+		v, _ := New(minisign(priv, 0x1122334455667788, content, true), "sig", keys)
+		if err := v.VerifyFile(file); err == nil || !strings.Contains(err.Error(), "prehashed") {
+			t.Errorf("VerifyFile() error = %v, want the legacy size limit", err)
+		}
+		v, _ = New(minisign(priv, 0x1122334455667788, content, false), "sig", keys)
+		if err := v.VerifyFile(file); err != nil {
+			t.Errorf("VerifyFile() of a prehashed signature error = %v", err)
+		}
+	})
+
+	t.Run("tampered trusted comment", func(t *testing.T) {
+		sig := bytes.Replace(minisign(priv, 0x1122334455667788, content, false), []byte("timestamp:1700000000"), []byte("timestamp:1800000000"), 1)
+		v, _ := New(sig, "sig", keys)
+		if err := v.VerifyFile(file); err == nil || !strings.Contains(err.Error(), "trusted comment") {
+			t.Errorf("VerifyFile() error = %v, want altered trusted comment", err)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other, _ := minisignKeyPair(t, 42)
+		v, _ := New(minisign(other, 42, content, false), "sig", keys)
+		if err := v.VerifyFile(file); err == nil || !strings.Contains(err.Error(), "not among the public keys") {
+			t.Errorf("VerifyFile() error = %v, want unknown key", err)
+		}
+	})
+}
+
+// openPGPKey returns a new entity of the given key type and its armored
+// public key
+func openPGPKey(t *testing.T, config *packet.Config) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Release Signing", "", "release@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, _ := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return entity, buf.Bytes()
+}
+
+func TestVerifier_OpenPGP(t *testing.T) {
+	keyTypes := map[string]*packet.Config{
+		"RSA": {Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048},
+		// GnuPG's default; x/crypto/openpgp could not read these keys
+		"EdDSA Ed25519": {Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519},
+		"Ed25519":       {Algorithm: packet.PubKeyAlgoEd25519},
+	}
+	for name, config := range keyTypes {
+		t.Run(name, func(t *testing.T) {
+			testVerifierOpenPGP(t, config)
+		})
+	}
+}
+
+func testVerifierOpenPGP(t *testing.T, config *packet.Config) {
+	dir := t.TempDir()
+	content := []byte("release archive content")
+	file := writeFile(t, dir, "release.tar.gz", content)
+
+	entity, pub := openPGPKey(t, config)
+	keyring := writeFile(t, dir, "keyring.asc", pub)
+
+	var armored, binarySig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&armored, entity, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&binarySig, entity, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, loadKeys := range map[string]func() (*Keyring, error){
+		"keyring": func() (*Keyring, error) { return LoadKeys(nil, []string{keyring}) },
+		"pubkey":  func() (*Keyring, error) { return LoadKeys([]string{keyring}, nil) },
+	} {
+		keys, err := loadKeys()
+		if err != nil {
+			t.Fatalf("LoadKeys(%s) error = %v", name, err)
+		}
+
+		for _, sig := range [][]byte{armored.Bytes(), binarySig.Bytes()} {
+			v, err := New(sig, "release.tar.gz.asc", keys)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := v.VerifyFile(file); err != nil {
+				t.Errorf("VerifyFile() with %s error = %v", name, err)
+			}
+			if !strings.Contains(v.Signer(), "release@example.com") {
+				t.Errorf("Signer() = %q", v.Signer())
+			}
+		}
+	}
+
+	keys, _ := LoadKeys(nil, []string{keyring})
+	v, _ := New(armored.Bytes(), "sig", keys)
+	var sigErr *Error
+	if err := v.VerifyFile(writeFile(t, dir, "tampered", []byte("other content"))); !errors.As(err, &sigErr) {
+		t.Errorf("VerifyFile() error = %v, want *Error", err)
+	}
+
+	other, _ := openPGPKey(t, config)
+	var otherSig bytes.Buffer
+	openpgp.ArmoredDetachSign(&otherSig, other, bytes.NewReader(content), nil)
+	v, _ = New(otherSig.Bytes(), "sig", keys)
+	if err := v.VerifyFile(file); !errors.As(err, &sigErr) {
+		t.Errorf("signature of an unknown key: error = %v, want *Error", err)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	keys := &Keyring{}
+	for _, data := range []string{"<html>not found</html>", "untrusted comment: x\nshort\n"} {
+		if _, err := New([]byte(data), "sig", keys); err == nil {
+			t.Errorf("New(%q) should fail", data)
+		}
+	}
+}
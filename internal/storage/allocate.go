@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AllocationMode selects how disk space is reserved for a download
+type AllocationMode string
+
+const (
+	AllocNone   AllocationMode = "none"   // Grow the file as data arrives
+	AllocSparse AllocationMode = "sparse" // Write the last byte, leaving a sparse file
+	AllocFalloc AllocationMode = "falloc" // Reserve real blocks with fallocate(2) (Linux)
+	AllocTrunc  AllocationMode = "trunc"  // Set the size with ftruncate(2)
+)
+
+// DefaultAllocationMode is used when no mode is selected
+const DefaultAllocationMode = AllocSparse
+
+// ErrFallocateUnsupported is returned when the platform or filesystem
+// cannot reserve blocks with fallocate
+var ErrFallocateUnsupported = errors.New("fallocate is not supported")
+
+// errFreeSpaceUnknown is returned where free space cannot be queried
+var errFreeSpaceUnknown = errors.New("free space cannot be determined on this platform")
+
+// ParseAllocationMode parses a --file-allocation value
+func ParseAllocationMode(s string) (AllocationMode, error) {
+	switch mode := AllocationMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return DefaultAllocationMode, nil
+	case AllocNone, AllocSparse, AllocFalloc, AllocTrunc:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid file allocation mode %q (use none, sparse, falloc or trunc)", s)
+}
+
+// InsufficientSpaceError is returned when the target filesystem cannot hold a download
+type InsufficientSpaceError struct {
+	Path      string
+	Needed    int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough free space for %s: %d bytes needed, %d available", e.Path, e.Needed, e.Available)
+}
+
+// FreeSpace returns the bytes available to this user on the filesystem holding dir
+func FreeSpace(dir string) (int64, error) {
+	return freeSpace(dir)
+}
+
+// CheckFreeSpace verifies that the filesystem path will be written to has
+// room for needed more bytes. Where free space cannot be queried, the check
+// is skipped.
+func CheckFreeSpace(path string, needed int64) error {
+	if needed <= 0 {
+		return nil
+	}
+
+	// The file may not exist yet; check the nearest existing directory
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	available, err := freeSpace(dir)
+	if err != nil {
+		return nil
+	}
+	if available < needed {
+		return &InsufficientSpaceError{Path: path, Needed: needed, Available: available}
+	}
+	return nil
+}
+
+// allocate reserves size bytes for the file using mode
+func allocate(file *os.File, size int64, mode AllocationMode) error {
+	if size <= 0 {
+		return nil
+	}
+
+	switch mode {
+	case AllocNone:
+		return nil
+	case AllocTrunc:
+		return file.Truncate(size)
+	case AllocFalloc:
+		return fallocate(file, size)
+	default:
+		// Write a single byte at the end to create a sparse file
+		_, err := file.WriteAt([]byte{0}, size-1)
+		return err
+	}
+}
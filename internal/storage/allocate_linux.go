@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fallocate reserves real blocks for the first size bytes of file
+func fallocate(file *os.File, size int64) error {
+	for {
+		err := unix.Fallocate(int(file.Fd()), 0, 0, size)
+		if err == unix.EINTR {
+			continue
+		}
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+			return fmt.Errorf("%w on this filesystem", ErrFallocateUnsupported)
+		}
+		return err
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// fallocate is only available on Linux
+func fallocate(file *os.File, size int64) error {
+	return fmt.Errorf("%w on %s", ErrFallocateUnsupported, runtime.GOOS)
+}
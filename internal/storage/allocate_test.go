@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAllocationMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    AllocationMode
+		wantErr bool
+	}{
+		{"", AllocSparse, false},
+		{"none", AllocNone, false},
+		{"sparse", AllocSparse, false},
+		{"FALLOC", AllocFalloc, false},
+		{"trunc", AllocTrunc, false},
+		{"prealloc", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAllocationMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAllocationMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAllocationMode(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileWriterWithAllocation(t *testing.T) {
+	const size = 1024 * 1024
+
+	tests := []struct {
+		mode     AllocationMode
+		wantSize int64
+	}{
+		{AllocNone, 0},
+		{AllocSparse, size},
+		{AllocTrunc, size},
+		{AllocFalloc, size},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.bin")
+
+			w, err := NewFileWriterWithAllocation(path, size, tt.mode)
+			if errors.Is(err, ErrFallocateUnsupported) {
+				t.Skipf("fallocate unavailable: %v", err)
+			}
+			if err != nil {
+				t.Fatalf("NewFileWriterWithAllocation() error = %v", err)
+			}
+			defer w.Close()
+
+			// Writes land at their offsets regardless of the allocation mode
+			if _, err := w.WriteAt([]byte("burkut"), 0); err != nil {
+				t.Fatalf("WriteAt() error = %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat() error = %v", err)
+			}
+			wantSize := tt.wantSize
+			if wantSize == 0 {
+				wantSize = int64(len("burkut"))
+			}
+			if info.Size() != wantSize {
+				t.Errorf("size = %d, want %d", info.Size(), wantSize)
+			}
+		})
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FreeSpace(dir); err != nil {
+		t.Skipf("free space unavailable: %v", err)
+	}
+
+	// The parent directory is checked when the file and its directory do not exist yet
+	path := filepath.Join(dir, "not", "yet", "created.bin")
+
+	if err := CheckFreeSpace(path, 1); err != nil {
+		t.Errorf("CheckFreeSpace(1 byte) error = %v", err)
+	}
+
+	err := CheckFreeSpace(path, 1<<62)
+	var noSpace *InsufficientSpaceError
+	if !errors.As(err, &noSpace) {
+		t.Fatalf("CheckFreeSpace(4 EiB) error = %v, want InsufficientSpaceError", err)
+	}
+	if noSpace.Needed != 1<<62 || noSpace.Available <= 0 {
+		t.Errorf("InsufficientSpaceError = %+v", noSpace)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CollisionPolicy decides what happens when the output file already exists.
+type CollisionPolicy string
+
+const (
+	// CollisionOverwrite replaces the existing file (default).
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionSkip keeps the existing file and skips the download (--no-clobber).
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionRename writes to a numbered name (file.1, file.2, ...) like wget.
+	CollisionRename CollisionPolicy = "rename"
+	// CollisionSkipSameSize skips the download if the existing file has the remote size.
+	CollisionSkipSameSize CollisionPolicy = "skip-same-size"
+)
+
+// maxCollisionSuffix bounds the numbered suffix search.
+const maxCollisionSuffix = 10000
+
+// ParseCollisionPolicy parses a policy name as given on the command line.
+// An empty string yields CollisionOverwrite.
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "overwrite":
+		return CollisionOverwrite, nil
+	case "skip", "no-clobber":
+		return CollisionSkip, nil
+	case "rename", "number":
+		return CollisionRename, nil
+	case "skip-same-size":
+		return CollisionSkipSameSize, nil
+	default:
+		return "", fmt.Errorf("unknown collision policy: %s (use overwrite, rename, skip or skip-same-size)", s)
+	}
+}
+
+// CollisionResult is the outcome of ResolveCollision.
+type CollisionResult struct {
+	// Path is the path the download should be written to
+	Path string
+	// Skip is true if the download should not happen at all
+	Skip bool
+	// Reason explains why the download was skipped
+	Reason string
+}
+
+// ResolveCollision applies policy to path.
+// remoteSize is only used by CollisionSkipSameSize; pass -1 if unknown.
+func ResolveCollision(path string, policy CollisionPolicy, remoteSize int64) (CollisionResult, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return CollisionResult{Path: path}, nil
+	}
+	if err != nil {
+		return CollisionResult{}, fmt.Errorf("checking %s: %w", path, err)
+	}
+
+	switch policy {
+	case CollisionSkip:
+		return CollisionResult{Path: path, Skip: true, Reason: "file already exists"}, nil
+
+	case CollisionSkipSameSize:
+		if remoteSize >= 0 && info.Size() == remoteSize {
+			return CollisionResult{Path: path, Skip: true, Reason: "file already exists with same size"}, nil
+		}
+		return CollisionResult{Path: path}, nil
+
+	case CollisionRename:
+		for i := 1; i <= maxCollisionSuffix; i++ {
+			candidate := fmt.Sprintf("%s.%d", path, i)
+			if _, err := os.Stat(candidate); os.IsNotExist(err) {
+				return CollisionResult{Path: candidate}, nil
+			}
+		}
+		return CollisionResult{}, fmt.Errorf("no free name for %s", path)
+
+	default:
+		return CollisionResult{Path: path}, nil
+	}
+}
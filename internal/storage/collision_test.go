@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCollisionPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    CollisionPolicy
+		wantErr bool
+	}{
+		{"", CollisionOverwrite, false},
+		{"overwrite", CollisionOverwrite, false},
+		{"skip", CollisionSkip, false},
+		{"no-clobber", CollisionSkip, false},
+		{"RENAME", CollisionRename, false},
+		{"skip-same-size", CollisionSkipSameSize, false},
+		{"bogus", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCollisionPolicy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCollisionPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCollisionPolicy(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestResolveCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "file.bin")
+	if err := os.WriteFile(existing, []byte("12345"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(existing+".1", []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	missing := filepath.Join(tmpDir, "missing.bin")
+
+	tests := []struct {
+		name       string
+		path       string
+		policy     CollisionPolicy
+		remoteSize int64
+		wantPath   string
+		wantSkip   bool
+	}{
+		{"missing file", missing, CollisionSkip, -1, missing, false},
+		{"overwrite", existing, CollisionOverwrite, -1, existing, false},
+		{"skip", existing, CollisionSkip, -1, existing, true},
+		{"rename picks next free", existing, CollisionRename, -1, existing + ".2", false},
+		{"same size skipped", existing, CollisionSkipSameSize, 5, existing, true},
+		{"different size downloaded", existing, CollisionSkipSameSize, 6, existing, false},
+		{"unknown size downloaded", existing, CollisionSkipSameSize, -1, existing, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ResolveCollision(tt.path, tt.policy, tt.remoteSize)
+			if err != nil {
+				t.Fatalf("ResolveCollision() error = %v", err)
+			}
+			if res.Path != tt.wantPath {
+				t.Errorf("Path = %q, want %q", res.Path, tt.wantPath)
+			}
+			if res.Skip != tt.wantSkip {
+				t.Errorf("Skip = %v, want %v", res.Skip, tt.wantSkip)
+			}
+		})
+	}
+}
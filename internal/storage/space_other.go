@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+// freeSpace is not implemented on this platform
+func freeSpace(dir string) (int64, error) {
+	return 0, errFreeSpaceUnknown
+}
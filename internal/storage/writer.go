@@ -16,13 +16,19 @@ type FileWriter struct {
 	path     string
 	size     int64
 	written  int64
-	mu       sync.Mutex
+	mu       sync.RWMutex
 	closed   bool
 }
 
 // NewFileWriter creates a new FileWriter for the given path.
 // If size > 0, it pre-allocates the file to that size (sparse file on supported systems).
 func NewFileWriter(path string, size int64) (*FileWriter, error) {
+	return NewFileWriterWithAllocation(path, size, AllocSparse)
+}
+
+// NewFileWriterWithAllocation creates a new FileWriter for the given path,
+// reserving size bytes with the given allocation mode.
+func NewFileWriterWithAllocation(path string, size int64, mode AllocationMode) (*FileWriter, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(path)
 	if dir != "" && dir != "." {
@@ -44,11 +50,9 @@ func NewFileWriter(path string, size int64) (*FileWriter, error) {
 	}
 
 	// Pre-allocate file if size is known
-	if size > 0 {
-		if err := fw.preallocate(size); err != nil {
-			file.Close()
-			return nil, fmt.Errorf("preallocating file: %w", err)
-		}
+	if err := allocate(file, size, mode); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("preallocating file (%s): %w", mode, err)
 	}
 
 	return fw, nil
@@ -77,21 +81,6 @@ func OpenFileWriter(path string, size int64) (*FileWriter, error) {
 	}, nil
 }
 
-// preallocate sets the file size without writing zeros (sparse file)
-func (w *FileWriter) preallocate(size int64) error {
-	// Seek to size-1 and write a single byte to create sparse file
-	// This is more efficient than truncate on some filesystems
-	if _, err := w.file.Seek(size-1, io.SeekStart); err != nil {
-		return err
-	}
-	if _, err := w.file.Write([]byte{0}); err != nil {
-		return err
-	}
-	// Seek back to beginning
-	_, err := w.file.Seek(0, io.SeekStart)
-	return err
-}
-
 // Write writes data sequentially to the file.
 // This is the io.Writer interface implementation.
 func (w *FileWriter) Write(p []byte) (int, error) {
@@ -110,8 +99,9 @@ func (w *FileWriter) Write(p []byte) (int, error) {
 // WriteAt writes data at a specific offset.
 // This is used for parallel chunk downloads.
 func (w *FileWriter) WriteAt(p []byte, offset int64) (int, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	// Positioned writes do not share the file offset, so chunks can write concurrently
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
 	if w.closed {
 		return 0, fmt.Errorf("writer is closed")
@@ -151,8 +141,8 @@ func (w *FileWriter) WriteChunk(r io.Reader, offset int64, size int64) (int64, e
 
 // Sync flushes the file to disk.
 func (w *FileWriter) Sync() error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
 	if w.closed {
 		return fmt.Errorf("writer is closed")
@@ -203,6 +193,34 @@ func (w *FileWriter) Truncate(size int64) error {
 	return w.file.Truncate(size)
 }
 
+// DefaultPartSuffix is appended to a file's name while it is being downloaded.
+const DefaultPartSuffix = ".part"
+
+// PartPath returns the temporary path a download to path is written to
+// until it is complete. An empty suffix means writing to path directly.
+func PartPath(path, suffix string) string {
+	return path + suffix
+}
+
+// CommitFile atomically moves a finished file from partPath to path and
+// syncs the directory so the rename survives a crash.
+func CommitFile(partPath, path string) error {
+	if partPath == path {
+		return nil
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		return fmt.Errorf("moving %s into place: %w", partPath, err)
+	}
+
+	// Not every platform can sync a directory; the rename itself has succeeded
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
 // FileExists checks if a file exists at the given path.
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
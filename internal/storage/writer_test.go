@@ -346,6 +346,36 @@ func TestRemoveFile(t *testing.T) {
 	}
 }
 
+func TestCommitFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "final.bin")
+	partPath := PartPath(path, DefaultPartSuffix)
+
+	if partPath != path+".part" {
+		t.Errorf("PartPath() = %q, want %q", partPath, path+".part")
+	}
+
+	// An existing file under the final name is replaced
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(partPath, []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if err := CommitFile(partPath, path); err != nil {
+		t.Fatalf("CommitFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("final file = %q, %v, want %q", data, err, "new")
+	}
+	if FileExists(partPath) {
+		t.Error("part file still exists after commit")
+	}
+}
+
 // BenchmarkWriteAt benchmarks parallel write performance
 func BenchmarkWriteAt(b *testing.B) {
 	tmpDir := b.TempDir()
@@ -0,0 +1,205 @@
+package torrent
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Priority is how soon the pieces of a selected file are fetched
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// ParsePriority parses a priority name: normal or high
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q (normal, high)", s)
+	}
+}
+
+func (p Priority) piecePriority() torrent.PiecePriority {
+	if p == PriorityHigh {
+		return torrent.PiecePriorityHigh
+	}
+	return torrent.PiecePriorityNormal
+}
+
+// FileInfo describes a file of a torrent
+type FileInfo struct {
+	Index     int    // Position in the torrent, from 1
+	Path      string // Path within the torrent
+	Size      int64
+	Completed int64 // Bytes downloaded
+	Selected  bool
+	Priority  Priority
+}
+
+// Files lists the files of d in torrent order
+func (d *Download) Files() []FileInfo {
+	var infos []FileInfo
+	for i, f := range d.Torrent.Files() {
+		infos = append(infos, FileInfo{
+			Index:     i + 1,
+			Path:      f.DisplayPath(),
+			Size:      f.Length(),
+			Completed: f.BytesCompleted(),
+			Selected:  d.files == nil || d.isSelected(f),
+			Priority:  d.priorities[f],
+		})
+	}
+	return infos
+}
+
+// SelectFiles limits d to the files matching spec: comma-separated indexes
+// and ranges from 1 ("1,3-5") or glob patterns matched against the path and
+// name of each file ("*.csv"). It fails if an item matches no file.
+func (d *Download) SelectFiles(spec string) error {
+	files, err := matchFiles(d.Torrent.Files(), spec)
+	if err != nil {
+		return err
+	}
+	d.selectFiles(files)
+	return nil
+}
+
+// SetPriority sets the priority of the files matching spec, written as for
+// SelectFiles. Files that are not selected stay unwanted.
+func (d *Download) SetPriority(spec string, p Priority) error {
+	files, err := matchFiles(d.Torrent.Files(), spec)
+	if err != nil {
+		return err
+	}
+	if d.priorities == nil {
+		d.priorities = make(map[*torrent.File]Priority)
+	}
+	for _, f := range files {
+		d.priorities[f] = p
+	}
+	return nil
+}
+
+// selectFiles limits d to files, counting only them in its total size
+func (d *Download) selectFiles(files []*torrent.File) {
+	d.files = files
+	d.TotalSize = 0
+	for _, f := range files {
+		d.TotalSize += f.Length()
+	}
+}
+
+func (d *Download) isSelected(f *torrent.File) bool {
+	for _, s := range d.files {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFiles returns the files matching spec, in torrent order
+func matchFiles(files []*torrent.File, spec string) ([]*torrent.File, error) {
+	matched := make([]bool, len(files))
+	var items int
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		items++
+
+		first, last, isRange, err := parseIndexRange(item)
+		if err != nil {
+			return nil, err
+		}
+		if isRange {
+			if first < 1 || last > len(files) || first > last {
+				return nil, fmt.Errorf("file index %s out of range 1-%d", item, len(files))
+			}
+			for i := first; i <= last; i++ {
+				matched[i-1] = true
+			}
+			continue
+		}
+
+		var found bool
+		for i, f := range files {
+			byPath, err := path.Match(item, f.DisplayPath())
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", item, err)
+			}
+			byName, _ := path.Match(item, path.Base(f.DisplayPath()))
+			if byPath || byName {
+				matched[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no file matches %q", item)
+		}
+	}
+	if items == 0 {
+		return nil, fmt.Errorf("no files given")
+	}
+
+	var selected []*torrent.File
+	for i, f := range files {
+		if matched[i] {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
+}
+
+// parseIndexRange parses "3" or "3-5". isRange is false for anything else,
+// such as a pattern.
+func parseIndexRange(item string) (first, last int, isRange bool, err error) {
+	from, to, hasDash := strings.Cut(item, "-")
+	if !isDigits(from) || hasDash && !isDigits(to) {
+		return 0, 0, false, nil
+	}
+	if first, err = strconv.Atoi(from); err != nil {
+		return 0, 0, false, fmt.Errorf("bad file index %q", item)
+	}
+	last = first
+	if hasDash {
+		if last, err = strconv.Atoi(to); err != nil {
+			return 0, 0, false, fmt.Errorf("bad file index %q", item)
+		}
+	}
+	return first, last, true, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDownload_SelectFiles(t *testing.T) {
+	torrentData, _ := newTestTorrent(t, t.TempDir())
+	client := testClient(t)
+	d, err := client.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+	total := d.TotalSize
+
+	tests := []struct {
+		spec string
+		want []bool
+		size int64
+	}{
+		{"2", []bool{false, true}, 30000},
+		{"1-2", []bool{true, true}, total},
+		{"a.*", []bool{true, false}, 40000},
+		{"*.bin, 1", []bool{true, true}, total},
+	}
+	for _, tt := range tests {
+		if err := d.SelectFiles(tt.spec); err != nil {
+			t.Errorf("SelectFiles(%q) error = %v", tt.spec, err)
+			continue
+		}
+		files := d.Files()
+		for i, f := range files {
+			if f.Selected != tt.want[i] {
+				t.Errorf("SelectFiles(%q): %s selected = %v", tt.spec, f.Path, f.Selected)
+			}
+		}
+		if d.TotalSize != tt.size {
+			t.Errorf("SelectFiles(%q): TotalSize = %d, want %d", tt.spec, d.TotalSize, tt.size)
+		}
+	}
+
+	for _, bad := range []string{"", "3", "0", "2-1", "*.csv", "[", "1,missing.bin"} {
+		if err := d.SelectFiles(bad); err == nil {
+			t.Errorf("SelectFiles(%q) should fail", bad)
+		}
+	}
+
+	if err := d.SetPriority("b.bin", PriorityHigh); err != nil {
+		t.Fatalf("SetPriority() error = %v", err)
+	}
+	files := d.Files()
+	if files[0].Index != 1 || files[0].Path != "a.bin" || files[0].Size != 40000 {
+		t.Errorf("Files()[0] = %+v", files[0])
+	}
+	if files[0].Priority != PriorityNormal || files[1].Priority != PriorityHigh {
+		t.Errorf("priorities = %s, %s", files[0].Priority, files[1].Priority)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for _, p := range []Priority{PriorityNormal, PriorityHigh} {
+		got, err := ParsePriority(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParsePriority(%q) = %v, %v", p, got, err)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("ParsePriority(\"urgent\") should fail")
+	}
+}
@@ -0,0 +1,254 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const (
+	// StateVersion is the current torrent state file format version
+	StateVersion = 1
+
+	// StateFileSuffix is the suffix of torrent state files, named after
+	// the info hash, as of HTTP download state files
+	StateFileSuffix = ".burkut-state"
+
+	// stateSaveInterval is how often changed piece completion is saved
+	stateSaveInterval = 5 * time.Second
+)
+
+// State is what the state file of a torrent records to resume it
+type State struct {
+	Version   int       `json:"version"`
+	InfoHash  string    `json:"info_hash"`
+	Name      string    `json:"name,omitempty"`
+	Info      []byte    `json:"info,omitempty"` // Bencoded info dictionary, so magnets resume without fetching it
+	Completed []byte    `json:"completed"`      // Bitfield of the pieces verified complete
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// pieceComplete reports whether piece i is recorded complete
+func (s *State) pieceComplete(i int) bool {
+	return i >= 0 && i/8 < len(s.Completed) && s.Completed[i/8]&(0x80>>(i%8)) != 0
+}
+
+// setPieceComplete records whether piece i is complete
+func (s *State) setPieceComplete(i int, complete bool) {
+	for i/8 >= len(s.Completed) {
+		s.Completed = append(s.Completed, 0)
+	}
+	if complete {
+		s.Completed[i/8] |= 0x80 >> (i % 8)
+	} else {
+		s.Completed[i/8] &^= 0x80 >> (i % 8)
+	}
+}
+
+// hasCompleted reports whether any piece is recorded complete
+func (s *State) hasCompleted() bool {
+	for _, b := range s.Completed {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// torrentState is the state of a torrent and what this run learned of it
+type torrentState struct {
+	State
+	checked map[int]bool // Pieces whose completion was set this run
+	dirty   bool
+	savedAt time.Time
+	done    bool // The torrent completed and its state file was removed
+}
+
+// resumeStore is the piece completion of a client's torrents, kept in a
+// state file per info hash. Pieces recorded complete are trusted when a
+// torrent is added again; only the others are checked.
+type resumeStore struct {
+	dir    string
+	mu     sync.Mutex
+	states map[metainfo.Hash]*torrentState
+}
+
+var _ storage.PieceCompletion = (*resumeStore)(nil)
+
+func newResumeStore(dir string) *resumeStore {
+	return &resumeStore{
+		dir:    dir,
+		states: make(map[metainfo.Hash]*torrentState),
+	}
+}
+
+// StateFilePath returns the path of the state file of the torrent with the
+// given info hash in dir
+func StateFilePath(dir string, infoHash metainfo.Hash) string {
+	return filepath.Join(dir, infoHash.HexString()+StateFileSuffix)
+}
+
+// LoadState loads the state of the torrent with the given info hash from dir
+func LoadState(dir string, infoHash metainfo.Hash) (*State, error) {
+	data, err := os.ReadFile(StateFilePath(dir, infoHash))
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unmarshaling state: %w", err)
+	}
+	if state.Version > StateVersion {
+		return nil, fmt.Errorf("state file version %d is newer than supported version %d",
+			state.Version, StateVersion)
+	}
+	if state.InfoHash != infoHash.HexString() {
+		return nil, fmt.Errorf("state file is for torrent %s", state.InfoHash)
+	}
+	return &state, nil
+}
+
+// state returns the state of a torrent, loading it on first use. A missing
+// or unreadable state file starts the torrent afresh. Must be called with
+// the lock held.
+func (rs *resumeStore) state(infoHash metainfo.Hash) *torrentState {
+	if ts, ok := rs.states[infoHash]; ok {
+		return ts
+	}
+	ts := &torrentState{checked: make(map[int]bool)}
+	if state, err := LoadState(rs.dir, infoHash); err == nil {
+		ts.State = *state
+	} else {
+		ts.State = State{Version: StateVersion, InfoHash: infoHash.HexString()}
+	}
+	rs.states[infoHash] = ts
+	return ts
+}
+
+// Get returns the completion of a piece: known if it was set this run or
+// recorded complete, and unknown, so that it is checked, otherwise
+func (rs *resumeStore) Get(pk metainfo.PieceKey) (storage.Completion, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ts := rs.state(pk.InfoHash)
+	complete := ts.pieceComplete(pk.Index)
+	return storage.Completion{
+		Ok:       complete || ts.checked[pk.Index],
+		Complete: complete,
+	}, nil
+}
+
+// Set records the completion of a piece, saving the torrent's state if it
+// was not saved recently
+func (rs *resumeStore) Set(pk metainfo.PieceKey, complete bool) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ts := rs.state(pk.InfoHash)
+	ts.checked[pk.Index] = true
+	if ts.pieceComplete(pk.Index) == complete {
+		return nil
+	}
+	ts.setPieceComplete(pk.Index, complete)
+	ts.dirty = true
+	if time.Since(ts.savedAt) >= stateSaveInterval {
+		// A failed save is retried with the next change or on close
+		rs.save(ts)
+	}
+	return nil
+}
+
+// setInfo records the name and info dictionary of a torrent, saved with
+// its piece completion
+func (rs *resumeStore) setInfo(infoHash metainfo.Hash, name string, info []byte) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ts := rs.state(infoHash)
+	ts.Name = name
+	ts.Info = info
+}
+
+// info returns the info dictionary recorded for a torrent, or nil
+func (rs *resumeStore) info(infoHash metainfo.Hash) []byte {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.state(infoHash).Info
+}
+
+// finish removes the state file of a completed torrent, which is not saved
+// again
+func (rs *resumeStore) finish(infoHash metainfo.Hash) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ts := rs.state(infoHash)
+	ts.done = true
+	ts.dirty = false
+	if err := os.Remove(StateFilePath(rs.dir, infoHash)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing state file: %w", err)
+	}
+	return nil
+}
+
+// save writes the state file of a torrent once a piece of it is complete.
+// Must be called with the lock held.
+func (rs *resumeStore) save(ts *torrentState) error {
+	if ts.done || !ts.dirty {
+		return nil
+	}
+	path := StateFilePath(rs.dir, metainfo.NewHashFromHex(ts.InfoHash))
+	if !ts.hasCompleted() {
+		ts.dirty = false
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing state file: %w", err)
+		}
+		return nil
+	}
+
+	ts.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(&ts.State, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	if err := os.MkdirAll(rs.dir, 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+
+	// Write to temp file first, then rename for atomicity
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming state file: %w", err)
+	}
+
+	ts.dirty = false
+	ts.savedAt = ts.UpdatedAt
+	return nil
+}
+
+// Close saves the changed state of every torrent
+func (rs *resumeStore) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var errs []error
+	for _, ts := range rs.states {
+		if err := rs.save(ts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
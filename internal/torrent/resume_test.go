@@ -0,0 +1,184 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestResumeStore_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	hash := metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567")
+	key := func(i int) metainfo.PieceKey { return metainfo.PieceKey{InfoHash: hash, Index: i} }
+
+	rs := newResumeStore(dir)
+	if c, _ := rs.Get(key(0)); c.Ok {
+		t.Errorf("Get() of a new torrent = %+v, want unknown", c)
+	}
+
+	// Nothing is saved until a piece is complete
+	rs.setInfo(hash, "dataset", []byte("d4:name7:dataset"))
+	rs.Set(key(0), false)
+	if c, _ := rs.Get(key(0)); !c.Ok || c.Complete {
+		t.Errorf("Get() of a failed piece = %+v, want known incomplete", c)
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(StateFilePath(dir, hash)); !os.IsNotExist(err) {
+		t.Error("state file written without a complete piece")
+	}
+
+	rs.Set(key(1), true)
+	rs.Set(key(9), true)
+	rs.Set(key(9), false)
+	rs.Set(key(10), true)
+	if err := rs.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	state, err := LoadState(dir, hash)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if state.Name != "dataset" || string(state.Info) != "d4:name7:dataset" {
+		t.Errorf("state = %+v", state)
+	}
+
+	// A new run trusts the pieces recorded complete and checks the others
+	rs = newResumeStore(dir)
+	for i, want := range map[int]bool{0: false, 1: true, 9: false, 10: true} {
+		c, _ := rs.Get(key(i))
+		if c.Ok != want || c.Complete != want {
+			t.Errorf("piece %d completion = %+v, want ok and complete %v", i, c, want)
+		}
+	}
+	if string(rs.info(hash)) != "d4:name7:dataset" {
+		t.Errorf("info() = %q", rs.info(hash))
+	}
+
+	if err := rs.finish(hash); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+	rs.Set(key(2), true)
+	rs.Close()
+	if _, err := os.Stat(StateFilePath(dir, hash)); !os.IsNotExist(err) {
+		t.Error("state file of a finished torrent still exists")
+	}
+}
+
+func TestLoadState_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	hash := metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567")
+	path := StateFilePath(dir, hash)
+
+	for name, data := range map[string]string{
+		"corrupt":    "{",
+		"newer":      `{"version": 99, "info_hash": "0123456789abcdef0123456789abcdef01234567"}`,
+		"other hash": `{"version": 1, "info_hash": "ffffffffffffffffffffffffffffffffffffffff"}`,
+	} {
+		os.WriteFile(path, []byte(data), 0644)
+		if _, err := LoadState(dir, hash); err == nil {
+			t.Errorf("LoadState() accepted a %s state file", name)
+		}
+	}
+
+	// An unusable state file starts the torrent afresh
+	rs := newResumeStore(dir)
+	if c, _ := rs.Get(metainfo.PieceKey{InfoHash: hash}); c.Ok {
+		t.Errorf("Get() = %+v, want unknown", c)
+	}
+}
+
+func TestClient_Resume(t *testing.T) {
+	served := t.TempDir()
+	torrentData, _ := newTestTorrent(t, served)
+
+	cfg := DefaultConfig()
+	cfg.DownloadDir = served
+	cfg.NoDHT = true
+	cfg.EnableUPnP = false
+	cfg.Seed = true
+	seeder, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer seeder.Close()
+	seed, err := seeder.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go seeder.Download(ctx, seed, nil)
+
+	dir := t.TempDir()
+	newLeecher := func() *Client {
+		cfg := DefaultConfig()
+		cfg.DownloadDir = dir
+		cfg.NoDHT = true
+		cfg.EnableUPnP = false
+		client, err := NewClient(cfg)
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+		return client
+	}
+
+	// Download a.bin, then stop as if interrupted
+	leecher := newLeecher()
+	d, err := leecher.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+	if err := d.SelectFiles("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	d.Torrent.AddClientPeer(seeder.client)
+	if err := leecher.Download(ctx, d, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	hash := d.Torrent.InfoHash()
+	leecher.Close()
+	if _, err := LoadState(dir, hash); err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+
+	// Pieces recorded complete are not checked again, so a byte changed
+	// since goes unnoticed and a.bin is complete without any peer
+	path := filepath.Join(dir, "dataset", "a.bin")
+	data, _ := os.ReadFile(path)
+	data[0] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	leecher = newLeecher()
+	defer leecher.Close()
+	magnet := "magnet:?xt=urn:btih:" + hash.HexString()
+	d, err = leecher.AddMagnet(magnet) // Metadata from the state file
+	if err != nil {
+		t.Fatalf("AddMagnet() error = %v", err)
+	}
+	if err := d.SelectFiles("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	shortCtx, shortCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer shortCancel()
+	if err := leecher.Download(shortCtx, d, nil); err != nil {
+		t.Fatalf("resumed Download() error = %v", err)
+	}
+
+	// Completing the whole torrent removes its state file
+	d.selectFiles(nil)
+	d.Torrent.AddClientPeer(seeder.client)
+	if err := leecher.Download(ctx, d, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if _, err := os.Stat(StateFilePath(dir, hash)); !os.IsNotExist(err) {
+		t.Error("state file of a complete torrent still exists")
+	}
+}
@@ -5,20 +5,29 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	g "github.com/anacrolix/generics"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
-	"golang.org/x/time/rate"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/kilimcininkoroglu/burkut/internal/engine"
 )
 
+// chunkSize is the size of the blocks pieces are exchanged in
+const chunkSize = 16 * 1024
+
 // Client wraps anacrolix/torrent client with Burkut-specific functionality
 type Client struct {
 	client    *torrent.Client
 	config    *Config
+	storage   storage.ClientImplCloser
+	resume    *resumeStore
 	mu        sync.Mutex
 	downloads map[string]*Download
 }
@@ -26,12 +35,13 @@ type Client struct {
 // Config holds torrent client configuration
 type Config struct {
 	DownloadDir     string        // Directory for downloaded files
-	DataDir         string        // Directory for torrent data/cache
+	DataDir         string        // Directory for torrent state files ("" = DownloadDir)
 	MaxConnections  int           // Maximum connections per torrent
 	UploadLimit     int64         // Upload speed limit (bytes/s), 0 = unlimited
 	DownloadLimit   int64         // Download speed limit (bytes/s), 0 = unlimited
 	Seed            bool          // Continue seeding after download
 	SeedRatio       float64       // Stop seeding after this ratio (0 = unlimited)
+	SeedTime        time.Duration // Stop seeding after this long (0 = unlimited)
 	NoDHT           bool          // Disable DHT
 	NoPEX           bool          // Disable PEX (Peer Exchange)
 	ListenPort      int           // Port to listen on (0 = random)
@@ -50,6 +60,7 @@ func DefaultConfig() *Config {
 		DownloadLimit:  0,
 		Seed:           false,
 		SeedRatio:      0,
+		SeedTime:       0,
 		NoDHT:          false,
 		NoPEX:          false,
 		ListenPort:     0,
@@ -69,11 +80,16 @@ type Download struct {
 	Uploaded   int64
 	Progress   float64
 	Speed      int64
+	UpSpeed    int64   // Upload speed (bytes/s)
+	Ratio      float64 // Uploaded bytes per byte of the selected files
 	Peers      int
 	Seeds      int
 	Status     DownloadStatus
 	Error      error
 	StartTime  time.Time
+
+	files      []*torrent.File // Files selected for download, nil for all
+	priorities map[*torrent.File]Priority
 }
 
 // DownloadStatus represents the current state of a download
@@ -116,6 +132,8 @@ type Progress struct {
 	Uploaded   int64
 	Percent    float64
 	Speed      int64
+	UpSpeed    int64
+	Ratio      float64
 	ETA        time.Duration
 	Peers      int
 	Seeds      int
@@ -133,17 +151,33 @@ func NewClient(cfg *Config) (*Client, error) {
 	clientCfg.DataDir = cfg.DownloadDir
 	clientCfg.NoDHT = cfg.NoDHT
 	clientCfg.DisablePEX = cfg.NoPEX
-
-	if cfg.ListenPort > 0 {
-		clientCfg.ListenPort = cfg.ListenPort
+	clientCfg.ListenPort = cfg.ListenPort
+	clientCfg.NoDefaultPortForwarding = !cfg.EnableUPnP
+	clientCfg.Seed = cfg.Seed
+
+	// Files are written in place, with piece completion kept in state files
+	// so an interrupted download resumes without checking its pieces again
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = cfg.DownloadDir
 	}
-
-	// Set rate limits
-	if cfg.DownloadLimit > 0 {
-		clientCfg.DownloadRateLimiter = rate.NewLimiter(rate.Limit(cfg.DownloadLimit), int(cfg.DownloadLimit))
+	resume := newResumeStore(dataDir)
+	fileStorage := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   cfg.DownloadDir,
+		PieceCompletion: resume,
+		UsePartFiles:    g.Some(false),
+	})
+	clientCfg.DefaultStorage = fileStorage
+
+	// Set rate limits, with the same token buckets as HTTP downloads
+	if limiter := engine.NewRateLimiter(cfg.DownloadLimit); limiter != nil {
+		clientCfg.DownloadRateLimiter = limiter.Bucket()
 	}
-	if cfg.UploadLimit > 0 {
-		clientCfg.UploadRateLimiter = rate.NewLimiter(rate.Limit(cfg.UploadLimit), int(cfg.UploadLimit))
+	if limiter := engine.NewRateLimiter(cfg.UploadLimit); limiter != nil {
+		// Peers are sent whole chunks, which must fit in the bucket
+		bucket := limiter.Bucket()
+		bucket.SetBurst(max(bucket.Burst(), chunkSize))
+		clientCfg.UploadRateLimiter = bucket
 	}
 
 	// Create client
@@ -155,13 +189,22 @@ func NewClient(cfg *Config) (*Client, error) {
 	return &Client{
 		client:    client,
 		config:    cfg,
+		storage:   fileStorage,
+		resume:    resume,
 		downloads: make(map[string]*Download),
 	}, nil
 }
 
-// AddMagnet adds a torrent from a magnet link
+// AddMagnet adds a torrent from a magnet link. Its metadata comes from
+// the torrent's state file if it was downloaded before, or else from peers.
 func (c *Client) AddMagnet(magnetURI string) (*Download, error) {
-	t, err := c.client.AddMagnet(magnetURI)
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add magnet: %w", err)
+	}
+	spec.InfoBytes = c.resume.info(spec.InfoHash)
+
+	t, _, err := c.client.AddTorrentSpec(spec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add magnet: %w", err)
 	}
@@ -206,8 +249,18 @@ func (c *Client) AddTorrentReader(r io.Reader) (*Download, error) {
 	return c.createDownload(t), nil
 }
 
+// InfoHash returns the info hash of the torrent file read from r
+func InfoHash(r io.Reader) (string, error) {
+	mi, err := metainfo.Load(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to load torrent: %w", err)
+	}
+	return mi.HashInfoBytes().HexString(), nil
+}
+
 func (c *Client) createDownload(t *torrent.Torrent) *Download {
 	info := t.Info()
+	c.resume.setInfo(t.InfoHash(), t.Name(), t.Metainfo().InfoBytes)
 	d := &Download{
 		Torrent:   t,
 		Name:      t.Name(),
@@ -224,40 +277,55 @@ func (c *Client) createDownload(t *torrent.Torrent) *Download {
 	return d
 }
 
-// Download starts downloading a torrent and blocks until complete or context cancelled
+// Download starts downloading a torrent and blocks until complete or context
+// cancelled. With Config.Seed it then seeds until Config.SeedRatio or
+// Config.SeedTime is reached; cancelling while seeding is not an error.
 func (c *Client) Download(ctx context.Context, d *Download, progressCb func(Progress)) error {
 	t := d.Torrent
 
-	// Download all files
-	t.DownloadAll()
+	d.start()
 	d.Status = StatusDownloading
 
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	var lastBytes int64
+	// Pieces resumed from a state file do not count towards the speed
+	lastBytes := d.bytesCompleted()
+	var lastUploaded int64
 	lastTime := time.Now()
+	var seedStart time.Time
 
 	for {
 		select {
 		case <-ctx.Done():
+			if d.Status == StatusSeeding {
+				d.Status = StatusCompleted
+				return nil
+			}
 			return ctx.Err()
 		case <-ticker.C:
 			stats := t.Stats()
-			bytesCompleted := t.BytesCompleted()
+			bytesCompleted := d.bytesCompleted()
+			uploaded := stats.BytesWrittenData.Int64()
 
 			// Calculate speed
 			now := time.Now()
 			elapsed := now.Sub(lastTime).Seconds()
 			if elapsed > 0 {
 				d.Speed = int64(float64(bytesCompleted-lastBytes) / elapsed)
+				d.UpSpeed = int64(float64(uploaded-lastUploaded) / elapsed)
 			}
 			lastBytes = bytesCompleted
+			lastUploaded = uploaded
 			lastTime = now
 
 			// Update download info
 			d.Downloaded = bytesCompleted
+			d.Uploaded = uploaded
 			d.Progress = float64(bytesCompleted) / float64(d.TotalSize) * 100
+			if d.TotalSize > 0 {
+				d.Ratio = float64(uploaded) / float64(d.TotalSize)
+			}
 			d.Peers = stats.TotalPeers
 			d.Seeds = stats.ConnectedSeeders
 
@@ -278,6 +346,8 @@ func (c *Client) Download(ctx context.Context, d *Download, progressCb func(Prog
 					Uploaded:   d.Uploaded,
 					Percent:    d.Progress,
 					Speed:      d.Speed,
+					UpSpeed:    d.UpSpeed,
+					Ratio:      d.Ratio,
 					ETA:        eta,
 					Peers:      d.Peers,
 					Seeds:      d.Seeds,
@@ -285,8 +355,21 @@ func (c *Client) Download(ctx context.Context, d *Download, progressCb func(Prog
 				})
 			}
 
-			// Check completion
-			if bytesCompleted >= d.TotalSize {
+			// Check completion, then whether seeding is done
+			if d.Status == StatusDownloading && d.complete() {
+				// A finished torrent needs no state; one with files left
+				// out keeps it for when they are selected
+				if t.Complete().Bool() {
+					c.resume.finish(t.InfoHash())
+				}
+				if !c.config.Seed {
+					d.Status = StatusCompleted
+					return nil
+				}
+				d.Status = StatusSeeding
+				seedStart = now
+			}
+			if d.Status == StatusSeeding && c.seedDone(d, now.Sub(seedStart)) {
 				d.Status = StatusCompleted
 				return nil
 			}
@@ -294,6 +377,128 @@ func (c *Client) Download(ctx context.Context, d *Download, progressCb func(Prog
 	}
 }
 
+// seedDone reports whether d, seeding for the given time, reached the seed
+// ratio or seed time. Without either it seeds until cancelled.
+func (c *Client) seedDone(d *Download, seeding time.Duration) bool {
+	if c.config.SeedRatio > 0 && d.Ratio >= c.config.SeedRatio {
+		return true
+	}
+	return c.config.SeedTime > 0 && seeding >= c.config.SeedTime
+}
+
+// SelectFile limits d to the file at path in the torrent, e.g. "part1.csv"
+// or "dataset/part1.csv". An empty path selects the only file of a
+// single-file torrent. It returns where the file is saved.
+func (c *Client) SelectFile(d *Download, path string) (string, error) {
+	files := d.Torrent.Files()
+	for _, f := range files {
+		if path == f.DisplayPath() || path == f.Path() || path == "" && len(files) == 1 {
+			d.selectFiles([]*torrent.File{f})
+			return filepath.Join(c.config.DownloadDir, filepath.FromSlash(f.Path())), nil
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("torrent %s has %d files, not one", d.Name, len(files))
+	}
+	return "", fmt.Errorf("torrent %s has no file %s", d.Name, path)
+}
+
+// start marks the selected files, or all of them, as wanted at their
+// priorities
+func (d *Download) start() {
+	if d.files == nil && len(d.priorities) == 0 {
+		d.Torrent.DownloadAll()
+		return
+	}
+	files := d.files
+	if files == nil {
+		files = d.Torrent.Files()
+	}
+	for _, f := range files {
+		f.SetPriority(d.priorities[f].piecePriority())
+	}
+}
+
+// bytesCompleted returns the bytes of the selected files downloaded so far
+func (d *Download) bytesCompleted() int64 {
+	if d.files == nil {
+		return d.Torrent.BytesCompleted()
+	}
+	var n int64
+	for _, f := range d.files {
+		n += f.BytesCompleted()
+	}
+	return n
+}
+
+// complete reports whether every piece of the selected files is verified
+func (d *Download) complete() bool {
+	if d.files == nil {
+		return d.Torrent.Complete().Bool()
+	}
+	for _, f := range d.files {
+		for i := f.BeginPieceIndex(); i < f.EndPieceIndex(); i++ {
+			if !d.Torrent.Piece(i).State().Complete {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WaitForPeers starts d and waits up to timeout for a peer to connect,
+// reporting whether one did
+func (c *Client) WaitForPeers(ctx context.Context, d *Download, timeout time.Duration) bool {
+	d.start()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if d.Torrent.Stats().ActivePeers > 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// AddWebSeeds lets d fetch pieces over HTTP (BEP 19) as well as from peers.
+// Every piece is checked against the torrent's hashes whatever its source.
+func (c *Client) AddWebSeeds(d *Download, urls []string) {
+	d.Torrent.AddWebSeeds(urls)
+}
+
+// WebSeedURL returns the web seed serving the torrent of d given fileURL,
+// the URL of its selected file. That is fileURL itself for a single-file
+// torrent, and for others the directory holding the torrent's own, which
+// fileURL must end with. It returns "" if there is no such directory.
+func (d *Download) WebSeedURL(fileURL string) string {
+	if len(d.Torrent.Files()) == 1 {
+		return fileURL
+	}
+	if len(d.files) != 1 {
+		return ""
+	}
+
+	u, err := url.Parse(fileURL)
+	if err != nil || u.RawQuery != "" || u.Fragment != "" {
+		return ""
+	}
+	prefix, ok := strings.CutSuffix(u.Path, "/"+d.files[0].Path())
+	if !ok {
+		return ""
+	}
+	u.Path = prefix + "/"
+	u.RawPath = ""
+	return u.String()
+}
+
 // GetDownload returns a download by info hash
 func (c *Client) GetDownload(infoHash string) *Download {
 	c.mu.Lock()
@@ -334,7 +539,8 @@ func (c *Client) Remove(d *Download, deleteFiles bool) error {
 	c.mu.Unlock()
 
 	if deleteFiles {
-		// Delete downloaded files
+		// Delete downloaded files, and the state that would resume them
+		c.resume.finish(d.Torrent.InfoHash())
 		info := d.Torrent.Info()
 		if info != nil {
 			for _, file := range info.Files {
@@ -350,6 +556,9 @@ func (c *Client) Remove(d *Download, deleteFiles bool) error {
 // Close closes the torrent client
 func (c *Client) Close() error {
 	errs := c.client.Close()
+	if err := c.storage.Close(); err != nil {
+		errs = append(errs, err)
+	}
 	if len(errs) > 0 {
 		return fmt.Errorf("errors closing client: %v", errs)
 	}
@@ -1,7 +1,18 @@
 package torrent
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -100,3 +111,211 @@ func TestDownloadStatus_String(t *testing.T) {
 		})
 	}
 }
+
+// newTestTorrent writes a two-file torrent named dataset under dir and
+// returns its metainfo and the content of dataset/b.bin
+func newTestTorrent(t *testing.T, dir string) ([]byte, []byte) {
+	t.Helper()
+	root := filepath.Join(dir, "dataset")
+	os.MkdirAll(root, 0755)
+	a := make([]byte, 40000)
+	b := make([]byte, 30000)
+	rand.Read(a)
+	rand.Read(b)
+	os.WriteFile(filepath.Join(root, "a.bin"), a, 0644)
+	os.WriteFile(filepath.Join(root, "b.bin"), b, 0644)
+
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	if err := info.BuildFromFilePath(root); err != nil {
+		t.Fatal(err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), b
+}
+
+func testClient(t *testing.T) *Client {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.DownloadDir = t.TempDir()
+	cfg.NoDHT = true
+	cfg.EnableUPnP = false
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClient_WebSeedFile(t *testing.T) {
+	served := t.TempDir()
+	torrentData, want := newTestTorrent(t, served)
+	server := httptest.NewServer(http.FileServer(http.Dir(served)))
+	defer server.Close()
+
+	client := testClient(t)
+	d, err := client.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+	if hash, err := InfoHash(bytes.NewReader(torrentData)); err != nil || hash != d.InfoHash {
+		t.Errorf("InfoHash() = %q, %v, want %q", hash, err, d.InfoHash)
+	}
+
+	if _, err := client.SelectFile(d, "missing.bin"); err == nil {
+		t.Error("SelectFile() accepted a file not in the torrent")
+	}
+	path, err := client.SelectFile(d, "b.bin")
+	if err != nil {
+		t.Fatalf("SelectFile() error = %v", err)
+	}
+	if d.TotalSize != int64(len(want)) {
+		t.Errorf("TotalSize = %d, want %d", d.TotalSize, len(want))
+	}
+
+	if d.WebSeedURL(server.URL+"/elsewhere/b.bin") != "" {
+		t.Error("WebSeedURL() accepted a URL not ending in the file's path")
+	}
+	seed := d.WebSeedURL(server.URL + "/dataset/b.bin")
+	if seed != server.URL+"/" {
+		t.Fatalf("WebSeedURL() = %q, want %q", seed, server.URL+"/")
+	}
+
+	if client.WaitForPeers(context.Background(), d, 100*time.Millisecond) {
+		t.Error("WaitForPeers() found a peer without any")
+	}
+
+	client.AddWebSeeds(d, []string{seed})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.Download(ctx, d, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("content mismatch")
+	}
+}
+
+func TestClient_Seed(t *testing.T) {
+	served := t.TempDir()
+	torrentData, want := newTestTorrent(t, served)
+
+	cfg := DefaultConfig()
+	cfg.DownloadDir = served
+	cfg.NoDHT = true
+	cfg.EnableUPnP = false
+	cfg.Seed = true
+	cfg.SeedRatio = 0.5
+	cfg.UploadLimit = chunkSize
+	seeder, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer seeder.Close()
+	seed, err := seeder.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+
+	leecher := testClient(t)
+	d, err := leecher.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+	path, err := leecher.SelectFile(d, "b.bin")
+	if err != nil {
+		t.Fatalf("SelectFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	seeding := make(chan error, 1)
+	var statuses []DownloadStatus
+	go func() {
+		seeding <- seeder.Download(ctx, seed, func(p Progress) {
+			statuses = append(statuses, p.Status)
+		})
+	}()
+
+	d.Torrent.AddClientPeer(seeder.client)
+	start := time.Now()
+	if err := leecher.Download(ctx, d, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	// The pieces of b.bin are more than two chunks, sent at one a second
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("download took %v despite the upload limit", elapsed)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("content mismatch")
+	}
+
+	// The seeder stops once it has uploaded half of the torrent's size
+	if err := <-seeding; err != nil {
+		t.Fatalf("seeder Download() error = %v", err)
+	}
+	if seed.Status != StatusCompleted || seed.Ratio < 0.5 || seed.Uploaded < int64(len(want)) {
+		t.Errorf("seeder status = %s, ratio = %.2f, uploaded = %d", seed.Status, seed.Ratio, seed.Uploaded)
+	}
+	if len(statuses) == 0 || statuses[len(statuses)-1] != StatusSeeding {
+		t.Errorf("seeder progress statuses = %v, want seeding last", statuses)
+	}
+}
+
+func TestClient_SeedTime(t *testing.T) {
+	served := t.TempDir()
+	torrentData, _ := newTestTorrent(t, served)
+
+	cfg := DefaultConfig()
+	cfg.DownloadDir = served
+	cfg.NoDHT = true
+	cfg.EnableUPnP = false
+	cfg.Seed = true
+	cfg.SeedTime = time.Second
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	d, err := client.AddTorrentReader(bytes.NewReader(torrentData))
+	if err != nil {
+		t.Fatalf("AddTorrentReader() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := client.Download(ctx, d, nil); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Download() returned after %v, before the seed time", elapsed)
+	}
+	if d.Status != StatusCompleted {
+		t.Errorf("Status = %s, want completed", d.Status)
+	}
+
+	// Cancelling while seeding ends the download without an error
+	cfg.SeedTime = 0
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Download(ctx, d, nil); err != nil {
+		t.Errorf("Download() cancelled while seeding, error = %v", err)
+	}
+}
@@ -112,12 +112,22 @@ func (p *ProgressBar) Render(w io.Writer, progress engine.Progress, filename str
 	etaStr := p.formatETA(progress.RemainingETA)
 	elapsedStr := p.formatDuration(progress.ElapsedTime)
 
-	sb.WriteString(fmt.Sprintf("  Speed: %s  |  ETA: %s  |  Elapsed: %s\n",
+	sb.WriteString(fmt.Sprintf("  Speed: %s  |  ETA: %s  |  Elapsed: %s",
 		p.color(colorCyan, speedStr),
 		p.color(colorYellow, etaStr),
 		elapsedStr))
+	if progress.Protocol != "" {
+		sb.WriteString(fmt.Sprintf("  |  %s", progress.Protocol))
+	}
+	sb.WriteString("\n")
 	lines++
 
+	// Fallback notice
+	if progress.SingleStream != "" {
+		sb.WriteString(fmt.Sprintf("  %s single stream: %s\n", p.color(colorYellow, "!"), progress.SingleStream))
+		lines++
+	}
+
 	// Chunk progress (optional)
 	if p.showChunks && len(progress.ChunkStatus) > 1 {
 		sb.WriteString("\n")
@@ -332,15 +342,19 @@ type JSONProgress struct {
 	Total      int64   `json:"total"`
 	Speed      int64   `json:"speed"`
 	ETA        int     `json:"eta"`
+	Protocol   string  `json:"protocol"`
+	Downgrade  string  `json:"downgrade"` // Reason for a single-stream fallback
 }
 
 // RenderJSON outputs progress as JSON line
 func RenderJSON(w io.Writer, progress engine.Progress, filename string) {
-	fmt.Fprintf(w, `{"filename":%q,"percent":%.1f,"downloaded":%d,"total":%d,"speed":%d,"eta":%d}`+"\n",
+	fmt.Fprintf(w, `{"filename":%q,"percent":%.1f,"downloaded":%d,"total":%d,"speed":%d,"eta":%d,"protocol":%q,"downgrade":%q}`+"\n",
 		filename,
 		progress.Percent,
 		progress.Downloaded,
 		progress.TotalSize,
 		progress.Speed,
-		int(progress.RemainingETA.Seconds()))
+		int(progress.RemainingETA.Seconds()),
+		progress.Protocol,
+		progress.SingleStream)
 }
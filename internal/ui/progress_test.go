@@ -214,6 +214,8 @@ func TestRenderJSON(t *testing.T) {
 		Speed:        100 * 1024,
 		Percent:      50.0,
 		RemainingETA: 5 * time.Second,
+		Protocol:     "HTTP/3.0",
+		SingleStream: "server ignored Range",
 	}
 
 	RenderJSON(&buf, progress, "test.zip")
@@ -235,6 +237,8 @@ func TestRenderJSON(t *testing.T) {
 		`"percent":50.0`,
 		`"downloaded":524288`,
 		`"total":1048576`,
+		`"protocol":"HTTP/3.0"`,
+		`"downgrade":"server ignored Range"`,
 	}
 
 	for _, field := range expectedFields {
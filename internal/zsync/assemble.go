@@ -0,0 +1,316 @@
+package zsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxFetchSize caps the bytes fetched by a single range request, so missing
+// ranges are spread over connections
+const maxFetchSize = 16 << 20
+
+// RangeGetter fetches bytes start-end (inclusive) of a remote file
+type RangeGetter interface {
+	GetRange(ctx context.Context, rawURL string, start, end int64) (io.ReadCloser, error)
+}
+
+// Range is a byte range of the target file, both ends inclusive
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// Assembler rebuilds the target file of a control file into out, first from
+// seed files and then by fetching the blocks still missing
+type Assembler struct {
+	c     *Control
+	out   io.WriterAt
+	mask  uint32
+	index map[uint32][]int // Blocks by rolling checksum
+
+	mu   sync.Mutex
+	have []bool
+}
+
+// NewAssembler returns an assembler writing the target of c to out
+func NewAssembler(c *Control, out io.WriterAt) *Assembler {
+	a := &Assembler{
+		c:     c,
+		out:   out,
+		mask:  uint32(1<<(8*c.RsumBytes) - 1),
+		index: make(map[uint32][]int),
+		have:  make([]bool, len(c.Blocks)),
+	}
+	if c.RsumBytes == 4 {
+		a.mask = 0xffffffff
+	}
+	for i, b := range c.Blocks {
+		a.index[b.Rsum&a.mask] = append(a.index[b.Rsum&a.mask], i)
+	}
+	return a
+}
+
+// Have returns the number of bytes of the target already in place
+func (a *Assembler) Have() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var n int64
+	for i, ok := range a.have {
+		if ok {
+			n += a.blockLen(i)
+		}
+	}
+	return n
+}
+
+// Missing returns the ranges of the target that are not in place yet
+func (a *Assembler) Missing() []Range {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ranges []Range
+	bs := int64(a.c.BlockSize)
+	for i := 0; i < len(a.have); i++ {
+		if a.have[i] {
+			continue
+		}
+		start := int64(i) * bs
+		for i+1 < len(a.have) && !a.have[i+1] {
+			i++
+		}
+		ranges = append(ranges, Range{Start: start, End: int64(i)*bs + a.blockLen(i) - 1})
+	}
+	return ranges
+}
+
+// blockLen returns the length of block i in the target, which is shorter
+// than the block size for the last block
+func (a *Assembler) blockLen(i int) int64 {
+	start := int64(i) * int64(a.c.BlockSize)
+	return min(int64(a.c.BlockSize), a.c.Length-start)
+}
+
+// checksum returns the truncated strong checksum of a block
+func (a *Assembler) checksum(block []byte) []byte {
+	return strongSum(block)[:a.c.ChecksumBytes]
+}
+
+// Seed scans r for blocks of the target, wherever they are in it, and writes
+// those found into place. It returns the number of target bytes it supplied.
+func (a *Assembler) Seed(r io.Reader) (int64, error) {
+	bs := a.c.BlockSize
+	if len(a.c.Blocks) == 0 {
+		return 0, nil
+	}
+	need := bs * (a.c.SeqMatches + 1) // Window kept ahead of the scan position
+
+	// The buffer keeps room for the zero padding appended at the end of the seed
+	buf := make([]byte, max(1<<20, 4*need)+bs)
+	fill := len(buf) - bs
+	n, i := 0, 0
+	eof := false
+	valid := false
+	next := -1 // Block expected right after the last match
+	var ra, rb uint16
+	var supplied int64
+
+	for {
+		if n-i < need && !eof {
+			copy(buf, buf[i:n])
+			n -= i
+			i = 0
+
+			m, err := io.ReadFull(r, buf[n:fill])
+			n += m
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// Pad like the last block of the target
+				eof = true
+				clear(buf[n : n+bs])
+				n += bs
+			} else if err != nil {
+				return supplied, fmt.Errorf("reading seed: %w", err)
+			}
+		}
+		if n-i < bs {
+			break
+		}
+
+		if !valid {
+			ra, rb = rsum(buf[i : i+bs])
+			valid = true
+		}
+
+		if j := a.match(buf[i:n], ra, rb, next); j >= 0 {
+			supplied += a.place(j, buf[i:i+bs])
+			next = j + 1
+			i += bs
+			valid = false
+			continue
+		}
+
+		// Roll the checksum one byte forward
+		if n-i <= bs {
+			break
+		}
+		out, in := uint16(buf[i]), uint16(buf[i+bs])
+		ra += in - out
+		rb += ra - uint16(bs)*out
+		i++
+		next = -1
+	}
+	return supplied, nil
+}
+
+// match returns the block of the target at the start of window, or -1.
+// The block following a previous match is accepted on its own; other blocks
+// also need the next SeqMatches-1 blocks to match.
+func (a *Assembler) match(window []byte, ra, rb uint16, next int) int {
+	bs := a.c.BlockSize
+	key := (uint32(ra)<<16 | uint32(rb)) & a.mask
+	candidates := a.index[key]
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	sum := a.checksum(window[:bs])
+	if next >= 0 && next < len(a.c.Blocks) {
+		b := a.c.Blocks[next]
+		if b.Rsum&a.mask == key && bytes.Equal(b.Checksum, sum) {
+			return next
+		}
+	}
+
+	for _, j := range candidates {
+		if !bytes.Equal(a.c.Blocks[j].Checksum, sum) {
+			continue
+		}
+		if a.c.SeqMatches > 1 && j+1 < len(a.c.Blocks) {
+			if len(window) < 2*bs || !a.matches(j+1, window[bs:2*bs]) {
+				continue
+			}
+		}
+		return j
+	}
+	return -1
+}
+
+// matches reports whether block is the content of target block j
+func (a *Assembler) matches(j int, block []byte) bool {
+	ra, rb := rsum(block)
+	b := a.c.Blocks[j]
+	return b.Rsum&a.mask == (uint32(ra)<<16|uint32(rb))&a.mask && bytes.Equal(b.Checksum, a.checksum(block))
+}
+
+// place writes block into every missing target block with the same content
+// as block j and returns the bytes written
+func (a *Assembler) place(j int, block []byte) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	want := a.c.Blocks[j]
+	var written int64
+	for _, k := range a.index[want.Rsum&a.mask] {
+		if a.have[k] || !bytes.Equal(a.c.Blocks[k].Checksum, want.Checksum) {
+			continue
+		}
+		length := a.blockLen(k)
+		if _, err := a.out.WriteAt(block[:length], int64(k)*int64(a.c.BlockSize)); err != nil {
+			continue
+		}
+		a.have[k] = true
+		written += length
+	}
+	return written
+}
+
+// Fetch downloads the missing ranges of the target from rawURL over up to
+// connections parallel requests. Each fetched block is checked against the
+// control file; progress is called with the bytes of every block written.
+func (a *Assembler) Fetch(ctx context.Context, getter RangeGetter, rawURL string, connections int, progress func(n int64)) error {
+	// Missing ranges start on a block boundary; splitting them in whole
+	// blocks keeps every piece starting on one
+	bs := int64(a.c.BlockSize)
+	step := max(bs, maxFetchSize/bs*bs)
+	var pieces []Range
+	for _, r := range a.Missing() {
+		for start := r.Start; start <= r.End; start += step {
+			pieces = append(pieces, Range{Start: start, End: min(start+step-1, r.End)})
+		}
+	}
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan Range)
+	errs := make(chan error, len(pieces))
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(connections, len(pieces))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				if err := a.fetchRange(ctx, getter, rawURL, r, progress); err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for _, r := range pieces {
+		select {
+		case work <- r:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// fetchRange downloads one range of whole blocks and writes it into place
+func (a *Assembler) fetchRange(ctx context.Context, getter RangeGetter, rawURL string, r Range, progress func(n int64)) error {
+	body, err := getter.GetRange(ctx, rawURL, r.Start, r.End)
+	if err != nil {
+		return fmt.Errorf("fetching bytes %d-%d: %w", r.Start, r.End, err)
+	}
+	defer body.Close()
+
+	bs := a.c.BlockSize
+	block := make([]byte, bs)
+	for off := r.Start; off <= r.End; off += int64(bs) {
+		i := int(off / int64(bs))
+		length := a.blockLen(i)
+		if _, err := io.ReadFull(body, block[:length]); err != nil {
+			return fmt.Errorf("fetching bytes %d-%d: %w", r.Start, r.End, err)
+		}
+
+		clear(block[length:])
+		if !bytes.Equal(a.checksum(block), a.c.Blocks[i].Checksum) {
+			return fmt.Errorf("block %d from %s does not match the zsync file", i, rawURL)
+		}
+		if _, err := a.out.WriteAt(block[:length], off); err != nil {
+			return fmt.Errorf("writing block %d: %w", i, err)
+		}
+
+		a.mu.Lock()
+		a.have[i] = true
+		a.mu.Unlock()
+		if progress != nil {
+			progress(length)
+		}
+	}
+	return nil
+}
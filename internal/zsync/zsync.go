@@ -0,0 +1,286 @@
+// Package zsync reads and writes zsync control files and rebuilds the file
+// they describe from blocks of older local copies, fetching only the ranges
+// that are missing.
+//
+// A control file starts with "Key: value" header lines and an empty line,
+// followed by one entry per block of the target file: the last RsumBytes bytes
+// of the block's rolling checksum and the first ChecksumBytes bytes of its MD4.
+package zsync
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/md4"
+)
+
+// DefaultBlockSize is the block size Generate uses when none is given
+const DefaultBlockSize = 4096
+
+// timeFormat is the format of the MTime header
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// ErrCompressed is returned for control files that only describe a
+// compressed copy of the target (Z-URL), which is not supported
+var ErrCompressed = errors.New("zsync: control files for compressed targets are not supported")
+
+// Block is the entry of one block of the target file
+type Block struct {
+	Rsum     uint32 // Rolling checksum, masked to RsumBytes
+	Checksum []byte // MD4, truncated to ChecksumBytes
+}
+
+// Control is a parsed zsync control file
+type Control struct {
+	Version       string
+	Filename      string
+	MTime         time.Time
+	BlockSize     int
+	Length        int64
+	SeqMatches    int // Consecutive blocks that must match before a block is used
+	RsumBytes     int
+	ChecksumBytes int
+	URLs          []string // Target locations, relative to the control file
+	SHA1          string   // Of the whole target file
+	Blocks        []Block
+}
+
+// IsZsync reports whether name looks like a zsync control file
+func IsZsync(name string) bool {
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" {
+		name = u.Path
+	}
+	return strings.HasSuffix(strings.ToLower(name), ".zsync")
+}
+
+// ParseFile parses the control file at path
+func ParseFile(path string) (*Control, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening zsync file: %w", err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse parses a control file
+func Parse(r io.Reader) (*Control, error) {
+	br := bufio.NewReader(r)
+	c := &Control{SeqMatches: 1, RsumBytes: 4, ChecksumBytes: 16}
+	compressed := false
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading zsync header: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid zsync header line: %q", line)
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "zsync":
+			c.Version = value
+		case "Filename":
+			c.Filename = value
+		case "MTime":
+			c.MTime, _ = time.Parse(timeFormat, value)
+		case "Blocksize":
+			c.BlockSize, err = strconv.Atoi(value)
+		case "Length":
+			c.Length, err = strconv.ParseInt(value, 10, 64)
+		case "Hash-Lengths":
+			_, err = fmt.Sscanf(value, "%d,%d,%d", &c.SeqMatches, &c.RsumBytes, &c.ChecksumBytes)
+		case "URL":
+			c.URLs = append(c.URLs, value)
+		case "Z-URL":
+			compressed = true
+		case "SHA-1":
+			c.SHA1 = strings.ToLower(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid zsync header %s: %w", key, err)
+		}
+	}
+
+	if c.Version == "" {
+		return nil, errors.New("not a zsync control file")
+	}
+	if len(c.URLs) == 0 && compressed {
+		return nil, ErrCompressed
+	}
+	if c.BlockSize <= 0 || c.Length < 0 {
+		return nil, fmt.Errorf("invalid zsync block size %d or length %d", c.BlockSize, c.Length)
+	}
+	if c.SeqMatches < 1 || c.SeqMatches > 2 || c.RsumBytes < 1 || c.RsumBytes > 4 ||
+		c.ChecksumBytes < 3 || c.ChecksumBytes > md4.Size {
+		return nil, fmt.Errorf("invalid zsync hash lengths %d,%d,%d", c.SeqMatches, c.RsumBytes, c.ChecksumBytes)
+	}
+
+	count := c.BlockCount()
+	entry := make([]byte, c.RsumBytes+c.ChecksumBytes)
+	c.Blocks = make([]Block, count)
+	for i := range c.Blocks {
+		if _, err := io.ReadFull(br, entry); err != nil {
+			return nil, fmt.Errorf("reading zsync block %d of %d: %w", i, count, err)
+		}
+
+		var rsum [4]byte
+		copy(rsum[4-c.RsumBytes:], entry[:c.RsumBytes])
+		c.Blocks[i] = Block{
+			Rsum:     binary.BigEndian.Uint32(rsum[:]),
+			Checksum: append([]byte(nil), entry[c.RsumBytes:]...),
+		}
+	}
+	return c, nil
+}
+
+// BlockCount returns the number of blocks of the target file
+func (c *Control) BlockCount() int {
+	return int((c.Length + int64(c.BlockSize) - 1) / int64(c.BlockSize))
+}
+
+// TargetURL returns the location of the target file. Relative URLs are
+// resolved against base, the location of the control file.
+func (c *Control) TargetURL(base string) (string, error) {
+	if len(c.URLs) == 0 {
+		return "", errors.New("zsync file has no URL for the target")
+	}
+
+	target, err := url.Parse(c.URLs[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid zsync target URL: %w", err)
+	}
+	if target.IsAbs() {
+		return target.String(), nil
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		return "", fmt.Errorf("zsync target URL %q is relative and the control file is not remote", c.URLs[0])
+	}
+	return baseURL.ResolveReference(target).String(), nil
+}
+
+// WriteTo writes the control file to w
+func (c *Control) WriteTo(w io.Writer) (int64, error) {
+	bw := new(bytes.Buffer)
+	version := c.Version
+	if version == "" {
+		version = "0.6.2"
+	}
+
+	fmt.Fprintf(bw, "zsync: %s\n", version)
+	if c.Filename != "" {
+		fmt.Fprintf(bw, "Filename: %s\n", c.Filename)
+	}
+	if !c.MTime.IsZero() {
+		fmt.Fprintf(bw, "MTime: %s\n", c.MTime.Format(timeFormat))
+	}
+	fmt.Fprintf(bw, "Blocksize: %d\n", c.BlockSize)
+	fmt.Fprintf(bw, "Length: %d\n", c.Length)
+	fmt.Fprintf(bw, "Hash-Lengths: %d,%d,%d\n", c.SeqMatches, c.RsumBytes, c.ChecksumBytes)
+	for _, u := range c.URLs {
+		fmt.Fprintf(bw, "URL: %s\n", u)
+	}
+	if c.SHA1 != "" {
+		fmt.Fprintf(bw, "SHA-1: %s\n", c.SHA1)
+	}
+	bw.WriteString("\n")
+
+	var rsum [4]byte
+	for _, b := range c.Blocks {
+		binary.BigEndian.PutUint32(rsum[:], b.Rsum)
+		bw.Write(rsum[4-c.RsumBytes:])
+		bw.Write(b.Checksum[:c.ChecksumBytes])
+	}
+
+	n, err := w.Write(bw.Bytes())
+	return int64(n), err
+}
+
+// Generate builds the control file of the file at path, with full-length
+// checksums. blockSize <= 0 selects DefaultBlockSize.
+func Generate(path string, blockSize int) (*Control, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("getting file info: %w", err)
+	}
+
+	c := &Control{
+		Version:       "0.6.2",
+		Filename:      filepath.Base(path),
+		MTime:         info.ModTime(),
+		BlockSize:     blockSize,
+		Length:        info.Size(),
+		SeqMatches:    1,
+		RsumBytes:     4,
+		ChecksumBytes: md4.Size,
+	}
+
+	whole := sha1.New()
+	r := io.TeeReader(f, whole)
+	block := make([]byte, blockSize)
+	for remaining := c.Length; remaining > 0; remaining -= int64(blockSize) {
+		n := blockSize
+		if remaining < int64(n) {
+			n = int(remaining)
+			clear(block[n:]) // The last block is zero-padded
+		}
+		if _, err := io.ReadFull(r, block[:n]); err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		a, b := rsum(block)
+		c.Blocks = append(c.Blocks, Block{Rsum: uint32(a)<<16 | uint32(b), Checksum: strongSum(block)})
+	}
+
+	c.SHA1 = hex.EncodeToString(whole.Sum(nil))
+	return c, nil
+}
+
+// rsum computes the rolling checksum of a block
+func rsum(block []byte) (a, b uint16) {
+	l := uint16(len(block))
+	for _, c := range block {
+		a += uint16(c)
+		b += l * uint16(c)
+		l--
+	}
+	return a, b
+}
+
+// strongSum returns the MD4 of a block
+func strongSum(block []byte) []byte {
+	h := md4.New()
+	h.Write(block)
+	return h.Sum(nil)
+}
@@ -0,0 +1,273 @@
+package zsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kilimcininkoroglu/burkut/internal/protocol"
+)
+
+// randomData returns n deterministic pseudo-random bytes
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// controlFor generates the control file of data with the given hash lengths,
+// passed through WriteTo and Parse like a published .zsync file
+func controlFor(t *testing.T, data []byte, blockSize, seqMatches, rsumBytes, checksumBytes int) *Control {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "target.iso")
+	os.WriteFile(path, data, 0644)
+	c, err := Generate(path, blockSize)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	c.SeqMatches, c.RsumBytes, c.ChecksumBytes = seqMatches, rsumBytes, checksumBytes
+	c.URLs = []string{"target.iso"}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return parsed
+}
+
+// newRangeServer serves data with range support and counts the bytes sent
+func newRangeServer(t *testing.T, data []byte) (*httptest.Server, *int64) {
+	t.Helper()
+
+	var sent int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{ResponseWriter: w, n: &sent}
+		http.ServeContent(cw, r, "target.iso", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+	return server, &sent
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+// assemble rebuilds target from seed through c and returns the result, the
+// bytes the seed supplied and the bytes fetched from the server
+func assemble(t *testing.T, c *Control, seed, target []byte) ([]byte, int64, int64) {
+	t.Helper()
+
+	server, sent := newRangeServer(t, target)
+	client := protocol.NewHTTPClient()
+	defer client.Close()
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "out.iso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	out.Truncate(c.Length)
+
+	a := NewAssembler(c, out)
+	supplied, err := a.Seed(bytes.NewReader(seed))
+	if err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	if err := a.Fetch(context.Background(), client, server.URL+"/target.iso", 4, nil); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(a.Missing()) != 0 || a.Have() != c.Length {
+		t.Errorf("Missing() = %v, Have() = %d after Fetch()", a.Missing(), a.Have())
+	}
+
+	result, _ := os.ReadFile(out.Name())
+	return result, supplied, atomic.LoadInt64(sent)
+}
+
+func TestControl_RoundTrip(t *testing.T) {
+	data := randomData(1, 10000)
+	c := controlFor(t, data, 1024, 2, 3, 8)
+
+	if c.Length != 10000 || c.BlockSize != 1024 || len(c.Blocks) != 10 {
+		t.Errorf("Length = %d, BlockSize = %d, blocks = %d", c.Length, c.BlockSize, len(c.Blocks))
+	}
+	if c.SeqMatches != 2 || c.RsumBytes != 3 || c.ChecksumBytes != 8 || len(c.Blocks[0].Checksum) != 8 {
+		t.Errorf("Hash-Lengths = %d,%d,%d", c.SeqMatches, c.RsumBytes, c.ChecksumBytes)
+	}
+	if sum := sha1.Sum(data); c.SHA1 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA1 = %s", c.SHA1)
+	}
+	if c.Filename != "target.iso" || c.MTime.IsZero() {
+		t.Errorf("Filename = %q, MTime = %v", c.Filename, c.MTime)
+	}
+}
+
+func TestAssembler_ReusesShiftedBlocks(t *testing.T) {
+	old := randomData(2, 256*1024)
+
+	// The new version inserts bytes near the start and changes a block later on
+	target := append([]byte("inserted header "), old...)
+	copy(target[100*1024:], randomData(3, 2048))
+
+	tests := []struct {
+		name                                 string
+		seqMatches, rsumBytes, checksumBytes int
+	}{
+		{"full hashes", 1, 4, 16},
+		{"zsyncmake defaults", 2, 2, 5},
+		{"short rsum", 2, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := controlFor(t, target, 2048, tt.seqMatches, tt.rsumBytes, tt.checksumBytes)
+
+			result, supplied, sent := assemble(t, c, old, target)
+			if !bytes.Equal(result, target) {
+				t.Fatal("assembled file differs from the target")
+			}
+			if supplied < int64(len(target))*9/10 {
+				t.Errorf("seed supplied %d of %d bytes", supplied, len(target))
+			}
+			if sent > int64(len(target))/10 {
+				t.Errorf("server sent %d of %d bytes", sent, len(target))
+			}
+		})
+	}
+}
+
+func TestAssembler_NoSeed(t *testing.T) {
+	target := randomData(4, 50000) // Not a multiple of the block size
+	c := controlFor(t, target, 4096, 1, 4, 16)
+
+	result, supplied, _ := assemble(t, c, nil, target)
+	if !bytes.Equal(result, target) {
+		t.Fatal("assembled file differs from the target")
+	}
+	if supplied != 0 {
+		t.Errorf("empty seed supplied %d bytes", supplied)
+	}
+}
+
+func TestAssembler_FetchSplitsOnBlocks(t *testing.T) {
+	// Missing ranges longer than maxFetchSize are split; with a block size
+	// that does not divide it, every piece must still start on a block
+	target := randomData(7, 2*maxFetchSize+12345)
+	c := controlFor(t, target, 3000, 1, 4, 16)
+
+	result, _, sent := assemble(t, c, nil, target)
+	if !bytes.Equal(result, target) {
+		t.Fatal("assembled file differs from the target")
+	}
+	if sent != int64(len(target)) {
+		t.Errorf("server sent %d of %d bytes", sent, len(target))
+	}
+}
+
+func TestAssembler_RepeatedBlocks(t *testing.T) {
+	// Identical blocks of the target are all filled from one seed block
+	target := make([]byte, 8*1024)
+	c := controlFor(t, target, 1024, 1, 4, 16)
+
+	out, _ := os.Create(filepath.Join(t.TempDir(), "out"))
+	defer out.Close()
+	a := NewAssembler(c, out)
+	supplied, err := a.Seed(bytes.NewReader(make([]byte, 1024)))
+	if err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	if supplied != int64(len(target)) || len(a.Missing()) != 0 {
+		t.Errorf("supplied %d bytes, missing %v", supplied, a.Missing())
+	}
+}
+
+func TestAssembler_FetchMismatch(t *testing.T) {
+	target := randomData(5, 8192)
+	c := controlFor(t, target, 1024, 1, 4, 16)
+
+	server, _ := newRangeServer(t, randomData(6, 8192))
+	client := protocol.NewHTTPClient()
+	defer client.Close()
+
+	out, _ := os.Create(filepath.Join(t.TempDir(), "out"))
+	defer out.Close()
+	err := NewAssembler(c, out).Fetch(context.Background(), client, server.URL, 2, nil)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Fetch() error = %v, want a block mismatch", err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not zsync", "<html>\n\n"},
+		{"bad hash lengths", "zsync: 0.6.2\nBlocksize: 2048\nLength: 10\nHash-Lengths: 3,2,5\nURL: x\n\n"},
+		{"truncated blocks", "zsync: 0.6.2\nBlocksize: 2048\nLength: 4096\nHash-Lengths: 1,4,16\nURL: x\n\nshort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); err == nil {
+				t.Error("Parse() should fail")
+			}
+		})
+	}
+
+	compressed := "zsync: 0.6.2\nBlocksize: 2048\nLength: 0\nZ-URL: x.gz\n\n"
+	if _, err := Parse(strings.NewReader(compressed)); !errors.Is(err, ErrCompressed) {
+		t.Errorf("Parse() error = %v, want ErrCompressed", err)
+	}
+}
+
+func TestControl_TargetURL(t *testing.T) {
+	c := &Control{URLs: []string{"new.iso"}}
+	got, err := c.TargetURL("https://example.com/images/new.iso.zsync")
+	if err != nil || got != "https://example.com/images/new.iso" {
+		t.Errorf("TargetURL() = %q, %v", got, err)
+	}
+	if _, err := c.TargetURL("new.iso.zsync"); err == nil {
+		t.Error("relative URL of a local control file should fail")
+	}
+
+	c.URLs = []string{"https://mirror.example.com/new.iso"}
+	if got, _ := c.TargetURL("new.iso.zsync"); got != c.URLs[0] {
+		t.Errorf("TargetURL() = %q", got)
+	}
+}
+
+func TestIsZsync(t *testing.T) {
+	for name, want := range map[string]bool{
+		"new.iso.zsync":                         true,
+		"https://example.com/new.iso.ZSYNC?x=1": true,
+		"new.iso":                               false,
+		"https://example.com/zsync/new.iso":     false,
+	} {
+		if got := IsZsync(name); got != want {
+			t.Errorf("IsZsync(%q) = %v, want %v", name, got, want)
+		}
+	}
+}